@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -27,7 +28,7 @@ type BenchmarkResult struct {
 func main() {
 	fmt.Println("========================================")
 	fmt.Println("  Navigation Service - Performance Benchmark")
-	fmt.Println("========================================\n")
+	fmt.Print("========================================\n\n")
 
 	// Load or parse graph
 	g := loadGraph()
@@ -86,7 +87,7 @@ func runAllBenchmarks(g *graph.Graph) {
 		{"Medium Distance - Foot", 43.73, 7.42, 43.74, 7.43, "foot"},
 	}
 
-	fmt.Println("Running benchmarks...\n")
+	fmt.Print("Running benchmarks...\n\n")
 	fmt.Println("Test Case                        | Iterations | Avg Time | Min Time | Max Time | Success")
 	fmt.Println("--------------------------------|------------|----------|----------|----------|--------")
 
@@ -96,7 +97,7 @@ func runAllBenchmarks(g *graph.Graph) {
 	}
 
 	// Benchmark multiple routes
-	fmt.Println("\nAlternative Routes Benchmarks:\n")
+	fmt.Print("\nAlternative Routes Benchmarks:\n\n")
 	fmt.Println("Test Case                        | Iterations | Avg Time | Success")
 	fmt.Println("--------------------------------|------------|----------|--------")
 
@@ -110,7 +111,7 @@ func runAllBenchmarks(g *graph.Graph) {
 	}
 
 	// Benchmark bidirectional vs unidirectional
-	fmt.Println("\nBidirectional vs Unidirectional A*:\n")
+	fmt.Print("\nBidirectional vs Unidirectional A*:\n\n")
 	fmt.Println("Algorithm                        | Iterations | Avg Time | Speedup")
 	fmt.Println("--------------------------------|------------|----------|--------")
 
@@ -147,7 +148,7 @@ func benchmarkRoute(g *graph.Graph, name string, fromLat, fromLon, toLat, toLon
 
 	for i := 0; i < iterations; i++ {
 		start := time.Now()
-		_, err := router.FindRouteWithProfile(fromLat, fromLon, toLat, toLon, profile)
+		_, err := router.FindRouteWithProfile(context.Background(), fromLat, fromLon, toLat, toLon, profile)
 		elapsed := time.Since(start)
 
 		totalTime += elapsed
@@ -186,7 +187,7 @@ func benchmarkBidirectional(g *graph.Graph, name string, fromLat, fromLon, toLat
 
 	for i := 0; i < iterations; i++ {
 		start := time.Now()
-		_, err := router.FindRouteBidirectional(fromLat, fromLon, toLat, toLon)
+		_, err := router.FindRouteBidirectional(context.Background(), fromLat, fromLon, toLat, toLon)
 		elapsed := time.Since(start)
 
 		totalTime += elapsed
@@ -223,7 +224,7 @@ func benchmarkMultipleRoutes(g *graph.Graph, name string, fromLat, fromLon, toLa
 
 	for i := 0; i < iterations; i++ {
 		start := time.Now()
-		_, err := router.FindMultipleRoutes(fromLat, fromLon, toLat, toLon, numRoutes)
+		_, err := router.FindMultipleRoutes(context.Background(), fromLat, fromLon, toLat, toLon, numRoutes)
 		elapsed := time.Since(start)
 
 		totalTime += elapsed
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/vamosdalian/nav/internal/elevation"
+	"github.com/vamosdalian/nav/internal/storage"
+)
+
+// Post-processing tool that adds node elevations to an existing graph file
+func main() {
+	graphPath := flag.String("graph", "graph.bin.snappy", "Graph file to read")
+	demDir := flag.String("dem", "", "Directory with SRTM .hgt or GeoTIFF elevation tiles")
+	outPath := flag.String("out", "", "Output graph file (default: overwrite input)")
+	flag.Parse()
+
+	if *demDir == "" {
+		log.Fatal("-dem is required")
+	}
+	if *outPath == "" {
+		*outPath = *graphPath
+	}
+
+	log.Printf("Loading graph from %s...", *graphPath)
+	in := storage.NewStorage(*graphPath)
+	g, err := in.Load()
+	if err != nil {
+		log.Fatalf("Failed to load graph: %v", err)
+	}
+
+	dem, err := elevation.Open(*demDir)
+	if err != nil {
+		log.Fatalf("Failed to open elevation data: %v", err)
+	}
+	log.Printf("Indexed %d elevation tiles", dem.TileCount())
+
+	assigned := elevation.Assign(g, dem)
+	log.Printf("Elevation assigned to %d/%d nodes", assigned, g.NodeCount())
+
+	log.Printf("Saving graph to %s...", *outPath)
+	out := storage.NewStorage(*outPath)
+	out.SetLayout(in.Layout())
+	out.SetMetadata(in.Metadata())
+	if err := out.Save(g); err != nil {
+		log.Fatalf("Failed to save graph: %v", err)
+	}
+	log.Println("Done")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/vamosdalian/nav/internal/storage"
+)
+
+// Tool that converts version 1 graph files to the current format, converts
+// between the compressed and mapped layouts, and prints the header and
+// section table of a graph file
+func main() {
+	graphPath := flag.String("graph", "graph.bin.snappy", "Graph file to migrate")
+	source := flag.String("source", "", "PBF file the graph was built from, recorded in the header")
+	infoOnly := flag.Bool("info", false, "Only print the file header and verify checksums")
+	layoutName := flag.String("layout", "", "Convert to a layout: compressed or mapped (memory-mappable)")
+	flag.Parse()
+
+	if !*infoOnly {
+		migrated, err := storage.Migrate(*graphPath, storage.Metadata{Source: *source})
+		if err != nil {
+			log.Fatalf("Failed to migrate graph: %v", err)
+		}
+		if migrated {
+			log.Printf("Migrated %s to format version 2 (original kept as %s.v1)", *graphPath, *graphPath)
+		} else {
+			log.Printf("%s already uses the current format", *graphPath)
+		}
+	}
+
+	if *layoutName != "" && !*infoOnly {
+		layout, err := storage.ParseLayout(*layoutName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		store := storage.NewStorage(*graphPath)
+		g, err := store.Load()
+		if err != nil {
+			log.Fatalf("Failed to load graph: %v", err)
+		}
+		if store.Layout() == layout {
+			log.Printf("%s already uses the %s layout", *graphPath, layout)
+		} else {
+			store.SetLayout(layout)
+			if err := store.Save(g); err != nil {
+				log.Fatalf("Failed to save graph: %v", err)
+			}
+			log.Printf("Converted %s to the %s layout", *graphPath, layout)
+		}
+	}
+
+	info, err := storage.Info(*graphPath)
+	if err != nil {
+		log.Fatalf("Failed to read graph file: %v", err)
+	}
+	if info.Version > 1 {
+		if err := storage.Verify(*graphPath); err != nil {
+			log.Fatalf("Graph file is corrupt: %v", err)
+		}
+		log.Println("All section checksums match")
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(info); err != nil {
+		log.Fatalf("Failed to print file info: %v", err)
+	}
+}
@@ -1,18 +1,32 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/vamosdalian/nav/internal/api"
+	"github.com/vamosdalian/nav/internal/closures"
 	"github.com/vamosdalian/nav/internal/config"
+	"github.com/vamosdalian/nav/internal/datex"
+	"github.com/vamosdalian/nav/internal/elevation"
+	"github.com/vamosdalian/nav/internal/ev"
 	"github.com/vamosdalian/nav/internal/graph"
+	"github.com/vamosdalian/nav/internal/journal"
+	"github.com/vamosdalian/nav/internal/openlr"
 	"github.com/vamosdalian/nav/internal/osm"
 	"github.com/vamosdalian/nav/internal/routing"
+	"github.com/vamosdalian/nav/internal/speeds"
 	"github.com/vamosdalian/nav/internal/storage"
+	"github.com/vamosdalian/nav/internal/traffic"
 )
 
 func main() {
@@ -31,8 +45,22 @@ func main() {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
 
+	// Initialize profile manager
+	log.Println("Loading routing profiles...")
+	profileManager := routing.NewProfileManager(cfg.ProfilesDir)
+	if err := profileManager.LoadProfiles(); err != nil {
+		log.Fatalf("Failed to load profiles: %v", err)
+	}
+
+	graphLayout, err := storage.ParseLayout(cfg.GraphLayout)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	// Initialize graph
 	var g *graph.Graph
+	var graphSource string
+	loadStart := time.Now()
 
 	// Try to load existing graph data first
 	if cfg.GraphDataPath != "" {
@@ -40,10 +68,21 @@ func main() {
 			log.Printf("Loading graph from %s...", cfg.GraphDataPath)
 			store := storage.NewStorage(cfg.GraphDataPath)
 			g, err = store.Load()
+			if err == nil {
+				if err = g.Validate(); err != nil {
+					g = nil
+					err = fmt.Errorf("invalid graph: %w", err)
+				}
+			}
 			if err != nil {
 				log.Printf("Failed to load graph: %v, will parse OSM data", err)
 			} else {
-				log.Printf("Graph loaded: %d nodes, %d edges", g.NodeCount(), g.EdgeCount())
+				log.Printf("Graph loaded: %d nodes, %d edges (%s layout)", g.NodeCount(), g.EdgeCount(), store.Layout())
+				graphSource = cfg.GraphDataPath
+				graphLayout = store.Layout()
+				if store.FormatVersion() < 2 {
+					log.Printf("Graph file uses format version %d; convert it with cmd/migrate", store.FormatVersion())
+				}
 			}
 		}
 	}
@@ -51,6 +90,8 @@ func main() {
 	// If graph not loaded and OSM data available, parse it
 	if g == nil && cfg.OSMDataPath != "" {
 		log.Printf("Parsing OSM data from %s...", cfg.OSMDataPath)
+		loadStart = time.Now()
+		graphSource = cfg.OSMDataPath
 		g = graph.NewGraph()
 		parser := osm.NewParser(g)
 
@@ -60,10 +101,33 @@ func main() {
 
 		log.Printf("Graph built: %d nodes, %d edges", g.NodeCount(), g.EdgeCount())
 
+		// Assign node elevations from DEM tiles if configured
+		if cfg.ElevationDataPath != "" {
+			log.Printf("Assigning elevations from %s...", cfg.ElevationDataPath)
+			dem, err := elevation.Open(cfg.ElevationDataPath)
+			if err != nil {
+				log.Printf("Warning: Failed to open elevation data: %v", err)
+			} else {
+				assigned := elevation.Assign(g, dem)
+				log.Printf("Elevation assigned to %d/%d nodes", assigned, g.NodeCount())
+			}
+		}
+
+		// Serve the graph from flat CSR arrays instead of adjacency maps
+		if err := g.Compact(); err != nil {
+			log.Printf("Warning: Failed to compact graph: %v", err)
+		}
+
 		// Save parsed graph for future use
 		if cfg.GraphDataPath != "" {
 			log.Printf("Saving graph to %s...", cfg.GraphDataPath)
 			store := storage.NewStorage(cfg.GraphDataPath)
+			store.SetLayout(graphLayout)
+			store.SetMetadata(storage.Metadata{
+				Source:        filepath.Base(cfg.OSMDataPath),
+				ParserVersion: storage.ParserVersion,
+				Profiles:      profileManager.ListProfiles(),
+			})
 			if err := store.Save(g); err != nil {
 				log.Printf("Warning: Failed to save graph: %v", err)
 			} else {
@@ -81,24 +145,159 @@ func main() {
 	if g == nil {
 		log.Fatal("No graph data available. Set OSM_DATA_PATH or GRAPH_DATA_PATH")
 	}
+	graphLoadTime := time.Since(loadStart)
 
 	if *parseOnly {
 		log.Println("Parse-only mode: graph already loaded, exiting without starting server")
 		return
 	}
 
-	// Initialize profile manager
-	log.Println("Loading routing profiles...")
-	profileManager := routing.NewProfileManager("./profiles")
-	if err := profileManager.LoadProfiles(); err != nil {
-		log.Fatalf("Failed to load profiles: %v", err)
+	// Replay runtime weight changes journaled by earlier runs
+	changeJournal, err := journal.Open(cfg.JournalPath, g)
+	if err != nil {
+		log.Fatalf("Failed to open change journal: %v", err)
+	}
+	defer changeJournal.Close()
+	if count := changeJournal.Len(); count > 0 {
+		log.Printf("Replayed %d journaled changes from %s", count, cfg.JournalPath)
+	}
+	if skipped := changeJournal.Skipped(); skipped > 0 {
+		log.Printf("Warning: Skipped %d journaled edge changes that no longer match the graph", skipped)
 	}
 
 	// Initialize router
 	router := routing.NewRouter(g)
+	router.SetMaxSearches(cfg.SearchConcurrency)
+
+	// Load historical speed profiles built by cmd/speedprofiles
+	speedProfilesPath := cfg.SpeedProfilesPath
+	if speedProfilesPath == "" && cfg.GraphDataPath != "" {
+		speedProfilesPath = speeds.SidecarPath(cfg.GraphDataPath)
+	}
+	if speedProfilesPath != "" {
+		if _, err := os.Stat(speedProfilesPath); err == nil {
+			profiles, err := speeds.Load(speedProfilesPath)
+			if err != nil {
+				log.Printf("Warning: Failed to load speed profiles: %v", err)
+			} else {
+				router.SetHistoricalSpeeds(profiles)
+				log.Printf("Loaded speed profiles for %d road directions from %s (%s)",
+					profiles.Len(), speedProfilesPath, profiles.Location())
+			}
+		} else if graphSource == cfg.GraphDataPath {
+			// Profiles embedded in the graph file with cmd/speedprofiles -embed
+			var profiles *speeds.Profiles
+			found, err := storage.NewStorage(cfg.GraphDataPath).ReadSection(storage.SectionSpeeds, func(r io.Reader) error {
+				var err error
+				profiles, err = speeds.Decode(r)
+				return err
+			})
+			if err != nil {
+				log.Printf("Warning: Failed to load embedded speed profiles: %v", err)
+			} else if found {
+				router.SetHistoricalSpeeds(profiles)
+				log.Printf("Loaded speed profiles for %d road directions from %s (%s)",
+					profiles.Len(), cfg.GraphDataPath, profiles.Location())
+			}
+		}
+	}
 
 	// Initialize API server with profile manager
 	apiServer := api.NewServer(router, g, profileManager)
+	apiServer.SetGraphSource(graphSource, graphLoadTime)
+	apiServer.SetSearchLimits(routing.SearchLimits{MaxNodes: cfg.SearchMaxNodes, TimeoutMs: cfg.SearchTimeoutMs})
+
+	// EV charging stations come from OSM data and an optional CSV file
+	if cfg.EVStationsPath != "" {
+		csvStations, err := ev.LoadCSV(cfg.EVStationsPath)
+		if err != nil {
+			log.Printf("Warning: Failed to load charging stations: %v", err)
+		} else {
+			apiServer.SetChargingStations(csvStations)
+		}
+	}
+	if count := apiServer.ChargingStationCount(); count > 0 {
+		log.Printf("Loaded %d EV charging stations", count)
+	}
+
+	// Load persisted road closures
+	closureStore := closures.NewStore(cfg.ClosuresPath, g)
+	if err := closureStore.Load(); err != nil {
+		log.Fatalf("Failed to load closures: %v", err)
+	} else if count := len(closureStore.List()); count > 0 {
+		log.Printf("Loaded %d road closures from %s", count, cfg.ClosuresPath)
+	}
+	apiServer.SetClosureStore(closureStore)
+	apiServer.SetJournal(changeJournal)
+	if cfg.GraphDataPath != "" {
+		snapshotStore := storage.NewStorage(cfg.GraphDataPath)
+		snapshotStore.SetLayout(graphLayout)
+		apiServer.SetStorage(snapshotStore)
+	}
+
+	// Live traffic: pushed to /traffic and optionally polled from a local file
+	trafficStore := traffic.NewStore(g, time.Duration(cfg.TrafficTTLSecs)*time.Second)
+	apiServer.SetTrafficStore(trafficStore)
+	datexFeed := datex.NewFeed(openlr.NewDecoder(g), closureStore, trafficStore)
+	apiServer.SetDatexFeed(datexFeed)
+	if cfg.TrafficFile != "" {
+		log.Printf("Watching traffic file %s every %ds", cfg.TrafficFile, cfg.TrafficPollSecs)
+		stopTraffic := traffic.Watch(cfg.TrafficFile, time.Duration(cfg.TrafficPollSecs)*time.Second, trafficStore)
+		defer stopTraffic()
+	}
+
+	// Profile files edited on disk are reloaded when they change
+	if cfg.ProfilesWatch != "off" {
+		stopProfiles := apiServer.WatchProfiles(time.Duration(cfg.ProfilesPollSecs)*time.Second, cfg.ProfilesWatch == "poll")
+		defer stopProfiles()
+		log.Printf("Watching profile directory %s (%s)", cfg.ProfilesDir, profileManager.Status().Watch)
+	}
+
+	// Multi-level overlay for plain route requests, customized in the background
+	if cfg.MLDEnabled {
+		start := time.Now()
+		if err := apiServer.SetOverlay(cfg.MLDCellSizes); err != nil {
+			log.Printf("Warning: Failed to build overlay: %v", err)
+		} else {
+			log.Printf("Built overlay with cell sizes %v in %v", cfg.MLDCellSizes, time.Since(start).Round(time.Millisecond))
+			closureStore.OnChange(apiServer.RefreshOverlay)
+			trafficStore.OnChange(apiServer.UpdateOverlay)
+			if cfg.MLDRefreshSecs > 0 {
+				// Historical speeds change with the time of day
+				go func() {
+					for range time.Tick(time.Duration(cfg.MLDRefreshSecs) * time.Second) {
+						apiServer.UpdateOverlay()
+					}
+				}()
+			}
+		}
+	}
+
+	// Graph reloads (POST /admin/reload or SIGHUP) rebind everything that holds the graph
+	apiServer.SetReloadHook(func(next *graph.Graph) error {
+		skipped, err := changeJournal.SetGraph(next)
+		if err != nil {
+			return err
+		}
+		if skipped > 0 {
+			log.Printf("Warning: Skipped %d journaled edge changes that no longer match the new graph", skipped)
+		}
+		closureStore.SetGraph(next)
+		trafficStore.SetGraph(next)
+		datexFeed.SetDecoder(openlr.NewDecoder(next))
+		return nil
+	})
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
+	go func() {
+		for range reloadSignals {
+			log.Printf("SIGHUP received, reloading graph")
+			if _, err := apiServer.ReloadGraph(""); err != nil && errors.Is(err, api.ErrReloadInProgress) {
+				log.Printf("Graph reload skipped: %v", err)
+			}
+		}
+	}()
+
 	handler := apiServer.SetupRoutes()
 
 	// Start HTTP server
@@ -109,11 +308,27 @@ func main() {
 	log.Printf("    GET/POST /route - Find route between two points")
 	log.Printf("  Profiles:")
 	log.Printf("    GET  /profiles - List all available profiles")
-	log.Printf("    GET  /profiles/{name} - Get specific profile details")
+	log.Printf("    GET  /profiles/{name} - Get specific profile details (?resolved=true merges inherited settings)")
+	log.Printf("    PUT/PATCH/DELETE /profiles/{name} - Create, change or delete a profile (If-Match with the ETag)")
+	log.Printf("    GET  /profiles/{name}/history - List previous versions of a profile")
+	log.Printf("    POST /profiles/{name}/rollback - Restore a previous version of a profile")
 	log.Printf("    POST /profiles/reload - Reload profiles from disk")
+	log.Printf("    GET  /profiles/status - Profile load and file watch status")
+	log.Printf("  Closures:")
+	log.Printf("    GET/POST /closures - List or create road closures")
+	log.Printf("    GET/DELETE /closures/{id} - Get or delete a closure")
+	log.Printf("  Traffic:")
+	log.Printf("    GET/POST/DELETE /traffic - Traffic status, ingest observations, reset")
+	log.Printf("    POST /traffic/datex - Ingest DATEX II incidents with OpenLR locations")
 	log.Printf("  Utilities:")
 	log.Printf("    POST /weight/update - Update edge weights")
 	log.Printf("    GET  /health - Health check")
+	log.Printf("  Admin:")
+	log.Printf("    GET  /admin/changes - Journal of runtime weight changes")
+	log.Printf("    POST /admin/changes/{id}/revert - Revert a change")
+	log.Printf("    POST /admin/changes/revert - Revert all changes after a point in time")
+	log.Printf("    GET/POST /admin/snapshot - List or write graph snapshots")
+	log.Printf("    POST /admin/reload - Load a new graph file without restarting (also on SIGHUP)")
 
 	if err := http.ListenAndServe(addr, handler); err != nil {
 		log.Fatalf("Server failed: %v", err)
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/speeds"
+	"github.com/vamosdalian/nav/internal/storage"
+)
+
+// Offline tool that aggregates map-matched probe records (CSV or Parquet) into
+// weekly speed profiles stored next to the graph file
+func main() {
+	graphPath := flag.String("graph", "graph.bin.snappy", "Graph file the probes were matched to")
+	outPath := flag.String("out", "", "Output profile file (default: <graph>.speeds)")
+	embed := flag.Bool("embed", false, "Store the profiles as a section of the graph file instead of a sidecar file")
+	zone := flag.String("tz", "UTC", "IANA time zone the weekly buckets are expressed in")
+	minSamples := flag.Int("min-samples", 3, "Samples needed per bucket before neighbouring buckets are pooled")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] probes.csv|probes.parquet...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *outPath == "" {
+		*outPath = speeds.SidecarPath(*graphPath)
+	}
+
+	location, err := time.LoadLocation(*zone)
+	if err != nil {
+		log.Fatalf("Invalid time zone: %v", err)
+	}
+
+	builder := speeds.NewBuilder(location)
+	rejected := 0
+	add := func(rec speeds.Record) error {
+		if err := builder.Add(rec); err != nil {
+			if rejected < 10 {
+				log.Printf("Skipping record for way %d: %v", rec.WayID, err)
+			}
+			rejected++
+		}
+		return nil
+	}
+
+	for _, path := range flag.Args() {
+		log.Printf("Reading probes from %s...", path)
+		if err := readProbes(path, add); err != nil {
+			log.Fatalf("Failed to read %s: %v", path, err)
+		}
+	}
+	log.Printf("Aggregated %d probe records (%d skipped)", builder.Records(), rejected)
+
+	profiles := builder.Build(*minSamples)
+	if profiles.Len() == 0 {
+		log.Fatal("No road direction has enough samples for a profile")
+	}
+
+	// Report how many profiles match the graph, if it is available
+	if _, err := os.Stat(*graphPath); err == nil {
+		g, err := storage.NewStorage(*graphPath).Load()
+		if err != nil {
+			log.Fatalf("Failed to load graph: %v", err)
+		}
+		matched := 0
+		for _, edges := range g.Export().Edges {
+			for i := range edges {
+				if _, ok := profiles.Get(speeds.KeyOf(&edges[i])); ok {
+					matched++
+				}
+			}
+		}
+		log.Printf("Profiles cover %d/%d graph edges", matched, g.EdgeCount())
+	}
+
+	if *embed {
+		log.Printf("Embedding %d profiles in %s...", profiles.Len(), *graphPath)
+		if err := storage.NewStorage(*graphPath).WriteSection(storage.SectionSpeeds, profiles.Encode); err != nil {
+			log.Fatalf("Failed to embed profiles: %v", err)
+		}
+		log.Println("Done")
+		return
+	}
+
+	log.Printf("Saving %d profiles to %s...", profiles.Len(), *outPath)
+	if err := profiles.Save(*outPath); err != nil {
+		log.Fatalf("Failed to save profiles: %v", err)
+	}
+	log.Println("Done")
+}
+
+// readProbes reads a CSV or Parquet probe file, chosen by extension
+func readProbes(path string, fn func(speeds.Record) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".parquet") {
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		return speeds.ReadParquet(file, info.Size(), fn)
+	}
+	return speeds.ReadCSV(file, fn)
+}
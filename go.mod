@@ -2,14 +2,18 @@ module github.com/vamosdalian/nav
 
 go 1.25.1
 
-require github.com/paulmach/osm v0.8.0
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/golang/snappy v1.0.0
+	github.com/paulmach/osm v0.8.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/datadog/czlib v0.0.0-20160811164712-4bc9a24e37f2 // indirect
-	github.com/golang/snappy v1.0.0 // indirect
 	github.com/paulmach/orb v0.11.1 // indirect
 	github.com/paulmach/protoscan v0.2.1 // indirect
 	go.mongodb.org/mongo-driver v1.11.4 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 	google.golang.org/protobuf v1.27.1 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
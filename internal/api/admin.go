@@ -0,0 +1,234 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/journal"
+	"github.com/vamosdalian/nav/internal/storage"
+)
+
+// SetJournal sets the journal that records and reverts weight updates
+func (s *Server) SetJournal(j *journal.Journal) {
+	s.journal = j
+}
+
+// SetStorage sets the graph storage that snapshots are written next to
+func (s *Server) SetStorage(store *storage.Storage) {
+	s.storage = store
+}
+
+// SnapshotResponse represents a written graph snapshot
+type SnapshotResponse struct {
+	Code       string `json:"code"`
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// RevertRequest selects the point in time to revert to
+type RevertRequest struct {
+	To time.Time `json:"to"`
+}
+
+// ChangeResponse represents a single journal entry response
+type ChangeResponse struct {
+	Code   string        `json:"code"`
+	Change journal.Entry `json:"change"`
+}
+
+// changesHandler routes journal requests to the appropriate handler
+func (s *Server) changesHandler(w http.ResponseWriter, r *http.Request) {
+	if s.journal == nil {
+		s.sendError(w, http.StatusServiceUnavailable, "journal_disabled", "Change journal is not enabled")
+		return
+	}
+
+	pathParts := splitPath(r.URL.Path)
+
+	switch {
+	case len(pathParts) == 2 && r.Method == http.MethodGet:
+		// GET /admin/changes - list journal entries
+		s.HandleListChanges(w, r)
+	case len(pathParts) == 3 && pathParts[2] == "revert" && r.Method == http.MethodPost:
+		// POST /admin/changes/revert - revert everything after a point in time
+		s.HandleRevertTo(w, r)
+	case len(pathParts) == 3 && r.Method == http.MethodGet:
+		// GET /admin/changes/{id} - get entry with per-edge changes
+		s.HandleGetChange(w, r, pathParts[2])
+	case len(pathParts) == 4 && pathParts[3] == "revert" && r.Method == http.MethodPost:
+		// POST /admin/changes/{id}/revert - revert one entry
+		s.HandleRevertChange(w, r, pathParts[2])
+	case len(pathParts) <= 4:
+		s.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	default:
+		s.sendError(w, http.StatusNotFound, "not_found", "Invalid changes endpoint")
+	}
+}
+
+// HandleListChanges lists journal entries, optionally after a point in time
+func (s *Server) HandleListChanges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var since time.Time
+	if value := query.Get("since"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			s.sendError(w, http.StatusBadRequest, "invalid_parameters", "since must be an RFC3339 time")
+			return
+		}
+		since = t
+	}
+
+	list := s.journal.List(since, query.Get("details") == "true")
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			s.sendError(w, http.StatusBadRequest, "invalid_parameters", "limit must be a non-negative integer")
+			return
+		}
+		// Keep the most recent entries
+		if len(list) > limit {
+			list = list[len(list)-limit:]
+		}
+	}
+	if list == nil {
+		list = []journal.Entry{}
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"code":    "Ok",
+		"changes": list,
+		"count":   len(list),
+	})
+}
+
+// HandleGetChange returns a journal entry with its per-edge changes
+func (s *Server) HandleGetChange(w http.ResponseWriter, r *http.Request, rawID string) {
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, "invalid_path", "Change ID must be an integer")
+		return
+	}
+
+	entry, err := s.journal.Get(id)
+	if err != nil {
+		s.sendError(w, http.StatusNotFound, "change_not_found", err.Error())
+		return
+	}
+	s.sendJSON(w, http.StatusOK, ChangeResponse{Code: "Ok", Change: entry})
+}
+
+// HandleRevertChange reverts a single journal entry
+func (s *Server) HandleRevertChange(w http.ResponseWriter, r *http.Request, rawID string) {
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, "invalid_path", "Change ID must be an integer")
+		return
+	}
+
+	entry, err := s.journal.Revert(id, actorOf(r))
+	if err != nil {
+		s.sendRevertError(w, err)
+		return
+	}
+	s.sendJSON(w, http.StatusOK, ChangeResponse{Code: "Ok", Change: entry})
+}
+
+// HandleRevertTo restores all weights to their state at a point in time
+func (s *Server) HandleRevertTo(w http.ResponseWriter, r *http.Request) {
+	var req RevertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON request")
+		return
+	}
+	if req.To.IsZero() {
+		s.sendError(w, http.StatusBadRequest, "invalid_request", "to is required")
+		return
+	}
+
+	entry, err := s.journal.RevertTo(req.To, actorOf(r))
+	if err != nil {
+		s.sendRevertError(w, err)
+		return
+	}
+	s.sendJSON(w, http.StatusOK, ChangeResponse{Code: "Ok", Change: entry})
+}
+
+// HandleSnapshot writes the in-memory graph to a new versioned file (POST) or
+// lists the existing snapshots (GET)
+func (s *Server) HandleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if s.storage == nil {
+		s.sendError(w, http.StatusServiceUnavailable, "snapshots_disabled", "No graph file configured")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		snapshots, err := s.storage.Snapshots()
+		if err != nil {
+			s.sendError(w, http.StatusInternalServerError, "snapshot_failed", err.Error())
+			return
+		}
+		if snapshots == nil {
+			snapshots = []string{}
+		}
+		s.sendJSON(w, http.StatusOK, map[string]interface{}{
+			"code":      "Ok",
+			"snapshots": snapshots,
+			"count":     len(snapshots),
+		})
+
+	case http.MethodPost:
+		start := time.Now()
+		path, err := s.storage.SaveSnapshot(s.current().graph)
+		if err != nil {
+			s.sendError(w, http.StatusInternalServerError, "snapshot_failed", err.Error())
+			return
+		}
+		var size int64
+		if info, err := os.Stat(path); err == nil {
+			size = info.Size()
+		}
+		s.sendJSON(w, http.StatusCreated, SnapshotResponse{
+			Code:       "Ok",
+			Path:       path,
+			Size:       size,
+			DurationMs: time.Since(start).Milliseconds(),
+		})
+
+	default:
+		s.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET and POST methods are allowed")
+	}
+}
+
+func (s *Server) sendRevertError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, journal.ErrNotFound):
+		s.sendError(w, http.StatusNotFound, "change_not_found", err.Error())
+	case errors.Is(err, journal.ErrConflict):
+		s.sendError(w, http.StatusConflict, "revert_conflict", err.Error())
+	default:
+		s.sendError(w, http.StatusInternalServerError, "revert_failed", err.Error())
+	}
+}
+
+// actorOf identifies who made a request: the client address, preceded by the
+// X-Actor header if set. The header is advisory since any client can send it;
+// the address is always recorded.
+func actorOf(r *http.Request) string {
+	addr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if actor := r.Header.Get("X-Actor"); actor != "" {
+		return fmt.Sprintf("%s (%s)", actor, addr)
+	}
+	return addr
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vamosdalian/nav/internal/geo"
+	"github.com/vamosdalian/nav/internal/routing"
+)
+
+// AvoidRequest is an area a route must avoid, given as GeoJSON geometry or as a bounding box
+type AvoidRequest struct {
+	Geometry json.RawMessage `json:"geometry,omitempty"` // GeoJSON Polygon, MultiPolygon or Feature
+	BBox     []float64       `json:"bbox,omitempty"`     // [min_lon, min_lat, max_lon, max_lat]
+	Penalty  float64         `json:"penalty,omitempty"`  // 0 forbids the area, > 1 multiplies edge weights inside it
+}
+
+// buildAvoidAreas converts request areas into an indexed set for the router
+func buildAvoidAreas(requests []AvoidRequest) (*routing.AvoidAreas, error) {
+	areas := make([]routing.AvoidArea, 0, len(requests))
+
+	for i, req := range requests {
+		if req.Penalty != 0 && req.Penalty < 1 {
+			return nil, fmt.Errorf("avoid[%d]: penalty must be 0 (hard) or at least 1.0", i)
+		}
+
+		switch {
+		case len(req.Geometry) > 0:
+			polygons, err := geo.ParsePolygons(req.Geometry)
+			if err != nil {
+				return nil, fmt.Errorf("avoid[%d]: %w", i, err)
+			}
+			for _, polygon := range polygons {
+				areas = append(areas, routing.AvoidArea{Polygon: polygon, Penalty: req.Penalty})
+			}
+
+		case len(req.BBox) > 0:
+			if len(req.BBox) != 4 {
+				return nil, fmt.Errorf("avoid[%d]: bbox needs 4 values [min_lon, min_lat, max_lon, max_lat]", i)
+			}
+			bbox := geo.BBox{MinLon: req.BBox[0], MinLat: req.BBox[1], MaxLon: req.BBox[2], MaxLat: req.BBox[3]}
+			if !bbox.Valid() {
+				return nil, fmt.Errorf("avoid[%d]: invalid bbox", i)
+			}
+			areas = append(areas, routing.AvoidArea{Polygon: geo.PolygonFromBBox(bbox), Penalty: req.Penalty})
+
+		default:
+			return nil, fmt.Errorf("avoid[%d]: geometry or bbox is required", i)
+		}
+	}
+
+	return routing.NewAvoidAreas(areas), nil
+}
+
+// parseAvoidBBox parses a query value "min_lon,min_lat,max_lon,max_lat[,penalty]"
+func parseAvoidBBox(value string) (AvoidRequest, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 && len(parts) != 5 {
+		return AvoidRequest{}, fmt.Errorf("invalid avoid_bbox %q", value)
+	}
+
+	numbers := make([]float64, len(parts))
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return AvoidRequest{}, fmt.Errorf("invalid avoid_bbox %q", value)
+		}
+		numbers[i] = f
+	}
+
+	req := AvoidRequest{BBox: numbers[:4]}
+	if len(numbers) == 5 {
+		req.Penalty = numbers[4]
+	}
+	return req, nil
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/closures"
+	"github.com/vamosdalian/nav/internal/routing"
+)
+
+// ClosureResponse represents a single closure response
+type ClosureResponse struct {
+	Code          string           `json:"code"`
+	Closure       closures.Closure `json:"closure"`
+	EdgesAffected int              `json:"edges_affected"`
+}
+
+// SetClosureStore sets the road closure store used by the API and the router
+func (s *Server) SetClosureStore(store *closures.Store) {
+	s.closures = store
+	s.current().router.SetClosures(closureSource{store})
+}
+
+// closureSource hands searches the closures in effect when they start
+type closureSource struct {
+	store *closures.Store
+}
+
+// Closures returns the closures in effect now
+func (c closureSource) Closures() routing.ClosureChecker {
+	return c.store.Active()
+}
+
+// closuresHandler routes closure requests to the appropriate handler
+func (s *Server) closuresHandler(w http.ResponseWriter, r *http.Request) {
+	if s.closures == nil {
+		s.sendError(w, http.StatusServiceUnavailable, "closures_disabled", "Road closures are not enabled")
+		return
+	}
+
+	pathParts := splitPath(r.URL.Path)
+
+	switch {
+	case len(pathParts) == 1 && r.Method == http.MethodGet:
+		// GET /closures - list closures
+		s.HandleListClosures(w, r)
+	case len(pathParts) == 1 && r.Method == http.MethodPost:
+		// POST /closures - create closure
+		s.HandleCreateClosure(w, r)
+	case len(pathParts) == 2 && r.Method == http.MethodGet:
+		// GET /closures/{id} - get closure
+		s.HandleGetClosure(w, r, pathParts[1])
+	case len(pathParts) == 2 && r.Method == http.MethodDelete:
+		// DELETE /closures/{id} - delete closure
+		s.HandleDeleteClosure(w, r, pathParts[1])
+	case len(pathParts) <= 2:
+		s.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	default:
+		s.sendError(w, http.StatusNotFound, "not_found", "Invalid closure endpoint")
+	}
+}
+
+// HandleListClosures lists all closures that have not expired
+func (s *Server) HandleListClosures(w http.ResponseWriter, r *http.Request) {
+	list := s.closures.List()
+
+	if r.URL.Query().Get("active") == "true" {
+		now := time.Now()
+		active := list[:0]
+		for _, c := range list {
+			if c.ActiveAt(now) {
+				active = append(active, c)
+			}
+		}
+		list = active
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"code":     "Ok",
+		"closures": list,
+		"count":    len(list),
+	})
+}
+
+// HandleCreateClosure creates a new closure
+func (s *Server) HandleCreateClosure(w http.ResponseWriter, r *http.Request) {
+	var req closures.Closure
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON request")
+		return
+	}
+
+	closure, err := s.closures.Add(req)
+	if err != nil {
+		if errors.Is(err, closures.ErrExists) {
+			s.sendError(w, http.StatusConflict, "closure_exists", err.Error())
+		} else {
+			s.sendError(w, http.StatusBadRequest, "invalid_closure", err.Error())
+		}
+		return
+	}
+
+	s.sendJSON(w, http.StatusCreated, ClosureResponse{
+		Code:          "Ok",
+		Closure:       closure,
+		EdgesAffected: s.closures.EdgeCount(closure.ID),
+	})
+}
+
+// HandleGetClosure returns a single closure
+func (s *Server) HandleGetClosure(w http.ResponseWriter, r *http.Request, id string) {
+	closure, err := s.closures.Get(id)
+	if err != nil {
+		s.sendError(w, http.StatusNotFound, "closure_not_found", err.Error())
+		return
+	}
+
+	s.sendJSON(w, http.StatusOK, ClosureResponse{
+		Code:          "Ok",
+		Closure:       closure,
+		EdgesAffected: s.closures.EdgeCount(closure.ID),
+	})
+}
+
+// HandleDeleteClosure removes a closure
+func (s *Server) HandleDeleteClosure(w http.ResponseWriter, r *http.Request, id string) {
+	if err := s.closures.Delete(id); err != nil {
+		if errors.Is(err, closures.ErrNotFound) {
+			s.sendError(w, http.StatusNotFound, "closure_not_found", err.Error())
+		} else {
+			s.sendError(w, http.StatusInternalServerError, "delete_failed", err.Error())
+		}
+		return
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"code":    "Ok",
+		"message": "Closure deleted",
+	})
+}
@@ -1,32 +1,81 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/vamosdalian/nav/internal/closures"
+	"github.com/vamosdalian/nav/internal/datex"
+	"github.com/vamosdalian/nav/internal/elevation"
 	"github.com/vamosdalian/nav/internal/encoding"
+	"github.com/vamosdalian/nav/internal/ev"
 	"github.com/vamosdalian/nav/internal/graph"
+	"github.com/vamosdalian/nav/internal/guidance"
+	"github.com/vamosdalian/nav/internal/journal"
 	"github.com/vamosdalian/nav/internal/routing"
+	"github.com/vamosdalian/nav/internal/storage"
+	"github.com/vamosdalian/nav/internal/traffic"
+	"github.com/vamosdalian/nav/internal/weights"
 )
 
 // Server holds the HTTP server dependencies
 type Server struct {
-	router         *routing.Router
-	graph          *graph.Graph
-	profileManager *routing.ProfileManager
+	state            atomic.Pointer[graphState] // Graph in use, swapped on reload
+	profileManager   *routing.ProfileManager
+	extraStations    []ev.Station     // Charging stations not stored in the graph
+	closures         *closures.Store  // Road closures (optional)
+	traffic          *traffic.Store   // Live traffic speeds (optional)
+	datex            *datex.Feed      // DATEX II incident feed (optional)
+	journal          *journal.Journal // Audit log of weight changes (optional)
+	storage          *storage.Storage // Graph file used for snapshots and reloads (optional)
+	reloadHook       ReloadHook
+	reloadMutex      sync.Mutex // Held while a graph reload is running
+	reloadStatus     ReloadStatus
+	statusMutex      sync.Mutex           // Guards reloadStatus
+	limits           routing.SearchLimits // Caps on the search budgets of profiles and requests
+	overlayCellSizes []int                // Cell sizes of the multi-level overlay (nil: disabled)
 }
 
 // NewServer creates a new API server
 func NewServer(r *routing.Router, g *graph.Graph, pm *routing.ProfileManager) *Server {
-	return &Server{
-		router:         r,
-		graph:          g,
-		profileManager: pm,
-	}
+	s := &Server{profileManager: pm}
+	s.state.Store(&graphState{
+		graph:    g,
+		router:   r,
+		stations: ev.Snap(g, ev.FromGraph(g.ChargingStations())),
+		info:     GraphInfo{Version: 1, LoadedAt: time.Now().UTC()},
+	})
+	return s
+}
+
+// SetSearchLimits sets the largest node and time budget a route search may use.
+// Profiles and requests can ask for less; searches without limits get these.
+func (s *Server) SetSearchLimits(limits routing.SearchLimits) {
+	s.limits = limits
+}
+
+// SetChargingStations adds charging stations that are not part of the graph
+// (e.g. from a CSV file) to the OSM stations available for EV routing
+func (s *Server) SetChargingStations(stations []ev.Station) {
+	s.extraStations = stations
+	st := s.current()
+	next := *st
+	next.stations = s.snapStations(st.graph)
+	s.state.Store(&next)
+}
+
+// ChargingStationCount returns the number of charging stations available for EV routing
+func (s *Server) ChargingStationCount() int {
+	return len(s.current().stations)
 }
 
 // RouteRequest represents a routing request (flat structure for GET/POST compatibility)
@@ -47,6 +96,23 @@ type RouteRequest struct {
 	AvoidTunnels  *bool    `json:"avoid_tunnels,omitempty"`
 	AllowUturns   *bool    `json:"allow_uturns,omitempty"`
 	MaxSpeed      *float64 `json:"max_speed,omitempty"` // km/h
+	Weighting     *string  `json:"weighting,omitempty"` // "eco" minimises fuel/energy consumption
+
+	// Departure time (RFC 3339) used for historical speeds (default: now)
+	DepartAt *time.Time `json:"depart_at,omitempty"`
+
+	// Areas to avoid on this request (GET: repeated avoid_bbox)
+	Avoid []AvoidRequest `json:"avoid,omitempty"`
+
+	// Electric vehicle routing with charging stops (POST only)
+	EV *ev.Vehicle `json:"ev,omitempty"`
+
+	// Speed and priority rules layered on the profile for this request (POST only)
+	CustomModel *routing.CustomModel `json:"custom_model,omitempty"`
+
+	// Search budget, capped by the server limits (default: profile limits)
+	MaxNodes  *int `json:"max_nodes,omitempty"`
+	TimeoutMs *int `json:"timeout_ms,omitempty"`
 }
 
 // RouteResponse represents a routing response
@@ -54,6 +120,8 @@ type RouteResponse struct {
 	Routes []RouteInfo `json:"routes"`
 	Code   string      `json:"code"`
 	Format string      `json:"format,omitempty"` // Format used for geometry
+
+	Traffic *traffic.Status `json:"traffic,omitempty"` // Age of the live traffic data, if enabled
 }
 
 // RouteInfo contains route details
@@ -61,6 +129,28 @@ type RouteInfo struct {
 	Distance float64     `json:"distance"`
 	Duration float64     `json:"duration"`
 	Geometry interface{} `json:"geometry"` // Can be [][2]float64, string (polyline), or GeoJSON
+
+	Maneuvers []guidance.Maneuver     `json:"maneuvers,omitempty"` // Turn-by-turn instructions with lane guidance
+	Elevation *elevation.RouteProfile `json:"elevation,omitempty"` // Only present if the graph has elevation data
+	EV        *EVInfo                 `json:"ev,omitempty"`        // Only present for EV requests
+
+	Consumption *ConsumptionInfo `json:"consumption,omitempty"` // Only present if the profile has a vehicle model
+}
+
+// ConsumptionInfo contains the estimated fuel/energy use of a route
+type ConsumptionInfo struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`  // "l" or "kWh"
+	CO2   float64 `json:"co2_g"` // Grams of CO2
+}
+
+// EVInfo contains battery and charging details of an EV route
+type EVInfo struct {
+	ChargingStops []routing.ChargingStop `json:"charging_stops"`
+	SoC           []float64              `json:"soc"` // State of charge at each route point
+	ArrivalSoC    float64                `json:"arrival_soc"`
+	EnergyUsed    float64                `json:"energy_used_kwh"`
+	ChargeTime    float64                `json:"charge_time"` // Total charging time in seconds
 }
 
 // ErrorResponse represents an error response
@@ -108,15 +198,80 @@ func (s *Server) HandleRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Index areas to avoid
+	avoid, err := buildAvoidAreas(req.Avoid)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, "invalid_avoid", err.Error())
+		return
+	}
+
+	// Compile the custom model
+	var custom *routing.CompiledModel
+	if req.CustomModel != nil {
+		custom, err = req.CustomModel.Compile()
+		if err != nil {
+			s.sendError(w, http.StatusBadRequest, "invalid_custom_model", "custom_model."+err.Error())
+			return
+		}
+	}
+
+	// The whole request runs on the graph in use when it arrived, even if a
+	// reload swaps it in the meantime
+	st := s.current()
+
+	// Searches stop when the client goes away
+	ctx := r.Context()
+
+	if req.EV != nil {
+		s.handleEVRoute(ctx, w, st, req, effectiveProfile, avoid, custom)
+		return
+	}
+
 	// Find routes with the specified profile
-	routes, err := s.findRoutes(req, effectiveProfile)
+	routes, err := s.findRoutes(ctx, st, req, effectiveProfile, avoid, custom)
 	if err != nil {
-		s.sendError(w, http.StatusNotFound, "no_route", err.Error())
+		s.sendRouteError(w, err)
 		return
 	}
 
 	// Build and send response
-	s.sendRouteResponse(w, routes, req.Format)
+	s.sendRouteResponse(w, st, routes, req.Format, effectiveProfile)
+}
+
+// handleEVRoute finds a route with charging stops for an electric vehicle
+func (s *Server) handleEVRoute(ctx context.Context, w http.ResponseWriter, st *graphState, req RouteRequest, profile *routing.ProfileConfig, avoid *routing.AvoidAreas, custom *routing.CompiledModel) {
+	if err := req.EV.Normalize(); err != nil {
+		s.sendError(w, http.StatusBadRequest, "invalid_ev_parameters", err.Error())
+		return
+	}
+
+	oldProfile := s.convertToOldProfile(profile)
+	oldProfile.Avoid = avoid
+	oldProfile.Custom = custom
+	oldProfile.Departure = req.departure()
+	oldProfile.Limits = profile.Limits.Cap(s.limits)
+
+	route, err := st.router.FindEVRoute(ctx, req.FromLat, req.FromLon, req.ToLat, req.ToLon,
+		oldProfile, req.EV, st.stations)
+	if err != nil {
+		s.sendRouteError(w, err)
+		return
+	}
+
+	response := s.buildRouteResponse(st, []*routing.Route{&route.Route}, req.Format, nil)
+	stops := route.Stops
+	if stops == nil {
+		stops = []routing.ChargingStop{}
+	}
+	response.Routes[0].EV = &EVInfo{
+		ChargingStops: stops,
+		SoC:           route.SoC,
+		ArrivalSoC:    route.SoC[len(route.SoC)-1],
+		EnergyUsed:    route.EnergyUsed,
+		ChargeTime:    route.ChargeTime,
+	}
+
+	s.sendJSON(w, http.StatusOK, response)
 }
 
 // HandleListProfiles handles listing all available profiles
@@ -149,12 +304,22 @@ func (s *Server) HandleGetProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The profile as written, or with ?resolved=true merged with the profiles it extends
 	profileName := pathParts[1]
-	profile, err := s.profileManager.GetProfile(profileName)
+	var profile interface{}
+	var err error
+	if resolved, _ := strconv.ParseBool(r.URL.Query().Get("resolved")); resolved {
+		profile, err = s.profileManager.GetProfile(profileName)
+	} else {
+		profile, err = s.profileManager.GetProfileDefinition(profileName)
+	}
 	if err != nil {
 		s.sendError(w, http.StatusNotFound, "profile_not_found", err.Error())
 		return
 	}
+	if etag, err := s.profileManager.ProfileETag(profileName); err == nil {
+		w.Header().Set("ETag", etag)
+	}
 
 	s.sendJSON(w, http.StatusOK, map[string]interface{}{
 		"code":    "Ok",
@@ -173,6 +338,7 @@ func (s *Server) HandleReloadProfiles(w http.ResponseWriter, r *http.Request) {
 		s.sendError(w, http.StatusInternalServerError, "reload_failed", err.Error())
 		return
 	}
+	s.refreshOverlayProfiles()
 
 	profiles := s.profileManager.ListProfiles()
 	s.sendJSON(w, http.StatusOK, map[string]interface{}{
@@ -183,19 +349,24 @@ func (s *Server) HandleReloadProfiles(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// UpdateWeightRequest represents a weight update request
+// UpdateWeightRequest represents a weight update request. Either a list of
+// updates or the legacy osm_way_id + multiplier pair is accepted.
 type UpdateWeightRequest struct {
-	OSMWayID   int64   `json:"osm_way_id"`
-	Multiplier float64 `json:"multiplier"`
+	Updates    []weights.Update `json:"updates,omitempty"`
+	OSMWayID   int64            `json:"osm_way_id,omitempty"`
+	Multiplier float64          `json:"multiplier,omitempty"`
 }
 
 // UpdateWeightResponse represents update response
 type UpdateWeightResponse struct {
 	Code         string `json:"code"`
 	EdgesUpdated int    `json:"edges_updated"`
+	Matched      []int  `json:"matched,omitempty"`   // Edges selected by each update
+	ChangeID     int64  `json:"change_id,omitempty"` // Journal entry of the update
 }
 
-// HandleUpdateWeight handles edge weight updates
+// HandleUpdateWeight handles edge weight updates. All updates of a request
+// are applied atomically.
 func (s *Server) HandleUpdateWeight(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		s.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
@@ -208,25 +379,69 @@ func (s *Server) HandleUpdateWeight(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Multiplier <= 0 {
-		s.sendError(w, http.StatusBadRequest, "invalid_multiplier", "Multiplier must be positive")
+	updates := req.Updates
+	if len(updates) == 0 {
+		if req.Multiplier <= 0 {
+			s.sendError(w, http.StatusBadRequest, "invalid_multiplier", "Multiplier must be positive")
+			return
+		}
+		updates = []weights.Update{{
+			Selector: weights.Selector{OSMWayID: req.OSMWayID},
+			Op:       graph.WeightMultiply,
+			Value:    req.Multiplier,
+		}}
+	}
+
+	if s.journal == nil {
+		result, err := weights.Apply(s.current().graph, updates)
+		if err != nil {
+			s.sendError(w, http.StatusBadRequest, "invalid_update", err.Error())
+			return
+		}
+		s.sendJSON(w, http.StatusOK, UpdateWeightResponse{
+			Code:         "Ok",
+			EdgesUpdated: result.EdgesUpdated,
+			Matched:      result.Matched,
+		})
 		return
 	}
 
-	count := s.graph.UpdateEdgeWeightByWay(req.OSMWayID, req.Multiplier)
+	for i := range updates {
+		if err := updates[i].Validate(); err != nil {
+			s.sendError(w, http.StatusBadRequest, "invalid_update", fmt.Sprintf("update %d: %v", i, err))
+			return
+		}
+	}
+	result, entry, err := s.journal.Apply(actorOf(r), updates)
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "update_failed", err.Error())
+		return
+	}
 
 	s.sendJSON(w, http.StatusOK, UpdateWeightResponse{
 		Code:         "Ok",
-		EdgesUpdated: count,
+		EdgesUpdated: result.EdgesUpdated,
+		Matched:      result.Matched,
+		ChangeID:     entry.ID,
 	})
 }
 
 // HandleHealth handles health check requests
 func (s *Server) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	st := s.current()
 	health := map[string]interface{}{
-		"status": "healthy",
-		"nodes":  s.graph.NodeCount(),
-		"edges":  s.graph.EdgeCount(),
+		"status":   "healthy",
+		"nodes":    st.graph.NodeCount(),
+		"edges":    st.graph.EdgeCount(),
+		"graph":    st.info,
+		"reload":   s.ReloadStatus(),
+		"profiles": s.profileManager.Status(),
+	}
+	if s.traffic != nil {
+		health["traffic"] = s.traffic.Status()
+	}
+	if st.mld != nil {
+		health["overlay"] = st.mld.Status()
 	}
 	s.sendJSON(w, http.StatusOK, health)
 }
@@ -301,9 +516,53 @@ func (s *Server) parseRouteQueryParams(r *http.Request) (RouteRequest, error) {
 		req.MaxSpeed = &f
 	}
 
+	if val := q.Get("weighting"); val != "" {
+		req.Weighting = &val
+	}
+
+	if val := q.Get("depart_at"); val != "" {
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			return req, fmt.Errorf("invalid depart_at (expected RFC 3339)")
+		}
+		req.DepartAt = &t
+	}
+
+	if val := q.Get("max_nodes"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return req, fmt.Errorf("invalid max_nodes")
+		}
+		req.MaxNodes = &n
+	}
+
+	if val := q.Get("timeout_ms"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return req, fmt.Errorf("invalid timeout_ms")
+		}
+		req.TimeoutMs = &n
+	}
+
+	for _, val := range q["avoid_bbox"] {
+		avoid, err := parseAvoidBBox(val)
+		if err != nil {
+			return req, err
+		}
+		req.Avoid = append(req.Avoid, avoid)
+	}
+
 	return req, nil
 }
 
+// departure returns the requested departure time, defaulting to now
+func (req *RouteRequest) departure() time.Time {
+	if req.DepartAt != nil {
+		return *req.DepartAt
+	}
+	return time.Now()
+}
+
 // getEffectiveProfile loads a profile and applies runtime options
 func (s *Server) getEffectiveProfile(req *RouteRequest) (*routing.ProfileConfig, error) {
 	profileName := req.Profile
@@ -331,35 +590,63 @@ func (s *Server) getEffectiveProfile(req *RouteRequest) (*routing.ProfileConfig,
 		AvoidTunnels:  req.AvoidTunnels,
 		AllowUturns:   req.AllowUturns,
 		MaxSpeed:      req.MaxSpeed,
+		Weighting:     req.Weighting,
+		MaxNodes:      req.MaxNodes,
+		TimeoutMs:     req.TimeoutMs,
 	}
 
 	// Apply runtime options if any are set
-	return routing.GetEffectiveProfile(baseProfile, options), nil
+	effective := routing.GetEffectiveProfile(baseProfile, options)
+
+	switch effective.WeightFormula.Mode {
+	case "":
+	case routing.WeightModeEco:
+		if effective.Vehicle == nil {
+			return nil, fmt.Errorf("profile '%s' has no vehicle model for eco weighting", effective.Name)
+		}
+	default:
+		return nil, fmt.Errorf("unknown weighting '%s'", effective.WeightFormula.Mode)
+	}
+
+	return effective, nil
 }
 
 // findRoutes finds routes using the effective profile
-func (s *Server) findRoutes(req RouteRequest, profile *routing.ProfileConfig) ([]*routing.Route, error) {
+func (s *Server) findRoutes(ctx context.Context, st *graphState, req RouteRequest, profile *routing.ProfileConfig, avoid *routing.AvoidAreas, custom *routing.CompiledModel) ([]*routing.Route, error) {
 	// Temporary bridge: Convert new ProfileConfig to old RoutingProfile
 	// This allows us to use the existing Router implementation
 	// TODO: Update Router to work directly with ProfileConfig
 	oldProfile := s.convertToOldProfile(profile)
+	oldProfile.Avoid = avoid
+	oldProfile.Custom = custom
+	oldProfile.Departure = req.departure()
+	oldProfile.Limits = profile.Limits.Cap(s.limits)
 
 	var routes []*routing.Route
 	var err error
 
+	// Plain requests run on the customized overlay when it is up to date
+	if st.mld != nil && req.usesOverlay(avoid) {
+		route, err := st.mld.FindRoute(ctx, req.FromLat, req.FromLon, req.ToLat, req.ToLon, oldProfile)
+		if !errors.Is(err, routing.ErrNotCustomized) {
+			if err != nil {
+				return nil, err
+			}
+			return []*routing.Route{route}, nil
+		}
+	}
+
 	if req.Alternatives > 0 {
-		// Set profile temporarily for multiple routes
-		s.router.SetProfile(oldProfile)
-		routes, err = s.router.FindMultipleRoutes(req.FromLat, req.FromLon, req.ToLat, req.ToLon, req.Alternatives)
+		routes, err = st.router.FindMultipleRoutesWithProfile(ctx, req.FromLat, req.FromLon, req.ToLat, req.ToLon, req.Alternatives, oldProfile)
 	} else {
 		var route *routing.Route
 		var routeErr error
 
 		// Default to bidirectional A* (faster), unless explicitly disabled
 		if req.Unidirectional {
-			route, routeErr = s.router.FindRouteWithProfile(req.FromLat, req.FromLon, req.ToLat, req.ToLon, oldProfile)
+			route, routeErr = st.router.FindRouteWithProfile(ctx, req.FromLat, req.FromLon, req.ToLat, req.ToLon, oldProfile)
 		} else {
-			route, routeErr = s.router.FindRouteBidirectionalWithProfile(req.FromLat, req.FromLon, req.ToLat, req.ToLon, oldProfile)
+			route, routeErr = st.router.FindRouteBidirectionalWithProfile(ctx, req.FromLat, req.FromLon, req.ToLat, req.ToLon, oldProfile)
 		}
 
 		if routeErr == nil {
@@ -371,6 +658,16 @@ func (s *Server) findRoutes(req RouteRequest, profile *routing.ProfileConfig) ([
 	return routes, err
 }
 
+// sendRouteError reports a failed search: search_aborted when it was cancelled
+// or ran out of budget, no_route otherwise
+func (s *Server) sendRouteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, routing.ErrSearchAborted) {
+		s.sendError(w, http.StatusUnprocessableEntity, "search_aborted", err.Error())
+		return
+	}
+	s.sendError(w, http.StatusNotFound, "no_route", err.Error())
+}
+
 // convertToOldProfile converts new ProfileConfig to old RoutingProfile (temporary bridge)
 func (s *Server) convertToOldProfile(config *routing.ProfileConfig) routing.RoutingProfile {
 	// Build allowed highways map
@@ -397,11 +694,20 @@ func (s *Server) convertToOldProfile(config *routing.ProfileConfig) routing.Rout
 		SpeedFactors:    speedFactors,
 		AvoidSurfaces:   avoidSurfaces,
 		MaxSpeed:        config.Settings.MaxSpeedKmh / 3.6, // Convert km/h to m/s
+		Elevation:       config.Elevation,
+		Weighting:       config.WeightFormula.Mode,
+		Vehicle:         config.Vehicle,
 	}
 }
 
 // sendRouteResponse builds and sends the route response
-func (s *Server) sendRouteResponse(w http.ResponseWriter, routes []*routing.Route, format string) {
+func (s *Server) sendRouteResponse(w http.ResponseWriter, st *graphState, routes []*routing.Route, format string, profile *routing.ProfileConfig) {
+	s.sendJSON(w, http.StatusOK, s.buildRouteResponse(st, routes, format, profile))
+}
+
+// buildRouteResponse converts routes into the API response structure.
+// Consumption estimates are added when the profile has a vehicle model.
+func (s *Server) buildRouteResponse(st *graphState, routes []*routing.Route, format string, profile *routing.ProfileConfig) RouteResponse {
 	// Determine output format (default: geojson)
 	if format == "" {
 		format = "geojson"
@@ -414,10 +720,15 @@ func (s *Server) sendRouteResponse(w http.ResponseWriter, routes []*routing.Rout
 		Routes: make([]RouteInfo, len(routes)),
 	}
 
+	if s.traffic != nil {
+		status := s.traffic.Status()
+		response.Traffic = &status
+	}
+
 	for i, route := range routes {
 		coordinates := make([][2]float64, len(route.Nodes))
 		for j, nodeID := range route.Nodes {
-			node, _ := s.graph.GetNode(nodeID)
+			node, _ := st.graph.GetNode(nodeID)
 			coordinates[j] = [2]float64{node.Lon, node.Lat}
 		}
 
@@ -430,13 +741,24 @@ func (s *Server) sendRouteResponse(w http.ResponseWriter, routes []*routing.Rout
 		}
 
 		response.Routes[i] = RouteInfo{
-			Distance: route.Distance,
-			Duration: route.Duration,
-			Geometry: geometry,
+			Distance:  route.Distance,
+			Duration:  route.Duration,
+			Geometry:  geometry,
+			Maneuvers: guidance.BuildManeuvers(st.graph, route.Nodes),
+			Elevation: elevation.ProfileForRoute(st.graph, route.Nodes),
+		}
+
+		if profile != nil && profile.Vehicle != nil {
+			consumption := routing.EstimateConsumption(st.graph, route.Nodes, profile.Vehicle, profile.Settings.MaxSpeedKmh/3.6)
+			response.Routes[i].Consumption = &ConsumptionInfo{
+				Value: consumption,
+				Unit:  profile.Vehicle.Unit(),
+				CO2:   profile.Vehicle.CO2(consumption),
+			}
 		}
 	}
 
-	s.sendJSON(w, http.StatusOK, response)
+	return response
 }
 
 func (s *Server) validateCoordinates(lat, lon float64) bool {
@@ -477,38 +799,40 @@ func (s *Server) SetupRoutes() http.Handler {
 	mux.HandleFunc("/route", s.HandleRoute) // Supports both GET and POST
 
 	// Profile endpoints
-	mux.HandleFunc("/profiles", s.profileHandler)              // GET list, or specific profile
+	mux.HandleFunc("/profiles", s.profileHandler)              // GET list
+	mux.HandleFunc("/profiles/", s.profileHandler)             // GET/PUT/PATCH/DELETE specific profile
 	mux.HandleFunc("/profiles/reload", s.HandleReloadProfiles) // POST reload
+	mux.HandleFunc("/profiles/status", s.HandleProfileStatus)  // GET load and watch status
+
+	// Closure endpoints
+	mux.HandleFunc("/closures", s.closuresHandler)  // GET list, POST create
+	mux.HandleFunc("/closures/", s.closuresHandler) // GET/DELETE specific closure
+
+	// Live traffic endpoint
+	mux.HandleFunc("/traffic", s.trafficHandler)          // GET status, POST observations, DELETE reset
+	mux.HandleFunc("/traffic/datex", s.HandleIngestDatex) // POST DATEX II situations with OpenLR locations
 
 	// Utility endpoints
 	mux.HandleFunc("/weight/update", s.HandleUpdateWeight)
 	mux.HandleFunc("/health", s.HandleHealth)
 
+	// Admin endpoints
+	mux.HandleFunc("/admin/changes", s.changesHandler)  // GET journal
+	mux.HandleFunc("/admin/changes/", s.changesHandler) // GET entry, POST revert
+	mux.HandleFunc("/admin/snapshot", s.HandleSnapshot) // GET list, POST write snapshot
+	mux.HandleFunc("/admin/reload", s.HandleReload)     // POST load a new graph file
+
 	// Add CORS and logging middleware
 	return s.loggingMiddleware(s.corsMiddleware(mux))
 }
 
-// profileHandler routes profile requests to appropriate handler
-func (s *Server) profileHandler(w http.ResponseWriter, r *http.Request) {
-	pathParts := splitPath(r.URL.Path)
-
-	if len(pathParts) == 1 {
-		// /profiles - list all profiles
-		s.HandleListProfiles(w, r)
-	} else if len(pathParts) == 2 {
-		// /profiles/{name} - get specific profile
-		s.HandleGetProfile(w, r)
-	} else {
-		s.sendError(w, http.StatusNotFound, "not_found", "Invalid profile endpoint")
-	}
-}
-
 // CORS middleware
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Actor, If-Match, If-None-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"log"
+
+	"github.com/vamosdalian/nav/internal/routing"
+)
+
+// SetOverlay enables multi-level overlay queries with the given cell sizes.
+// The overlay of the current graph is built now and rebuilt on every reload;
+// profiles are customized in the background.
+func (s *Server) SetOverlay(cellSizes []int) error {
+	st := s.current()
+	mld, err := routing.NewMLD(st.router, cellSizes)
+	if err != nil {
+		return err
+	}
+	s.overlayCellSizes = cellSizes
+	mld.SetProfiles(s.overlayProfiles())
+	next := *st
+	next.mld = mld
+	s.state.Store(&next)
+	return nil
+}
+
+// RefreshOverlay customizes the overlay again, e.g. after closures changed.
+// Queries fall back to the regular searches meanwhile.
+func (s *Server) RefreshOverlay() {
+	if mld := s.current().mld; mld != nil {
+		mld.Refresh()
+	}
+}
+
+// UpdateOverlay customizes the overlay again, e.g. after live traffic
+// changed. Queries keep using the previous customization meanwhile.
+func (s *Server) UpdateOverlay() {
+	if mld := s.current().mld; mld != nil {
+		mld.Update()
+	}
+}
+
+// refreshOverlayProfiles customizes the overlay for the profiles now loaded
+func (s *Server) refreshOverlayProfiles() {
+	if mld := s.current().mld; mld != nil {
+		mld.SetProfiles(s.overlayProfiles())
+	}
+}
+
+// overlayProfiles returns the loaded profiles by name in router form
+func (s *Server) overlayProfiles() map[string]routing.RoutingProfile {
+	profiles := make(map[string]routing.RoutingProfile)
+	for _, name := range s.profileManager.ListProfiles() {
+		config, err := s.profileManager.GetProfile(name)
+		if err != nil {
+			continue
+		}
+		profiles[name] = s.convertToOldProfile(config)
+	}
+	return profiles
+}
+
+// buildOverlay builds the overlay for the router of a new graph, or returns
+// nil if overlays are disabled or the build fails
+func (s *Server) buildOverlay(router *routing.Router) *routing.MLD {
+	if s.overlayCellSizes == nil {
+		return nil
+	}
+	mld, err := routing.NewMLD(router, s.overlayCellSizes)
+	if err != nil {
+		log.Printf("Warning: Failed to build overlay: %v", err)
+		return nil
+	}
+	mld.SetProfiles(s.overlayProfiles())
+	return mld
+}
+
+// usesOverlay reports whether a request can be answered on the overlay: a
+// single route with a stored profile as it is, departing now
+func (req *RouteRequest) usesOverlay(avoid *routing.AvoidAreas) bool {
+	return req.Alternatives == 0 && !req.Unidirectional && avoid == nil && req.DepartAt == nil && req.CustomModel == nil &&
+		req.AvoidTolls == nil && req.AvoidHighways == nil && req.AvoidFerries == nil && req.AvoidTunnels == nil &&
+		req.AllowUturns == nil && req.MaxSpeed == nil && req.Weighting == nil
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/routing"
+)
+
+// maxProfileSize limits the size of profile documents sent to the API
+const maxProfileSize = 1 << 20
+
+// WatchProfiles reloads the profiles when their files change, polling every
+// pollInterval if poll is set or file notifications are unavailable. It
+// returns a function that stops watching.
+func (s *Server) WatchProfiles(pollInterval time.Duration, poll bool) func() {
+	return s.profileManager.Watch(pollInterval, poll, s.refreshOverlayProfiles)
+}
+
+// HandleProfileStatus reports the loaded profiles and the outcome of the last reload
+func (s *Server) HandleProfileStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"code":     "Ok",
+		"profiles": s.profileManager.Status(),
+	})
+}
+
+// profileHandler routes profile requests to the appropriate handler
+func (s *Server) profileHandler(w http.ResponseWriter, r *http.Request) {
+	pathParts := splitPath(r.URL.Path)
+
+	switch {
+	case len(pathParts) == 1:
+		// /profiles - list all profiles
+		s.HandleListProfiles(w, r)
+	case len(pathParts) == 2 && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
+		// PUT/PATCH /profiles/{name} - create, replace or change profile
+		s.HandleSaveProfile(w, r, pathParts[1])
+	case len(pathParts) == 2 && r.Method == http.MethodDelete:
+		// DELETE /profiles/{name} - delete profile
+		s.HandleDeleteProfile(w, r, pathParts[1])
+	case len(pathParts) == 2:
+		// /profiles/{name} - get specific profile
+		s.HandleGetProfile(w, r)
+	case len(pathParts) == 3 && pathParts[2] == "history":
+		// GET /profiles/{name}/history - list previous versions
+		s.HandleProfileHistory(w, r, pathParts[1])
+	case len(pathParts) == 3 && pathParts[2] == "rollback":
+		// POST /profiles/{name}/rollback - restore a previous version
+		s.HandleRollbackProfile(w, r, pathParts[1])
+	default:
+		s.sendError(w, http.StatusNotFound, "not_found", "Invalid profile endpoint")
+	}
+}
+
+// HandleSaveProfile creates or replaces a profile (PUT) or applies a merge
+// patch to it (PATCH). Bodies are YAML or JSON.
+func (s *Server) HandleSaveProfile(w http.ResponseWriter, r *http.Request, name string) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProfileSize))
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, "invalid_request", "Failed to read request body: "+err.Error())
+		return
+	}
+
+	var change *routing.ProfileChange
+	if r.Method == http.MethodPut {
+		change, err = s.profileManager.SaveProfile(name, body, profileCondition(r))
+	} else {
+		change, err = s.profileManager.PatchProfile(name, body, profileCondition(r))
+	}
+	if err != nil {
+		s.sendProfileError(w, err)
+		return
+	}
+	s.refreshOverlayProfiles()
+	log.Printf("Profile %s saved by %s", name, actorOf(r))
+
+	status := http.StatusOK
+	if change.Created {
+		status = http.StatusCreated
+	}
+	s.sendProfileChange(w, status, name, change)
+}
+
+// HandleDeleteProfile deletes a profile; it can be restored with a rollback
+func (s *Server) HandleDeleteProfile(w http.ResponseWriter, r *http.Request, name string) {
+	if err := s.profileManager.DeleteProfile(name, profileCondition(r)); err != nil {
+		s.sendProfileError(w, err)
+		return
+	}
+	s.refreshOverlayProfiles()
+	log.Printf("Profile %s deleted by %s", name, actorOf(r))
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"code":    "Ok",
+		"message": "Profile deleted",
+	})
+}
+
+// HandleProfileHistory lists the previous versions of a profile
+func (s *Server) HandleProfileHistory(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET method is allowed")
+		return
+	}
+
+	history, err := s.profileManager.ProfileHistory(name)
+	if err != nil {
+		s.sendProfileError(w, err)
+		return
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"code":      "Ok",
+		"name":      name,
+		"revisions": history,
+		"count":     len(history),
+	})
+}
+
+// HandleRollbackProfile restores a previous version of a profile
+func (s *Server) HandleRollbackProfile(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+
+	var req struct {
+		Revision int `json:"revision"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON request")
+		return
+	}
+
+	change, err := s.profileManager.RollbackProfile(name, req.Revision, profileCondition(r))
+	if err != nil {
+		s.sendProfileError(w, err)
+		return
+	}
+	s.refreshOverlayProfiles()
+	log.Printf("Profile %s rolled back to revision %d by %s", name, req.Revision, actorOf(r))
+
+	s.sendProfileChange(w, http.StatusOK, name, change)
+}
+
+// profileCondition returns the preconditions of a profile change from the request headers
+func profileCondition(r *http.Request) routing.ProfileCondition {
+	return routing.ProfileCondition{
+		IfMatch:     r.Header.Get("If-Match"),
+		IfNoneMatch: r.Header.Get("If-None-Match"),
+	}
+}
+
+// sendProfileChange responds with a changed profile, its version and ETag
+func (s *Server) sendProfileChange(w http.ResponseWriter, status int, name string, change *routing.ProfileChange) {
+	w.Header().Set("ETag", change.ETag)
+	s.sendJSON(w, status, map[string]interface{}{
+		"code":    "Ok",
+		"name":    name,
+		"version": change.Profile.Version,
+		"etag":    change.ETag,
+		"profile": change.Profile,
+	})
+}
+
+// sendProfileError responds with the status matching a profile change error
+func (s *Server) sendProfileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, routing.ErrProfileNotFound):
+		s.sendError(w, http.StatusNotFound, "profile_not_found", err.Error())
+	case errors.Is(err, routing.ErrInvalidProfile):
+		s.sendError(w, http.StatusBadRequest, "invalid_profile", err.Error())
+	case errors.Is(err, routing.ErrProfileInUse):
+		s.sendError(w, http.StatusConflict, "profile_in_use", err.Error())
+	case errors.Is(err, routing.ErrProfileModified):
+		s.sendError(w, http.StatusPreconditionFailed, "precondition_failed", err.Error())
+	default:
+		s.sendError(w, http.StatusInternalServerError, "profile_write_failed", err.Error())
+	}
+}
@@ -0,0 +1,275 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/ev"
+	"github.com/vamosdalian/nav/internal/graph"
+	"github.com/vamosdalian/nav/internal/routing"
+	"github.com/vamosdalian/nav/internal/storage"
+)
+
+// ErrReloadInProgress is returned when a reload is requested while another one runs
+var ErrReloadInProgress = errors.New("a graph reload is already in progress")
+
+// ReloadHook prepares components that hold the graph (closures, traffic,
+// journal, ...) for a new graph. It runs right before the swap, once the graph
+// has been loaded, validated and indexed. An error aborts the reload.
+type ReloadHook func(g *graph.Graph) error
+
+// GraphInfo describes the graph in use
+type GraphInfo struct {
+	Version    int               `json:"version"`               // Incremented on every reload
+	Source     string            `json:"source,omitempty"`      // File the graph was loaded from
+	ModifiedAt *time.Time        `json:"modified_at,omitempty"` // Modification time of the file
+	Format     int               `json:"format,omitempty"`      // Graph file format version
+	Layout     storage.Layout    `json:"layout,omitempty"`      // compressed or mapped
+	Metadata   *storage.Metadata `json:"metadata,omitempty"`    // Header of version 2 files
+	LoadedAt   time.Time         `json:"loaded_at"`             // When the graph was swapped in
+	LoadTimeMs int64             `json:"load_time_ms"`          // Time to load and validate the file
+	Nodes      int               `json:"nodes"`
+	Edges      int               `json:"edges"`
+}
+
+// ReloadStatus reports the state of graph reloads
+type ReloadStatus struct {
+	InProgress  bool       `json:"in_progress"`
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// ReloadRequest optionally names the file to load: the graph file or one of its snapshots
+type ReloadRequest struct {
+	Path string `json:"path,omitempty"`
+}
+
+// graphState is everything that must be swapped together when the graph changes.
+// Requests load it once and use it until they finish.
+type graphState struct {
+	graph    *graph.Graph
+	router   *routing.Router
+	stations []ev.Station // Charging stations snapped to the graph
+	mld      *routing.MLD // Multi-level overlay of the graph (optional)
+	info     GraphInfo
+}
+
+// current returns the graph state in use
+func (s *Server) current() *graphState {
+	return s.state.Load()
+}
+
+// SetReloadHook sets the hook run on a new graph before it is swapped in
+func (s *Server) SetReloadHook(hook ReloadHook) {
+	s.reloadHook = hook
+}
+
+// SetGraphSource records where the initial graph came from and how long it took to load
+func (s *Server) SetGraphSource(path string, loadTime time.Duration) {
+	st := s.current()
+	next := *st
+	next.info = s.describe(st.graph, path, loadTime)
+	next.info.Version = st.info.Version
+	s.state.Store(&next)
+}
+
+// GraphInfo returns information about the graph in use
+func (s *Server) GraphInfo() GraphInfo {
+	return s.current().info
+}
+
+// ReloadStatus returns the state of graph reloads
+func (s *Server) ReloadStatus() ReloadStatus {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	return s.reloadStatus
+}
+
+// ReloadGraph loads a graph file, validates it and swaps it in. Requests
+// already running finish on the previous graph. An empty path reloads the
+// configured graph file.
+func (s *Server) ReloadGraph(path string) (GraphInfo, error) {
+	if !s.reloadMutex.TryLock() {
+		return GraphInfo{}, ErrReloadInProgress
+	}
+	defer s.reloadMutex.Unlock()
+	return s.reloadGraph(path)
+}
+
+// reloadGraph does the work of ReloadGraph (caller holds reloadMutex)
+func (s *Server) reloadGraph(path string) (GraphInfo, error) {
+	s.setReloadStatus(true, nil)
+
+	info, err := s.swapGraph(path)
+	s.setReloadStatus(false, err)
+	if err != nil {
+		log.Printf("Graph reload failed: %v", err)
+		return GraphInfo{}, err
+	}
+	log.Printf("Reloaded graph version %d from %s in %dms (%d nodes, %d edges)",
+		info.Version, info.Source, info.LoadTimeMs, info.Nodes, info.Edges)
+	return info, nil
+}
+
+func (s *Server) swapGraph(path string) (GraphInfo, error) {
+	if s.storage == nil {
+		return GraphInfo{}, fmt.Errorf("no graph file configured")
+	}
+	path, err := s.reloadPath(path)
+	if err != nil {
+		return GraphInfo{}, err
+	}
+
+	start := time.Now()
+	g, err := storage.NewStorage(path).Load()
+	if err != nil {
+		return GraphInfo{}, err
+	}
+	if err := g.Validate(); err != nil {
+		return GraphInfo{}, fmt.Errorf("invalid graph: %w", err)
+	}
+	loadTime := time.Since(start)
+
+	old := s.current()
+	router := old.router.WithGraph(g)
+	next := &graphState{
+		graph:    g,
+		router:   router,
+		stations: s.snapStations(g),
+		mld:      s.buildOverlay(router),
+		info:     s.describe(g, path, loadTime),
+	}
+	next.info.Version = old.info.Version + 1
+
+	// Rebind the stores right before the swap, so requests on the old graph
+	// see them bound to it for as short a time as possible
+	if s.reloadHook != nil {
+		if err := s.reloadHook(g); err != nil {
+			return GraphInfo{}, err
+		}
+		if next.mld != nil {
+			next.mld.Refresh() // Its customization may have started with the old bindings
+		}
+	}
+	s.state.Store(next)
+	return next.info, nil
+}
+
+// reloadPath resolves the file to reload: the graph file or one of its snapshots
+func (s *Server) reloadPath(path string) (string, error) {
+	if path == "" || path == s.storage.Path() {
+		return s.storage.Path(), nil
+	}
+	snapshots, err := s.storage.Snapshots()
+	if err != nil {
+		return "", err
+	}
+	for _, snapshot := range snapshots {
+		if snapshot == path {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s is neither the graph file nor one of its snapshots", path)
+}
+
+// describe builds the information about a loaded graph
+func (s *Server) describe(g *graph.Graph, path string, loadTime time.Duration) GraphInfo {
+	info := GraphInfo{
+		Source:     path,
+		LoadedAt:   time.Now().UTC(),
+		LoadTimeMs: loadTime.Milliseconds(),
+		Nodes:      g.NodeCount(),
+		Edges:      g.EdgeCount(),
+	}
+	if stat, err := os.Stat(path); err == nil {
+		modified := stat.ModTime().UTC()
+		info.ModifiedAt = &modified
+	}
+	if file, err := storage.Info(path); err == nil {
+		info.Format = file.Version
+		info.Layout = file.Layout
+		info.Metadata = file.Metadata
+	}
+	return info
+}
+
+// snapStations snaps the OSM and extra charging stations to a graph
+func (s *Server) snapStations(g *graph.Graph) []ev.Station {
+	stations := ev.FromGraph(g.ChargingStations())
+	stations = append(stations, s.extraStations...)
+	return ev.Snap(g, stations)
+}
+
+func (s *Server) setReloadStatus(inProgress bool, err error) {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+
+	s.reloadStatus.InProgress = inProgress
+	if inProgress {
+		now := time.Now().UTC()
+		s.reloadStatus.LastAttempt = &now
+		return
+	}
+	s.reloadStatus.LastError = ""
+	if err != nil {
+		s.reloadStatus.LastError = err.Error()
+	}
+}
+
+// HandleReload loads a new graph file in the background and swaps it in.
+// With wait=true the response is sent once the reload has finished.
+func (s *Server) HandleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+	if s.storage == nil {
+		s.sendError(w, http.StatusServiceUnavailable, "reload_disabled", "No graph file configured")
+		return
+	}
+
+	var req ReloadRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON request")
+			return
+		}
+	}
+	if _, err := s.reloadPath(req.Path); err != nil {
+		s.sendError(w, http.StatusBadRequest, "invalid_path", err.Error())
+		return
+	}
+
+	if !s.reloadMutex.TryLock() {
+		s.sendError(w, http.StatusConflict, "reload_in_progress", ErrReloadInProgress.Error())
+		return
+	}
+
+	if r.URL.Query().Get("wait") != "true" {
+		go func() {
+			defer s.reloadMutex.Unlock()
+			s.reloadGraph(req.Path)
+		}()
+		s.sendJSON(w, http.StatusAccepted, map[string]interface{}{
+			"code":    "Ok",
+			"message": "Graph reload started",
+		})
+		return
+	}
+
+	info, err := s.reloadGraph(req.Path)
+	s.reloadMutex.Unlock()
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "reload_failed", err.Error())
+		return
+	}
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"code":  "Ok",
+		"graph": info,
+	})
+}
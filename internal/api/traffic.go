@@ -0,0 +1,124 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/vamosdalian/nav/internal/datex"
+	"github.com/vamosdalian/nav/internal/routing"
+	"github.com/vamosdalian/nav/internal/traffic"
+)
+
+// SetTrafficStore sets the live traffic store used by the API and the router
+func (s *Server) SetTrafficStore(store *traffic.Store) {
+	s.traffic = store
+	s.current().router.SetTraffic(speedSource{store})
+}
+
+// speedSource hands searches the live speeds in effect when they start
+type speedSource struct {
+	store *traffic.Store
+}
+
+// Speeds returns the live speeds in effect now
+func (t speedSource) Speeds() routing.SpeedProvider {
+	return t.store.Speeds()
+}
+
+// trafficHandler routes traffic requests to the appropriate handler
+func (s *Server) trafficHandler(w http.ResponseWriter, r *http.Request) {
+	if s.traffic == nil {
+		s.sendError(w, http.StatusServiceUnavailable, "traffic_disabled", "Live traffic is not enabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.HandleTrafficStatus(w, r)
+	case http.MethodPost:
+		s.HandleIngestTraffic(w, r)
+	case http.MethodDelete:
+		s.HandleResetTraffic(w, r)
+	default:
+		s.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET, POST and DELETE methods are allowed")
+	}
+}
+
+// HandleIngestTraffic applies a batch of speed observations (CSV or JSON)
+func (s *Server) HandleIngestTraffic(w http.ResponseWriter, r *http.Request) {
+	var observations []traffic.Observation
+	var err error
+
+	if strings.Contains(r.Header.Get("Content-Type"), "csv") || r.URL.Query().Get("format") == "csv" {
+		observations, err = traffic.ParseCSV(r.Body)
+	} else {
+		observations, err = traffic.ParseJSON(r.Body)
+	}
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	result, err := s.traffic.Apply(observations)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, "invalid_observation", err.Error())
+		return
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"code":    "Ok",
+		"result":  result,
+		"traffic": s.traffic.Status(),
+	})
+}
+
+// HandleTrafficStatus reports the age of the traffic data
+func (s *Server) HandleTrafficStatus(w http.ResponseWriter, r *http.Request) {
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"code":    "Ok",
+		"traffic": s.traffic.Status(),
+	})
+}
+
+// HandleResetTraffic removes all speed overrides
+func (s *Server) HandleResetTraffic(w http.ResponseWriter, r *http.Request) {
+	removed := s.traffic.Reset()
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"code":    "Ok",
+		"removed": removed,
+	})
+}
+
+// SetDatexFeed sets the DATEX II incident feed
+func (s *Server) SetDatexFeed(feed *datex.Feed) {
+	s.datex = feed
+}
+
+// HandleIngestDatex decodes a DATEX II publication and applies its incidents
+func (s *Server) HandleIngestDatex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
+		return
+	}
+	if s.datex == nil {
+		s.sendError(w, http.StatusServiceUnavailable, "datex_disabled", "DATEX II ingestion is not enabled")
+		return
+	}
+
+	incidents, skipped, err := datex.Parse(r.Body)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	applied := s.datex.Ingest(incidents)
+	if skipped == nil {
+		skipped = []datex.Skipped{}
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"code":      "Ok",
+		"incidents": applied,
+		"skipped":   skipped,
+	})
+}
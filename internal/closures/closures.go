@@ -0,0 +1,163 @@
+package closures
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/geo"
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// Closure types
+const (
+	TypeWay     = "way"     // All edges of an OSM way, both directions
+	TypeEdge    = "edge"    // A single directed edge between two nodes
+	TypePolygon = "polygon" // All edges touching a polygon
+	TypePath    = "path"    // Directed edges along a sequence of nodes
+)
+
+var (
+	// ErrNotFound is returned when a closure ID does not exist
+	ErrNotFound = errors.New("closure not found")
+	// ErrExists is returned when a closure ID is already taken
+	ErrExists = errors.New("closure already exists")
+)
+
+// Closure blocks roads for a time window
+type Closure struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	OSMWayID  int64           `json:"osm_way_id,omitempty"` // TypeWay
+	From      int64           `json:"from,omitempty"`       // TypeEdge: from node ID
+	To        int64           `json:"to,omitempty"`         // TypeEdge: to node ID
+	Geometry  json.RawMessage `json:"geometry,omitempty"`   // TypePolygon: GeoJSON Polygon/MultiPolygon
+	Nodes     []int64         `json:"nodes,omitempty"`      // TypePath: node IDs along the closed road
+	Start     *time.Time      `json:"start,omitempty"`      // Closed from (default: immediately)
+	End       *time.Time      `json:"end,omitempty"`        // Closed until (default: indefinitely)
+	Reason    string          `json:"reason,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ActiveAt reports whether the closure is in effect at a given time
+func (c *Closure) ActiveAt(t time.Time) bool {
+	if c.Start != nil && t.Before(*c.Start) {
+		return false
+	}
+	return c.End == nil || t.Before(*c.End)
+}
+
+// ExpiredAt reports whether the closure has ended before a given time
+func (c *Closure) ExpiredAt(t time.Time) bool {
+	return c.End != nil && !t.Before(*c.End)
+}
+
+// Validate checks that the closure is complete and consistent
+func (c *Closure) Validate() error {
+	switch c.Type {
+	case TypeWay:
+		if c.OSMWayID == 0 {
+			return fmt.Errorf("osm_way_id is required for way closures")
+		}
+	case TypeEdge:
+		if c.From == 0 || c.To == 0 {
+			return fmt.Errorf("from and to are required for edge closures")
+		}
+	case TypePolygon:
+		if len(c.Geometry) == 0 {
+			return fmt.Errorf("geometry is required for polygon closures")
+		}
+		if _, err := geo.ParsePolygons(c.Geometry); err != nil {
+			return err
+		}
+	case TypePath:
+		if len(c.Nodes) < 2 {
+			return fmt.Errorf("at least 2 nodes are required for path closures")
+		}
+	default:
+		return fmt.Errorf("unknown closure type %q (expected way, edge, polygon or path)", c.Type)
+	}
+
+	if c.Start != nil && c.End != nil && !c.End.After(*c.Start) {
+		return fmt.Errorf("end must be after start")
+	}
+	return nil
+}
+
+// edgeKey identifies a directed edge
+type edgeKey struct {
+	from, to int64
+}
+
+// resolveEdges returns the directed edges an edge, path or polygon closure applies to.
+// Way closures are matched by way ID and do not need resolving.
+func resolveEdges(g *graph.Graph, c *Closure) ([]edgeKey, error) {
+	switch c.Type {
+	case TypeWay:
+		if g.CountEdgesByWay(c.OSMWayID) == 0 {
+			return nil, fmt.Errorf("no edges found for way %d", c.OSMWayID)
+		}
+		return nil, nil
+
+	case TypeEdge:
+		if _, exists := g.EdgeBetween(c.From, c.To); !exists {
+			return nil, fmt.Errorf("no edge from node %d to node %d", c.From, c.To)
+		}
+		return []edgeKey{{from: c.From, to: c.To}}, nil
+
+	case TypePath:
+		keys := make([]edgeKey, 0, len(c.Nodes)-1)
+		for i := 0; i < len(c.Nodes)-1; i++ {
+			if _, exists := g.EdgeBetween(c.Nodes[i], c.Nodes[i+1]); !exists {
+				return nil, fmt.Errorf("no edge from node %d to node %d", c.Nodes[i], c.Nodes[i+1])
+			}
+			keys = append(keys, edgeKey{from: c.Nodes[i], to: c.Nodes[i+1]})
+		}
+		return keys, nil
+
+	case TypePolygon:
+		polygons, err := geo.ParsePolygons(c.Geometry)
+		if err != nil {
+			return nil, err
+		}
+
+		bounds := make([]geo.BBox, len(polygons))
+		for i := range polygons {
+			bounds[i] = polygons[i].Bounds()
+		}
+		index := geo.NewIndex(bounds)
+
+		var keys []edgeKey
+		for _, nodeID := range g.NodeIDs() {
+			from, _ := g.GetNode(nodeID)
+			for _, edge := range g.GetEdges(nodeID) {
+				to, err := g.GetNode(edge.To)
+				if err != nil {
+					continue
+				}
+				hit := false
+				index.Search(geo.SegmentBBox(from.Lon, from.Lat, to.Lon, to.Lat), func(item int) bool {
+					hit = polygons[item].IntersectsSegment(from.Lon, from.Lat, to.Lon, to.Lat)
+					return !hit
+				})
+				if hit {
+					keys = append(keys, edgeKey{from: edge.From, to: edge.To})
+				}
+			}
+		}
+		return keys, nil
+	}
+	return nil, nil
+}
+
+// newID returns a random closure ID
+func newID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,414 @@
+package closures
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/atomicfile"
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// Store keeps the road closures, indexes them for the router and persists
+// them to a JSON file so they survive restarts. Expired closures are dropped
+// whenever the store changes or is listed.
+type Store struct {
+	path     string
+	graph    *graph.Graph
+	entries  map[string]*entry
+	byWay    map[int64][]*entry
+	byEdge   map[edgeKey][]*entry
+	mutex    sync.RWMutex
+	now      func() time.Time
+	onChange func()
+	timer    *time.Timer            // Fires at the next start or end of a closure
+	active   atomic.Pointer[Active] // Closures in effect; nil after a change
+}
+
+// Active is an immutable set of the closures in effect at a point in time.
+// Lookups take no lock, so a search takes the set once and queries it per edge.
+type Active struct {
+	ways  map[int64]struct{}
+	edges map[edgeKey]struct{}
+	from  time.Time // The set is valid from this time until the next closure starts or ends
+	until time.Time // Zero if no closure starts or ends later
+}
+
+// entry is a closure with the edges it was resolved to
+type entry struct {
+	closure Closure
+	edges   []edgeKey
+}
+
+// NewStore creates a closure store persisted at path (no persistence if empty)
+func NewStore(path string, g *graph.Graph) *Store {
+	return &Store{
+		path:    path,
+		graph:   g,
+		entries: make(map[string]*entry),
+		byWay:   make(map[int64][]*entry),
+		byEdge:  make(map[edgeKey][]*entry),
+		now:     time.Now,
+	}
+}
+
+// Load reads persisted closures; a missing file is not an error.
+// Closures that expired or no longer match the graph are skipped.
+func (s *Store) Load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read closures: %w", err)
+	}
+
+	var list []Closure
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed to decode closures: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	for _, c := range list {
+		if c.ExpiredAt(now) {
+			continue
+		}
+		edges, err := resolveEdges(s.graph, &c)
+		if err != nil {
+			log.Printf("Warning: Skipping closure %s: %v", c.ID, err)
+			continue
+		}
+		s.insert(&entry{closure: c, edges: edges})
+	}
+	s.changed()
+	return nil
+}
+
+// OnChange sets a function called whenever the closures in effect change:
+// closures are added, deleted or rebound to a new graph, or a closure starts
+// or ends. It is called on its own goroutine.
+func (s *Store) OnChange(fn func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onChange = fn
+	s.schedule()
+}
+
+// Add validates, stores and persists a new closure, assigning an ID if needed
+func (s *Store) Add(c Closure) (Closure, error) {
+	if err := c.Validate(); err != nil {
+		return Closure{}, err
+	}
+
+	if c.ExpiredAt(s.now()) {
+		return Closure{}, fmt.Errorf("closure has already ended")
+	}
+
+	edges, err := resolveEdges(s.currentGraph(), &c)
+	if err != nil {
+		return Closure{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if c.ID == "" {
+		c.ID = newID()
+	} else if _, exists := s.entries[c.ID]; exists {
+		return Closure{}, fmt.Errorf("%w: %s", ErrExists, c.ID)
+	}
+	c.CreatedAt = s.now().UTC()
+
+	s.insert(&entry{closure: c, edges: edges})
+	s.purgeExpired()
+
+	if err := s.save(); err != nil {
+		s.remove(c.ID)
+		return Closure{}, err
+	}
+	s.changed()
+	return c, nil
+}
+
+// SetGraph switches the store to a new graph and resolves the closures
+// against it. Closures that no longer match the graph are dropped, as on Load.
+func (s *Store) SetGraph(g *graph.Graph) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old := s.entries
+	s.graph = g
+	s.entries = make(map[string]*entry)
+	s.byWay = make(map[int64][]*entry)
+	s.byEdge = make(map[edgeKey][]*entry)
+
+	for id, e := range old {
+		edges, err := resolveEdges(g, &e.closure)
+		if err != nil {
+			log.Printf("Warning: Dropping closure %s: %v", id, err)
+			continue
+		}
+		s.insert(&entry{closure: e.closure, edges: edges})
+	}
+	s.changed()
+}
+
+// currentGraph returns the graph closures are resolved against
+func (s *Store) currentGraph() *graph.Graph {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.graph
+}
+
+// Delete removes a closure and persists the change
+func (s *Store) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.entries[id]; !exists {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	s.remove(id)
+	s.purgeExpired()
+	s.changed()
+	return s.save()
+}
+
+// Get returns a closure by ID
+func (s *Store) Get(id string) (Closure, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	e, exists := s.entries[id]
+	if !exists {
+		return Closure{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return e.closure, nil
+}
+
+// List returns all closures that have not expired, ordered by creation time
+func (s *Store) List() []Closure {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.purgeExpired() > 0 {
+		if err := s.save(); err != nil {
+			log.Printf("Warning: Failed to save closures: %v", err)
+		}
+		s.changed()
+	}
+
+	list := make([]Closure, 0, len(s.entries))
+	for _, e := range s.entries {
+		list = append(list, e.closure)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// EdgeCount returns the number of directed edges a closure applies to
+func (s *Store) EdgeCount(id string) int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	e, exists := s.entries[id]
+	if !exists {
+		return 0
+	}
+	if e.closure.Type == TypeWay {
+		return s.graph.CountEdgesByWay(e.closure.OSMWayID)
+	}
+	return len(e.edges)
+}
+
+// IsClosed reports whether an edge is blocked by an active closure.
+// Searches should take the Active set once instead.
+func (s *Store) IsClosed(edge *graph.Edge) bool {
+	return s.Active().IsClosed(edge)
+}
+
+// Active returns the closures in effect now. The set is shared until the
+// closures change or one of them starts or ends.
+func (s *Store) Active() *Active {
+	now := s.now()
+	if a := s.active.Load(); a != nil && !now.Before(a.from) && (a.until.IsZero() || now.Before(a.until)) {
+		return a
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	a := &Active{ways: make(map[int64]struct{}), edges: make(map[edgeKey]struct{}), from: now}
+	for _, e := range s.entries {
+		if e.closure.ActiveAt(now) {
+			if e.closure.Type == TypeWay {
+				a.ways[e.closure.OSMWayID] = struct{}{}
+			}
+			for _, key := range e.edges {
+				a.edges[key] = struct{}{}
+			}
+		}
+		for _, t := range []*time.Time{e.closure.Start, e.closure.End} {
+			if t != nil && t.After(now) && (a.until.IsZero() || t.Before(a.until)) {
+				a.until = *t
+			}
+		}
+	}
+	s.active.Store(a)
+	return a
+}
+
+// IsClosed reports whether an edge is blocked by one of the closures
+func (a *Active) IsClosed(edge *graph.Edge) bool {
+	if _, closed := a.ways[edge.OSMWayID]; closed {
+		return true
+	}
+	_, closed := a.edges[edgeKey{from: edge.From, to: edge.To}]
+	return closed
+}
+
+// changed notifies the change listener and schedules the next notification
+// (caller holds the lock)
+func (s *Store) changed() {
+	s.active.Store(nil)
+	if s.onChange != nil {
+		go s.onChange()
+	}
+	s.schedule()
+}
+
+// schedule sets the timer to the next start or end of a closure, when the
+// closures in effect change without a call to the store (caller holds the lock)
+func (s *Store) schedule() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.onChange == nil {
+		return
+	}
+
+	now := s.now()
+	var next time.Time
+	for _, e := range s.entries {
+		for _, t := range []*time.Time{e.closure.Start, e.closure.End} {
+			if t != nil && t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = *t
+			}
+		}
+	}
+	if !next.IsZero() {
+		s.timer = time.AfterFunc(next.Sub(now), s.transition)
+	}
+}
+
+// transition drops the closures that ended and notifies the change listener
+func (s *Store) transition() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.purgeExpired() > 0 {
+		if err := s.save(); err != nil {
+			log.Printf("Warning: Failed to save closures: %v", err)
+		}
+	}
+	s.changed()
+}
+
+// insert adds an entry to the indexes (caller holds the lock)
+func (s *Store) insert(e *entry) {
+	s.entries[e.closure.ID] = e
+	if e.closure.Type == TypeWay {
+		s.byWay[e.closure.OSMWayID] = append(s.byWay[e.closure.OSMWayID], e)
+	}
+	for _, key := range e.edges {
+		s.byEdge[key] = append(s.byEdge[key], e)
+	}
+}
+
+// remove drops an entry from the indexes (caller holds the lock)
+func (s *Store) remove(id string) {
+	e, exists := s.entries[id]
+	if !exists {
+		return
+	}
+	delete(s.entries, id)
+
+	if e.closure.Type == TypeWay {
+		s.byWay[e.closure.OSMWayID] = without(s.byWay[e.closure.OSMWayID], e)
+		if len(s.byWay[e.closure.OSMWayID]) == 0 {
+			delete(s.byWay, e.closure.OSMWayID)
+		}
+	}
+	for _, key := range e.edges {
+		s.byEdge[key] = without(s.byEdge[key], e)
+		if len(s.byEdge[key]) == 0 {
+			delete(s.byEdge, key)
+		}
+	}
+}
+
+// purgeExpired removes closures whose end time has passed (caller holds the lock)
+func (s *Store) purgeExpired() int {
+	now := s.now()
+	count := 0
+	for id, e := range s.entries {
+		if e.closure.ExpiredAt(now) {
+			s.remove(id)
+			count++
+		}
+	}
+	return count
+}
+
+// save writes all closures to disk atomically (caller holds the lock)
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	list := make([]Closure, 0, len(s.entries))
+	for _, e := range s.entries {
+		list = append(list, e.closure)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode closures: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(s.path, data); err != nil {
+		return fmt.Errorf("failed to save closures: %w", err)
+	}
+	return nil
+}
+
+// without returns entries without e
+func without(entries []*entry, e *entry) []*entry {
+	result := entries[:0]
+	for _, other := range entries {
+		if other != e {
+			result = append(result, other)
+		}
+	}
+	return result
+}
@@ -0,0 +1,211 @@
+package closures
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// createTestGraph creates a two-way road 1-2-3 (way 100) and a one-way road 3-4 (way 200)
+func createTestGraph() *graph.Graph {
+	g := graph.NewGraph()
+	g.AddNode(&graph.Node{ID: 1, Lat: 43.0, Lon: 7.0})
+	g.AddNode(&graph.Node{ID: 2, Lat: 43.0, Lon: 7.01})
+	g.AddNode(&graph.Node{ID: 3, Lat: 43.0, Lon: 7.02})
+	g.AddNode(&graph.Node{ID: 4, Lat: 43.0, Lon: 7.03})
+
+	g.AddEdge(graph.Edge{From: 1, To: 2, Weight: 800, OSMWayID: 100})
+	g.AddEdge(graph.Edge{From: 2, To: 1, Weight: 800, OSMWayID: 100})
+	g.AddEdge(graph.Edge{From: 2, To: 3, Weight: 800, OSMWayID: 100})
+	g.AddEdge(graph.Edge{From: 3, To: 2, Weight: 800, OSMWayID: 100})
+	g.AddEdge(graph.Edge{From: 3, To: 4, Weight: 800, OSMWayID: 200})
+	return g
+}
+
+func TestStoreClosureTypes(t *testing.T) {
+	g := createTestGraph()
+	store := NewStore("", g)
+
+	edge := func(from, to, way int64) *graph.Edge {
+		return &graph.Edge{From: from, To: to, OSMWayID: way}
+	}
+
+	if _, err := store.Add(Closure{Type: TypeEdge, From: 2, To: 3}); err != nil {
+		t.Fatalf("Failed to add edge closure: %v", err)
+	}
+	if !store.IsClosed(edge(2, 3, 100)) || store.IsClosed(edge(3, 2, 100)) {
+		t.Error("Expected edge closure to block only 2->3")
+	}
+
+	polygon := `{"type": "Polygon", "coordinates": [[[7.025, 42.99], [7.035, 42.99], [7.035, 43.01], [7.025, 43.01], [7.025, 42.99]]]}`
+	c, err := store.Add(Closure{Type: TypePolygon, Geometry: []byte(polygon), Reason: "market"})
+	if err != nil {
+		t.Fatalf("Failed to add polygon closure: %v", err)
+	}
+	if store.EdgeCount(c.ID) != 1 || !store.IsClosed(edge(3, 4, 200)) {
+		t.Errorf("Expected polygon closure to block edge 3->4, got %d edges", store.EdgeCount(c.ID))
+	}
+
+	if _, err := store.Add(Closure{Type: TypeWay, OSMWayID: 999}); err == nil {
+		t.Error("Expected error for unknown way")
+	}
+	if _, err := store.Add(Closure{ID: c.ID, Type: TypeWay, OSMWayID: 100}); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected ErrExists for duplicate ID, got %v", err)
+	}
+
+	if err := store.Delete(c.ID); err != nil {
+		t.Fatalf("Failed to delete closure: %v", err)
+	}
+	if store.IsClosed(edge(3, 4, 200)) {
+		t.Error("Expected edge 3->4 to be open after deleting the closure")
+	}
+}
+
+func TestStoreValidityWindowAndPersistence(t *testing.T) {
+	g := createTestGraph()
+	path := filepath.Join(t.TempDir(), "closures.json")
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	start := now.Add(time.Hour)
+	end := now.Add(2 * time.Hour)
+
+	store := NewStore(path, g)
+	store.now = func() time.Time { return now }
+
+	c, err := store.Add(Closure{Type: TypeWay, OSMWayID: 100, Start: &start, End: &end, Reason: "roadworks"})
+	if err != nil {
+		t.Fatalf("Failed to add closure: %v", err)
+	}
+
+	edge := &graph.Edge{From: 1, To: 2, OSMWayID: 100}
+	if store.IsClosed(edge) {
+		t.Error("Expected closure to be inactive before its start")
+	}
+
+	// Reload from disk during the closure window
+	reloaded := NewStore(path, g)
+	reloaded.now = func() time.Time { return now.Add(90 * time.Minute) }
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Failed to load closures: %v", err)
+	}
+	got, err := reloaded.Get(c.ID)
+	if err != nil || got.Reason != "roadworks" {
+		t.Fatalf("Expected persisted closure, got %+v (%v)", got, err)
+	}
+	if !reloaded.IsClosed(edge) {
+		t.Error("Expected closure to be active during its window")
+	}
+
+	// Expired closures are dropped
+	reloaded.now = func() time.Time { return end }
+	if reloaded.IsClosed(edge) {
+		t.Error("Expected closure to be inactive after its end")
+	}
+	if list := reloaded.List(); len(list) != 0 {
+		t.Errorf("Expected expired closure to be purged, got %d", len(list))
+	}
+}
+
+func TestStoreSetGraph(t *testing.T) {
+	store := NewStore("", createTestGraph())
+	if _, err := store.Add(Closure{Type: TypeEdge, From: 3, To: 4}); err != nil {
+		t.Fatalf("Failed to add closure: %v", err)
+	}
+	if _, err := store.Add(Closure{Type: TypeWay, OSMWayID: 100}); err != nil {
+		t.Fatalf("Failed to add closure: %v", err)
+	}
+
+	// The new graph no longer has the one-way road 3-4
+	g := graph.NewGraph()
+	g.AddNode(&graph.Node{ID: 1, Lat: 43.0, Lon: 7.0})
+	g.AddNode(&graph.Node{ID: 2, Lat: 43.0, Lon: 7.01})
+	g.AddEdge(graph.Edge{From: 1, To: 2, Weight: 800, OSMWayID: 100})
+	store.SetGraph(g)
+
+	if len(store.List()) != 1 {
+		t.Errorf("Expected the closure of the removed edge to be dropped, got %d closures", len(store.List()))
+	}
+	if !store.IsClosed(&graph.Edge{From: 1, To: 2, OSMWayID: 100}) {
+		t.Error("Expected way 100 to stay closed on the new graph")
+	}
+	if _, err := store.Add(Closure{Type: TypeEdge, From: 3, To: 4}); err == nil {
+		t.Error("Expected new closures to be resolved against the new graph")
+	}
+}
+
+func TestStoreActiveSnapshots(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	start := now.Add(time.Hour)
+
+	store := NewStore("", createTestGraph())
+	store.now = func() time.Time { return now }
+	if _, err := store.Add(Closure{Type: TypeEdge, From: 2, To: 3}); err != nil {
+		t.Fatalf("Failed to add closure: %v", err)
+	}
+	if _, err := store.Add(Closure{Type: TypeWay, OSMWayID: 200, Start: &start}); err != nil {
+		t.Fatalf("Failed to add closure: %v", err)
+	}
+
+	active := store.Active()
+	if store.Active() != active {
+		t.Error("Expected the set to be shared until a closure starts or ends")
+	}
+	edge := &graph.Edge{From: 3, To: 4, OSMWayID: 200}
+	if !active.IsClosed(&graph.Edge{From: 2, To: 3, OSMWayID: 100}) || active.IsClosed(edge) {
+		t.Error("Expected only the edge closure to be in effect")
+	}
+
+	// A set taken earlier is not affected by changes
+	if _, err := store.Add(Closure{Type: TypeWay, OSMWayID: 100}); err != nil {
+		t.Fatalf("Failed to add closure: %v", err)
+	}
+	if active.IsClosed(&graph.Edge{From: 1, To: 2, OSMWayID: 100}) {
+		t.Error("Expected a taken set not to change")
+	}
+
+	now = start
+	if !store.Active().IsClosed(edge) {
+		t.Error("Expected the way closure to be in effect once it started")
+	}
+}
+
+func TestStoreNotifiesChanges(t *testing.T) {
+	store := NewStore("", createTestGraph())
+	changes := make(chan struct{}, 10)
+	store.OnChange(func() { changes <- struct{}{} })
+
+	wait := func(what string) {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected a change notification when %s", what)
+		}
+	}
+
+	start := time.Now().Add(50 * time.Millisecond)
+	end := start.Add(50 * time.Millisecond)
+	if _, err := store.Add(Closure{Type: TypeWay, OSMWayID: 100, Start: &start, End: &end}); err != nil {
+		t.Fatalf("Failed to add closure: %v", err)
+	}
+	wait("the closure is added")
+
+	edge := &graph.Edge{From: 1, To: 2, OSMWayID: 100}
+	wait("the closure starts")
+	if !store.IsClosed(edge) {
+		t.Error("Expected closure to be active after the start notification")
+	}
+	wait("the closure ends")
+	if store.IsClosed(edge) || len(store.List()) != 0 {
+		t.Error("Expected closure to be purged after the end notification")
+	}
+
+	select {
+	case <-changes:
+		t.Error("Expected no further notifications")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
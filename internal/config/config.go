@@ -3,26 +3,69 @@ package config
 import (
 	"fmt"
 	"os"
+	"runtime"
 	"strconv"
+	"strings"
 )
 
 // Config holds application configuration
 type Config struct {
-	ServerPort    string
-	OSMDataPath   string
-	GraphDataPath string
-	LogLevel      string
+	ServerPort        string
+	OSMDataPath       string
+	GraphDataPath     string
+	GraphLayout       string // Layout of graph files written after parsing: compressed or mapped
+	ElevationDataPath string // Directory with SRTM .hgt / GeoTIFF tiles (optional)
+	EVStationsPath    string // CSV file with additional charging stations (optional)
+	ProfilesDir       string // Directory of routing profile YAML files
+	ProfilesWatch     string // How profile file changes are picked up: auto, poll or off
+	ProfilesPollSecs  int    // Poll interval of the profile directory when polling
+	ClosuresPath      string // JSON file where road closures are persisted
+	TrafficFile       string // CSV/JSON file polled for traffic observations (optional)
+	TrafficPollSecs   int    // Poll interval of the traffic file
+	TrafficTTLSecs    int    // Default validity of traffic observations
+	SpeedProfilesPath string // Historical speed profiles (default: next to the graph file)
+	JournalPath       string // JSON Lines audit log of runtime weight changes
+	SearchMaxNodes    int    // Most nodes a route search may settle
+	SearchTimeoutMs   int    // Longest a route search may run (0 = no limit)
+	SearchConcurrency int    // Most route searches running at once (0 = no limit)
+	MLDEnabled        bool   // Answer plain route requests on a multi-level overlay
+	MLDCellSizes      []int  // Most nodes per overlay cell on each level, smallest first
+	MLDRefreshSecs    int    // Interval of periodic overlay customization for historical speeds (0 = only on changes)
+	LogLevel          string
 }
 
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	config := &Config{
-		ServerPort:    getEnv("PORT", "8080"),
-		OSMDataPath:   getEnv("OSM_DATA_PATH", ""),
-		GraphDataPath: getEnv("GRAPH_DATA_PATH", "graph.bin.snappy"),
-		LogLevel:      getEnv("LOG_LEVEL", "info"),
+		ServerPort:        getEnv("PORT", "8080"),
+		OSMDataPath:       getEnv("OSM_DATA_PATH", ""),
+		GraphDataPath:     getEnv("GRAPH_DATA_PATH", "graph.bin.snappy"),
+		GraphLayout:       getEnv("GRAPH_LAYOUT", "compressed"),
+		ElevationDataPath: getEnv("ELEVATION_DATA_PATH", ""),
+		EVStationsPath:    getEnv("EV_STATIONS_PATH", ""),
+		ProfilesDir:       getEnv("PROFILES_DIR", "./profiles"),
+		ProfilesWatch:     getEnv("PROFILES_WATCH", "auto"),
+		ProfilesPollSecs:  getEnvInt("PROFILES_POLL_INTERVAL", 5),
+		ClosuresPath:      getEnv("CLOSURES_PATH", "closures.json"),
+		TrafficFile:       getEnv("TRAFFIC_FILE", ""),
+		TrafficPollSecs:   getEnvInt("TRAFFIC_POLL_INTERVAL", 30),
+		TrafficTTLSecs:    getEnvInt("TRAFFIC_TTL", 600),
+		SpeedProfilesPath: getEnv("SPEED_PROFILES_PATH", ""),
+		JournalPath:       getEnv("JOURNAL_PATH", "changes.jsonl"),
+		SearchMaxNodes:    getEnvInt("SEARCH_MAX_NODES", 1000000),
+		SearchTimeoutMs:   getEnvInt("SEARCH_TIMEOUT_MS", 10000),
+		SearchConcurrency: getEnvInt("SEARCH_MAX_CONCURRENT", runtime.NumCPU()),
+		MLDEnabled:        getEnvBool("MLD_ENABLED", false),
+		MLDRefreshSecs:    getEnvInt("MLD_REFRESH_INTERVAL", 300),
+		LogLevel:          getEnv("LOG_LEVEL", "info"),
 	}
 
+	cellSizes, err := getEnvInts("MLD_CELL_SIZES", []int{256, 4096, 65536})
+	if err != nil {
+		return nil, err
+	}
+	config.MLDCellSizes = cellSizes
+
 	return config, nil
 }
 
@@ -42,6 +85,22 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvInts(key string, defaultValue []int) ([]int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	var values []int
+	for _, field := range strings.Split(value, ",") {
+		intValue, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a comma-separated list of integers, got %q", key, value)
+		}
+		values = append(values, intValue)
+	}
+	return values, nil
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -56,5 +115,20 @@ func (c *Config) Validate() error {
 	if c.OSMDataPath == "" && c.GraphDataPath == "" {
 		return fmt.Errorf("either OSM_DATA_PATH or GRAPH_DATA_PATH must be set")
 	}
+	if c.GraphLayout != "compressed" && c.GraphLayout != "mapped" {
+		return fmt.Errorf("GRAPH_LAYOUT must be compressed or mapped, got %q", c.GraphLayout)
+	}
+	if c.SearchMaxNodes < 0 || c.SearchTimeoutMs < 0 || c.SearchConcurrency < 0 {
+		return fmt.Errorf("SEARCH_MAX_NODES, SEARCH_TIMEOUT_MS and SEARCH_MAX_CONCURRENT must not be negative")
+	}
+	if c.MLDRefreshSecs < 0 {
+		return fmt.Errorf("MLD_REFRESH_INTERVAL must not be negative")
+	}
+	if c.ProfilesWatch != "auto" && c.ProfilesWatch != "poll" && c.ProfilesWatch != "off" {
+		return fmt.Errorf("PROFILES_WATCH must be auto, poll or off, got %q", c.ProfilesWatch)
+	}
+	if c.ProfilesWatch != "off" && c.ProfilesPollSecs <= 0 {
+		return fmt.Errorf("PROFILES_POLL_INTERVAL must be positive")
+	}
 	return nil
 }
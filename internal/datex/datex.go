@@ -0,0 +1,184 @@
+package datex
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/openlr"
+	"github.com/vamosdalian/nav/internal/xmltree"
+)
+
+// Incident types
+const (
+	TypeClosure  = "closure"
+	TypeSlowdown = "slowdown"
+)
+
+// defaultSlowdownKmh is the speed assumed for lane closures and roadworks without a measured speed
+const defaultSlowdownKmh = 30.0
+
+// closureValues are DATEX II enumeration values that block the road completely
+var closureValues = map[string]bool{
+	"roadClosed":                    true,
+	"carriagewayClosures":           true,
+	"closedPermanentlyForTheWinter": true,
+	"roadBlocked":                   true,
+	"carriagewayBlocked":            true,
+	"blocked":                       true,
+}
+
+// slowdownValues are DATEX II abnormal traffic types with their assumed speeds (km/h)
+var slowdownValues = map[string]float64{
+	"stationaryTraffic": 5,
+	"queuingTraffic":    10,
+	"slowTraffic":       20,
+	"heavyTraffic":      30,
+}
+
+// slowdownRecords are record types that reduce speed when they do not close the road
+var slowdownRecords = map[string]bool{
+	"MaintenanceWorks":                  true,
+	"ConstructionWorks":                 true,
+	"Roadworks":                         true,
+	"RoadOrCarriagewayOrLaneManagement": true,
+	"Accident":                          true,
+	"VehicleObstruction":                true,
+	"GeneralObstruction":                true,
+}
+
+// Incident is a DATEX II situation record that affects routing
+type Incident struct {
+	ID       string
+	Type     string  // TypeClosure or TypeSlowdown
+	SpeedKmh float64 // Expected speed for slowdowns
+	Start    *time.Time
+	End      *time.Time
+	Reason   string
+	Location *openlr.LineLocation
+}
+
+// Skipped is a situation record that was not turned into an incident
+type Skipped struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// Parse reads the situation records of a DATEX II publication (v2 or v3)
+func Parse(r io.Reader) ([]Incident, []Skipped, error) {
+	root, err := xmltree.Parse(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records := root.FindAll("situationRecord")
+	if len(records) == 0 && root.Find("situation") == nil {
+		return nil, nil, fmt.Errorf("no DATEX II situations found")
+	}
+
+	var incidents []Incident
+	var skipped []Skipped
+	for _, record := range records {
+		incident, err := parseRecord(record)
+		if err != nil {
+			skipped = append(skipped, Skipped{ID: record.Attr("id"), Reason: err.Error()})
+			continue
+		}
+		incidents = append(incidents, incident)
+	}
+	return incidents, skipped, nil
+}
+
+// parseRecord turns a situation record into an incident
+func parseRecord(record *xmltree.Node) (Incident, error) {
+	incident := Incident{ID: record.Attr("id")}
+	if incident.ID == "" {
+		return incident, fmt.Errorf("record has no id")
+	}
+
+	if status := record.FindText("validityStatus"); status == "suspended" {
+		return incident, fmt.Errorf("record is suspended")
+	}
+
+	var err error
+	if incident.Start, err = parseTime(record.FindText("overallStartTime")); err != nil {
+		return incident, err
+	}
+	if incident.End, err = parseTime(record.FindText("overallEndTime")); err != nil {
+		return incident, err
+	}
+
+	recordType := record.Attr("type")
+	if i := strings.LastIndex(recordType, ":"); i >= 0 {
+		recordType = recordType[i+1:]
+	}
+
+	switch {
+	case hasValue(record, closureValues):
+		incident.Type = TypeClosure
+	case speedOf(record) > 0:
+		incident.Type = TypeSlowdown
+		incident.SpeedKmh = speedOf(record)
+	case slowdownRecords[recordType]:
+		incident.Type = TypeSlowdown
+		incident.SpeedKmh = defaultSlowdownKmh
+	default:
+		return incident, fmt.Errorf("record type %q does not affect routing", recordType)
+	}
+
+	incident.Reason = recordType
+	if comment := record.Find("generalPublicComment"); comment != nil {
+		if text := comment.FindText("value"); text != "" {
+			incident.Reason += ": " + text
+		}
+	}
+
+	if incident.Location, err = openlr.FromXML(record); err != nil {
+		return incident, err
+	}
+	return incident, nil
+}
+
+// hasValue reports whether any element below n has one of the values
+func hasValue(n *xmltree.Node, values map[string]bool) bool {
+	if values[n.Text()] {
+		return true
+	}
+	for _, child := range n.Children {
+		if hasValue(child, values) {
+			return true
+		}
+	}
+	return false
+}
+
+// speedOf returns a measured speed or the speed implied by the abnormal traffic type (0 if none)
+func speedOf(record *xmltree.Node) float64 {
+	for _, name := range []string{"averageVehicleSpeed", "speed"} {
+		if n := record.Find(name); n != nil {
+			if text := n.FindText("speed"); text != "" {
+				if speed, err := strconv.ParseFloat(text, 64); err == nil && speed >= 0 {
+					return speed
+				}
+			}
+			if speed, err := strconv.ParseFloat(n.Text(), 64); err == nil && speed >= 0 {
+				return speed
+			}
+		}
+	}
+	return slowdownValues[record.FindText("abnormalTrafficType")]
+}
+
+// parseTime parses an optional RFC 3339 timestamp
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q", value)
+	}
+	return &t, nil
+}
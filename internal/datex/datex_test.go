@@ -0,0 +1,109 @@
+package datex
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/closures"
+	"github.com/vamosdalian/nav/internal/graph"
+	"github.com/vamosdalian/nav/internal/openlr"
+	"github.com/vamosdalian/nav/internal/traffic"
+)
+
+// createTestGraph creates a two-way primary road 1-6 along latitude 52 (way 100)
+func createTestGraph() *graph.Graph {
+	g := graph.NewGraph()
+	for i := int64(1); i <= 6; i++ {
+		g.AddNode(&graph.Node{ID: i, Lat: 52.0, Lon: 13.0 + float64(i-1)*0.002})
+	}
+	for i := int64(1); i < 6; i++ {
+		a, _ := g.GetNode(i)
+		b, _ := g.GetNode(i + 1)
+		distance := graph.HaversineDistance(a.Lat, a.Lon, b.Lat, b.Lon)
+		tags := map[string]string{"highway": "primary"}
+		g.AddEdge(graph.Edge{From: i, To: i + 1, Weight: distance, OSMWayID: 100, MaxSpeed: 13.89, Tags: tags})
+		g.AddEdge(graph.Edge{From: i + 1, To: i, Weight: distance, OSMWayID: 100, MaxSpeed: 13.89, Tags: tags, Reverse: true})
+	}
+	return g
+}
+
+func loadSample(t *testing.T) ([]Incident, []Skipped) {
+	file, err := os.Open("testdata/situations.xml")
+	if err != nil {
+		t.Fatalf("Failed to open sample: %v", err)
+	}
+	defer file.Close()
+
+	incidents, skipped, err := Parse(file)
+	if err != nil {
+		t.Fatalf("Failed to parse sample: %v", err)
+	}
+	return incidents, skipped
+}
+
+func TestParseSituations(t *testing.T) {
+	incidents, skipped := loadSample(t)
+
+	if len(incidents) != 2 {
+		t.Fatalf("Expected 2 incidents, got %d", len(incidents))
+	}
+	if len(skipped) != 1 || skipped[0].ID != "REC-FOG" {
+		t.Errorf("Expected fog record to be skipped, got %+v", skipped)
+	}
+
+	closure := incidents[0]
+	if closure.ID != "REC-CLOSURE" || closure.Type != TypeClosure || closure.Start == nil || closure.End != nil {
+		t.Errorf("Unexpected closure incident %+v", closure)
+	}
+	if closure.Reason != "RoadOrCarriagewayOrLaneManagement: Main Street closed until further notice" {
+		t.Errorf("Unexpected reason %q", closure.Reason)
+	}
+
+	slowdown := incidents[1]
+	if slowdown.Type != TypeSlowdown || slowdown.SpeedKmh != 10 || len(slowdown.Location.Points) != 2 {
+		t.Errorf("Unexpected slowdown incident %+v", slowdown)
+	}
+}
+
+func TestFeedAppliesIncidents(t *testing.T) {
+	g := createTestGraph()
+	closureStore := closures.NewStore("", g)
+	trafficStore := traffic.NewStore(g, 10*time.Minute)
+
+	feed := NewFeed(openlr.NewDecoder(g), closureStore, trafficStore)
+	feed.now = func() time.Time { return time.Date(2025, 6, 1, 8, 30, 0, 0, time.UTC) }
+
+	incidents, _ := loadSample(t)
+	for _, result := range feed.Ingest(incidents) {
+		if result.Error != "" {
+			t.Errorf("Incident %s failed: %s", result.ID, result.Error)
+		}
+	}
+
+	// Closure of the eastbound road, minus the first edge covered by the positive offset
+	closure, err := closureStore.Get("datex-REC-CLOSURE")
+	if err != nil {
+		t.Fatalf("Expected closure from DATEX record: %v", err)
+	}
+	if len(closure.Nodes) != 5 || closure.Nodes[0] != 2 || closure.Nodes[4] != 6 {
+		t.Errorf("Expected closure nodes 2..6, got %v", closure.Nodes)
+	}
+
+	// Queue on the westbound road from node 6 to node 3
+	for _, edge := range []graph.Edge{{From: 6, To: 5}, {From: 4, To: 3}} {
+		if speed, ok := trafficStore.Speed(&edge); !ok || speed*3.6 < 9.9 || speed*3.6 > 10.1 {
+			t.Errorf("Expected 10 km/h on %d->%d, got %.1f (%v)", edge.From, edge.To, speed*3.6, ok)
+		}
+	}
+	if _, ok := trafficStore.Speed(&graph.Edge{From: 3, To: 2}); ok {
+		t.Error("Expected no slowdown on 3->2")
+	}
+
+	// Publishing again replaces the closure instead of failing on the duplicate ID
+	for _, result := range feed.Ingest(incidents[:1]) {
+		if result.Error != "" {
+			t.Errorf("Re-ingesting %s failed: %s", result.ID, result.Error)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package datex
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/closures"
+	"github.com/vamosdalian/nav/internal/graph"
+	"github.com/vamosdalian/nav/internal/openlr"
+	"github.com/vamosdalian/nav/internal/traffic"
+)
+
+// closureIDPrefix marks closures created from DATEX II records
+const closureIDPrefix = "datex-"
+
+// Feed map-matches incidents and applies them: closures go to the closure
+// store, slowdowns become speed overrides in the traffic store
+type Feed struct {
+	decoder  *openlr.Decoder
+	closures *closures.Store
+	traffic  *traffic.Store
+	now      func() time.Time
+	mutex    sync.RWMutex // Guards decoder
+}
+
+// Applied describes the outcome for a single incident
+type Applied struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Edges int    `json:"edges"`
+	Error string `json:"error,omitempty"`
+}
+
+// NewFeed creates a feed; either store may be nil to ignore that incident type
+func NewFeed(decoder *openlr.Decoder, closureStore *closures.Store, trafficStore *traffic.Store) *Feed {
+	return &Feed{
+		decoder:  decoder,
+		closures: closureStore,
+		traffic:  trafficStore,
+		now:      time.Now,
+	}
+}
+
+// SetDecoder replaces the location decoder, e.g. after the graph was reloaded
+func (f *Feed) SetDecoder(decoder *openlr.Decoder) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.decoder = decoder
+}
+
+// Ingest applies incidents to routing. A closure with the same record ID replaces
+// the previous one, so repeated publications update instead of duplicating.
+func (f *Feed) Ingest(incidents []Incident) []Applied {
+	f.mutex.RLock()
+	decoder := f.decoder
+	f.mutex.RUnlock()
+
+	results := make([]Applied, 0, len(incidents))
+
+	for _, incident := range incidents {
+		result := Applied{ID: incident.ID, Type: incident.Type}
+
+		edges, err := decoder.Decode(incident.Location)
+		if err == nil {
+			switch incident.Type {
+			case TypeClosure:
+				err = f.applyClosure(&incident, edges)
+			case TypeSlowdown:
+				err = f.applySlowdown(&incident, edges)
+			}
+		}
+
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Edges = len(edges)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// applyClosure stores a path closure for the matched edges
+func (f *Feed) applyClosure(incident *Incident, edges []graph.Edge) error {
+	if f.closures == nil {
+		return fmt.Errorf("closures are not enabled")
+	}
+
+	id := closureIDPrefix + incident.ID
+	if err := f.closures.Delete(id); err != nil && !errors.Is(err, closures.ErrNotFound) {
+		return err
+	}
+
+	_, err := f.closures.Add(closures.Closure{
+		ID:     id,
+		Type:   closures.TypePath,
+		Nodes:  pathNodes(edges),
+		Start:  incident.Start,
+		End:    incident.End,
+		Reason: incident.Reason,
+	})
+	return err
+}
+
+// applySlowdown adds speed overrides for the matched edges until the incident ends
+func (f *Feed) applySlowdown(incident *Incident, edges []graph.Edge) error {
+	if f.traffic == nil {
+		return fmt.Errorf("traffic is not enabled")
+	}
+
+	// Speed overrides apply immediately, so future slowdowns wait for a later publication
+	if incident.Start != nil && incident.Start.After(f.now()) {
+		return fmt.Errorf("incident has not started yet")
+	}
+
+	ttl := 0.0 // Store default
+	if incident.End != nil {
+		ttl = incident.End.Sub(f.now()).Seconds()
+		if ttl <= 0 {
+			return fmt.Errorf("incident has already ended")
+		}
+	}
+
+	observations := make([]traffic.Observation, len(edges))
+	for i, edge := range edges {
+		observations[i] = traffic.Observation{From: edge.From, To: edge.To, SpeedKmh: incident.SpeedKmh, TTL: ttl}
+	}
+	_, err := f.traffic.Apply(observations)
+	return err
+}
+
+// pathNodes returns the node sequence of a connected edge path
+func pathNodes(edges []graph.Edge) []int64 {
+	if len(edges) == 0 {
+		return nil
+	}
+	nodes := []int64{edges[0].From}
+	for _, edge := range edges {
+		nodes = append(nodes, edge.To)
+	}
+	return nodes
+}
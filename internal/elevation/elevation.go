@@ -0,0 +1,193 @@
+package elevation
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// Tile is a raster of elevation samples covering a geographic area
+type Tile interface {
+	// Contains reports whether the coordinates fall inside the tile
+	Contains(lat, lon float64) bool
+	// Elevation returns the interpolated elevation in meters (false for voids)
+	Elevation(lat, lon float64) (float64, bool)
+}
+
+// Store looks up elevations from SRTM .hgt and GeoTIFF tiles in a directory.
+// HGT tiles are located by file name and loaded on first use; GeoTIFF bounds
+// are read from the file headers when the store is opened.
+type Store struct {
+	dir      string
+	hgtFiles map[string]string // "N43E007" -> path
+	geoTIFFs []*geoTIFFFile
+	tiles    map[string]Tile
+	mutex    sync.Mutex
+}
+
+// Open indexes the elevation tiles in a directory
+func Open(dir string) (*Store, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read elevation directory: %w", err)
+	}
+
+	s := &Store{
+		dir:      dir,
+		hgtFiles: make(map[string]string),
+		tiles:    make(map[string]Tile),
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".hgt":
+			key := strings.ToUpper(strings.TrimSuffix(name, filepath.Ext(name)))
+			s.hgtFiles[key] = path
+		case ".tif", ".tiff":
+			tiff, err := openGeoTIFF(path)
+			if err != nil {
+				log.Printf("Warning: skipping GeoTIFF %s: %v", path, err)
+				continue
+			}
+			s.geoTIFFs = append(s.geoTIFFs, tiff)
+		}
+	}
+
+	if len(s.hgtFiles) == 0 && len(s.geoTIFFs) == 0 {
+		return nil, fmt.Errorf("no .hgt or GeoTIFF tiles found in %s", dir)
+	}
+
+	return s, nil
+}
+
+// TileCount returns the number of indexed tiles
+func (s *Store) TileCount() int {
+	return len(s.hgtFiles) + len(s.geoTIFFs)
+}
+
+// Elevation returns the elevation in meters at the given coordinates
+func (s *Store) Elevation(lat, lon float64) (float64, bool) {
+	tile := s.tileFor(lat, lon)
+	if tile == nil {
+		return 0, false
+	}
+	return tile.Elevation(lat, lon)
+}
+
+// tileFor finds (and loads if needed) the tile covering a coordinate
+func (s *Store) tileFor(lat, lon float64) Tile {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Points on a whole degree are also covered by the edge of the tile below/left
+	south, west := math.Floor(lat), math.Floor(lon)
+	for _, origin := range [][2]float64{{south, west}, {south - 1, west}, {south, west - 1}, {south - 1, west - 1}} {
+		if (origin[0] != south && lat != south) || (origin[1] != west && lon != west) {
+			continue
+		}
+		if tile := s.hgtTile(origin[0], origin[1]); tile != nil {
+			return tile
+		}
+	}
+
+	for _, tiff := range s.geoTIFFs {
+		if tiff.Contains(lat, lon) {
+			if err := tiff.load(); err != nil {
+				log.Printf("Warning: failed to load %s: %v", tiff.path, err)
+				continue
+			}
+			return tiff
+		}
+	}
+
+	return nil
+}
+
+// hgtTile returns the loaded SRTM tile with the given south-west corner (must be called with lock held)
+func (s *Store) hgtTile(south, west float64) Tile {
+	key := hgtName(south, west)
+	if tile, loaded := s.tiles[key]; loaded {
+		return tile
+	}
+
+	path, exists := s.hgtFiles[key]
+	if !exists {
+		return nil
+	}
+
+	tile, err := loadHGT(path, south, west)
+	if err != nil {
+		log.Printf("Warning: failed to load %s: %v", path, err)
+		s.tiles[key] = nil
+		return nil
+	}
+	s.tiles[key] = tile
+	return tile
+}
+
+// hgtName returns the SRTM tile name covering a coordinate, e.g. "N43E007"
+func hgtName(lat, lon float64) string {
+	latDeg := int(math.Floor(lat))
+	lonDeg := int(math.Floor(lon))
+
+	ns, ew := 'N', 'E'
+	if latDeg < 0 {
+		ns = 'S'
+		latDeg = -latDeg
+	}
+	if lonDeg < 0 {
+		ew = 'W'
+		lonDeg = -lonDeg
+	}
+	return fmt.Sprintf("%c%02d%c%03d", ns, latDeg, ew, lonDeg)
+}
+
+// Assign looks up and stores the elevation of every node in the graph.
+// It returns the number of nodes that received an elevation.
+func Assign(g *graph.Graph, s *Store) int {
+	assigned := 0
+	for _, id := range g.NodeIDs() {
+		node, err := g.GetNode(id)
+		if err != nil {
+			continue
+		}
+		if elevation, ok := s.Elevation(node.Lat, node.Lon); ok {
+			if err := g.SetElevation(id, elevation); err == nil {
+				assigned++
+			}
+		}
+	}
+	return assigned
+}
+
+// bilinear interpolates between four samples, skipping voids
+func bilinear(v00, v10, v01, v11, fx, fy float64, isVoid func(float64) bool) (float64, bool) {
+	values := [4]float64{v00, v10, v01, v11}
+	weights := [4]float64{(1 - fx) * (1 - fy), fx * (1 - fy), (1 - fx) * fy, fx * fy}
+
+	var sum, weightSum float64
+	for i, v := range values {
+		if isVoid(v) {
+			continue
+		}
+		sum += v * weights[i]
+		weightSum += weights[i]
+	}
+
+	if weightSum == 0 {
+		return 0, false
+	}
+	return sum / weightSum, true
+}
@@ -0,0 +1,121 @@
+package elevation
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// writeHGT writes a 3x3 sample tile; rows are ordered north to south
+func writeHGT(t *testing.T, dir, name string, samples []int16) {
+	data := make([]byte, len(samples)*2)
+	for i, v := range samples {
+		binary.BigEndian.PutUint16(data[i*2:], uint16(v))
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		t.Fatalf("Failed to write tile: %v", err)
+	}
+}
+
+func TestHGTElevation(t *testing.T) {
+	dir := t.TempDir()
+	writeHGT(t, dir, "N43E007.hgt", []int16{
+		200, 200, 200,
+		100, 100, 100,
+		0, 0, hgtVoid,
+	})
+
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	tests := []struct {
+		lat, lon float64
+		expected float64
+	}{
+		{44.0, 7.0, 200},   // North-west corner
+		{43.5, 7.5, 100},   // Center
+		{43.75, 7.25, 150}, // Between rows
+		{43.0, 7.0, 0},     // South-west corner
+	}
+	for _, tc := range tests {
+		elevation, ok := store.Elevation(tc.lat, tc.lon)
+		if !ok {
+			t.Errorf("No elevation at (%.2f, %.2f)", tc.lat, tc.lon)
+			continue
+		}
+		if math.Abs(elevation-tc.expected) > 1e-6 {
+			t.Errorf("Elevation at (%.2f, %.2f): expected %.1f, got %.1f", tc.lat, tc.lon, tc.expected, elevation)
+		}
+	}
+
+	if _, ok := store.Elevation(43.0, 8.0); ok {
+		t.Error("Expected void sample to have no elevation")
+	}
+	if _, ok := store.Elevation(45.5, 7.5); ok {
+		t.Error("Expected no elevation outside of available tiles")
+	}
+}
+
+func TestAssignAndProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeHGT(t, dir, "N43E007.hgt", []int16{
+		200, 200, 200,
+		100, 100, 100,
+		0, 0, 0,
+	})
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	g := graph.NewGraph()
+	g.AddNode(&graph.Node{ID: 1, Lat: 43.0, Lon: 7.2})
+	g.AddNode(&graph.Node{ID: 2, Lat: 44.0, Lon: 7.2})
+	g.AddNode(&graph.Node{ID: 3, Lat: 43.5, Lon: 7.2})
+
+	if assigned := Assign(g, store); assigned != 3 {
+		t.Fatalf("Expected 3 nodes with elevation, got %d", assigned)
+	}
+
+	profile := ProfileForRoute(g, []int64{1, 2, 3})
+	if profile == nil {
+		t.Fatal("Expected elevation profile")
+	}
+	if math.Abs(profile.Ascent-200) > 1e-6 || math.Abs(profile.Descent-100) > 1e-6 {
+		t.Errorf("Expected ascent 200 / descent 100, got %.1f / %.1f", profile.Ascent, profile.Descent)
+	}
+	if len(profile.Points) != 3 || profile.Points[2][1] != 100 {
+		t.Errorf("Unexpected profile points: %v", profile.Points)
+	}
+}
+
+func TestProfileSkipsUnknownElevations(t *testing.T) {
+	g := graph.NewGraph()
+	g.AddNode(&graph.Node{ID: 1, Lat: 43.0, Lon: 7.2})
+	g.AddNode(&graph.Node{ID: 2, Lat: 43.1, Lon: 7.2})
+	g.AddNode(&graph.Node{ID: 3, Lat: 43.2, Lon: 7.2})
+	if err := g.SetElevation(1, 200); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.SetElevation(3, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	// Node 2 lies outside the elevation tiles: neither edge has a known climb
+	profile := ProfileForRoute(g, []int64{1, 2, 3})
+	if profile == nil {
+		t.Fatal("Expected elevation profile")
+	}
+	if profile.Ascent != 0 || profile.Descent != 0 {
+		t.Errorf("Expected no climb next to a node without elevation, got %.1f / %.1f", profile.Ascent, profile.Descent)
+	}
+	if len(profile.Points) != 2 || profile.Points[1][1] != 100 {
+		t.Errorf("Expected points only for nodes with elevation, got %v", profile.Points)
+	}
+}
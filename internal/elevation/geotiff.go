@@ -0,0 +1,417 @@
+package elevation
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TIFF tags used by the reader
+const (
+	tagImageWidth      = 256
+	tagImageLength     = 257
+	tagBitsPerSample   = 258
+	tagCompression     = 259
+	tagStripOffsets    = 273
+	tagSamplesPerPixel = 277
+	tagRowsPerStrip    = 278
+	tagStripByteCounts = 279
+	tagTileWidth       = 322
+	tagTileLength      = 323
+	tagTileOffsets     = 324
+	tagTileByteCounts  = 325
+	tagSampleFormat    = 339
+	tagModelPixelScale = 33550
+	tagModelTiepoint   = 33922
+	tagGeoKeyDirectory = 34735
+	tagGDALNoData      = 42113
+)
+
+// GeoKeys used by the reader
+const (
+	geoKeyModelType  = 1024
+	geoKeyRasterType = 1025
+
+	modelTypeGeographic = 2
+	rasterPixelIsPoint  = 2
+)
+
+// Sample formats
+const (
+	sampleFormatUint  = 1
+	sampleFormatInt   = 2
+	sampleFormatFloat = 3
+)
+
+// geoTIFFFile is a single-band, uncompressed GeoTIFF in geographic coordinates
+// (EPSG:4326), the format produced by most DEM download services
+type geoTIFFFile struct {
+	path  string
+	order binary.ByteOrder
+
+	width, height      int
+	west, north        float64 // Coordinates of the raster's top-left corner
+	scaleX, scaleY     float64 // Degrees per pixel
+	pixelIsPoint       bool
+	noData             float64
+	hasNoData          bool
+	bitsPerSample      int
+	sampleFormat       int
+	tiled              bool
+	blockWidth         int
+	blockHeight        int
+	offsets, byteCount []uint64
+
+	once    sync.Once
+	loadErr error
+	raster  []float32
+}
+
+// openGeoTIFF parses the TIFF header and georeferencing of a file
+func openGeoTIFF(path string) (*geoTIFFFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 8)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	t := &geoTIFFFile{path: path}
+	switch string(header[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+	if t.order.Uint16(header[2:]) != 42 {
+		return nil, fmt.Errorf("unsupported TIFF variant (BigTIFF is not supported)")
+	}
+
+	entries, err := t.readIFD(f, int64(t.order.Uint32(header[4:])))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.parseTags(entries); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ifdEntry holds the decoded values of a TIFF tag
+type ifdEntry struct {
+	numbers []float64
+	text    string
+}
+
+// readIFD reads the first image file directory
+func (t *geoTIFFFile) readIFD(f *os.File, offset int64) (map[uint16]ifdEntry, error) {
+	countBuf := make([]byte, 2)
+	if _, err := f.ReadAt(countBuf, offset); err != nil {
+		return nil, fmt.Errorf("failed to read IFD: %w", err)
+	}
+	count := int(t.order.Uint16(countBuf))
+
+	raw := make([]byte, count*12)
+	if _, err := f.ReadAt(raw, offset+2); err != nil {
+		return nil, fmt.Errorf("failed to read IFD entries: %w", err)
+	}
+
+	entries := make(map[uint16]ifdEntry, count)
+	for i := 0; i < count; i++ {
+		e := raw[i*12 : (i+1)*12]
+		tag := t.order.Uint16(e[0:])
+		typ := t.order.Uint16(e[2:])
+		n := int(t.order.Uint32(e[4:]))
+
+		size := typeSize(typ)
+		if size == 0 {
+			continue // Unsupported type, not needed
+		}
+
+		data := e[8:12]
+		if size*n > 4 {
+			data = make([]byte, size*n)
+			if _, err := f.ReadAt(data, int64(t.order.Uint32(e[8:]))); err != nil {
+				return nil, fmt.Errorf("failed to read tag %d: %w", tag, err)
+			}
+		}
+
+		entries[tag] = t.decodeValues(typ, n, data)
+	}
+
+	return entries, nil
+}
+
+func typeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	}
+	return 0
+}
+
+func (t *geoTIFFFile) decodeValues(typ uint16, n int, data []byte) ifdEntry {
+	if typ == 2 {
+		return ifdEntry{text: strings.TrimRight(string(data[:n]), "\x00")}
+	}
+
+	values := make([]float64, n)
+	for i := 0; i < n; i++ {
+		switch typ {
+		case 1, 7:
+			values[i] = float64(data[i])
+		case 6:
+			values[i] = float64(int8(data[i]))
+		case 3:
+			values[i] = float64(t.order.Uint16(data[i*2:]))
+		case 8:
+			values[i] = float64(int16(t.order.Uint16(data[i*2:])))
+		case 4:
+			values[i] = float64(t.order.Uint32(data[i*4:]))
+		case 9:
+			values[i] = float64(int32(t.order.Uint32(data[i*4:])))
+		case 11:
+			values[i] = float64(math.Float32frombits(t.order.Uint32(data[i*4:])))
+		case 12:
+			values[i] = math.Float64frombits(t.order.Uint64(data[i*8:]))
+		case 5:
+			values[i] = float64(t.order.Uint32(data[i*8:])) / float64(t.order.Uint32(data[i*8+4:]))
+		case 10:
+			values[i] = float64(int32(t.order.Uint32(data[i*8:]))) / float64(int32(t.order.Uint32(data[i*8+4:])))
+		}
+	}
+	return ifdEntry{numbers: values}
+}
+
+// parseTags validates the image layout and extracts georeferencing
+func (t *geoTIFFFile) parseTags(entries map[uint16]ifdEntry) error {
+	first := func(tag uint16, def float64) float64 {
+		if e, ok := entries[tag]; ok && len(e.numbers) > 0 {
+			return e.numbers[0]
+		}
+		return def
+	}
+
+	t.width = int(first(tagImageWidth, 0))
+	t.height = int(first(tagImageLength, 0))
+	if t.width == 0 || t.height == 0 {
+		return fmt.Errorf("missing image dimensions")
+	}
+	if compression := first(tagCompression, 1); compression != 1 {
+		return fmt.Errorf("compressed GeoTIFFs are not supported (compression=%v)", compression)
+	}
+	if samples := first(tagSamplesPerPixel, 1); samples != 1 {
+		return fmt.Errorf("only single-band rasters are supported")
+	}
+
+	t.bitsPerSample = int(first(tagBitsPerSample, 16))
+	t.sampleFormat = int(first(tagSampleFormat, sampleFormatUint))
+	switch {
+	case t.sampleFormat == sampleFormatFloat && (t.bitsPerSample == 32 || t.bitsPerSample == 64):
+	case t.sampleFormat != sampleFormatFloat && (t.bitsPerSample == 8 || t.bitsPerSample == 16 || t.bitsPerSample == 32):
+	default:
+		return fmt.Errorf("unsupported sample type (%d bits, format %d)", t.bitsPerSample, t.sampleFormat)
+	}
+
+	// Strip or tile layout
+	if _, ok := entries[tagTileOffsets]; ok {
+		t.tiled = true
+		t.blockWidth = int(first(tagTileWidth, 0))
+		t.blockHeight = int(first(tagTileLength, 0))
+		t.offsets = toUint64(entries[tagTileOffsets].numbers)
+		t.byteCount = toUint64(entries[tagTileByteCounts].numbers)
+	} else {
+		t.blockWidth = t.width
+		t.blockHeight = int(first(tagRowsPerStrip, float64(t.height)))
+		t.offsets = toUint64(entries[tagStripOffsets].numbers)
+		t.byteCount = toUint64(entries[tagStripByteCounts].numbers)
+	}
+	if t.blockWidth == 0 || t.blockHeight == 0 || len(t.offsets) == 0 {
+		return fmt.Errorf("missing strip or tile layout")
+	}
+
+	// Georeferencing
+	scale := entries[tagModelPixelScale].numbers
+	tiepoint := entries[tagModelTiepoint].numbers
+	if len(scale) < 2 || len(tiepoint) < 6 {
+		return fmt.Errorf("missing ModelPixelScale or ModelTiepoint (not a GeoTIFF?)")
+	}
+	t.scaleX, t.scaleY = scale[0], scale[1]
+	t.west = tiepoint[3] - tiepoint[0]*t.scaleX
+	t.north = tiepoint[4] + tiepoint[1]*t.scaleY
+
+	if keys := entries[tagGeoKeyDirectory].numbers; len(keys) >= 4 {
+		for i := 4; i+3 < len(keys); i += 4 {
+			switch int(keys[i]) {
+			case geoKeyModelType:
+				if int(keys[i+3]) != modelTypeGeographic {
+					return fmt.Errorf("only geographic (lat/lon) GeoTIFFs are supported")
+				}
+			case geoKeyRasterType:
+				t.pixelIsPoint = int(keys[i+3]) == rasterPixelIsPoint
+			}
+		}
+	}
+
+	if noData, ok := entries[tagGDALNoData]; ok {
+		if v, err := strconv.ParseFloat(strings.TrimSpace(noData.text), 64); err == nil {
+			t.noData = v
+			t.hasNoData = true
+		}
+	}
+
+	return nil
+}
+
+func toUint64(values []float64) []uint64 {
+	result := make([]uint64, len(values))
+	for i, v := range values {
+		result[i] = uint64(v)
+	}
+	return result
+}
+
+func (t *geoTIFFFile) Contains(lat, lon float64) bool {
+	return lon >= t.west && lon <= t.west+float64(t.width)*t.scaleX &&
+		lat <= t.north && lat >= t.north-float64(t.height)*t.scaleY
+}
+
+// load reads the raster into memory (once)
+func (t *geoTIFFFile) load() error {
+	t.once.Do(func() {
+		t.loadErr = t.readRaster()
+	})
+	return t.loadErr
+}
+
+func (t *geoTIFFFile) readRaster() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bytesPerSample := t.bitsPerSample / 8
+	blocksAcross := (t.width + t.blockWidth - 1) / t.blockWidth
+	raster := make([]float32, t.width*t.height)
+
+	for i, offset := range t.offsets {
+		size := uint64(t.blockWidth * t.blockHeight * bytesPerSample)
+		if i < len(t.byteCount) && t.byteCount[i] < size {
+			size = t.byteCount[i]
+		}
+		block := make([]byte, size)
+		if _, err := f.ReadAt(block, int64(offset)); err != nil {
+			return fmt.Errorf("failed to read block %d: %w", i, err)
+		}
+
+		originX := (i % blocksAcross) * t.blockWidth
+		originY := (i / blocksAcross) * t.blockHeight
+		if !t.tiled {
+			originX, originY = 0, i*t.blockHeight
+		}
+
+		for by := 0; by < t.blockHeight; by++ {
+			y := originY + by
+			if y >= t.height {
+				break
+			}
+			for bx := 0; bx < t.blockWidth; bx++ {
+				x := originX + bx
+				pos := (by*t.blockWidth + bx) * bytesPerSample
+				if x >= t.width || pos+bytesPerSample > len(block) {
+					continue
+				}
+				raster[y*t.width+x] = float32(t.decodeSample(block[pos:]))
+			}
+		}
+	}
+
+	t.raster = raster
+	return nil
+}
+
+func (t *geoTIFFFile) decodeSample(b []byte) float64 {
+	switch t.sampleFormat {
+	case sampleFormatFloat:
+		if t.bitsPerSample == 64 {
+			return math.Float64frombits(t.order.Uint64(b))
+		}
+		return float64(math.Float32frombits(t.order.Uint32(b)))
+	case sampleFormatInt:
+		switch t.bitsPerSample {
+		case 8:
+			return float64(int8(b[0]))
+		case 16:
+			return float64(int16(t.order.Uint16(b)))
+		default:
+			return float64(int32(t.order.Uint32(b)))
+		}
+	default:
+		switch t.bitsPerSample {
+		case 8:
+			return float64(b[0])
+		case 16:
+			return float64(t.order.Uint16(b))
+		default:
+			return float64(t.order.Uint32(b))
+		}
+	}
+}
+
+func (t *geoTIFFFile) Elevation(lat, lon float64) (float64, bool) {
+	if t.raster == nil || !t.Contains(lat, lon) {
+		return 0, false
+	}
+
+	x := (lon - t.west) / t.scaleX
+	y := (t.north - lat) / t.scaleY
+	if !t.pixelIsPoint {
+		// Sample values refer to pixel centers
+		x -= 0.5
+		y -= 0.5
+	}
+
+	x = math.Max(0, math.Min(x, float64(t.width-1)))
+	y = math.Max(0, math.Min(y, float64(t.height-1)))
+	col := int(math.Min(math.Floor(x), float64(t.width-2)))
+	row := int(math.Min(math.Floor(y), float64(t.height-2)))
+	if col < 0 || row < 0 {
+		return float64(t.raster[0]), !t.isVoid(float64(t.raster[0]))
+	}
+
+	sample := func(r, c int) float64 {
+		return float64(t.raster[r*t.width+c])
+	}
+
+	return bilinear(
+		sample(row, col), sample(row, col+1),
+		sample(row+1, col), sample(row+1, col+1),
+		x-float64(col), y-float64(row),
+		t.isVoid,
+	)
+}
+
+func (t *geoTIFFFile) isVoid(v float64) bool {
+	if math.IsNaN(v) {
+		return true
+	}
+	return t.hasNoData && v == t.noData
+}
@@ -0,0 +1,74 @@
+package elevation
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+)
+
+// hgtVoid marks missing data in SRTM tiles
+const hgtVoid = -32768
+
+// hgtTile is a 1x1 degree SRTM tile (1201x1201 for 3", 3601x3601 for 1")
+type hgtTile struct {
+	south, west float64
+	size        int
+	samples     []int16
+}
+
+// loadHGT reads an SRTM .hgt file whose south-west corner is at (south, west)
+func loadHGT(path string, south, west float64) (*hgtTile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := len(data) / 2
+	size := int(math.Sqrt(float64(samples)))
+	if size*size != samples || size < 2 {
+		return nil, fmt.Errorf("unexpected .hgt size: %d bytes", len(data))
+	}
+
+	tile := &hgtTile{
+		south:   south,
+		west:    west,
+		size:    size,
+		samples: make([]int16, samples),
+	}
+
+	// Samples are big-endian, rows ordered north to south
+	for i := range tile.samples {
+		tile.samples[i] = int16(binary.BigEndian.Uint16(data[i*2:]))
+	}
+
+	return tile, nil
+}
+
+func (t *hgtTile) Contains(lat, lon float64) bool {
+	return lat >= t.south && lat <= t.south+1 && lon >= t.west && lon <= t.west+1
+}
+
+func (t *hgtTile) Elevation(lat, lon float64) (float64, bool) {
+	if !t.Contains(lat, lon) {
+		return 0, false
+	}
+
+	cells := float64(t.size - 1)
+	x := (lon - t.west) * cells
+	y := (t.south + 1 - lat) * cells
+
+	col := int(math.Min(math.Floor(x), cells-1))
+	row := int(math.Min(math.Floor(y), cells-1))
+
+	sample := func(r, c int) float64 {
+		return float64(t.samples[r*t.size+c])
+	}
+
+	return bilinear(
+		sample(row, col), sample(row, col+1),
+		sample(row+1, col), sample(row+1, col+1),
+		x-float64(col), y-float64(row),
+		func(v float64) bool { return v == hgtVoid },
+	)
+}
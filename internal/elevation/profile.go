@@ -0,0 +1,49 @@
+package elevation
+
+import (
+	"math"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// RouteProfile summarizes the elevation along a route
+type RouteProfile struct {
+	Ascent  float64      `json:"ascent"`  // Total climb in meters
+	Descent float64      `json:"descent"` // Total descent in meters
+	Points  [][2]float64 `json:"points"`  // [distance from start (m), elevation (m)] per route node with a known elevation
+}
+
+// ProfileForRoute builds the elevation profile of a route given as a node sequence.
+// It returns nil if the graph has no elevation data.
+func ProfileForRoute(g *graph.Graph, nodes []int64) *RouteProfile {
+	if !g.HasElevation() || len(nodes) == 0 {
+		return nil
+	}
+
+	profile := &RouteProfile{Points: make([][2]float64, 0, len(nodes))}
+
+	var prev *graph.Node
+	distance := 0.0
+	for _, id := range nodes {
+		node, err := g.GetNode(id)
+		if err != nil {
+			return nil
+		}
+
+		if prev != nil {
+			distance += graph.HaversineDistance(prev.Lat, prev.Lon, node.Lat, node.Lon)
+			if delta := graph.ElevationChange(prev.Elevation, node.Elevation); delta > 0 {
+				profile.Ascent += delta
+			} else {
+				profile.Descent -= delta
+			}
+		}
+
+		if !math.IsNaN(node.Elevation) {
+			profile.Points = append(profile.Points, [2]float64{distance, node.Elevation})
+		}
+		prev = node
+	}
+
+	return profile
+}
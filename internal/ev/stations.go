@@ -0,0 +1,149 @@
+package ev
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// Station is a charging station snapped to the road network
+type Station struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name,omitempty"`
+	Lat        float64  `json:"lat"`
+	Lon        float64  `json:"lon"`
+	PowerKW    float64  `json:"power_kw"`
+	Connectors []string `json:"connectors,omitempty"`
+	NodeID     int64    `json:"-"` // Nearest graph node
+}
+
+// connectorAliases maps OSM socket names and common spellings to connector types
+var connectorAliases = map[string]string{
+	"type2_combo":        "ccs",
+	"ccs2":               "ccs",
+	"ccs1":               "ccs",
+	"type1_combo":        "ccs",
+	"type2_cable":        "type2",
+	"mennekes":           "type2",
+	"tesla_supercharger": "tesla",
+	"nacs":               "tesla",
+	"j1772":              "type1",
+}
+
+// NormalizeConnector converts a connector name to its canonical form
+func NormalizeConnector(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := connectorAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// FromGraph converts charging stations parsed from OSM
+func FromGraph(stations []graph.ChargingStation) []Station {
+	result := make([]Station, 0, len(stations))
+	for _, s := range stations {
+		station := Station{
+			ID:      fmt.Sprintf("osm:%d", s.ID),
+			Name:    s.Name,
+			Lat:     s.Lat,
+			Lon:     s.Lon,
+			PowerKW: s.PowerKW,
+		}
+		for _, c := range s.Connectors {
+			station.Connectors = append(station.Connectors, NormalizeConnector(c))
+		}
+		result = append(result, station)
+	}
+	return result
+}
+
+// LoadCSV loads charging stations from a CSV file with the header
+// id,name,lat,lon,power_kw,connectors (connectors separated by ';')
+func LoadCSV(path string) ([]Station, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stations file: %w", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"id", "lat", "lon"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing required column %q", required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var stations []Station
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		lat, errLat := strconv.ParseFloat(field(record, "lat"), 64)
+		lon, errLon := strconv.ParseFloat(field(record, "lon"), 64)
+		if errLat != nil || errLon != nil {
+			return nil, fmt.Errorf("line %d: invalid coordinates", line)
+		}
+
+		station := Station{
+			ID:   field(record, "id"),
+			Name: field(record, "name"),
+			Lat:  lat,
+			Lon:  lon,
+		}
+		if power := field(record, "power_kw"); power != "" {
+			if station.PowerKW, err = strconv.ParseFloat(power, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid power_kw", line)
+			}
+		}
+		for _, c := range strings.Split(field(record, "connectors"), ";") {
+			if c = NormalizeConnector(c); c != "" {
+				station.Connectors = append(station.Connectors, c)
+			}
+		}
+
+		stations = append(stations, station)
+	}
+
+	return stations, nil
+}
+
+// Snap assigns each station to its nearest graph node
+func Snap(g *graph.Graph, stations []Station) []Station {
+	snapped := make([]Station, 0, len(stations))
+	for _, s := range stations {
+		node, err := g.FindNearestNode(s.Lat, s.Lon)
+		if err != nil {
+			continue
+		}
+		s.NodeID = node.ID
+		snapped = append(snapped, s)
+	}
+	return snapped
+}
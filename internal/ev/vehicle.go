@@ -0,0 +1,139 @@
+package ev
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	gravity    = 9.81  // m/s²
+	airDensity = 1.225 // kg/m³
+	joulesKWh  = 3.6e6
+)
+
+// Vehicle describes an electric vehicle, its battery state and energy model
+type Vehicle struct {
+	BatteryCapacityKWh float64  `json:"battery_capacity_kwh"`
+	InitialSoC         float64  `json:"initial_soc"`                     // State of charge at departure (0-1)
+	MinSoC             float64  `json:"min_soc"`                         // Reserve that must never be used (0-1)
+	MaxChargeSoC       float64  `json:"max_charge_soc"`                  // Charge at most up to this level (0-1, default 0.8)
+	MaxChargePowerKW   float64  `json:"max_charge_power_kw"`             // Vehicle charging limit (default 50)
+	Connectors         []string `json:"connectors"`                      // Supported connector types, e.g. ["ccs", "type2"]
+	MassKg             float64  `json:"mass_kg,omitempty"`               // Default 1800
+	DragArea           float64  `json:"drag_area,omitempty"`             // Drag coefficient × frontal area in m² (default 0.6)
+	RollingResistance  float64  `json:"rolling_resistance,omitempty"`    // Default 0.01
+	DrivetrainEff      float64  `json:"drivetrain_efficiency,omitempty"` // Default 0.9
+	RegenEff           float64  `json:"regen_efficiency,omitempty"`      // Share of braking energy recovered (default 0.6)
+	AuxiliaryKW        float64  `json:"auxiliary_kw,omitempty"`          // Constant load (HVAC etc., default 1.0)
+}
+
+// Normalize fills defaults and validates the vehicle parameters
+func (v *Vehicle) Normalize() error {
+	if v.BatteryCapacityKWh <= 0 {
+		return fmt.Errorf("battery_capacity_kwh must be positive")
+	}
+	if v.InitialSoC <= 0 || v.InitialSoC > 1 {
+		return fmt.Errorf("initial_soc must be between 0 and 1")
+	}
+	if v.MinSoC < 0 || v.MinSoC >= 1 {
+		return fmt.Errorf("min_soc must be between 0 and 1")
+	}
+	if v.MaxChargeSoC == 0 {
+		v.MaxChargeSoC = 0.8
+	}
+	if v.MaxChargeSoC <= v.MinSoC || v.MaxChargeSoC > 1 {
+		return fmt.Errorf("max_charge_soc must be greater than min_soc and at most 1")
+	}
+
+	setDefault(&v.MaxChargePowerKW, 50)
+	setDefault(&v.MassKg, 1800)
+	setDefault(&v.DragArea, 0.6)
+	setDefault(&v.RollingResistance, 0.01)
+	setDefault(&v.DrivetrainEff, 0.9)
+	setDefault(&v.RegenEff, 0.6)
+	setDefault(&v.AuxiliaryKW, 1.0)
+
+	for i, c := range v.Connectors {
+		v.Connectors[i] = NormalizeConnector(c)
+	}
+
+	return nil
+}
+
+func setDefault(value *float64, def float64) {
+	if *value <= 0 {
+		*value = def
+	}
+}
+
+// EdgeEnergy estimates the battery energy (kWh) used to drive a segment of the
+// given length (m) at a constant speed (m/s) with an elevation change (m).
+// Negative values mean energy was recovered through regenerative braking.
+func (v *Vehicle) EdgeEnergy(length, speed, elevationChange float64) float64 {
+	if length <= 0 || speed <= 0 {
+		return 0
+	}
+
+	rolling := v.MassKg * gravity * v.RollingResistance * length
+	aero := 0.5 * airDensity * v.DragArea * speed * speed * length
+	climb := v.MassKg * gravity * elevationChange
+	traction := rolling + aero + climb
+
+	var battery float64
+	if traction >= 0 {
+		battery = traction / v.DrivetrainEff
+	} else {
+		battery = traction * v.RegenEff
+	}
+
+	auxiliary := v.AuxiliaryKW * 1000 * (length / speed)
+	return (battery + auxiliary) / joulesKWh
+}
+
+// UsableEnergy returns the energy (kWh) between two states of charge
+func (v *Vehicle) UsableEnergy(fromSoC, toSoC float64) float64 {
+	return (fromSoC - toSoC) * v.BatteryCapacityKWh
+}
+
+// ChargeTime estimates the time (s) to charge from one SoC to another at a
+// station with the given power. Power is limited by the vehicle and tapers to
+// half above 80% state of charge.
+func (v *Vehicle) ChargeTime(fromSoC, toSoC, stationPowerKW float64) float64 {
+	if toSoC <= fromSoC {
+		return 0
+	}
+
+	power := v.MaxChargePowerKW
+	if stationPowerKW > 0 {
+		power = math.Min(power, stationPowerKW)
+	}
+
+	const taperSoC = 0.8
+	var hours float64
+	if fromSoC < taperSoC {
+		bulk := math.Min(toSoC, taperSoC) - fromSoC
+		hours += bulk * v.BatteryCapacityKWh / power
+	}
+	if toSoC > taperSoC {
+		taper := toSoC - math.Max(fromSoC, taperSoC)
+		hours += taper * v.BatteryCapacityKWh / (power / 2)
+	}
+
+	return hours * 3600
+}
+
+// Compatible reports whether the vehicle can charge at a station.
+// Stations without connector information are assumed to be compatible.
+func (v *Vehicle) Compatible(station *Station) bool {
+	if len(v.Connectors) == 0 || len(station.Connectors) == 0 {
+		return true
+	}
+	for _, want := range v.Connectors {
+		for _, have := range station.Connectors {
+			if want == have {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package geo
+
+import "testing"
+
+func TestPolygonContainsPointWithHole(t *testing.T) {
+	polygons, err := ParsePolygons([]byte(`{"type": "Polygon", "coordinates": [
+		[[0, 0], [10, 0], [10, 10], [0, 10]],
+		[[4, 4], [6, 4], [6, 6], [4, 6], [4, 4]]
+	]}`))
+	if err != nil {
+		t.Fatalf("Failed to parse polygon: %v", err)
+	}
+	p := polygons[0]
+
+	if !p.ContainsPoint(2, 2) {
+		t.Error("Expected (2, 2) inside the polygon")
+	}
+	if p.ContainsPoint(5, 5) {
+		t.Error("Expected (5, 5) inside the hole to be outside")
+	}
+	if p.ContainsPoint(11, 5) {
+		t.Error("Expected (11, 5) outside the polygon")
+	}
+}
+
+func TestPolygonIntersectsSegment(t *testing.T) {
+	p := PolygonFromBBox(BBox{MinLon: 0, MinLat: 0, MaxLon: 1, MaxLat: 1})
+
+	if !p.IntersectsSegment(-1, 0.5, 2, 0.5) {
+		t.Error("Expected segment crossing the box to intersect")
+	}
+	if p.IntersectsSegment(-1, 2, 2, 2) {
+		t.Error("Expected segment above the box not to intersect")
+	}
+	if !p.IntersectsSegment(0.2, 0.2, 0.3, 0.3) {
+		t.Error("Expected segment inside the box to intersect")
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	boxes := make([]BBox, 0, 100)
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			lon, lat := float64(i), float64(j)
+			boxes = append(boxes, BBox{MinLon: lon, MinLat: lat, MaxLon: lon + 0.5, MaxLat: lat + 0.5})
+		}
+	}
+	idx := NewIndex(boxes)
+
+	found := map[int]bool{}
+	idx.Search(BBox{MinLon: 2.2, MinLat: 3.2, MaxLon: 3.2, MaxLat: 3.3}, func(item int) bool {
+		found[item] = true
+		return true
+	})
+
+	// Boxes starting at (2, 3) and (3, 3)
+	if len(found) != 2 || !found[2*10+3] || !found[3*10+3] {
+		t.Errorf("Expected boxes 23 and 33, got %v", found)
+	}
+}
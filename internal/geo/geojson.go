@@ -0,0 +1,79 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// geoJSONObject covers the GeoJSON members needed to read polygons
+type geoJSONObject struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    json.RawMessage `json:"geometry"`
+}
+
+// ParsePolygons reads a GeoJSON Polygon, MultiPolygon or a Feature wrapping one
+func ParsePolygons(data []byte) ([]Polygon, error) {
+	var obj geoJSONObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+
+	switch obj.Type {
+	case "Feature":
+		if len(obj.Geometry) == 0 {
+			return nil, fmt.Errorf("feature has no geometry")
+		}
+		return ParsePolygons(obj.Geometry)
+
+	case "Polygon":
+		var rings [][][2]float64
+		if err := json.Unmarshal(obj.Coordinates, &rings); err != nil {
+			return nil, fmt.Errorf("invalid polygon coordinates: %w", err)
+		}
+		polygon, err := newPolygon(rings)
+		if err != nil {
+			return nil, err
+		}
+		return []Polygon{polygon}, nil
+
+	case "MultiPolygon":
+		var polygons [][][][2]float64
+		if err := json.Unmarshal(obj.Coordinates, &polygons); err != nil {
+			return nil, fmt.Errorf("invalid multipolygon coordinates: %w", err)
+		}
+		result := make([]Polygon, 0, len(polygons))
+		for _, rings := range polygons {
+			polygon, err := newPolygon(rings)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, polygon)
+		}
+		return result, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %q (expected Polygon or MultiPolygon)", obj.Type)
+	}
+}
+
+// newPolygon validates rings and closes them if necessary
+func newPolygon(rings [][][2]float64) (Polygon, error) {
+	if len(rings) == 0 {
+		return Polygon{}, fmt.Errorf("polygon has no rings")
+	}
+	for i, ring := range rings {
+		if len(ring) < 3 {
+			return Polygon{}, fmt.Errorf("polygon ring %d needs at least 3 positions", i)
+		}
+		for _, pos := range ring {
+			if pos[0] < -180 || pos[0] > 180 || pos[1] < -90 || pos[1] > 90 {
+				return Polygon{}, fmt.Errorf("polygon position [%g, %g] out of range", pos[0], pos[1])
+			}
+		}
+		if ring[0] != ring[len(ring)-1] {
+			rings[i] = append(ring, ring[0])
+		}
+	}
+	return Polygon{Rings: rings}, nil
+}
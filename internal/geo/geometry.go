@@ -0,0 +1,144 @@
+package geo
+
+import "math"
+
+// BBox is an axis-aligned bounding box in degrees
+type BBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+// EmptyBBox returns a box that contains nothing and grows with Extend
+func EmptyBBox() BBox {
+	return BBox{MinLon: math.Inf(1), MinLat: math.Inf(1), MaxLon: math.Inf(-1), MaxLat: math.Inf(-1)}
+}
+
+// Extend grows the box to include a point
+func (b *BBox) Extend(lon, lat float64) {
+	b.MinLon = math.Min(b.MinLon, lon)
+	b.MinLat = math.Min(b.MinLat, lat)
+	b.MaxLon = math.Max(b.MaxLon, lon)
+	b.MaxLat = math.Max(b.MaxLat, lat)
+}
+
+// Union returns the smallest box containing both boxes
+func (b BBox) Union(o BBox) BBox {
+	return BBox{
+		MinLon: math.Min(b.MinLon, o.MinLon),
+		MinLat: math.Min(b.MinLat, o.MinLat),
+		MaxLon: math.Max(b.MaxLon, o.MaxLon),
+		MaxLat: math.Max(b.MaxLat, o.MaxLat),
+	}
+}
+
+// Intersects reports whether two boxes overlap
+func (b BBox) Intersects(o BBox) bool {
+	return b.MinLon <= o.MaxLon && o.MinLon <= b.MaxLon && b.MinLat <= o.MaxLat && o.MinLat <= b.MaxLat
+}
+
+// Contains reports whether a point lies inside the box (borders included)
+func (b BBox) Contains(lon, lat float64) bool {
+	return lon >= b.MinLon && lon <= b.MaxLon && lat >= b.MinLat && lat <= b.MaxLat
+}
+
+// Valid reports whether the box has sensible coordinates
+func (b BBox) Valid() bool {
+	return b.MinLon <= b.MaxLon && b.MinLat <= b.MaxLat &&
+		b.MinLon >= -180 && b.MaxLon <= 180 && b.MinLat >= -90 && b.MaxLat <= 90
+}
+
+// SegmentBBox returns the bounding box of a segment
+func SegmentBBox(lon1, lat1, lon2, lat2 float64) BBox {
+	return BBox{
+		MinLon: math.Min(lon1, lon2),
+		MinLat: math.Min(lat1, lat2),
+		MaxLon: math.Max(lon1, lon2),
+		MaxLat: math.Max(lat1, lat2),
+	}
+}
+
+// Polygon is a polygon with an outer ring followed by optional holes.
+// Rings are lists of [lon, lat] positions, as in GeoJSON.
+type Polygon struct {
+	Rings [][][2]float64
+}
+
+// PolygonFromBBox returns a rectangular polygon
+func PolygonFromBBox(b BBox) Polygon {
+	return Polygon{Rings: [][][2]float64{{
+		{b.MinLon, b.MinLat},
+		{b.MaxLon, b.MinLat},
+		{b.MaxLon, b.MaxLat},
+		{b.MinLon, b.MaxLat},
+		{b.MinLon, b.MinLat},
+	}}}
+}
+
+// Bounds returns the bounding box of the outer ring
+func (p *Polygon) Bounds() BBox {
+	b := EmptyBBox()
+	if len(p.Rings) > 0 {
+		for _, pos := range p.Rings[0] {
+			b.Extend(pos[0], pos[1])
+		}
+	}
+	return b
+}
+
+// ContainsPoint reports whether a point lies inside the polygon (even-odd rule, holes excluded)
+func (p *Polygon) ContainsPoint(lon, lat float64) bool {
+	inside := false
+	for _, ring := range p.Rings {
+		n := len(ring)
+		for i, j := 0, n-1; i < n; j, i = i, i+1 {
+			a, b := ring[i], ring[j]
+			if (a[1] > lat) != (b[1] > lat) &&
+				lon < (b[0]-a[0])*(lat-a[1])/(b[1]-a[1])+a[0] {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// IntersectsSegment reports whether a segment touches the polygon interior or crosses its boundary
+func (p *Polygon) IntersectsSegment(lon1, lat1, lon2, lat2 float64) bool {
+	if p.ContainsPoint(lon1, lat1) || p.ContainsPoint(lon2, lat2) {
+		return true
+	}
+	for _, ring := range p.Rings {
+		for i := 0; i < len(ring)-1; i++ {
+			if segmentsIntersect(lon1, lat1, lon2, lat2, ring[i][0], ring[i][1], ring[i+1][0], ring[i+1][1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// segmentsIntersect reports whether segments p1-p2 and p3-p4 intersect
+func segmentsIntersect(x1, y1, x2, y2, x3, y3, x4, y4 float64) bool {
+	d1 := orientation(x3, y3, x4, y4, x1, y1)
+	d2 := orientation(x3, y3, x4, y4, x2, y2)
+	d3 := orientation(x1, y1, x2, y2, x3, y3)
+	d4 := orientation(x1, y1, x2, y2, x4, y4)
+
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+
+	// Collinear and touching cases
+	return (d1 == 0 && onSegment(x3, y3, x4, y4, x1, y1)) ||
+		(d2 == 0 && onSegment(x3, y3, x4, y4, x2, y2)) ||
+		(d3 == 0 && onSegment(x1, y1, x2, y2, x3, y3)) ||
+		(d4 == 0 && onSegment(x1, y1, x2, y2, x4, y4))
+}
+
+// orientation returns the sign of the cross product (b-a) x (c-a)
+func orientation(ax, ay, bx, by, cx, cy float64) float64 {
+	return (bx-ax)*(cy-ay) - (by-ay)*(cx-ax)
+}
+
+// onSegment reports whether collinear point c lies within segment a-b
+func onSegment(ax, ay, bx, by, cx, cy float64) bool {
+	return cx >= math.Min(ax, bx) && cx <= math.Max(ax, bx) && cy >= math.Min(ay, by) && cy <= math.Max(ay, by)
+}
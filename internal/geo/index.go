@@ -0,0 +1,101 @@
+package geo
+
+import (
+	"math"
+	"sort"
+)
+
+// nodeCapacity is the maximum number of children per R-tree node
+const nodeCapacity = 8
+
+// Index is a static R-tree over bounding boxes, bulk loaded with the
+// Sort-Tile-Recursive algorithm. It is read-only after construction and
+// safe for concurrent searches.
+type Index struct {
+	root *indexNode
+	size int
+}
+
+type indexNode struct {
+	bounds   BBox
+	children []*indexNode
+	item     int // Item position for leaf entries, -1 for inner nodes
+}
+
+// NewIndex builds an index over the given boxes; Search reports positions in this slice
+func NewIndex(boxes []BBox) *Index {
+	if len(boxes) == 0 {
+		return &Index{}
+	}
+
+	level := make([]*indexNode, len(boxes))
+	for i, b := range boxes {
+		level[i] = &indexNode{bounds: b, item: i}
+	}
+
+	for len(level) > 1 {
+		level = packLevel(level)
+	}
+
+	return &Index{root: level[0], size: len(boxes)}
+}
+
+// Len returns the number of indexed boxes
+func (idx *Index) Len() int {
+	return idx.size
+}
+
+// Search calls fn for every indexed box that intersects b; returning false stops the search
+func (idx *Index) Search(b BBox, fn func(item int) bool) {
+	if idx.root != nil {
+		idx.root.search(b, fn)
+	}
+}
+
+func (n *indexNode) search(b BBox, fn func(item int) bool) bool {
+	if !n.bounds.Intersects(b) {
+		return true
+	}
+	if n.item >= 0 {
+		return fn(n.item)
+	}
+	for _, child := range n.children {
+		if !child.search(b, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// packLevel groups nodes into parents: sort by longitude into vertical
+// slices, then by latitude within each slice
+func packLevel(nodes []*indexNode) []*indexNode {
+	parentCount := int(math.Ceil(float64(len(nodes)) / nodeCapacity))
+	sliceCount := int(math.Ceil(math.Sqrt(float64(parentCount))))
+	sliceSize := sliceCount * nodeCapacity
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return centerLon(nodes[i].bounds) < centerLon(nodes[j].bounds)
+	})
+
+	parents := make([]*indexNode, 0, parentCount)
+	for start := 0; start < len(nodes); start += sliceSize {
+		slice := nodes[start:min(start+sliceSize, len(nodes))]
+		sort.Slice(slice, func(i, j int) bool {
+			return centerLat(slice[i].bounds) < centerLat(slice[j].bounds)
+		})
+
+		for i := 0; i < len(slice); i += nodeCapacity {
+			children := append([]*indexNode(nil), slice[i:min(i+nodeCapacity, len(slice))]...)
+			bounds := children[0].bounds
+			for _, child := range children[1:] {
+				bounds = bounds.Union(child.bounds)
+			}
+			parents = append(parents, &indexNode{bounds: bounds, children: children, item: -1})
+		}
+	}
+	return parents
+}
+
+func centerLon(b BBox) float64 { return (b.MinLon + b.MaxLon) / 2 }
+func centerLat(b BBox) float64 { return (b.MinLat + b.MaxLat) / 2 }
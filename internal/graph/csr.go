@@ -0,0 +1,584 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// CSR is the flat, array-based form of a graph. Nodes are addressed by dense
+// indices in the order of their sorted OSM IDs, adjacency is stored in
+// compressed sparse row form and edge attributes are interned per way.
+// The arrays may alias a memory-mapped file.
+type CSR struct {
+	NodeIDs   []int64 // Sorted OSM node IDs; the position is the node index
+	Lat       []float64
+	Lon       []float64
+	Elevation []float32 // Empty if the graph has no elevations
+
+	FirstOut []uint32  // Outgoing edges of node i are FirstOut[i] to FirstOut[i+1]-1
+	Head     []uint32  // Target node index per edge
+	Weight   []float64 // Per edge
+	Attr     []uint32  // Attribute record per edge
+	Flags    []uint8   // Per edge (bit 0: edge runs against its way)
+
+	FirstIn []uint32 // Incoming edges of node i are InEdge[FirstIn[i]] to InEdge[FirstIn[i+1]-1]
+	InEdge  []uint32 // Edge index of each incoming edge
+
+	AttrWay      []int64   // OSM way ID per attribute record
+	AttrMaxSpeed []float64 // Max speed per attribute record
+	AttrTags     []uint32  // Tag set per attribute record
+
+	TagStart []uint32 // Tag set i is TagPairs[2*TagStart[i]] to TagPairs[2*TagStart[i+1]-1]
+	TagPairs []uint32 // Key and value string indices
+	StrStart []uint32 // String i is StrData[StrStart[i]:StrStart[i+1]]
+	StrData  []byte
+
+	WayIDs   []int64  // Sorted OSM way IDs
+	WayStart []uint32 // Edges of way i are WayEdges[WayStart[i]] to WayEdges[WayStart[i+1]-1]
+	WayEdges []uint32
+
+	Owner any // Keeps the memory the arrays alias alive, e.g. a file mapping
+}
+
+// csrReverse marks edges that run against the node order of their way
+const csrReverse uint8 = 1
+
+// weightChunk is the number of weights a weight change copies at least
+const weightChunk = 4096
+
+// csrGraph serves graph queries from a CSR. The CSR is never modified:
+// weights are read through a table of chunks, and weight changes replace the
+// chunks they modify.
+type csrGraph struct {
+	*CSR
+	weights [][]float64                         // Chunks of weightChunk weights
+	tags    []atomic.Pointer[map[string]string] // Tag maps, built on first use
+}
+
+// NewGraphFromCSR creates a graph that serves queries from the CSR arrays
+// without decoding them. Restrictions, signals and stations come from extra.
+func NewGraphFromCSR(c *CSR, extra *ExportData) (*Graph, error) {
+	if err := c.checkShape(); err != nil {
+		return nil, err
+	}
+
+	s := &snapshot{
+		restrictions: make(map[int64][]TurnRestriction),
+		signals:      make(map[int64]bool),
+		originals:    make(map[EdgeRef]float64),
+		csr:          newCSRGraph(c),
+		hasElevation: len(c.Elevation) > 0,
+	}
+	if extra != nil {
+		if extra.Restrictions != nil {
+			s.restrictions = extra.Restrictions
+		}
+		if extra.Signals != nil {
+			s.signals = extra.Signals
+		}
+		s.stations = extra.Stations
+	}
+	g := &Graph{}
+	g.state.Store(s)
+	return g, nil
+}
+
+// newCSRGraph wraps a CSR for serving queries
+func newCSRGraph(c *CSR) *csrGraph {
+	weights := make([][]float64, 0, (len(c.Weight)+weightChunk-1)/weightChunk)
+	for start := 0; start < len(c.Weight); start += weightChunk {
+		end := min(start+weightChunk, len(c.Weight))
+		weights = append(weights, c.Weight[start:end:end])
+	}
+	return &csrGraph{CSR: c, weights: weights, tags: make([]atomic.Pointer[map[string]string], len(c.TagStart)-1)}
+}
+
+// weight returns the current weight of an edge
+func (c *csrGraph) weight(e uint32) float64 {
+	return c.weights[e/weightChunk][e%weightChunk]
+}
+
+// withWeights returns a copy that shares everything but the chunk table, for
+// weight changes to replace chunks in
+func (c *csrGraph) withWeights() *csrGraph {
+	copied := *c
+	copied.weights = append([][]float64(nil), c.weights...)
+	return &copied
+}
+
+// checkShape verifies that the array lengths fit together, so lookups stay in bounds
+func (c *CSR) checkShape() error {
+	n, m := len(c.NodeIDs), len(c.Head)
+	switch {
+	case len(c.Lat) != n || len(c.Lon) != n:
+		return fmt.Errorf("csr: %d node IDs but %d/%d coordinates", n, len(c.Lat), len(c.Lon))
+	case len(c.Elevation) != 0 && len(c.Elevation) != n:
+		return fmt.Errorf("csr: %d nodes but %d elevations", n, len(c.Elevation))
+	case len(c.FirstOut) != n+1 || len(c.FirstIn) != n+1:
+		return fmt.Errorf("csr: offset arrays do not match %d nodes", n)
+	case int(c.FirstOut[n]) != m || int(c.FirstIn[n]) != m:
+		return fmt.Errorf("csr: offset arrays do not match %d edges", m)
+	case len(c.Weight) != m || len(c.Attr) != m || len(c.Flags) != m || len(c.InEdge) != m:
+		return fmt.Errorf("csr: edge arrays differ in length")
+	case len(c.AttrMaxSpeed) != len(c.AttrWay) || len(c.AttrTags) != len(c.AttrWay):
+		return fmt.Errorf("csr: attribute arrays differ in length")
+	case len(c.TagStart) == 0 || int(c.TagStart[len(c.TagStart)-1])*2 != len(c.TagPairs):
+		return fmt.Errorf("csr: tag offsets do not match %d tag pairs", len(c.TagPairs)/2)
+	case len(c.StrStart) == 0 || int(c.StrStart[len(c.StrStart)-1]) != len(c.StrData):
+		return fmt.Errorf("csr: string offsets do not match %d bytes", len(c.StrData))
+	case len(c.WayStart) != len(c.WayIDs)+1 || int(c.WayStart[len(c.WayIDs)]) != len(c.WayEdges):
+		return fmt.Errorf("csr: way index does not match %d ways", len(c.WayIDs))
+	}
+	return nil
+}
+
+// CSR returns the graph in flat form for writing. For a graph built from a
+// CSR the arrays are shared, except for a copy of the current weights.
+func (g *Graph) CSR() *CSR {
+	s := g.state.Load()
+	if s.csr != nil {
+		c := *s.csr.CSR
+		c.Weight = make([]float64, 0, len(c.Head))
+		for _, chunk := range s.csr.weights {
+			c.Weight = append(c.Weight, chunk...)
+		}
+		return &c
+	}
+	c, _ := buildCSR(s.nodes, s.edges, s.hasElevation)
+	return c
+}
+
+// Compact converts the graph to CSR form and drops its adjacency maps: nodes
+// get dense indices, edges share their attributes per way, and tags are
+// stored once. Lookups by OSM ID keep working. Edges to missing nodes have no
+// place in a CSR; the graph then keeps its maps and an error is returned.
+// Adding nodes or edges converts the graph back to maps.
+func (g *Graph) Compact() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.compact()
+}
+
+// compact implements Compact (caller holds the mutex)
+func (g *Graph) compact() error {
+	s := g.state.Load()
+	if s.csr != nil {
+		return nil
+	}
+	c, dangling := buildCSR(s.nodes, s.edges, s.hasElevation)
+	if dangling > 0 {
+		return fmt.Errorf("%d edges reference missing nodes", dangling)
+	}
+	next := *s
+	next.csr = newCSRGraph(c)
+	next.nodes, next.edges, next.reverseEdges, next.wayIndex = nil, nil, nil, nil
+	g.state.Store(&next)
+	return nil
+}
+
+// buildCSR flattens adjacency maps, keeping the order of each adjacency list
+// so edge references stay valid. It returns the number of edges left out
+// because their target node is missing.
+func buildCSR(nodes map[int64]*Node, edges map[int64][]Edge, hasElevation bool) (*CSR, int) {
+	c := &CSR{NodeIDs: make([]int64, 0, len(nodes))}
+	for id := range nodes {
+		c.NodeIDs = append(c.NodeIDs, id)
+	}
+	sort.Slice(c.NodeIDs, func(i, j int) bool { return c.NodeIDs[i] < c.NodeIDs[j] })
+
+	index := make(map[int64]uint32, len(c.NodeIDs))
+	c.Lat = make([]float64, len(c.NodeIDs))
+	c.Lon = make([]float64, len(c.NodeIDs))
+	if hasElevation {
+		c.Elevation = make([]float32, len(c.NodeIDs))
+	}
+	for i, id := range c.NodeIDs {
+		node := nodes[id]
+		index[id] = uint32(i)
+		c.Lat[i], c.Lon[i] = node.Lat, node.Lon
+		if hasElevation {
+			c.Elevation[i] = float32(node.Elevation)
+		}
+	}
+
+	interner := newAttrInterner(c)
+	dangling := 0
+	c.FirstOut = make([]uint32, 0, len(c.NodeIDs)+1)
+	inDegree := make([]uint32, len(c.NodeIDs)+1)
+	for _, id := range c.NodeIDs {
+		c.FirstOut = append(c.FirstOut, uint32(len(c.Head)))
+		for i := range edges[id] {
+			edge := &edges[id][i]
+			head, ok := index[edge.To]
+			if !ok {
+				dangling++
+				continue
+			}
+			var flags uint8
+			if edge.Reverse {
+				flags |= csrReverse
+			}
+			c.Head = append(c.Head, head)
+			c.Weight = append(c.Weight, edge.Weight)
+			c.Attr = append(c.Attr, interner.attr(edge))
+			c.Flags = append(c.Flags, flags)
+			inDegree[head+1]++
+		}
+	}
+	c.FirstOut = append(c.FirstOut, uint32(len(c.Head)))
+
+	// Incoming edges, grouped by target in order of edge index
+	c.FirstIn = make([]uint32, len(c.NodeIDs)+1)
+	for i := 1; i < len(inDegree); i++ {
+		c.FirstIn[i] = c.FirstIn[i-1] + inDegree[i]
+	}
+	next := append([]uint32(nil), c.FirstIn[:len(c.NodeIDs)]...)
+	c.InEdge = make([]uint32, len(c.Head))
+	for e, head := range c.Head {
+		c.InEdge[next[head]] = uint32(e)
+		next[head]++
+	}
+
+	// Way index: edges grouped by OSM way ID
+	order := make([]uint32, len(c.Head))
+	for e := range order {
+		order[e] = uint32(e)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return c.AttrWay[c.Attr[order[i]]] < c.AttrWay[c.Attr[order[j]]]
+	})
+	c.WayEdges = order
+	for i, e := range order {
+		way := c.AttrWay[c.Attr[e]]
+		if len(c.WayIDs) == 0 || c.WayIDs[len(c.WayIDs)-1] != way {
+			c.WayIDs = append(c.WayIDs, way)
+			c.WayStart = append(c.WayStart, uint32(i))
+		}
+	}
+	c.WayStart = append(c.WayStart, uint32(len(order)))
+	return c, dangling
+}
+
+// attrInterner shares attribute records, tag sets and strings between edges
+type attrInterner struct {
+	c       *CSR
+	attrs   map[attrKey]uint32
+	tagSets map[string]uint32
+	strs    map[string]uint32
+}
+
+// attrKey identifies an attribute record
+type attrKey struct {
+	way      int64
+	maxSpeed float64
+	tags     uint32
+}
+
+func newAttrInterner(c *CSR) *attrInterner {
+	c.TagStart = []uint32{0}
+	c.StrStart = []uint32{0}
+	return &attrInterner{c: c, attrs: map[attrKey]uint32{}, tagSets: map[string]uint32{}, strs: map[string]uint32{}}
+}
+
+// attr returns the attribute record of an edge, adding it if needed
+func (in *attrInterner) attr(edge *Edge) uint32 {
+	tags := in.tagSet(edge.Tags)
+	key := attrKey{way: edge.OSMWayID, maxSpeed: edge.MaxSpeed, tags: tags}
+	if id, ok := in.attrs[key]; ok {
+		return id
+	}
+	id := uint32(len(in.c.AttrWay))
+	in.c.AttrWay = append(in.c.AttrWay, edge.OSMWayID)
+	in.c.AttrMaxSpeed = append(in.c.AttrMaxSpeed, edge.MaxSpeed)
+	in.c.AttrTags = append(in.c.AttrTags, tags)
+	in.attrs[key] = id
+	return id
+}
+
+// tagSet returns the index of a tag set, adding it if needed
+func (in *attrInterner) tagSet(tags map[string]string) uint32 {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var canonical strings.Builder
+	for _, key := range keys {
+		canonical.WriteString(key)
+		canonical.WriteByte(0)
+		canonical.WriteString(tags[key])
+		canonical.WriteByte(0)
+	}
+	if id, ok := in.tagSets[canonical.String()]; ok {
+		return id
+	}
+
+	id := uint32(len(in.c.TagStart) - 1)
+	for _, key := range keys {
+		in.c.TagPairs = append(in.c.TagPairs, in.str(key), in.str(tags[key]))
+	}
+	in.c.TagStart = append(in.c.TagStart, uint32(len(in.c.TagPairs)/2))
+	in.tagSets[canonical.String()] = id
+	return id
+}
+
+// str returns the index of a string, adding it if needed
+func (in *attrInterner) str(s string) uint32 {
+	if id, ok := in.strs[s]; ok {
+		return id
+	}
+	id := uint32(len(in.c.StrStart) - 1)
+	in.c.StrData = append(in.c.StrData, s...)
+	in.c.StrStart = append(in.c.StrStart, uint32(len(in.c.StrData)))
+	in.strs[s] = id
+	return id
+}
+
+// nodeIndex returns the dense index of an OSM node ID
+func (c *csrGraph) nodeIndex(id int64) (uint32, bool) {
+	i := sort.Search(len(c.NodeIDs), func(i int) bool { return c.NodeIDs[i] >= id })
+	if i < len(c.NodeIDs) && c.NodeIDs[i] == id {
+		return uint32(i), true
+	}
+	return 0, false
+}
+
+// node returns a copy of the node at an index
+func (c *csrGraph) node(i uint32) *Node {
+	node := &Node{ID: c.NodeIDs[i], Lat: c.Lat[i], Lon: c.Lon[i]}
+	if len(c.Elevation) > 0 {
+		node.Elevation = float64(c.Elevation[i])
+	}
+	return node
+}
+
+// tail returns the source node index of an edge
+func (c *csrGraph) tail(e uint32) uint32 {
+	return uint32(sort.Search(len(c.NodeIDs), func(i int) bool { return c.FirstOut[i+1] > e }))
+}
+
+// edge materializes an edge. Tag maps are shared and must not be modified.
+func (c *csrGraph) edge(e, from uint32) Edge {
+	attr := c.Attr[e]
+	return Edge{
+		From:     c.NodeIDs[from],
+		To:       c.NodeIDs[c.Head[e]],
+		Weight:   c.weight(e),
+		OSMWayID: c.AttrWay[attr],
+		MaxSpeed: c.AttrMaxSpeed[attr],
+		Tags:     c.tagMap(c.AttrTags[attr]),
+		Reverse:  c.Flags[e]&csrReverse != 0,
+	}
+}
+
+// tagMap returns the tags of a tag set, copying the strings out of the arrays
+func (c *csrGraph) tagMap(set uint32) map[string]string {
+	if tags := c.tags[set].Load(); tags != nil {
+		return *tags
+	}
+	start, end := c.TagStart[set], c.TagStart[set+1]
+	tags := make(map[string]string, end-start)
+	for p := start; p < end; p++ {
+		tags[c.str(c.TagPairs[2*p])] = c.str(c.TagPairs[2*p+1])
+	}
+	c.tags[set].Store(&tags)
+	return tags
+}
+
+// str copies a string out of the string data
+func (c *csrGraph) str(i uint32) string {
+	return string(c.StrData[c.StrStart[i]:c.StrStart[i+1]])
+}
+
+// outEdges materializes the outgoing edges of a node
+func (c *csrGraph) outEdges(id int64) []Edge {
+	i, ok := c.nodeIndex(id)
+	if !ok {
+		return nil
+	}
+	start, end := c.FirstOut[i], c.FirstOut[i+1]
+	if start == end {
+		return nil
+	}
+	edges := make([]Edge, 0, end-start)
+	for e := start; e < end; e++ {
+		edges = append(edges, c.edge(e, i))
+	}
+	return edges
+}
+
+// inEdges materializes the incoming edges of a node
+func (c *csrGraph) inEdges(id int64) []Edge {
+	i, ok := c.nodeIndex(id)
+	if !ok {
+		return nil
+	}
+	start, end := c.FirstIn[i], c.FirstIn[i+1]
+	if start == end {
+		return nil
+	}
+	edges := make([]Edge, 0, end-start)
+	for p := start; p < end; p++ {
+		e := c.InEdge[p]
+		edges = append(edges, c.edge(e, c.tail(e)))
+	}
+	return edges
+}
+
+// edgeIndex resolves an edge reference
+func (c *csrGraph) edgeIndex(ref EdgeRef) (uint32, bool) {
+	i, ok := c.nodeIndex(ref.From)
+	if !ok || ref.Index < 0 || ref.Index >= int(c.FirstOut[i+1]-c.FirstOut[i]) {
+		return 0, false
+	}
+	return c.FirstOut[i] + uint32(ref.Index), true
+}
+
+// ref returns the reference of an edge index
+func (c *csrGraph) ref(e uint32) EdgeRef {
+	from := c.tail(e)
+	return EdgeRef{From: c.NodeIDs[from], Index: int(e - c.FirstOut[from])}
+}
+
+// wayEdges returns references to the edges of an OSM way
+func (c *csrGraph) wayEdges(wayID int64) []EdgeRef {
+	i := sort.Search(len(c.WayIDs), func(i int) bool { return c.WayIDs[i] >= wayID })
+	if i == len(c.WayIDs) || c.WayIDs[i] != wayID {
+		return nil
+	}
+	refs := make([]EdgeRef, 0, c.WayStart[i+1]-c.WayStart[i])
+	for _, e := range c.WayEdges[c.WayStart[i]:c.WayStart[i+1]] {
+		refs = append(refs, c.ref(e))
+	}
+	return refs
+}
+
+// forEachEdge implements ForEachEdge
+func (c *csrGraph) forEachEdge(fn func(ref EdgeRef, edge *Edge, from, to *Node) bool) {
+	for i := range c.NodeIDs {
+		from := c.node(uint32(i))
+		for e := c.FirstOut[i]; e < c.FirstOut[i+1]; e++ {
+			edge := c.edge(e, uint32(i))
+			if !fn(EdgeRef{From: from.ID, Index: int(e - c.FirstOut[i])}, &edge, from, c.node(c.Head[e])) {
+				return
+			}
+		}
+	}
+}
+
+// nearest implements FindNearestNode
+func (c *csrGraph) nearest(lat, lon float64) (*Node, error) {
+	i, err := c.nearestIndex(lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	return c.node(i), nil
+}
+
+// nearestIndex returns the index of the node closest to a point
+func (c *csrGraph) nearestIndex(lat, lon float64) (uint32, error) {
+	if len(c.NodeIDs) == 0 {
+		return 0, fmt.Errorf("graph is empty")
+	}
+	best, minDist := 0, math.MaxFloat64
+	for i := range c.NodeIDs {
+		if dist := HaversineDistance(lat, lon, c.Lat[i], c.Lon[i]); dist < minDist {
+			best, minDist = i, dist
+		}
+	}
+	return uint32(best), nil
+}
+
+// validate implements Validate: besides weights it checks that offsets and
+// indices stay within the arrays, as they may come from a file
+func (c *csrGraph) validate() error {
+	n, m := len(c.NodeIDs), len(c.Head)
+	if n == 0 {
+		return fmt.Errorf("graph has no nodes")
+	}
+	if m == 0 {
+		return fmt.Errorf("graph has no edges")
+	}
+	for i := 1; i < n; i++ {
+		if c.NodeIDs[i] <= c.NodeIDs[i-1] {
+			return fmt.Errorf("node IDs are not sorted at index %d", i)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if c.FirstOut[i] > c.FirstOut[i+1] || c.FirstIn[i] > c.FirstIn[i+1] {
+			return fmt.Errorf("edge offsets of node %d decrease", c.NodeIDs[i])
+		}
+	}
+	for e := 0; e < m; e++ {
+		if int(c.Head[e]) >= n || int(c.InEdge[e]) >= m || int(c.Attr[e]) >= len(c.AttrWay) {
+			return fmt.Errorf("edge %d references data out of range", e)
+		}
+		if w := c.weight(uint32(e)); math.IsNaN(w) || math.IsInf(w, 0) || w < 0 {
+			return fmt.Errorf("edge %d has invalid weight %v", e, w)
+		}
+	}
+	for i := range c.AttrTags {
+		if int(c.AttrTags[i]) >= len(c.TagStart)-1 {
+			return fmt.Errorf("attribute %d references tag set out of range", i)
+		}
+	}
+	for i := 0; i+1 < len(c.TagStart); i++ {
+		if c.TagStart[i] > c.TagStart[i+1] {
+			return fmt.Errorf("tag offsets decrease at set %d", i)
+		}
+	}
+	for _, s := range c.TagPairs {
+		if int(s) >= len(c.StrStart)-1 {
+			return fmt.Errorf("tag references string out of range")
+		}
+	}
+	for i := 0; i+1 < len(c.StrStart); i++ {
+		if c.StrStart[i] > c.StrStart[i+1] {
+			return fmt.Errorf("string offsets decrease at string %d", i)
+		}
+	}
+	for i := 0; i+1 < len(c.WayStart); i++ {
+		if c.WayStart[i] > c.WayStart[i+1] {
+			return fmt.Errorf("way index offsets decrease at way %d", i)
+		}
+	}
+	for _, e := range c.WayEdges {
+		if int(e) >= m {
+			return fmt.Errorf("way index references edge out of range")
+		}
+	}
+	return nil
+}
+
+// export materializes the graph as adjacency maps
+func (c *csrGraph) export() (map[int64]*Node, map[int64][]Edge) {
+	nodes := make(map[int64]*Node, len(c.NodeIDs))
+	edges := make(map[int64][]Edge)
+	for i := range c.NodeIDs {
+		nodes[c.NodeIDs[i]] = c.node(uint32(i))
+		for e := c.FirstOut[i]; e < c.FirstOut[i+1]; e++ {
+			edges[c.NodeIDs[i]] = append(edges[c.NodeIDs[i]], c.edge(e, uint32(i)))
+		}
+	}
+	return nodes, edges
+}
+
+// thaw returns a copy of a CSR-backed snapshot that uses adjacency maps, so
+// it can be modified
+func (s *snapshot) thaw() *snapshot {
+	next := *s
+	next.nodes, next.edges = s.csr.export()
+	next.reverseEdges = make(map[int64][]Edge)
+	for _, edgeList := range next.edges {
+		for _, edge := range edgeList {
+			next.reverseEdges[edge.To] = append(next.reverseEdges[edge.To], edge)
+		}
+	}
+	next.csr = nil
+	next.rebuildWayIndex()
+	return &next
+}
@@ -4,67 +4,113 @@ import (
 	"fmt"
 	"math"
 	"sync"
+	"sync/atomic"
 )
 
 // Node represents a geographic point in the road network
 type Node struct {
-	ID  int64
-	Lat float64
-	Lon float64
+	ID        int64
+	Lat       float64
+	Lon       float64
+	Elevation float64 // Meters above sea level, NaN where unknown (only meaningful if the graph has elevation data)
 }
 
 // Edge represents a road segment between two nodes
 type Edge struct {
-	From   int64
-	To     int64
-	Weight float64 // Cost (distance, time, etc.)
+	From     int64
+	To       int64
+	Weight   float64 // Cost (distance, time, etc.)
 	OSMWayID int64
 	MaxSpeed float64
 	Tags     map[string]string
+	Reverse  bool // Edge runs against the node order of its OSM way
 }
 
-// Graph represents the road network
+// Graph represents the road network. Queries read the current snapshot
+// without locking. Weight changes copy the parts they modify and publish a
+// new snapshot, so a search that holds a snapshot (see Index) sees consistent
+// weights. Building methods (AddNode, AddEdge, AddRestriction, SetElevation,
+// ...) modify the current snapshot in place: a graph is built before it is
+// queried concurrently.
 type Graph struct {
-	nodes         map[int64]*Node
-	edges         map[int64][]Edge // adjacency list: nodeID -> outgoing edges
-	reverseEdges  map[int64][]Edge // reverse adjacency list: nodeID -> incoming edges
-	restrictions  map[int64][]TurnRestriction // nodeID -> turn restrictions at that node
-	mutex         sync.RWMutex
+	state    atomic.Pointer[snapshot]
+	mutex    sync.Mutex            // serializes writers
+	fallback atomic.Pointer[Index] // index view of a snapshot that cannot be compacted
+}
+
+// snapshot is the contents of a graph. Published snapshots are only modified
+// by building methods.
+type snapshot struct {
+	nodes        map[int64]*Node
+	edges        map[int64][]Edge            // adjacency list: nodeID -> outgoing edges
+	reverseEdges map[int64][]Edge            // reverse adjacency list: nodeID -> incoming edges
+	restrictions map[int64][]TurnRestriction // nodeID -> turn restrictions at that node
+	hasElevation bool                        // true once node elevations have been assigned
+	stations     []ChargingStation           // EV charging stations (not part of the road network)
+	signals      map[int64]bool              // nodes with traffic signals or stop signs
+	wayIndex     map[int64][]EdgeRef         // OSM way ID -> edges of that way
+	originals    map[EdgeRef]float64         // weights before runtime changes (modified edges only)
+	csr          *csrGraph                   // flat arrays serving nodes and edges instead of the maps above
 }
 
 // NewGraph creates a new empty graph
 func NewGraph() *Graph {
-	return &Graph{
-		nodes:         make(map[int64]*Node),
-		edges:         make(map[int64][]Edge),
-		reverseEdges:  make(map[int64][]Edge),
-		restrictions:  make(map[int64][]TurnRestriction),
+	g := &Graph{}
+	g.state.Store(&snapshot{
+		nodes:        make(map[int64]*Node),
+		edges:        make(map[int64][]Edge),
+		reverseEdges: make(map[int64][]Edge),
+		restrictions: make(map[int64][]TurnRestriction),
+		signals:      make(map[int64]bool),
+		wayIndex:     make(map[int64][]EdgeRef),
+		originals:    make(map[EdgeRef]float64),
+	})
+	return g
+}
+
+// building returns the snapshot building methods modify in place, converting
+// a CSR graph to adjacency maps first (caller holds the mutex)
+func (g *Graph) building() *snapshot {
+	s := g.state.Load()
+	if s.csr != nil {
+		s = s.thaw()
+		g.state.Store(s)
 	}
+	g.fallback.Store(nil)
+	return s
 }
 
 // AddNode adds a node to the graph
 func (g *Graph) AddNode(node *Node) {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
-	g.nodes[node.ID] = node
+	s := g.building()
+	s.nodes[node.ID] = node
 }
 
 // AddEdge adds an edge to the graph
 func (g *Graph) AddEdge(edge Edge) {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
-	g.edges[edge.From] = append(g.edges[edge.From], edge)
+	s := g.building()
+	s.edges[edge.From] = append(s.edges[edge.From], edge)
+	s.wayIndex[edge.OSMWayID] = append(s.wayIndex[edge.OSMWayID], EdgeRef{From: edge.From, Index: len(s.edges[edge.From]) - 1})
 	
 	// Also add to reverse adjacency list for bidirectional search
-	g.reverseEdges[edge.To] = append(g.reverseEdges[edge.To], edge)
+	s.reverseEdges[edge.To] = append(s.reverseEdges[edge.To], edge)
 }
 
 // GetNode returns a node by ID
 func (g *Graph) GetNode(id int64) (*Node, error) {
-	g.mutex.RLock()
-	defer g.mutex.RUnlock()
+	s := g.state.Load()
 	
-	node, exists := g.nodes[id]
+	if s.csr != nil {
+		if i, ok := s.csr.nodeIndex(id); ok {
+			return s.csr.node(i), nil
+		}
+		return nil, fmt.Errorf("node %d not found", id)
+	}
+	node, exists := s.nodes[id]
 	if !exists {
 		return nil, fmt.Errorf("node %d not found", id)
 	}
@@ -73,16 +119,40 @@ func (g *Graph) GetNode(id int64) (*Node, error) {
 
 // GetEdges returns all outgoing edges from a node
 func (g *Graph) GetEdges(nodeID int64) []Edge {
-	g.mutex.RLock()
-	defer g.mutex.RUnlock()
-	return g.edges[nodeID]
+	s := g.state.Load()
+	if s.csr != nil {
+		return s.csr.outEdges(nodeID)
+	}
+	return s.edges[nodeID]
+}
+
+// EdgeBetween returns the cheapest edge from one node to another
+func (g *Graph) EdgeBetween(from, to int64) (Edge, bool) {
+	s := g.state.Load()
+
+	var best *Edge
+	edges := s.edges[from]
+	if s.csr != nil {
+		edges = s.csr.outEdges(from)
+	}
+	for i := range edges {
+		if edges[i].To == to && (best == nil || edges[i].Weight < best.Weight) {
+			best = &edges[i]
+		}
+	}
+	if best == nil {
+		return Edge{}, false
+	}
+	return *best, true
 }
 
 // GetReverseEdges returns all incoming edges to a node
 func (g *Graph) GetReverseEdges(nodeID int64) []Edge {
-	g.mutex.RLock()
-	defer g.mutex.RUnlock()
-	return g.reverseEdges[nodeID]
+	s := g.state.Load()
+	if s.csr != nil {
+		return s.csr.inEdges(nodeID)
+	}
+	return s.reverseEdges[nodeID]
 }
 
 // UpdateEdgeWeight updates the weight of a specific edge
@@ -90,15 +160,17 @@ func (g *Graph) UpdateEdgeWeight(from, to int64, newWeight float64) error {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 	
-	edges, exists := g.edges[from]
-	if !exists {
+	s := g.state.Load()
+	edges := s.edgeList(from)
+	if len(edges) == 0 {
 		return fmt.Errorf("no edges from node %d", from)
 	}
 	
+	edit := s.edit()
 	found := false
 	for i := range edges {
 		if edges[i].To == to {
-			edges[i].Weight = newWeight
+			edit.setWeight(EdgeRef{From: from, Index: i}, newWeight)
 			found = true
 		}
 	}
@@ -107,6 +179,7 @@ func (g *Graph) UpdateEdgeWeight(from, to int64, newWeight float64) error {
 		return fmt.Errorf("edge from %d to %d not found", from, to)
 	}
 	
+	g.state.Store(edit.snapshot)
 	return nil
 }
 
@@ -115,32 +188,89 @@ func (g *Graph) UpdateEdgeWeightByWay(osmWayID int64, multiplier float64) int {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 	
-	count := 0
-	for _, edgeList := range g.edges {
-		for i := range edgeList {
-			if edgeList[i].OSMWayID == osmWayID {
-				edgeList[i].Weight *= multiplier
-				count++
-			}
+	s := g.state.Load()
+	refs := s.wayRefs(osmWayID)
+	edit := s.edit()
+	for _, ref := range refs {
+		edit.setWeight(ref, s.weightAt(ref)*multiplier)
+	}
+	g.state.Store(edit.snapshot)
+	return len(refs)
+}
+
+// CountEdgesByWay returns the number of directed edges belonging to an OSM way
+func (g *Graph) CountEdgesByWay(osmWayID int64) int {
+	s := g.state.Load()
+	return len(s.wayRefs(osmWayID))
+}
+
+// SetElevation assigns an elevation (in meters) to a node and marks the graph as elevation-aware.
+// Nodes that have not been assigned one have an unknown (NaN) elevation.
+func (g *Graph) SetElevation(nodeID int64, elevation float64) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	s := g.building()
+
+	node, exists := s.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+	if !s.hasElevation {
+		for _, other := range s.nodes {
+			other.Elevation = math.NaN()
 		}
+		s.hasElevation = true
 	}
-	return count
+	node.Elevation = elevation
+	return nil
+}
+
+// HasElevation reports whether node elevations are available
+func (g *Graph) HasElevation() bool {
+	s := g.state.Load()
+	return s.hasElevation
+}
+
+// ElevationChange returns the climb (m) between two elevations, or 0 if either is unknown
+func ElevationChange(from, to float64) float64 {
+	if math.IsNaN(from) || math.IsNaN(to) {
+		return 0
+	}
+	return to - from
+}
+
+// NodeIDs returns the IDs of all nodes in the graph
+func (g *Graph) NodeIDs() []int64 {
+	s := g.state.Load()
+
+	if s.csr != nil {
+		return append([]int64(nil), s.csr.NodeIDs...)
+	}
+	ids := make([]int64, 0, len(s.nodes))
+	for id := range s.nodes {
+		ids = append(ids, id)
+	}
+	return ids
 }
 
 // NodeCount returns the total number of nodes
 func (g *Graph) NodeCount() int {
-	g.mutex.RLock()
-	defer g.mutex.RUnlock()
-	return len(g.nodes)
+	s := g.state.Load()
+	if s.csr != nil {
+		return len(s.csr.NodeIDs)
+	}
+	return len(s.nodes)
 }
 
 // EdgeCount returns the total number of edges
 func (g *Graph) EdgeCount() int {
-	g.mutex.RLock()
-	defer g.mutex.RUnlock()
+	s := g.state.Load()
 	
+	if s.csr != nil {
+		return len(s.csr.Head)
+	}
 	count := 0
-	for _, edges := range g.edges {
+	for _, edges := range s.edges {
 		count += len(edges)
 	}
 	return count
@@ -148,17 +278,19 @@ func (g *Graph) EdgeCount() int {
 
 // FindNearestNode finds the closest node to given coordinates
 func (g *Graph) FindNearestNode(lat, lon float64) (*Node, error) {
-	g.mutex.RLock()
-	defer g.mutex.RUnlock()
+	s := g.state.Load()
 	
-	if len(g.nodes) == 0 {
+	if s.csr != nil {
+		return s.csr.nearest(lat, lon)
+	}
+	if len(s.nodes) == 0 {
 		return nil, fmt.Errorf("graph is empty")
 	}
 	
 	var nearest *Node
 	minDist := math.MaxFloat64
 	
-	for _, node := range g.nodes {
+	for _, node := range s.nodes {
 		dist := HaversineDistance(lat, lon, node.Lat, node.Lon)
 		if dist < minDist {
 			minDist = dist
@@ -187,3 +319,17 @@ func HaversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
 	return earthRadius * c
 }
 
+
+// InitialBearing calculates the initial bearing from the first point to the second (in degrees, 0-360)
+func InitialBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1Rad := lat1 * math.Pi / 180
+	lat2Rad := lat2 * math.Pi / 180
+	deltaLon := (lon2 - lon1) * math.Pi / 180
+
+	y := math.Sin(deltaLon) * math.Cos(lat2Rad)
+	x := math.Cos(lat1Rad)*math.Sin(lat2Rad) -
+		math.Sin(lat1Rad)*math.Cos(lat2Rad)*math.Cos(deltaLon)
+
+	bearing := math.Atan2(y, x) * 180 / math.Pi
+	return math.Mod(bearing+360, 360)
+}
@@ -0,0 +1,150 @@
+package graph
+
+// Index is a read view of one graph snapshot in CSR form that addresses nodes
+// and edges by dense uint32 indices, for searches that keep per-node state in
+// compact structures. It needs no locking and does not see later changes.
+type Index struct {
+	s *snapshot
+	c *csrGraph
+}
+
+// IndexedEdge is an edge together with its index and the indices of its nodes.
+// Its tag map is shared and must not be modified.
+type IndexedEdge struct {
+	Edge
+	ID   uint32 // Edge index
+	Tail uint32 // Index of the From node
+	Head uint32 // Index of the To node
+}
+
+// Index returns an index view of the current snapshot, compacting the graph
+// first if it still uses adjacency maps. A graph with edges to missing nodes
+// stays as it is; the view then leaves those edges out and is built once per
+// snapshot.
+func (g *Graph) Index() *Index {
+	s := g.state.Load()
+	if s.csr != nil {
+		return &Index{s: s, c: s.csr}
+	}
+	if x := g.fallback.Load(); x != nil && x.s == s {
+		return x
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if err := g.compact(); err != nil {
+		s := g.state.Load()
+		if x := g.fallback.Load(); x != nil && x.s == s {
+			return x
+		}
+		built, _ := buildCSR(s.nodes, s.edges, s.hasElevation)
+		x := &Index{s: s, c: newCSRGraph(built)}
+		g.fallback.Store(x)
+		return x
+	}
+	s = g.state.Load()
+	return &Index{s: s, c: s.csr}
+}
+
+// NodeCount returns the number of node indices
+func (x *Index) NodeCount() int {
+	return len(x.c.NodeIDs)
+}
+
+// EdgeCount returns the number of edge indices
+func (x *Index) EdgeCount() int {
+	return len(x.c.Head)
+}
+
+// Lookup returns the index of an OSM node ID
+func (x *Index) Lookup(id int64) (uint32, bool) {
+	return x.c.nodeIndex(id)
+}
+
+// NodeID returns the OSM ID of a node index
+func (x *Index) NodeID(i uint32) int64 {
+	return x.c.NodeIDs[i]
+}
+
+// Coord returns the coordinates of a node index
+func (x *Index) Coord(i uint32) (lat, lon float64) {
+	return x.c.Lat[i], x.c.Lon[i]
+}
+
+// Elevation returns the elevation of a node index, NaN if it is unknown or 0 if the graph has none
+func (x *Index) Elevation(i uint32) float64 {
+	if len(x.c.Elevation) == 0 {
+		return 0
+	}
+	return float64(x.c.Elevation[i])
+}
+
+// ElevationChange returns the climb (m) from one node index to another, or 0 if either elevation is unknown
+func (x *Index) ElevationChange(from, to uint32) float64 {
+	return ElevationChange(x.Elevation(from), x.Elevation(to))
+}
+
+// Nearest returns the index of the node closest to a point
+func (x *Index) Nearest(lat, lon float64) (uint32, error) {
+	return x.c.nearestIndex(lat, lon)
+}
+
+// Head returns the target node index of an edge index
+func (x *Index) Head(e uint32) uint32 {
+	return x.c.Head[e]
+}
+
+// Tail returns the source node index of an edge index
+func (x *Index) Tail(e uint32) uint32 {
+	return x.c.tail(e)
+}
+
+// OutEdgeRange returns the indices [first, end) of the edges leaving a node index
+func (x *Index) OutEdgeRange(i uint32) (first, end uint32) {
+	return x.c.FirstOut[i], x.c.FirstOut[i+1]
+}
+
+// InEdgeIDs returns the indices of the edges entering a node index. The slice
+// must not be modified.
+func (x *Index) InEdgeIDs(i uint32) []uint32 {
+	return x.c.InEdge[x.c.FirstIn[i]:x.c.FirstIn[i+1]]
+}
+
+// OutEdges appends the outgoing edges of a node index to buf
+func (x *Index) OutEdges(buf []IndexedEdge, i uint32) []IndexedEdge {
+	for e := x.c.FirstOut[i]; e < x.c.FirstOut[i+1]; e++ {
+		buf = append(buf, IndexedEdge{Edge: x.c.edge(e, i), ID: e, Tail: i, Head: x.c.Head[e]})
+	}
+	return buf
+}
+
+// InEdges appends the incoming edges of a node index to buf
+func (x *Index) InEdges(buf []IndexedEdge, i uint32) []IndexedEdge {
+	for p := x.c.FirstIn[i]; p < x.c.FirstIn[i+1]; p++ {
+		e := x.c.InEdge[p]
+		tail := x.c.tail(e)
+		buf = append(buf, IndexedEdge{Edge: x.c.edge(e, tail), ID: e, Tail: tail, Head: i})
+	}
+	return buf
+}
+
+// HasElevation reports whether node elevations are available
+func (x *Index) HasElevation() bool {
+	return x.s.hasElevation
+}
+
+// HasTrafficSignal reports whether vehicles usually have to stop at a node
+func (x *Index) HasTrafficSignal(nodeID int64) bool {
+	return x.s.signals[nodeID]
+}
+
+// IsValidTurn checks if a turn from one way to another is allowed
+func (x *Index) IsValidTurn(fromWayID, viaNodeID, toWayID int64) bool {
+	return x.s.isValidTurn(fromWayID, viaNodeID, toWayID)
+}
+
+// SameSnapshot reports whether two views show the same graph snapshot, so
+// they have the same edges and weights
+func (x *Index) SameSnapshot(y *Index) bool {
+	return x.s == y.s
+}
@@ -0,0 +1,38 @@
+package graph
+
+import "testing"
+
+func TestIndexWithDanglingEdge(t *testing.T) {
+	g := newWeightTestGraph()
+	g.AddEdge(Edge{From: 3, To: 4, Weight: 5, OSMWayID: 300})
+	if err := g.Compact(); err == nil {
+		t.Fatal("Compact accepted an edge to a missing node")
+	}
+
+	x := g.Index()
+	if y := g.Index(); y.c != x.c {
+		t.Error("Index rebuilt the view of an unchanged snapshot")
+	}
+	if x.EdgeCount() != 2 {
+		t.Errorf("edge count = %d, want 2 without the dangling edge", x.EdgeCount())
+	}
+
+	// A new snapshot gets a new view with its weights
+	if _, err := g.ApplyWeightChanges([]WeightChange{{Edges: []EdgeRef{{From: 1, Index: 0}}, Op: WeightSet, Value: 99}}); err != nil {
+		t.Fatal(err)
+	}
+	y := g.Index()
+	if y.c == x.c {
+		t.Fatal("Index reused the view of an old snapshot")
+	}
+	from, _ := y.Lookup(1)
+	if edges := y.OutEdges(nil, from); edges[0].Weight != 99 {
+		t.Errorf("weight = %v, want 99", edges[0].Weight)
+	}
+
+	// Building methods modify the snapshot in place
+	g.AddEdge(Edge{From: 3, To: 1, Weight: 7, OSMWayID: 400})
+	if z := g.Index(); z.c == y.c || z.EdgeCount() != 3 {
+		t.Errorf("Index after AddEdge has %d edges, want a new view with 3", z.EdgeCount())
+	}
+}
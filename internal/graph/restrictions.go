@@ -24,29 +24,28 @@ func (g *Graph) AddRestriction(restriction TurnRestriction) {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 	
-	if g.restrictions == nil {
-		g.restrictions = make(map[int64][]TurnRestriction)
+	s := g.state.Load()
+	if s.restrictions == nil {
+		s.restrictions = make(map[int64][]TurnRestriction)
 	}
 	
 	// Index by via node for fast lookup during routing
-	g.restrictions[restriction.ViaNode] = append(g.restrictions[restriction.ViaNode], restriction)
+	s.restrictions[restriction.ViaNode] = append(s.restrictions[restriction.ViaNode], restriction)
 }
 
 // GetRestrictions returns all turn restrictions at a node
 func (g *Graph) GetRestrictions(nodeID int64) []TurnRestriction {
-	g.mutex.RLock()
-	defer g.mutex.RUnlock()
-	
-	if g.restrictions == nil {
-		return nil
-	}
-	
-	return g.restrictions[nodeID]
+	return g.state.Load().restrictions[nodeID]
 }
 
 // IsValidTurn checks if a turn from one way to another is allowed
 func (g *Graph) IsValidTurn(fromWayID, viaNodeID, toWayID int64) bool {
-	restrictions := g.GetRestrictions(viaNodeID)
+	return g.state.Load().isValidTurn(fromWayID, viaNodeID, toWayID)
+}
+
+// isValidTurn implements IsValidTurn
+func (s *snapshot) isValidTurn(fromWayID, viaNodeID, toWayID int64) bool {
+	restrictions := s.restrictions[viaNodeID]
 	
 	if len(restrictions) == 0 {
 		return true // No restrictions, turn is allowed
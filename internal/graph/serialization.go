@@ -2,22 +2,55 @@ package graph
 
 // ExportData exports graph data for serialization
 type ExportData struct {
-	Nodes         map[int64]*Node
-	Edges         map[int64][]Edge
-	ReverseEdges  map[int64][]Edge
-	Restrictions  map[int64][]TurnRestriction
+	Nodes        map[int64]*Node
+	Edges        map[int64][]Edge
+	ReverseEdges map[int64][]Edge
+	Restrictions map[int64][]TurnRestriction
+	HasElevation bool
+	Stations     []ChargingStation
+	Signals      map[int64]bool
 }
 
 // Export exports the graph data
 func (g *Graph) Export() *ExportData {
-	g.mutex.RLock()
-	defer g.mutex.RUnlock()
+	s := g.state.Load()
 	
+	if s.csr != nil {
+		return s.csrExport()
+	}
 	return &ExportData{
-		Nodes:         g.nodes,
-		Edges:         g.edges,
-		ReverseEdges:  g.reverseEdges,
-		Restrictions:  g.restrictions,
+		Nodes:        s.nodes,
+		Edges:        s.edges,
+		ReverseEdges: s.reverseEdges,
+		Restrictions: s.restrictions,
+		HasElevation: s.hasElevation,
+		Stations:     s.stations,
+		Signals:      s.signals,
+	}
+}
+
+// ExportExtras returns the data stored besides nodes and edges: restrictions,
+// signals, stations and whether nodes have elevations
+func (g *Graph) ExportExtras() *ExportData {
+	s := g.state.Load()
+	return &ExportData{
+		Restrictions: s.restrictions,
+		HasElevation: s.hasElevation,
+		Stations:     s.stations,
+		Signals:      s.signals,
+	}
+}
+
+// csrExport materializes a CSR-backed snapshot
+func (s *snapshot) csrExport() *ExportData {
+	nodes, edges := s.csr.export()
+	return &ExportData{
+		Nodes:        nodes,
+		Edges:        edges,
+		Restrictions: s.restrictions,
+		HasElevation: s.hasElevation,
+		Stations:     s.stations,
+		Signals:      s.signals,
 	}
 }
 
@@ -26,25 +59,38 @@ func (g *Graph) Import(data *ExportData) {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 	
-	g.nodes = data.Nodes
-	g.edges = data.Edges
+	s := &snapshot{
+		nodes:        data.Nodes,
+		edges:        data.Edges,
+		hasElevation: data.HasElevation,
+		stations:     data.Stations,
+		originals:    make(map[EdgeRef]float64),
+	}
+	s.rebuildWayIndex()
+
+	if data.Signals != nil {
+		s.signals = data.Signals
+	} else {
+		s.signals = make(map[int64]bool)
+	}
 	
 	if data.ReverseEdges != nil {
-		g.reverseEdges = data.ReverseEdges
+		s.reverseEdges = data.ReverseEdges
 	} else {
 		// Rebuild reverse edges if not present in data
-		g.reverseEdges = make(map[int64][]Edge)
+		s.reverseEdges = make(map[int64][]Edge)
 		for _, edgeList := range data.Edges {
 			for _, edge := range edgeList {
-				g.reverseEdges[edge.To] = append(g.reverseEdges[edge.To], edge)
+				s.reverseEdges[edge.To] = append(s.reverseEdges[edge.To], edge)
 			}
 		}
 	}
 	
 	if data.Restrictions != nil {
-		g.restrictions = data.Restrictions
+		s.restrictions = data.Restrictions
 	} else {
-		g.restrictions = make(map[int64][]TurnRestriction)
+		s.restrictions = make(map[int64][]TurnRestriction)
 	}
+	g.state.Store(s)
 }
 
@@ -0,0 +1,18 @@
+package graph
+
+// AddTrafficSignal marks a node as controlled by traffic signals (or a stop sign)
+func (g *Graph) AddTrafficSignal(nodeID int64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	s := g.state.Load()
+	if s.signals == nil {
+		s.signals = make(map[int64]bool)
+	}
+	s.signals[nodeID] = true
+}
+
+// HasTrafficSignal reports whether vehicles usually have to stop at a node
+func (g *Graph) HasTrafficSignal(nodeID int64) bool {
+	return g.state.Load().signals[nodeID]
+}
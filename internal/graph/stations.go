@@ -0,0 +1,24 @@
+package graph
+
+// ChargingStation represents an EV charging station parsed from OSM
+type ChargingStation struct {
+	ID         int64 // OSM node ID
+	Lat        float64
+	Lon        float64
+	Name       string
+	PowerKW    float64  // Maximum charging power (0 if unknown)
+	Connectors []string // Socket types, e.g. "type2", "ccs", "chademo"
+}
+
+// AddChargingStation adds a charging station to the graph
+func (g *Graph) AddChargingStation(station ChargingStation) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	s := g.state.Load()
+	s.stations = append(s.stations, station)
+}
+
+// ChargingStations returns all charging stations stored in the graph
+func (g *Graph) ChargingStations() []ChargingStation {
+	return g.state.Load().stations
+}
@@ -0,0 +1,54 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+)
+
+// Validate checks that a loaded graph is usable for routing: it has nodes and
+// edges, every edge connects known nodes with a finite non-negative weight,
+// and the reverse adjacency list mirrors the forward one
+func (g *Graph) Validate() error {
+	s := g.state.Load()
+
+	if s.csr != nil {
+		return s.csr.validate()
+	}
+	if len(s.nodes) == 0 {
+		return fmt.Errorf("graph has no nodes")
+	}
+
+	forward := 0
+	for nodeID, edges := range s.edges {
+		for i := range edges {
+			edge := &edges[i]
+			if edge.From != nodeID {
+				return fmt.Errorf("edge %d->%d is listed under node %d", edge.From, edge.To, nodeID)
+			}
+			if s.nodes[edge.From] == nil || s.nodes[edge.To] == nil {
+				return fmt.Errorf("edge %d->%d references an unknown node", edge.From, edge.To)
+			}
+			if math.IsNaN(edge.Weight) || math.IsInf(edge.Weight, 0) || edge.Weight < 0 {
+				return fmt.Errorf("edge %d->%d has invalid weight %v", edge.From, edge.To, edge.Weight)
+			}
+		}
+		forward += len(edges)
+	}
+	if forward == 0 {
+		return fmt.Errorf("graph has no edges")
+	}
+
+	reverse := 0
+	for nodeID, edges := range s.reverseEdges {
+		for i := range edges {
+			if edges[i].To != nodeID {
+				return fmt.Errorf("reverse edge %d->%d is listed under node %d", edges[i].From, edges[i].To, nodeID)
+			}
+		}
+		reverse += len(edges)
+	}
+	if reverse != forward {
+		return fmt.Errorf("graph has %d edges but %d reverse edges", forward, reverse)
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package graph
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Weight update operations
+const (
+	WeightSet      = "set"      // Replace the weight with a value
+	WeightMultiply = "multiply" // Multiply the current weight by a value
+	WeightReset    = "reset"    // Restore the weight the graph was built or loaded with
+)
+
+// EdgeRef identifies an edge by its source node and position in that node's adjacency list
+type EdgeRef struct {
+	From  int64
+	Index int
+}
+
+// WeightChange applies one operation to a set of edges
+type WeightChange struct {
+	Edges []EdgeRef
+	Op    string
+	Value float64
+}
+
+// WeightDelta records how an edge weight changed
+type WeightDelta struct {
+	Ref      EdgeRef
+	To       int64
+	OSMWayID int64
+	Old      float64
+	New      float64
+}
+
+// EdgesByWay returns references to all directed edges of an OSM way
+func (g *Graph) EdgesByWay(osmWayID int64) []EdgeRef {
+	return append([]EdgeRef(nil), g.state.Load().wayRefs(osmWayID)...)
+}
+
+// wayRefs returns the edges of a way (the result may be shared with the index)
+func (s *snapshot) wayRefs(osmWayID int64) []EdgeRef {
+	if s.csr != nil {
+		return s.csr.wayEdges(osmWayID)
+	}
+	return s.wayIndex[osmWayID]
+}
+
+// edgeList returns the outgoing edges of a node
+func (s *snapshot) edgeList(nodeID int64) []Edge {
+	if s.csr != nil {
+		return s.csr.outEdges(nodeID)
+	}
+	return s.edges[nodeID]
+}
+
+// weightAt returns the current weight of an existing edge
+func (s *snapshot) weightAt(ref EdgeRef) float64 {
+	if s.csr != nil {
+		e, _ := s.csr.edgeIndex(ref)
+		return s.csr.weight(e)
+	}
+	return s.edges[ref.From][ref.Index].Weight
+}
+
+// EdgeRefsBetween returns references to all edges from one node to another
+func (g *Graph) EdgeRefsBetween(from, to int64) []EdgeRef {
+	var refs []EdgeRef
+	for i, edge := range g.state.Load().edgeList(from) {
+		if edge.To == to {
+			refs = append(refs, EdgeRef{From: from, Index: i})
+		}
+	}
+	return refs
+}
+
+// EdgeAt returns the edge a reference points to
+func (g *Graph) EdgeAt(ref EdgeRef) (Edge, bool) {
+	s := g.state.Load()
+	if !s.hasEdge(ref) {
+		return Edge{}, false
+	}
+	return s.edgeAt(ref), true
+}
+
+// ForEachEdge calls fn for every edge with its end nodes until fn returns false
+func (g *Graph) ForEachEdge(fn func(ref EdgeRef, edge *Edge, from, to *Node) bool) {
+	s := g.state.Load()
+	if s.csr != nil {
+		s.csr.forEachEdge(fn)
+		return
+	}
+	for nodeID, edges := range s.edges {
+		from := s.nodes[nodeID]
+		for i := range edges {
+			to := s.nodes[edges[i].To]
+			if from == nil || to == nil {
+				continue
+			}
+			edge := edges[i]
+			if !fn(EdgeRef{From: nodeID, Index: i}, &edge, from, to) {
+				return
+			}
+		}
+	}
+}
+
+// OriginalWeight returns the weight an edge had before any runtime change
+func (g *Graph) OriginalWeight(ref EdgeRef) (float64, bool) {
+	s := g.state.Load()
+	if weight, modified := s.originals[ref]; modified {
+		return weight, true
+	}
+	if !s.hasEdge(ref) {
+		return 0, false
+	}
+	return s.weightAt(ref), true
+}
+
+// ModifiedEdgeCount returns the number of edges whose weight differs from the original
+func (g *Graph) ModifiedEdgeCount() int {
+	return len(g.state.Load().originals)
+}
+
+// ApplyWeightChanges applies a batch of weight changes atomically: either every
+// change is applied, in order, or none is. Readers see all of them at once.
+// Returns one delta per modified edge.
+func (g *Graph) ApplyWeightChanges(changes []WeightChange) ([]WeightDelta, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	s := g.state.Load()
+	for i, change := range changes {
+		switch change.Op {
+		case WeightSet, WeightMultiply:
+			if change.Value <= 0 {
+				return nil, fmt.Errorf("change %d: %s needs a positive value", i, change.Op)
+			}
+		case WeightReset:
+		default:
+			return nil, fmt.Errorf("change %d: unknown operation %q", i, change.Op)
+		}
+		for _, ref := range change.Edges {
+			if !s.hasEdge(ref) {
+				return nil, fmt.Errorf("change %d: edge %d/%d does not exist", i, ref.From, ref.Index)
+			}
+		}
+	}
+
+	edit := s.edit()
+	var deltas []WeightDelta
+	for _, change := range changes {
+		for _, ref := range change.Edges {
+			edge := edit.edgeAt(ref)
+			old := edge.Weight
+
+			weight := old
+			switch change.Op {
+			case WeightSet:
+				weight = change.Value
+			case WeightMultiply:
+				weight = old * change.Value
+			case WeightReset:
+				if original, modified := edit.originals[ref]; modified {
+					weight = original
+				}
+			}
+			if weight == old {
+				continue
+			}
+
+			edit.setWeight(ref, weight)
+			deltas = append(deltas, WeightDelta{Ref: ref, To: edge.To, OSMWayID: edge.OSMWayID, Old: old, New: weight})
+		}
+	}
+	if len(deltas) > 0 {
+		g.state.Store(edit.snapshot)
+	}
+	return deltas, nil
+}
+
+// hasEdge reports whether a reference points to an edge
+func (s *snapshot) hasEdge(ref EdgeRef) bool {
+	if s.csr != nil {
+		_, ok := s.csr.edgeIndex(ref)
+		return ok
+	}
+	return ref.Index >= 0 && ref.Index < len(s.edges[ref.From])
+}
+
+// edgeAt returns an existing edge
+func (s *snapshot) edgeAt(ref EdgeRef) Edge {
+	if s.csr != nil {
+		e, _ := s.csr.edgeIndex(ref)
+		return s.csr.edge(e, s.csr.tail(e))
+	}
+	return s.edges[ref.From][ref.Index]
+}
+
+// weightEdit is the snapshot that replaces another one after weight changes.
+// Edge lists, weight chunks and the original weights are copied before they
+// are first written, so readers of the old snapshot are not affected.
+type weightEdit struct {
+	*snapshot
+	lists   map[int64]bool // Copied adjacency lists
+	reverse map[int64]bool // Copied reverse adjacency lists
+	chunks  map[int]bool   // Copied weight chunks
+}
+
+// edit starts weight changes on a copy of the snapshot. For a CSR graph
+// the copy shares everything but the weight chunk table. Adjacency maps are
+// copied shallowly, which takes time linear in the number of nodes per batch;
+// that is acceptable because maps are only used while a graph is built (or
+// when Compact fails), and served graphs are compacted.
+func (s *snapshot) edit() *weightEdit {
+	next := *s
+	next.originals = maps.Clone(s.originals)
+	if next.originals == nil {
+		next.originals = make(map[EdgeRef]float64)
+	}
+	edit := &weightEdit{snapshot: &next}
+	if s.csr != nil {
+		next.csr = s.csr.withWeights()
+		edit.chunks = make(map[int]bool)
+	} else {
+		next.edges = maps.Clone(s.edges)
+		next.reverseEdges = maps.Clone(s.reverseEdges)
+		edit.lists = make(map[int64]bool)
+		edit.reverse = make(map[int64]bool)
+	}
+	return edit
+}
+
+// setWeight changes an edge weight in both adjacency lists, remembering the
+// original weight
+func (e *weightEdit) setWeight(ref EdgeRef, weight float64) {
+	original, modified := e.originals[ref]
+	if !modified {
+		original = e.weightAt(ref)
+		e.originals[ref] = original
+	}
+	if weight == original {
+		delete(e.originals, ref)
+	}
+
+	if e.csr != nil {
+		// Incoming edges refer to the same weight
+		i, _ := e.csr.edgeIndex(ref)
+		chunk := int(i / weightChunk)
+		if !e.chunks[chunk] {
+			e.csr.weights[chunk] = slices.Clone(e.csr.weights[chunk])
+			e.chunks[chunk] = true
+		}
+		e.csr.weights[chunk][i%weightChunk] = weight
+		return
+	}
+	if !e.lists[ref.From] {
+		e.edges[ref.From] = slices.Clone(e.edges[ref.From])
+		e.lists[ref.From] = true
+	}
+	edge := &e.edges[ref.From][ref.Index]
+
+	if rev := e.reverseSlot(ref); rev >= 0 {
+		if !e.reverse[edge.To] {
+			e.reverseEdges[edge.To] = slices.Clone(e.reverseEdges[edge.To])
+			e.reverse[edge.To] = true
+		}
+		e.reverseEdges[edge.To][rev].Weight = weight
+	}
+	edge.Weight = weight
+}
+
+// reverseSlot finds the copy of an edge in the reverse adjacency list of its
+// target node. Parallel edges are paired up by their order of appearance.
+func (s *snapshot) reverseSlot(ref EdgeRef) int {
+	edges := s.edges[ref.From]
+	edge := edges[ref.Index]
+	same := func(e *Edge) bool {
+		return e.From == edge.From && e.To == edge.To && e.OSMWayID == edge.OSMWayID && e.Reverse == edge.Reverse
+	}
+
+	occurrence := 0
+	for i := 0; i < ref.Index; i++ {
+		if same(&edges[i]) {
+			occurrence++
+		}
+	}
+
+	reverse := s.reverseEdges[edge.To]
+	for i := range reverse {
+		if same(&reverse[i]) {
+			if occurrence == 0 {
+				return i
+			}
+			occurrence--
+		}
+	}
+	return -1
+}
+
+// rebuildWayIndex indexes all edges by OSM way ID
+func (s *snapshot) rebuildWayIndex() {
+	s.wayIndex = make(map[int64][]EdgeRef)
+	for nodeID, edges := range s.edges {
+		for i := range edges {
+			s.wayIndex[edges[i].OSMWayID] = append(s.wayIndex[edges[i].OSMWayID], EdgeRef{From: nodeID, Index: i})
+		}
+	}
+}
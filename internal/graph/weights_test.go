@@ -0,0 +1,124 @@
+package graph
+
+import "testing"
+
+// newWeightTestGraph builds 1 -> 2 -> 3 with weights 10 and 20
+func newWeightTestGraph() *Graph {
+	g := NewGraph()
+	for i, id := range []int64{1, 2, 3} {
+		g.AddNode(&Node{ID: id, Lat: 43.7, Lon: 7.4 + float64(i)*0.001})
+	}
+	g.AddEdge(Edge{From: 1, To: 2, Weight: 10, OSMWayID: 100})
+	g.AddEdge(Edge{From: 2, To: 3, Weight: 20, OSMWayID: 200})
+	return g
+}
+
+func TestApplyWeightChanges(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		name := "maps"
+		if compact {
+			name = "csr"
+		}
+		t.Run(name, func(t *testing.T) {
+			g := newWeightTestGraph()
+			if compact {
+				if err := g.Compact(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ref := EdgeRef{From: 1, Index: 0}
+
+			deltas, err := g.ApplyWeightChanges([]WeightChange{
+				{Edges: []EdgeRef{ref}, Op: WeightMultiply, Value: 3},
+				{Edges: g.EdgesByWay(200), Op: WeightSet, Value: 5},
+			})
+			if err != nil {
+				t.Fatalf("ApplyWeightChanges: %v", err)
+			}
+			if len(deltas) != 2 || deltas[0].Old != 10 || deltas[0].New != 30 || deltas[1].Old != 20 || deltas[1].New != 5 {
+				t.Fatalf("deltas = %+v, want 10 -> 30 and 20 -> 5", deltas)
+			}
+			if edge, _ := g.EdgeAt(ref); edge.Weight != 30 {
+				t.Errorf("weight = %v, want 30", edge.Weight)
+			}
+			if edges := g.GetReverseEdges(2); len(edges) != 1 || edges[0].Weight != 30 {
+				t.Errorf("reverse edges = %+v, want weight 30", edges)
+			}
+			if original, _ := g.OriginalWeight(ref); original != 10 {
+				t.Errorf("original weight = %v, want 10", original)
+			}
+			if n := g.ModifiedEdgeCount(); n != 2 {
+				t.Errorf("modified edges = %d, want 2", n)
+			}
+
+			// Reset restores the original weight, however often it changed
+			if _, err := g.ApplyWeightChanges([]WeightChange{{Edges: []EdgeRef{ref}, Op: WeightMultiply, Value: 2}}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := g.ApplyWeightChanges([]WeightChange{{Edges: []EdgeRef{ref}, Op: WeightReset}}); err != nil {
+				t.Fatal(err)
+			}
+			if edge, _ := g.EdgeAt(ref); edge.Weight != 10 {
+				t.Errorf("weight after reset = %v, want 10", edge.Weight)
+			}
+			if edges := g.GetReverseEdges(2); edges[0].Weight != 10 {
+				t.Errorf("reverse weight after reset = %v, want 10", edges[0].Weight)
+			}
+			if n := g.ModifiedEdgeCount(); n != 1 {
+				t.Errorf("modified edges after reset = %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestApplyWeightChangesKeepsSnapshots(t *testing.T) {
+	t.Run("maps", func(t *testing.T) {
+		g := newWeightTestGraph()
+		held := g.state.Load()
+		if _, err := g.ApplyWeightChanges([]WeightChange{{Edges: []EdgeRef{{From: 1, Index: 0}}, Op: WeightSet, Value: 99}}); err != nil {
+			t.Fatal(err)
+		}
+		if w := held.edges[1][0].Weight; w != 10 {
+			t.Errorf("held snapshot weight = %v, want 10", w)
+		}
+		if w := held.reverseEdges[2][0].Weight; w != 10 {
+			t.Errorf("held snapshot reverse weight = %v, want 10", w)
+		}
+		if len(held.originals) != 0 {
+			t.Errorf("held snapshot has %d modified edges, want 0", len(held.originals))
+		}
+	})
+
+	t.Run("csr", func(t *testing.T) {
+		g := newWeightTestGraph()
+		x := g.Index()
+		from, _ := x.Lookup(1)
+		if _, err := g.ApplyWeightChanges([]WeightChange{{Edges: []EdgeRef{{From: 1, Index: 0}}, Op: WeightSet, Value: 99}}); err != nil {
+			t.Fatal(err)
+		}
+		if edges := x.OutEdges(nil, from); len(edges) != 1 || edges[0].Weight != 10 {
+			t.Errorf("held index edges = %+v, want weight 10", edges)
+		}
+		y := g.Index()
+		if edges := y.OutEdges(nil, from); edges[0].Weight != 99 {
+			t.Errorf("new index weight = %v, want 99", edges[0].Weight)
+		}
+		if x.SameSnapshot(y) {
+			t.Error("index views of different snapshots report the same snapshot")
+		}
+	})
+}
+
+func TestApplyWeightChangesIsAtomic(t *testing.T) {
+	g := newWeightTestGraph()
+	_, err := g.ApplyWeightChanges([]WeightChange{
+		{Edges: []EdgeRef{{From: 1, Index: 0}}, Op: WeightSet, Value: 50},
+		{Edges: []EdgeRef{{From: 3, Index: 0}}, Op: WeightSet, Value: 50},
+	})
+	if err == nil {
+		t.Fatal("ApplyWeightChanges accepted a missing edge")
+	}
+	if edge, _ := g.EdgeAt(EdgeRef{From: 1, Index: 0}); edge.Weight != 10 {
+		t.Errorf("weight = %v after a failed batch, want 10", edge.Weight)
+	}
+}
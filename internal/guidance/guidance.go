@@ -0,0 +1,237 @@
+package guidance
+
+import (
+	"math"
+	"strings"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// Maneuver types
+const (
+	TypeDepart   = "depart"
+	TypeArrive   = "arrive"
+	TypeTurn     = "turn"
+	TypeContinue = "continue"
+	TypeOnRamp   = "on ramp"
+	TypeOffRamp  = "off ramp"
+	TypeMerge    = "merge"
+)
+
+// Maneuver modifiers (direction of the turn)
+const (
+	ModifierUTurn       = "uturn"
+	ModifierSharpRight  = "sharp right"
+	ModifierRight       = "right"
+	ModifierSlightRight = "slight right"
+	ModifierStraight    = "straight"
+	ModifierSlightLeft  = "slight left"
+	ModifierLeft        = "left"
+	ModifierSharpLeft   = "sharp left"
+)
+
+// Maneuver describes a single instruction along a route
+type Maneuver struct {
+	Type          string     `json:"type"`
+	Modifier      string     `json:"modifier,omitempty"`
+	Location      [2]float64 `json:"location"` // [lon, lat]
+	BearingBefore int        `json:"bearing_before"`
+	BearingAfter  int        `json:"bearing_after"`
+	Name          string     `json:"name,omitempty"`
+	Ref           string     `json:"ref,omitempty"`
+	Distance      float64    `json:"distance"` // Meters until the next maneuver
+	Lanes         []Lane     `json:"lanes,omitempty"`
+	Destinations  string     `json:"destinations,omitempty"`
+}
+
+// BuildManeuvers derives turn-by-turn maneuvers for a route given as a node sequence
+func BuildManeuvers(g *graph.Graph, nodes []int64) []Maneuver {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	coords := make([]*graph.Node, len(nodes))
+	for i, id := range nodes {
+		node, err := g.GetNode(id)
+		if err != nil {
+			return nil
+		}
+		coords[i] = node
+	}
+
+	edges := PathEdges(g, nodes)
+	if len(edges) == 0 {
+		location := [2]float64{coords[0].Lon, coords[0].Lat}
+		return []Maneuver{
+			{Type: TypeDepart, Location: location},
+			{Type: TypeArrive, Location: location},
+		}
+	}
+
+	bearings := make([]float64, len(edges))
+	lengths := make([]float64, len(edges))
+	for i := range edges {
+		from, to := coords[i], coords[i+1]
+		bearings[i] = graph.InitialBearing(from.Lat, from.Lon, to.Lat, to.Lon)
+		lengths[i] = graph.HaversineDistance(from.Lat, from.Lon, to.Lat, to.Lon)
+	}
+
+	first := edges[0]
+	maneuvers := []Maneuver{{
+		Type:         TypeDepart,
+		Location:     [2]float64{coords[0].Lon, coords[0].Lat},
+		BearingAfter: roundBearing(bearings[0]),
+		Name:         first.Tags["name"],
+		Ref:          first.Tags["ref"],
+		Destinations: formatDestinations(first.Tags),
+	}}
+
+	for i := 1; i < len(edges); i++ {
+		in, out := edges[i-1], edges[i]
+		maneuvers[len(maneuvers)-1].Distance += lengths[i-1]
+
+		if in.OSMWayID == out.OSMWayID {
+			continue
+		}
+
+		modifier := turnModifier(bearings[i-1], bearings[i])
+		maneuverType := classify(in, out, modifier)
+		if maneuverType == "" {
+			continue
+		}
+
+		maneuvers = append(maneuvers, Maneuver{
+			Type:          maneuverType,
+			Modifier:      modifier,
+			Location:      [2]float64{coords[i].Lon, coords[i].Lat},
+			BearingBefore: roundBearing(bearings[i-1]),
+			BearingAfter:  roundBearing(bearings[i]),
+			Name:          out.Tags["name"],
+			Ref:           out.Tags["ref"],
+			Lanes:         LanesForManeuver(in.Tags["turn:lanes"], modifier),
+			Destinations:  formatDestinations(out.Tags),
+		})
+	}
+	maneuvers[len(maneuvers)-1].Distance += lengths[len(lengths)-1]
+
+	last := coords[len(coords)-1]
+	maneuvers = append(maneuvers, Maneuver{
+		Type:          TypeArrive,
+		Location:      [2]float64{last.Lon, last.Lat},
+		BearingBefore: roundBearing(bearings[len(bearings)-1]),
+	})
+
+	return maneuvers
+}
+
+// PathEdges returns the edges connecting consecutive nodes of a route.
+// When parallel edges exist the cheapest one is used.
+func PathEdges(g *graph.Graph, nodes []int64) []graph.Edge {
+	if len(nodes) < 2 {
+		return nil
+	}
+
+	edges := make([]graph.Edge, 0, len(nodes)-1)
+	for i := 0; i < len(nodes)-1; i++ {
+		edge, exists := g.EdgeBetween(nodes[i], nodes[i+1])
+		if !exists {
+			return nil
+		}
+		edges = append(edges, edge)
+	}
+
+	return edges
+}
+
+// classify decides the maneuver type at a way change, returning "" when no
+// instruction is needed (e.g. the same road continues under a new way ID)
+func classify(in, out graph.Edge, modifier string) string {
+	inLink := isLink(in.Tags["highway"])
+	outLink := isLink(out.Tags["highway"])
+
+	switch {
+	case !inLink && outLink:
+		if isMotorway(in.Tags["highway"]) {
+			return TypeOffRamp
+		}
+		return TypeOnRamp
+	case inLink && !outLink && isMotorway(out.Tags["highway"]):
+		return TypeMerge
+	}
+
+	if modifier != ModifierStraight {
+		return TypeTurn
+	}
+
+	if in.Tags["name"] != out.Tags["name"] || in.Tags["ref"] != out.Tags["ref"] {
+		return TypeContinue
+	}
+
+	return ""
+}
+
+// turnModifier maps the change of bearing at an intersection to a modifier
+func turnModifier(bearingBefore, bearingAfter float64) string {
+	angle := math.Mod(bearingAfter-bearingBefore+540, 360) - 180 // (-180, 180], positive is right
+
+	switch abs := math.Abs(angle); {
+	case abs < 20:
+		return ModifierStraight
+	case abs >= 170:
+		return ModifierUTurn
+	case angle > 0 && abs < 60:
+		return ModifierSlightRight
+	case angle > 0 && abs < 120:
+		return ModifierRight
+	case angle > 0:
+		return ModifierSharpRight
+	case abs < 60:
+		return ModifierSlightLeft
+	case abs < 120:
+		return ModifierLeft
+	default:
+		return ModifierSharpLeft
+	}
+}
+
+// formatDestinations builds a signpost text such as "A 8: München; Salzburg"
+func formatDestinations(tags map[string]string) string {
+	destination := strings.Join(splitValues(tags["destination"]), ", ")
+	ref := strings.Join(splitValues(tags["destination:ref"]), ", ")
+
+	switch {
+	case ref != "" && destination != "":
+		return ref + ": " + destination
+	case ref != "":
+		return ref
+	default:
+		return destination
+	}
+}
+
+// splitValues splits an OSM multi-value tag ("a;b") into trimmed values
+func splitValues(value string) []string {
+	if value == "" {
+		return nil
+	}
+	parts := strings.Split(value, ";")
+	values := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+func isLink(highway string) bool {
+	return strings.HasSuffix(highway, "_link")
+}
+
+func isMotorway(highway string) bool {
+	return highway == "motorway" || highway == "trunk"
+}
+
+func roundBearing(bearing float64) int {
+	return int(math.Round(bearing)) % 360
+}
@@ -0,0 +1,75 @@
+package guidance
+
+import (
+	"testing"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+func TestLanesForManeuver(t *testing.T) {
+	lanes := LanesForManeuver("left|left;through|through|right", ModifierLeft)
+	if len(lanes) != 4 {
+		t.Fatalf("Expected 4 lanes, got %d", len(lanes))
+	}
+
+	expected := []struct{ valid, active bool }{
+		{true, true},
+		{true, false},
+		{false, false},
+		{false, false},
+	}
+	for i, e := range expected {
+		if lanes[i].Valid != e.valid || lanes[i].Active != e.active {
+			t.Errorf("Lane %d: expected valid=%v active=%v, got valid=%v active=%v",
+				i, e.valid, e.active, lanes[i].Valid, lanes[i].Active)
+		}
+	}
+}
+
+func TestLanesForManeuverEmptyLane(t *testing.T) {
+	lanes := LanesForManeuver("left||right", ModifierStraight)
+	if len(lanes) != 3 {
+		t.Fatalf("Expected 3 lanes, got %d", len(lanes))
+	}
+	if lanes[1].Indications[0] != "none" || !lanes[1].Valid || !lanes[1].Active {
+		t.Errorf("Expected unmarked middle lane to be valid and active for straight, got %+v", lanes[1])
+	}
+}
+
+func TestBuildManeuvers(t *testing.T) {
+	g := graph.NewGraph()
+	g.AddNode(&graph.Node{ID: 1, Lat: 43.7300, Lon: 7.4200})
+	g.AddNode(&graph.Node{ID: 2, Lat: 43.7310, Lon: 7.4200})
+	g.AddNode(&graph.Node{ID: 3, Lat: 43.7310, Lon: 7.4190})
+
+	g.AddEdge(graph.Edge{From: 1, To: 2, Weight: 111, OSMWayID: 10, Tags: map[string]string{
+		"highway":    "primary",
+		"name":       "Main Street",
+		"turn:lanes": "left|through",
+	}})
+	g.AddEdge(graph.Edge{From: 2, To: 3, Weight: 80, OSMWayID: 11, Tags: map[string]string{
+		"highway":         "secondary",
+		"name":            "Side Street",
+		"destination":     "Nice;Menton",
+		"destination:ref": "D 6007",
+	}})
+
+	maneuvers := BuildManeuvers(g, []int64{1, 2, 3})
+	if len(maneuvers) != 3 {
+		t.Fatalf("Expected 3 maneuvers, got %d", len(maneuvers))
+	}
+
+	turn := maneuvers[1]
+	if turn.Type != TypeTurn || turn.Modifier != ModifierLeft {
+		t.Errorf("Expected left turn, got %s %s", turn.Type, turn.Modifier)
+	}
+	if len(turn.Lanes) != 2 || !turn.Lanes[0].Active || turn.Lanes[1].Valid {
+		t.Errorf("Unexpected lanes: %+v", turn.Lanes)
+	}
+	if turn.Destinations != "D 6007: Nice, Menton" {
+		t.Errorf("Unexpected destinations: %q", turn.Destinations)
+	}
+	if maneuvers[2].Type != TypeArrive {
+		t.Errorf("Expected arrive, got %s", maneuvers[2].Type)
+	}
+}
@@ -0,0 +1,111 @@
+package guidance
+
+import "strings"
+
+// Lane describes a single lane at a maneuver
+type Lane struct {
+	Indications []string `json:"indications"` // OSM turn:lanes values, e.g. "left", "through"
+	Valid       bool     `json:"valid"`       // Lane can be used to perform the maneuver
+	Active      bool     `json:"active"`      // Lane is recommended for the maneuver
+}
+
+// modifierIndications lists the turn:lanes indications that match a modifier
+// exactly, followed by looser matches used when no lane matches exactly
+var modifierIndications = map[string][2][]string{
+	ModifierStraight:    {{"through"}, {"none", "slight_left", "slight_right"}},
+	ModifierSlightRight: {{"slight_right"}, {"right", "merge_to_right", "through"}},
+	ModifierRight:       {{"right"}, {"slight_right", "sharp_right"}},
+	ModifierSharpRight:  {{"sharp_right"}, {"right"}},
+	ModifierSlightLeft:  {{"slight_left"}, {"left", "merge_to_left", "through"}},
+	ModifierLeft:        {{"left"}, {"slight_left", "sharp_left"}},
+	ModifierSharpLeft:   {{"sharp_left"}, {"left"}},
+	ModifierUTurn:       {{"reverse"}, {"left"}},
+}
+
+// ParseTurnLanes parses a turn:lanes value ("left|through;right|") into the
+// indications of each lane, ordered from left to right
+func ParseTurnLanes(value string) [][]string {
+	if value == "" {
+		return nil
+	}
+
+	lanes := strings.Split(value, "|")
+	result := make([][]string, len(lanes))
+	for i, lane := range lanes {
+		indications := splitValues(lane)
+		if len(indications) == 0 {
+			indications = []string{"none"}
+		}
+		result[i] = indications
+	}
+	return result
+}
+
+// LanesForManeuver builds the lane array for a maneuver from the turn:lanes
+// tag of the approaching road. Lanes whose indications match the maneuver are
+// valid; valid lanes dedicated to the maneuver alone are active.
+func LanesForManeuver(turnLanes, modifier string) []Lane {
+	parsed := ParseTurnLanes(turnLanes)
+	if len(parsed) == 0 {
+		return nil
+	}
+
+	lanes := make([]Lane, len(parsed))
+	for i, indications := range parsed {
+		lanes[i] = Lane{Indications: indications}
+	}
+
+	matches, ok := modifierIndications[modifier]
+	if !ok {
+		return lanes
+	}
+
+	// Prefer exact matches, fall back to looser ones
+	for _, accepted := range matches {
+		if markValid(lanes, accepted) {
+			break
+		}
+	}
+
+	// Active lanes are the valid lanes that serve only this maneuver; if every
+	// valid lane is shared with other directions, all of them are active
+	anyDedicated := false
+	for i := range lanes {
+		if lanes[i].Valid && len(lanes[i].Indications) == 1 {
+			lanes[i].Active = true
+			anyDedicated = true
+		}
+	}
+	if !anyDedicated {
+		for i := range lanes {
+			lanes[i].Active = lanes[i].Valid
+		}
+	}
+
+	return lanes
+}
+
+// markValid flags lanes carrying one of the accepted indications and reports
+// whether any lane matched
+func markValid(lanes []Lane, accepted []string) bool {
+	found := false
+	for i := range lanes {
+		for _, indication := range lanes[i].Indications {
+			if contains(accepted, indication) {
+				lanes[i].Valid = true
+				found = true
+				break
+			}
+		}
+	}
+	return found
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
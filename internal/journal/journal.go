@@ -0,0 +1,454 @@
+// Package journal keeps an append-only log of runtime weight changes so they
+// can be audited, reverted and replayed after a restart.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/graph"
+	"github.com/vamosdalian/nav/internal/weights"
+)
+
+// Entry actions
+const (
+	ActionUpdate = "update" // Weight updates from /weight/update
+	ActionRevert = "revert" // Undo of earlier entries
+)
+
+var (
+	// ErrNotFound is returned for unknown entry IDs
+	ErrNotFound = errors.New("change not found")
+	// ErrConflict is returned when a change can no longer be reverted cleanly
+	ErrConflict = errors.New("change conflicts with the current graph")
+)
+
+// Change is one edge weight change
+type Change struct {
+	From     int64   `json:"from"`
+	Index    int     `json:"index"` // Position in the adjacency list of From
+	To       int64   `json:"to"`
+	OSMWayID int64   `json:"osm_way_id"`
+	Old      float64 `json:"old"`
+	New      float64 `json:"new"`
+}
+
+// Entry is one journaled modification
+type Entry struct {
+	ID         int64            `json:"id"`
+	Time       time.Time        `json:"time"`
+	Actor      string           `json:"actor,omitempty"`
+	Action     string           `json:"action"`
+	Updates    []weights.Update `json:"updates,omitempty"`   // Requested updates (update entries)
+	Reverts    []int64          `json:"reverts,omitempty"`   // Entries undone (revert entries)
+	RevertTo   *time.Time       `json:"revert_to,omitempty"` // Point in time restored (revert entries)
+	Edges      int              `json:"edges"`               // Number of changed edges
+	Changes    []Change         `json:"changes,omitempty"`
+	RevertedBy int64            `json:"reverted_by,omitempty"` // Derived from later revert entries
+}
+
+// Journal applies weight changes to a graph and records them in a JSON Lines file
+type Journal struct {
+	path    string
+	graph   *graph.Graph
+	file    *os.File
+	entries []Entry
+	byID    map[int64]int // Entry ID -> position in entries
+	nextID  int64
+	skipped int
+	mutex   sync.Mutex
+	now     func() time.Time
+}
+
+// Open reads the journal at path and replays its changes onto g. Changes that
+// no longer match the graph (e.g. after a rebuild) are skipped. An empty path
+// keeps the journal in memory only.
+func Open(path string, g *graph.Graph) (*Journal, error) {
+	j := &Journal{
+		path:   path,
+		graph:  g,
+		byID:   make(map[int64]int),
+		nextID: 1,
+		now:    time.Now,
+	}
+	if path == "" {
+		return j, nil
+	}
+
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	if err := j.replay(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	j.file = file
+	return j, nil
+}
+
+// SetGraph replays the journal onto a new graph and records further changes
+// there. Returns the number of changes that no longer match the graph.
+func (j *Journal) SetGraph(g *graph.Graph) (int, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	previous, skipped := j.graph, j.skipped
+	j.graph, j.skipped = g, 0
+	if err := j.replay(); err != nil {
+		j.graph, j.skipped = previous, skipped
+		return 0, err
+	}
+	return j.skipped, nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// Len returns the number of entries
+func (j *Journal) Len() int {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return len(j.entries)
+}
+
+// Skipped returns the number of changes not replayed because they no longer match the graph
+func (j *Journal) Skipped() int {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.skipped
+}
+
+// Apply applies weight updates atomically and journals them
+func (j *Journal) Apply(actor string, updates []weights.Update) (*weights.Result, Entry, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	result, err := weights.Apply(j.graph, updates)
+	if err != nil {
+		return nil, Entry{}, err
+	}
+
+	entry := Entry{
+		Action:  ActionUpdate,
+		Actor:   actor,
+		Updates: updates,
+		Changes: fromDeltas(result.Changes),
+	}
+	if err := j.append(&entry); err != nil {
+		j.undo(entry.Changes)
+		return nil, Entry{}, err
+	}
+	return result, entry, nil
+}
+
+// Revert undoes the changes of one entry. It fails with ErrConflict if the entry
+// was already reverted or a later change modified the same edges.
+func (j *Journal) Revert(id int64, actor string) (Entry, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	pos, exists := j.byID[id]
+	if !exists {
+		return Entry{}, fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	target := &j.entries[pos]
+	if target.RevertedBy != 0 {
+		return Entry{}, fmt.Errorf("%w: change %d was already reverted by %d", ErrConflict, id, target.RevertedBy)
+	}
+
+	// Restore the weight each edge had before the entry, provided it still
+	// has the weight the entry left behind
+	before := make(map[graph.EdgeRef]float64)
+	after := make(map[graph.EdgeRef]float64)
+	var order []graph.EdgeRef
+	for _, c := range target.Changes {
+		ref := graph.EdgeRef{From: c.From, Index: c.Index}
+		if _, seen := before[ref]; !seen {
+			before[ref] = c.Old
+			order = append(order, ref)
+		}
+		after[ref] = c.New
+	}
+	for _, ref := range order {
+		edge, ok := j.graph.EdgeAt(ref)
+		if !ok || !sameWeight(edge.Weight, after[ref]) {
+			return Entry{}, fmt.Errorf("%w: edge %d/%d was modified after change %d", ErrConflict, ref.From, ref.Index, id)
+		}
+	}
+
+	entry := Entry{Action: ActionRevert, Actor: actor, Reverts: []int64{id}}
+	if err := j.restore(&entry, order, before); err != nil {
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+// RevertTo restores every edge to the weight it had at t, undoing all later entries
+func (j *Journal) RevertTo(t time.Time, actor string) (Entry, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	before := make(map[graph.EdgeRef]float64)
+	var order []graph.EdgeRef
+	var reverts []int64
+	for i := range j.entries {
+		e := &j.entries[i]
+		if !e.Time.After(t) {
+			continue
+		}
+		if e.Action == ActionUpdate && e.RevertedBy == 0 {
+			reverts = append(reverts, e.ID)
+		}
+		for _, c := range e.Changes {
+			ref := graph.EdgeRef{From: c.From, Index: c.Index}
+			if _, seen := before[ref]; !seen {
+				before[ref] = c.Old
+				order = append(order, ref)
+			}
+		}
+	}
+
+	if len(order) == 0 && len(reverts) == 0 {
+		return Entry{}, fmt.Errorf("%w: nothing changed after %s", ErrNotFound, t.UTC().Format(time.RFC3339))
+	}
+
+	at := t.UTC()
+	entry := Entry{Action: ActionRevert, Actor: actor, Reverts: reverts, RevertTo: &at}
+	if err := j.restore(&entry, order, before); err != nil {
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+// List returns the entries after since (all if zero), oldest first. Per-edge
+// changes are left out unless details is set.
+func (j *Journal) List(since time.Time, details bool) []Entry {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	var list []Entry
+	for _, e := range j.entries {
+		if !since.IsZero() && !e.Time.After(since) {
+			continue
+		}
+		if !details {
+			e.Changes = nil
+		}
+		list = append(list, e)
+	}
+	return list
+}
+
+// Get returns an entry with its changes
+func (j *Journal) Get(id int64) (Entry, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	pos, exists := j.byID[id]
+	if !exists {
+		return Entry{}, fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	return j.entries[pos], nil
+}
+
+// restore sets edges back to the given weights and journals the revert entry
+// (caller holds the lock)
+func (j *Journal) restore(entry *Entry, order []graph.EdgeRef, weightsByRef map[graph.EdgeRef]float64) error {
+	changes := make([]graph.WeightChange, 0, len(order))
+	for _, ref := range order {
+		changes = append(changes, graph.WeightChange{
+			Edges: []graph.EdgeRef{ref},
+			Op:    graph.WeightSet,
+			Value: weightsByRef[ref],
+		})
+	}
+	deltas, err := j.graph.ApplyWeightChanges(changes)
+	if err != nil {
+		return fmt.Errorf("failed to revert: %w", err)
+	}
+
+	entry.Changes = fromDeltas(deltas)
+	if err := j.append(entry); err != nil {
+		j.undo(entry.Changes)
+		return err
+	}
+	return nil
+}
+
+// undo rolls back applied changes after the journal could not be written
+// (caller holds the lock)
+func (j *Journal) undo(changes []Change) {
+	rollback := make([]graph.WeightChange, 0, len(changes))
+	for i := len(changes) - 1; i >= 0; i-- {
+		rollback = append(rollback, graph.WeightChange{
+			Edges: []graph.EdgeRef{{From: changes[i].From, Index: changes[i].Index}},
+			Op:    graph.WeightSet,
+			Value: changes[i].Old,
+		})
+	}
+	if _, err := j.graph.ApplyWeightChanges(rollback); err != nil {
+		log.Printf("Warning: Failed to roll back weight changes: %v", err)
+	}
+}
+
+// append assigns an ID and time to an entry, writes it to the file and adds
+// it to memory (caller holds the lock)
+func (j *Journal) append(entry *Entry) error {
+	entry.ID = j.nextID
+	entry.Time = j.now().UTC()
+	entry.Edges = len(entry.Changes)
+
+	if j.file != nil {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode journal entry: %w", err)
+		}
+		line = append(line, '\n')
+		if _, err := j.file.Write(line); err != nil {
+			return fmt.Errorf("failed to write journal: %w", err)
+		}
+		if err := j.file.Sync(); err != nil {
+			return fmt.Errorf("failed to write journal: %w", err)
+		}
+	}
+
+	j.nextID++
+	j.add(*entry)
+	return nil
+}
+
+// add inserts an entry into memory and marks the entries it reverts (caller holds the lock)
+func (j *Journal) add(entry Entry) {
+	for _, id := range entry.Reverts {
+		if pos, exists := j.byID[id]; exists {
+			j.entries[pos].RevertedBy = entry.ID
+		}
+	}
+	j.byID[entry.ID] = len(j.entries)
+	j.entries = append(j.entries, entry)
+	if entry.ID >= j.nextID {
+		j.nextID = entry.ID + 1
+	}
+}
+
+// load reads the journal file. A torn last line from an interrupted write is
+// cut off; any other malformed line is an error.
+func (j *Journal) load() error {
+	file, err := os.OpenFile(j.path, os.O_RDWR, 0)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for lineNo := 1; ; lineNo++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return fmt.Errorf("failed to read journal: %w", readErr)
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var entry Entry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				if readErr == io.EOF {
+					log.Printf("Warning: Dropping incomplete last journal entry (line %d)", lineNo)
+					if err := file.Truncate(offset); err != nil {
+						return fmt.Errorf("failed to repair journal: %w", err)
+					}
+					return nil
+				}
+				return fmt.Errorf("invalid journal entry on line %d: %w", lineNo, err)
+			}
+			entry.RevertedBy = 0
+			j.add(entry)
+		}
+		offset += int64(len(line))
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+// replay applies the journaled changes in order. A change is replayed only
+// if its edge still exists with the recorded target, way and old weight;
+// edges that already have the new weight are left as they are.
+func (j *Journal) replay() error {
+	current := make(map[graph.EdgeRef]float64)
+	var changes []graph.WeightChange
+	for _, e := range j.entries {
+		for _, c := range e.Changes {
+			ref := graph.EdgeRef{From: c.From, Index: c.Index}
+			weight, known := current[ref]
+			if !known {
+				edge, ok := j.graph.EdgeAt(ref)
+				if !ok || edge.To != c.To || edge.OSMWayID != c.OSMWayID {
+					j.skipped++
+					continue
+				}
+				weight = edge.Weight
+			}
+			if !sameWeight(weight, c.Old) {
+				// A graph snapshot taken after the change already contains it
+				if sameWeight(weight, c.New) {
+					current[ref] = c.New
+				} else {
+					j.skipped++
+				}
+				continue
+			}
+			current[ref] = c.New
+			changes = append(changes, graph.WeightChange{Edges: []graph.EdgeRef{ref}, Op: graph.WeightSet, Value: c.New})
+		}
+	}
+
+	if _, err := j.graph.ApplyWeightChanges(changes); err != nil {
+		return fmt.Errorf("failed to replay journal: %w", err)
+	}
+	return nil
+}
+
+func fromDeltas(deltas []graph.WeightDelta) []Change {
+	changes := make([]Change, len(deltas))
+	for i, d := range deltas {
+		changes[i] = Change{
+			From:     d.Ref.From,
+			Index:    d.Ref.Index,
+			To:       d.To,
+			OSMWayID: d.OSMWayID,
+			Old:      d.Old,
+			New:      d.New,
+		}
+	}
+	return changes
+}
+
+// sameWeight compares weights that went through a JSON round trip
+func sameWeight(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
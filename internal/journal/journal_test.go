@@ -0,0 +1,195 @@
+package journal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/graph"
+	"github.com/vamosdalian/nav/internal/weights"
+)
+
+// createTestGraph creates a two-way road 1-2-3 (way 100) and a one-way road 3-4 (way 200)
+func createTestGraph() *graph.Graph {
+	g := graph.NewGraph()
+	for i := int64(1); i <= 4; i++ {
+		g.AddNode(&graph.Node{ID: i, Lat: 43.0, Lon: 7.0 + float64(i)*0.01})
+	}
+	g.AddEdge(graph.Edge{From: 1, To: 2, Weight: 800, OSMWayID: 100})
+	g.AddEdge(graph.Edge{From: 2, To: 1, Weight: 800, OSMWayID: 100})
+	g.AddEdge(graph.Edge{From: 2, To: 3, Weight: 800, OSMWayID: 100})
+	g.AddEdge(graph.Edge{From: 3, To: 2, Weight: 800, OSMWayID: 100})
+	g.AddEdge(graph.Edge{From: 3, To: 4, Weight: 800, OSMWayID: 200})
+	return g
+}
+
+func weightOf(t *testing.T, g *graph.Graph, from, to int64) float64 {
+	t.Helper()
+	edge, ok := g.EdgeBetween(from, to)
+	if !ok {
+		t.Fatalf("edge %d->%d not found", from, to)
+	}
+	return edge.Weight
+}
+
+func multiplyWay(way int64, factor float64) []weights.Update {
+	return []weights.Update{{Selector: weights.Selector{OSMWayID: way}, Op: graph.WeightMultiply, Value: factor}}
+}
+
+// fakeClock returns a clock that advances one minute per call
+func fakeClock(start time.Time) func() time.Time {
+	now := start
+	return func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+}
+
+func TestApplyAndRevert(t *testing.T) {
+	g := createTestGraph()
+	j, err := Open("", g)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	_, first, err := j.Apply("alice", multiplyWay(100, 2))
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if first.Edges != 4 || first.Actor != "alice" || first.Changes[0].Old != 800 || first.Changes[0].New != 1600 {
+		t.Errorf("Unexpected entry %+v", first)
+	}
+	_, second, err := j.Apply("bob", []weights.Update{{Selector: weights.Selector{From: 1, To: 2}, Op: graph.WeightSet, Value: 100}})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// Edge 1->2 was changed again by the second entry
+	if _, err := j.Revert(first.ID, "alice"); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+	if _, err := j.Revert(second.ID, "bob"); err != nil {
+		t.Fatalf("Revert failed: %v", err)
+	}
+	if w := weightOf(t, g, 1, 2); w != 1600 {
+		t.Errorf("Expected 1->2 weight 1600 after reverting the second change, got %v", w)
+	}
+	if _, err := j.Revert(second.ID, "bob"); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict for a change reverted twice, got %v", err)
+	}
+	if _, err := j.Revert(first.ID, "alice"); err != nil {
+		t.Fatalf("Revert failed: %v", err)
+	}
+	if w := weightOf(t, g, 2, 3); w != 800 {
+		t.Errorf("Expected 2->3 weight 800 after reverting, got %v", w)
+	}
+	if _, err := j.Revert(99, ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if list := j.List(time.Time{}, false); len(list) != 4 || list[0].RevertedBy != 4 || list[0].Changes != nil {
+		t.Errorf("Unexpected list %+v", list)
+	}
+	if _, _, err := j.Apply("", multiplyWay(100, 0)); err == nil || j.Len() != 4 {
+		t.Error("Expected invalid update to be rejected without an entry")
+	}
+}
+
+func TestRevertTo(t *testing.T) {
+	g := createTestGraph()
+	j, _ := Open("", g)
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	j.now = fakeClock(start)
+
+	j.Apply("", multiplyWay(100, 2)) // 12:01
+	j.Apply("", multiplyWay(200, 3)) // 12:02
+	j.Apply("", multiplyWay(100, 5)) // 12:03
+
+	entry, err := j.RevertTo(start.Add(90*time.Second), "admin")
+	if err != nil {
+		t.Fatalf("RevertTo failed: %v", err)
+	}
+	if len(entry.Reverts) != 2 || entry.Edges != 5 {
+		t.Errorf("Expected 2 reverted entries and 5 edges, got %+v", entry)
+	}
+	if w := weightOf(t, g, 1, 2); w != 1600 {
+		t.Errorf("Expected 1->2 weight 1600 (state at 12:01), got %v", w)
+	}
+	if w := weightOf(t, g, 3, 4); w != 800 {
+		t.Errorf("Expected 3->4 weight 800, got %v", w)
+	}
+
+	if _, err := j.RevertTo(start.Add(time.Hour), ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound when nothing changed, got %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.jsonl")
+
+	j, err := Open(path, createTestGraph())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	_, first, _ := j.Apply("", multiplyWay(100, 2))
+	j.Apply("", multiplyWay(200, 3))
+	j.Revert(first.ID, "")
+	j.Close()
+
+	// Simulate a write interrupted by a crash
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(`{"id":4,"action":"upd`)
+	f.Close()
+
+	g := createTestGraph()
+	j, err = Open(path, g)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer j.Close()
+
+	if j.Len() != 3 || j.Skipped() != 0 {
+		t.Errorf("Expected 3 entries and no skipped changes, got %d and %d", j.Len(), j.Skipped())
+	}
+	if w := weightOf(t, g, 1, 2); w != 800 {
+		t.Errorf("Expected reverted way 100 to stay at 800, got %v", w)
+	}
+	if w := weightOf(t, g, 3, 4); w != 2400 {
+		t.Errorf("Expected way 200 at 2400 after replay, got %v", w)
+	}
+	if e, _ := j.Get(first.ID); e.RevertedBy != 3 {
+		t.Errorf("Expected first entry to be reverted by 3, got %d", e.RevertedBy)
+	}
+
+	// New entries continue the ID sequence after the dropped line
+	_, entry, err := j.Apply("", multiplyWay(100, 2))
+	if err != nil || entry.ID != 4 {
+		t.Errorf("Expected new entry 4, got %d (%v)", entry.ID, err)
+	}
+}
+
+func TestReplayOnSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.jsonl")
+	j, _ := Open(path, createTestGraph())
+	j.Apply("", multiplyWay(100, 2))
+	j.Close()
+
+	// A snapshot taken after the change already has the new weights
+	g := createTestGraph()
+	for _, ref := range g.EdgesByWay(100) {
+		g.ApplyWeightChanges([]graph.WeightChange{{Edges: []graph.EdgeRef{ref}, Op: graph.WeightSet, Value: 1600}})
+	}
+	j, err := Open(path, g)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer j.Close()
+	if j.Skipped() != 0 {
+		t.Errorf("Expected no skipped changes, got %d", j.Skipped())
+	}
+	if w := weightOf(t, g, 1, 2); w != 1600 {
+		t.Errorf("Expected weight 1600, got %v", w)
+	}
+}
@@ -0,0 +1,141 @@
+package openlr
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Binary format constants (OpenLR physical format version 3)
+const (
+	binaryVersion    = 3
+	firstLRPSize     = 9 // 6 bytes absolute coordinates + 3 attribute bytes
+	intermediateSize = 7 // 4 bytes relative coordinates + 3 attribute bytes
+	lastLRPSize      = 6 // 4 bytes relative coordinates + 2 attribute bytes
+	bearingSector    = 11.25
+	dnpInterval      = 58.6
+)
+
+// DecodeBase64 decodes a base64 encoded binary line location
+func DecodeBase64(value string) (*LineLocation, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 location reference: %w", err)
+	}
+	return DecodeBinary(data)
+}
+
+// DecodeBinary decodes a binary (version 3) line location reference
+func DecodeBinary(data []byte) (*LineLocation, error) {
+	if len(data) < 1+firstLRPSize+lastLRPSize {
+		return nil, fmt.Errorf("location reference too short (%d bytes)", len(data))
+	}
+
+	status := data[0]
+	if version := status & 0x07; version != binaryVersion {
+		return nil, fmt.Errorf("unsupported OpenLR version %d", version)
+	}
+	pointFlag := status&0x20 != 0
+	areaFlag := status&0x40 != 0 || status&0x10 != 0
+	attrFlag := status&0x08 != 0
+	if pointFlag || areaFlag || !attrFlag {
+		return nil, fmt.Errorf("only line location references are supported")
+	}
+
+	body := data[1:]
+	intermediateBytes := len(body) - firstLRPSize - lastLRPSize
+	offsetBytes := intermediateBytes % intermediateSize
+	if offsetBytes > 2 {
+		return nil, fmt.Errorf("invalid location reference length %d", len(data))
+	}
+	intermediates := intermediateBytes / intermediateSize
+
+	loc := &LineLocation{}
+
+	// First LRP with absolute coordinates
+	first := LRP{
+		Lon: absoluteCoordinate(body[0:3]),
+		Lat: absoluteCoordinate(body[3:6]),
+	}
+	decodeAttributes(&first, body[6], body[7], body[8])
+	loc.Points = append(loc.Points, first)
+	pos := firstLRPSize
+
+	// Intermediate LRPs relative to the previous point
+	for i := 0; i < intermediates; i++ {
+		prev := loc.Points[len(loc.Points)-1]
+		p := LRP{
+			Lon: prev.Lon + relativeCoordinate(body[pos:pos+2]),
+			Lat: prev.Lat + relativeCoordinate(body[pos+2:pos+4]),
+		}
+		decodeAttributes(&p, body[pos+4], body[pos+5], body[pos+6])
+		loc.Points = append(loc.Points, p)
+		pos += intermediateSize
+	}
+
+	// Last LRP: relative coordinates, attribute 1 and attribute 4
+	prev := loc.Points[len(loc.Points)-1]
+	last := LRP{
+		Lon: prev.Lon + relativeCoordinate(body[pos:pos+2]),
+		Lat: prev.Lat + relativeCoordinate(body[pos+2:pos+4]),
+		FRC: int(body[pos+4]>>3) & 0x07,
+		FOW: int(body[pos+4]) & 0x07,
+	}
+	attr4 := body[pos+5]
+	last.Bearing = float64(attr4&0x1f)*bearingSector + bearingSector/2
+	loc.Points = append(loc.Points, last)
+	pos += lastLRPSize
+
+	// Optional offsets, relative to the first and last segment lengths
+	positiveFlag := attr4&0x40 != 0
+	negativeFlag := attr4&0x20 != 0
+	expected := 0
+	if positiveFlag {
+		expected++
+	}
+	if negativeFlag {
+		expected++
+	}
+	if expected != offsetBytes {
+		return nil, fmt.Errorf("offset flags do not match location reference length")
+	}
+	if positiveFlag {
+		loc.PositiveOffset = (float64(body[pos]) + 0.5) / 256 * loc.Points[0].DNP
+		pos++
+	}
+	if negativeFlag {
+		loc.NegativeOffset = (float64(body[pos]) + 0.5) / 256 * loc.Points[len(loc.Points)-2].DNP
+	}
+
+	return loc, loc.Validate()
+}
+
+// decodeAttributes decodes attribute bytes 1-3 of a non-last LRP
+func decodeAttributes(p *LRP, attr1, attr2, attr3 byte) {
+	p.FRC = int(attr1>>3) & 0x07
+	p.FOW = int(attr1) & 0x07
+	p.LFRCNP = int(attr2>>5) & 0x07
+	p.Bearing = float64(attr2&0x1f)*bearingSector + bearingSector/2
+	p.DNP = (float64(attr3) + 0.5) * dnpInterval
+}
+
+// absoluteCoordinate decodes a signed 24-bit coordinate in degrees
+func absoluteCoordinate(b []byte) float64 {
+	value := int32(b[0])<<16 | int32(b[1])<<8 | int32(b[2])
+	if value&0x800000 != 0 {
+		value -= 1 << 24
+	}
+	sign := 0.0
+	if value > 0 {
+		sign = 1
+	} else if value < 0 {
+		sign = -1
+	}
+	return (float64(value) - sign*0.5) * 360 / math.Pow(2, 24)
+}
+
+// relativeCoordinate decodes a signed 16-bit offset in decamicrodegrees
+func relativeCoordinate(b []byte) float64 {
+	return float64(int16(uint16(b[0])<<8|uint16(b[1]))) / 100000
+}
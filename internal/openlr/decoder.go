@@ -0,0 +1,326 @@
+package openlr
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// gridCellSize is the size of the node lookup grid in degrees (~500 m)
+const gridCellSize = 0.005
+
+// maxCandidates is the number of candidate edges kept per LRP
+const maxCandidates = 5
+
+// Decoder map-matches OpenLR line locations onto the edges of a graph
+type Decoder struct {
+	graph *graph.Graph
+	grid  map[[2]int][]int64
+
+	SearchRadius   float64 // Max distance (m) between an LRP and a candidate node
+	MaxBearingDiff float64 // Max bearing difference (degrees) for candidate edges
+	FRCTolerance   int     // Allowed FRC difference when checking LFRCNP
+}
+
+// candidate is a graph position for an LRP: a node and the edge leaving it
+// (or, for the last LRP, the edge arriving at it)
+type candidate struct {
+	node  int64
+	edge  graph.Edge
+	dist  float64
+	score float64
+}
+
+// NewDecoder indexes the graph nodes for map matching
+func NewDecoder(g *graph.Graph) *Decoder {
+	d := &Decoder{
+		graph:          g,
+		grid:           make(map[[2]int][]int64),
+		SearchRadius:   100,
+		MaxBearingDiff: 60,
+		FRCTolerance:   2,
+	}
+
+	for _, id := range g.NodeIDs() {
+		node, err := g.GetNode(id)
+		if err != nil {
+			continue
+		}
+		cell := gridCell(node.Lat, node.Lon)
+		d.grid[cell] = append(d.grid[cell], id)
+	}
+	return d
+}
+
+// Decode returns the directed edges covered by a line location, with offsets applied
+func (d *Decoder) Decode(loc *LineLocation) ([]graph.Edge, error) {
+	if err := loc.Validate(); err != nil {
+		return nil, err
+	}
+
+	last := len(loc.Points) - 1
+	candidates := make([][]candidate, len(loc.Points))
+	for i, p := range loc.Points {
+		candidates[i] = d.candidates(p, i == last)
+		if len(candidates[i]) == 0 {
+			return nil, fmt.Errorf("no candidate roads for location point %d", i)
+		}
+	}
+
+	var path []graph.Edge
+	starts := candidates[0]
+	for i := 0; i < last; i++ {
+		segment, end, ok := d.matchSegment(loc.Points[i], starts, candidates[i+1], i+1 == last)
+		if !ok {
+			return nil, fmt.Errorf("no route matches the segment between location points %d and %d", i, i+1)
+		}
+		path = append(path, segment...)
+		starts = []candidate{end}
+	}
+
+	return d.applyOffsets(path, loc.PositiveOffset, loc.NegativeOffset), nil
+}
+
+// candidates returns the best scoring edges near an LRP
+func (d *Decoder) candidates(p LRP, last bool) []candidate {
+	var result []candidate
+
+	for _, id := range d.nodesNear(p.Lat, p.Lon) {
+		node, err := d.graph.GetNode(id)
+		if err != nil {
+			continue
+		}
+		dist := graph.HaversineDistance(p.Lat, p.Lon, node.Lat, node.Lon)
+		if dist > d.SearchRadius {
+			continue
+		}
+
+		edges := d.graph.GetEdges(id)
+		if last {
+			edges = d.graph.GetReverseEdges(id)
+		}
+		for _, edge := range edges {
+			other := edge.To
+			if last {
+				other = edge.From
+			}
+			otherNode, err := d.graph.GetNode(other)
+			if err != nil {
+				continue
+			}
+
+			bearing := graph.InitialBearing(node.Lat, node.Lon, otherNode.Lat, otherNode.Lon)
+			bearingDiff := angleDiff(bearing, p.Bearing)
+			if bearingDiff > d.MaxBearingDiff {
+				continue
+			}
+
+			frcDiff := math.Abs(float64(FRCForHighway(edge.Tags["highway"]) - p.FRC))
+			result = append(result, candidate{
+				node:  id,
+				edge:  edge,
+				dist:  dist,
+				score: dist/d.SearchRadius + bearingDiff/d.MaxBearingDiff + 0.2*frcDiff,
+			})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].score < result[j].score })
+	if len(result) > maxCandidates {
+		result = result[:maxCandidates]
+	}
+	return result
+}
+
+// matchSegment finds the best path between candidates of two consecutive LRPs
+// whose length matches the distance to the next point
+func (d *Decoder) matchSegment(from LRP, starts, ends []candidate, endIsLast bool) ([]graph.Edge, candidate, bool) {
+	type pair struct {
+		start, end candidate
+		score      float64
+	}
+	pairs := make([]pair, 0, len(starts)*len(ends))
+	for _, s := range starts {
+		for _, e := range ends {
+			pairs = append(pairs, pair{start: s, end: e, score: s.score + e.score})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].score < pairs[j].score })
+
+	maxFRC := from.LFRCNP + d.FRCTolerance
+	for _, p := range pairs {
+		tolerance := dnpInterval + 0.25*from.DNP + p.start.dist + p.end.dist
+		path, length, ok := d.connect(p.start, p.end, endIsLast, maxFRC, from.DNP+tolerance)
+		if !ok || math.Abs(length-from.DNP) > tolerance {
+			continue
+		}
+		return path, p.end, true
+	}
+	return nil, candidate{}, false
+}
+
+// connect finds the shortest path starting with the start candidate's edge and
+// ending at the end candidate's node (and edge, for the last LRP)
+func (d *Decoder) connect(start, end candidate, endIsLast bool, maxFRC int, maxLength float64) ([]graph.Edge, float64, bool) {
+	target := end.node
+	if endIsLast {
+		target = end.edge.From
+	}
+
+	var path []graph.Edge
+	if endIsLast && sameEdge(start.edge, end.edge) {
+		path = []graph.Edge{start.edge}
+	} else if !endIsLast && start.node == target {
+		path = nil
+	} else {
+		first := start.edge
+		middle, ok := d.shortestPath(first.To, target, maxFRC, maxLength)
+		if !ok {
+			return nil, 0, false
+		}
+		path = append([]graph.Edge{first}, middle...)
+		if endIsLast {
+			path = append(path, end.edge)
+		}
+	}
+
+	length := 0.0
+	for i := range path {
+		length += d.edgeLength(&path[i])
+	}
+	return path, length, length <= maxLength
+}
+
+// shortestPath runs a length-bounded Dijkstra search restricted by road class
+func (d *Decoder) shortestPath(from, to int64, maxFRC int, maxLength float64) ([]graph.Edge, bool) {
+	if from == to {
+		return nil, true
+	}
+
+	dist := map[int64]float64{from: 0}
+	prev := make(map[int64]graph.Edge)
+	queue := &nodeQueue{{node: from}}
+
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(nodeItem)
+		if current.dist > dist[current.node] {
+			continue
+		}
+		if current.node == to {
+			break
+		}
+
+		for _, edge := range d.graph.GetEdges(current.node) {
+			if FRCForHighway(edge.Tags["highway"]) > maxFRC {
+				continue
+			}
+			next := current.dist + d.edgeLength(&edge)
+			if next > maxLength {
+				continue
+			}
+			if known, exists := dist[edge.To]; !exists || next < known {
+				dist[edge.To] = next
+				prev[edge.To] = edge
+				heap.Push(queue, nodeItem{node: edge.To, dist: next})
+			}
+		}
+	}
+
+	if _, reached := dist[to]; !reached {
+		return nil, false
+	}
+
+	var path []graph.Edge
+	for node := to; node != from; {
+		edge := prev[node]
+		path = append([]graph.Edge{edge}, path...)
+		node = edge.From
+	}
+	return path, true
+}
+
+// applyOffsets drops edges that lie mostly within the positive/negative offsets
+func (d *Decoder) applyOffsets(path []graph.Edge, positive, negative float64) []graph.Edge {
+	covered := 0.0
+	for len(path) > 1 {
+		length := d.edgeLength(&path[0])
+		if covered+length/2 > positive {
+			break
+		}
+		covered += length
+		path = path[1:]
+	}
+
+	covered = 0.0
+	for len(path) > 1 {
+		length := d.edgeLength(&path[len(path)-1])
+		if covered+length/2 > negative {
+			break
+		}
+		covered += length
+		path = path[:len(path)-1]
+	}
+	return path
+}
+
+// edgeLength returns the geometric length of an edge in meters
+func (d *Decoder) edgeLength(edge *graph.Edge) float64 {
+	from, errFrom := d.graph.GetNode(edge.From)
+	to, errTo := d.graph.GetNode(edge.To)
+	if errFrom != nil || errTo != nil {
+		return edge.Weight
+	}
+	return graph.HaversineDistance(from.Lat, from.Lon, to.Lat, to.Lon)
+}
+
+// nodesNear returns the nodes in the grid cells around a point
+func (d *Decoder) nodesNear(lat, lon float64) []int64 {
+	center := gridCell(lat, lon)
+	var nodes []int64
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			nodes = append(nodes, d.grid[[2]int{center[0] + dx, center[1] + dy}]...)
+		}
+	}
+	return nodes
+}
+
+func gridCell(lat, lon float64) [2]int {
+	return [2]int{int(math.Floor(lat / gridCellSize)), int(math.Floor(lon / gridCellSize))}
+}
+
+// angleDiff returns the absolute difference between two bearings (0-180)
+func angleDiff(a, b float64) float64 {
+	diff := math.Mod(math.Abs(a-b), 360)
+	if diff > 180 {
+		diff = 360 - diff
+	}
+	return diff
+}
+
+func sameEdge(a, b graph.Edge) bool {
+	return a.From == b.From && a.To == b.To && a.OSMWayID == b.OSMWayID
+}
+
+// nodeItem is a node in the Dijkstra queue
+type nodeItem struct {
+	node int64
+	dist float64
+}
+
+// nodeQueue is a min-heap of nodes by distance
+type nodeQueue []nodeItem
+
+func (q nodeQueue) Len() int            { return len(q) }
+func (q nodeQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q nodeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(nodeItem)) }
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,105 @@
+package openlr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Form of way values
+const (
+	FOWUndefined = iota
+	FOWMotorway
+	FOWMultipleCarriageway
+	FOWSingleCarriageway
+	FOWRoundabout
+	FOWTrafficSquare
+	FOWSlipRoad
+	FOWOther
+)
+
+// LRP is a location reference point
+type LRP struct {
+	Lat     float64
+	Lon     float64
+	FRC     int     // Functional road class (0 = main road ... 7 = other)
+	FOW     int     // Form of way
+	Bearing float64 // Degrees from north; for the last LRP it points back along the line
+	LFRCNP  int     // Lowest FRC to the next point
+	DNP     float64 // Distance to the next point in meters
+}
+
+// LineLocation is an OpenLR line location reference
+type LineLocation struct {
+	Points         []LRP
+	PositiveOffset float64 // Meters to skip at the start
+	NegativeOffset float64 // Meters to skip at the end
+}
+
+// Validate checks that the location can be decoded
+func (l *LineLocation) Validate() error {
+	if len(l.Points) < 2 {
+		return fmt.Errorf("line location needs at least 2 points, got %d", len(l.Points))
+	}
+	for i, p := range l.Points {
+		if p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180 {
+			return fmt.Errorf("point %d has invalid coordinates", i)
+		}
+		if p.FRC < 0 || p.FRC > 7 || p.LFRCNP < 0 || p.LFRCNP > 7 {
+			return fmt.Errorf("point %d has an invalid functional road class", i)
+		}
+	}
+	return nil
+}
+
+// FRCForHighway maps an OSM highway type to an OpenLR functional road class
+func FRCForHighway(highway string) int {
+	switch strings.TrimSuffix(highway, "_link") {
+	case "motorway":
+		return 0
+	case "trunk":
+		return 1
+	case "primary":
+		return 2
+	case "secondary":
+		return 3
+	case "tertiary":
+		return 4
+	case "unclassified":
+		return 5
+	case "residential":
+		return 6
+	default:
+		return 7
+	}
+}
+
+// parseFRC parses "FRC3" (or "3")
+func parseFRC(value string) (int, error) {
+	var frc int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(value)), "FRC"), "%d", &frc); err != nil {
+		return 0, fmt.Errorf("invalid functional road class %q", value)
+	}
+	return frc, nil
+}
+
+// parseFOW parses OpenLR XML ("SINGLE_CARRIAGEWAY") and DATEX II ("singleCarriageway") names
+func parseFOW(value string) int {
+	switch strings.ToLower(strings.ReplaceAll(strings.TrimSpace(value), "_", "")) {
+	case "motorway":
+		return FOWMotorway
+	case "multiplecarriageway":
+		return FOWMultipleCarriageway
+	case "singlecarriageway":
+		return FOWSingleCarriageway
+	case "roundabout":
+		return FOWRoundabout
+	case "trafficsquare":
+		return FOWTrafficSquare
+	case "sliproad":
+		return FOWSlipRoad
+	case "other":
+		return FOWOther
+	default:
+		return FOWUndefined
+	}
+}
@@ -0,0 +1,111 @@
+package openlr
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// createTestGraph creates a two-way primary road 1-6 along latitude 52 (way 100)
+// with a residential side road from node 3 to node 7 (way 200)
+func createTestGraph() *graph.Graph {
+	g := graph.NewGraph()
+	for i := int64(1); i <= 6; i++ {
+		g.AddNode(&graph.Node{ID: i, Lat: 52.0, Lon: 13.0 + float64(i-1)*0.002})
+	}
+	g.AddNode(&graph.Node{ID: 7, Lat: 52.002, Lon: 13.004})
+
+	addRoad := func(from, to, way int64, highway string) {
+		a, _ := g.GetNode(from)
+		b, _ := g.GetNode(to)
+		distance := graph.HaversineDistance(a.Lat, a.Lon, b.Lat, b.Lon)
+		tags := map[string]string{"highway": highway}
+		g.AddEdge(graph.Edge{From: from, To: to, Weight: distance, OSMWayID: way, Tags: tags})
+		g.AddEdge(graph.Edge{From: to, To: from, Weight: distance, OSMWayID: way, Tags: tags, Reverse: true})
+	}
+	for i := int64(1); i < 6; i++ {
+		addRoad(i, i+1, 100, "primary")
+	}
+	addRoad(3, 7, 200, "residential")
+	return g
+}
+
+func edgePath(edges []graph.Edge) []int64 {
+	if len(edges) == 0 {
+		return nil
+	}
+	nodes := []int64{edges[0].From}
+	for _, edge := range edges {
+		nodes = append(nodes, edge.To)
+	}
+	return nodes
+}
+
+func TestDecodeBinary(t *testing.T) {
+	loc, err := DecodeBase64("Cwk+lCT6UBNICwPoAAATWDg=")
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	if len(loc.Points) != 2 {
+		t.Fatalf("Expected 2 points, got %d", len(loc.Points))
+	}
+	first, last := loc.Points[0], loc.Points[1]
+	if math.Abs(first.Lat-52.0) > 1e-4 || math.Abs(first.Lon-13.0) > 1e-4 {
+		t.Errorf("Unexpected first point %.5f, %.5f", first.Lat, first.Lon)
+	}
+	if math.Abs(last.Lon-13.01) > 1e-4 {
+		t.Errorf("Unexpected last longitude %.5f", last.Lon)
+	}
+	if first.FRC != 2 || first.FOW != FOWSingleCarriageway || first.LFRCNP != 2 {
+		t.Errorf("Unexpected attributes %+v", first)
+	}
+	if first.Bearing != 95.625 || last.Bearing != 275.625 {
+		t.Errorf("Unexpected bearings %.3f / %.3f", first.Bearing, last.Bearing)
+	}
+	if math.Abs(first.DNP-673.9) > 0.1 {
+		t.Errorf("Expected DNP 673.9 m, got %.1f", first.DNP)
+	}
+	if loc.PositiveOffset < 140 || loc.PositiveOffset > 160 || loc.NegativeOffset != 0 {
+		t.Errorf("Unexpected offsets %.1f / %.1f", loc.PositiveOffset, loc.NegativeOffset)
+	}
+
+	if _, err := DecodeBase64("CwAAAA=="); err == nil {
+		t.Error("Expected error for truncated reference")
+	}
+}
+
+func TestDecodeOntoGraph(t *testing.T) {
+	decoder := NewDecoder(createTestGraph())
+
+	loc, err := DecodeBase64("Cwk+lCT6UBNICwPoAAATGA==")
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	edges, err := decoder.Decode(loc)
+	if err != nil {
+		t.Fatalf("Failed to match location: %v", err)
+	}
+	if got := edgePath(edges); len(got) != 6 || got[0] != 1 || got[5] != 6 {
+		t.Errorf("Expected eastbound path 1..6, got %v", got)
+	}
+
+	// OpenLR XML sample: westbound with a negative offset covering the last edge
+	data, err := os.ReadFile("testdata/line.xml")
+	if err != nil {
+		t.Fatalf("Failed to read sample: %v", err)
+	}
+	loc, err = DecodeXML(data)
+	if err != nil {
+		t.Fatalf("Failed to decode XML: %v", err)
+	}
+	edges, err = decoder.Decode(loc)
+	if err != nil {
+		t.Fatalf("Failed to match XML location: %v", err)
+	}
+	if got := edgePath(edges); len(got) != 5 || got[0] != 6 || got[4] != 2 {
+		t.Errorf("Expected westbound path 6..2, got %v", got)
+	}
+}
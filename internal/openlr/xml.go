@@ -0,0 +1,128 @@
+package openlr
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/vamosdalian/nav/internal/xmltree"
+)
+
+// xmlNames are the element names of the OpenLR XML and DATEX II encodings
+type xmlNames struct {
+	point, lastPoint                 string
+	coordinates, latitude, longitude string
+	frc, fow, bearing, lfrcnp, dnp   string
+	positiveOffset, negativeOffset   string
+}
+
+var (
+	openLRXMLNames = xmlNames{
+		point: "LocationReferencePoint", lastPoint: "LastLocationReferencePoint",
+		coordinates: "Coordinates", latitude: "Latitude", longitude: "Longitude",
+		frc: "FRC", fow: "FOW", bearing: "BEAR", lfrcnp: "LFRCNP", dnp: "DNP",
+		positiveOffset: "PosOff", negativeOffset: "NegOff",
+	}
+	datexNames = xmlNames{
+		point: "openlrLocationReferencePoint", lastPoint: "openlrLastLocationReferencePoint",
+		coordinates: "openlrCoordinate", latitude: "latitude", longitude: "longitude",
+		frc: "openlrFunctionalRoadClass", fow: "openlrFormOfWay", bearing: "openlrBearing",
+		lfrcnp: "openlrLowestFRCToNextLRPoint", dnp: "openlrDistanceToNextLRPoint",
+		positiveOffset: "openlrPositiveOffset", negativeOffset: "openlrNegativeOffset",
+	}
+)
+
+// DecodeXML decodes the first line location reference in an XML document
+func DecodeXML(data []byte) (*LineLocation, error) {
+	root, err := xmltree.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return FromXML(root)
+}
+
+// FromXML decodes the first line location reference below an XML element. It
+// understands OpenLR XML, the DATEX II OpenLR extension and base64 binary
+// references in openlrBinary/Binary elements.
+func FromXML(n *xmltree.Node) (*LineLocation, error) {
+	for _, name := range []string{"openlrBinary", "Binary"} {
+		if binary := n.Find(name); binary != nil {
+			return DecodeBase64(binary.Text())
+		}
+	}
+
+	for _, names := range []xmlNames{openLRXMLNames, datexNames} {
+		if last := n.Find(names.lastPoint); last != nil {
+			return decodeXMLPoints(n, names)
+		}
+	}
+
+	return nil, fmt.Errorf("no OpenLR line location reference found")
+}
+
+// decodeXMLPoints reads the points and offsets using one set of element names
+func decodeXMLPoints(n *xmltree.Node, names xmlNames) (*LineLocation, error) {
+	loc := &LineLocation{}
+
+	points := n.FindAll(names.point)
+	points = append(points, n.Find(names.lastPoint))
+	for i, pn := range points {
+		p, err := decodeXMLPoint(pn, names, i == len(points)-1)
+		if err != nil {
+			return nil, fmt.Errorf("point %d: %w", i, err)
+		}
+		loc.Points = append(loc.Points, p)
+	}
+
+	if value := n.FindText(names.positiveOffset); value != "" {
+		offset, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid positive offset %q", value)
+		}
+		loc.PositiveOffset = offset
+	}
+	if value := n.FindText(names.negativeOffset); value != "" {
+		offset, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid negative offset %q", value)
+		}
+		loc.NegativeOffset = offset
+	}
+
+	return loc, loc.Validate()
+}
+
+// decodeXMLPoint reads a single location reference point
+func decodeXMLPoint(n *xmltree.Node, names xmlNames, last bool) (LRP, error) {
+	var p LRP
+	var err error
+
+	coordinates := n.Find(names.coordinates)
+	if coordinates == nil {
+		return p, fmt.Errorf("missing coordinates")
+	}
+	if p.Lat, err = strconv.ParseFloat(coordinates.FindText(names.latitude), 64); err != nil {
+		return p, fmt.Errorf("invalid latitude")
+	}
+	if p.Lon, err = strconv.ParseFloat(coordinates.FindText(names.longitude), 64); err != nil {
+		return p, fmt.Errorf("invalid longitude")
+	}
+
+	if p.FRC, err = parseFRC(n.FindText(names.frc)); err != nil {
+		return p, err
+	}
+	p.FOW = parseFOW(n.FindText(names.fow))
+	if p.Bearing, err = strconv.ParseFloat(n.FindText(names.bearing), 64); err != nil {
+		return p, fmt.Errorf("invalid bearing")
+	}
+
+	if !last {
+		if p.LFRCNP, err = parseFRC(n.FindText(names.lfrcnp)); err != nil {
+			return p, err
+		}
+		if p.DNP, err = strconv.ParseFloat(n.FindText(names.dnp), 64); err != nil {
+			return p, fmt.Errorf("invalid distance to next point")
+		}
+	}
+	return p, nil
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/paulmach/osm"
@@ -49,6 +50,12 @@ func (p *Parser) Parse(r io.Reader) error {
 	// Collect relations (for turn restrictions)
 	relations := make([]*osm.Relation, 0)
 
+	// Collect EV charging stations (they are not part of the road network)
+	stations := make([]graph.ChargingStation, 0)
+
+	// Collect nodes where vehicles have to stop (traffic signals, stop signs)
+	stopNodes := make(map[int64]bool)
+
 	// Progress tracking
 	var nodeCount, wayCount, relationCount int64
 	lastProgressTime := time.Now()
@@ -68,6 +75,13 @@ func (p *Parser) Parse(r io.Reader) error {
 			}
 			nodeCount++
 
+			if v.Tags.Find("amenity") == "charging_station" {
+				stations = append(stations, p.parseChargingStation(v))
+			}
+			if highway := v.Tags.Find("highway"); highway == "traffic_signals" || highway == "stop" {
+				stopNodes[int64(v.ID)] = true
+			}
+
 		case *osm.Way:
 			if p.isRoutableWay(v) {
 				ways = append(ways, v)
@@ -114,6 +128,10 @@ func (p *Parser) Parse(r io.Reader) error {
 		if node, exists := allNodes[nodeID]; exists {
 			p.graph.AddNode(node)
 			graphNodeCount++
+
+			if stopNodes[nodeID] {
+				p.graph.AddTrafficSignal(nodeID)
+			}
 		}
 	}
 	log.Printf("Phase 3/5: Complete - Added %d nodes to graph", graphNodeCount)
@@ -147,6 +165,13 @@ func (p *Parser) Parse(r io.Reader) error {
 	}
 	log.Printf("Phase 5/5: Complete - Processed %d turn restrictions", restrictionCount)
 
+	for _, station := range stations {
+		p.graph.AddChargingStation(station)
+	}
+	if len(stations) > 0 {
+		log.Printf("Found %d EV charging stations", len(stations))
+	}
+
 	log.Printf("✓ OSM parsing complete: %d nodes, %d edges, %d restrictions",
 		graphNodeCount, p.graph.EdgeCount(), restrictionCount)
 
@@ -192,6 +217,10 @@ func (p *Parser) processWay(way *osm.Way, nodes map[int64]*graph.Node) {
 	maxSpeed := p.getMaxSpeed(way)
 	tags := p.extractTags(way)
 
+	// Lane and signpost tags may differ per direction of travel
+	forwardTags := p.directionalTags(way, tags, "forward", oneway || reverseOneway)
+	backwardTags := p.directionalTags(way, tags, "backward", oneway || reverseOneway)
+
 	for i := 0; i < len(way.Nodes)-1; i++ {
 		fromID := int64(way.Nodes[i].ID)
 		toID := int64(way.Nodes[i+1].ID)
@@ -216,7 +245,7 @@ func (p *Parser) processWay(way *osm.Way, nodes map[int64]*graph.Node) {
 				Weight:   distance,
 				OSMWayID: int64(way.ID),
 				MaxSpeed: maxSpeed,
-				Tags:     tags,
+				Tags:     forwardTags,
 			})
 		}
 
@@ -228,7 +257,8 @@ func (p *Parser) processWay(way *osm.Way, nodes map[int64]*graph.Node) {
 				Weight:   distance,
 				OSMWayID: int64(way.ID),
 				MaxSpeed: maxSpeed,
-				Tags:     tags,
+				Tags:     backwardTags,
+				Reverse:  true,
 			})
 		}
 	}
@@ -267,7 +297,9 @@ func (p *Parser) getMaxSpeed(way *osm.Way) float64 {
 func (p *Parser) extractTags(way *osm.Way) map[string]string {
 	tags := make(map[string]string)
 
-	relevantKeys := []string{"highway", "name", "surface", "lanes", "oneway"}
+	relevantKeys := []string{"highway", "name", "ref", "surface", "lanes", "oneway",
+		"turn:lanes", "destination", "destination:ref",
+		"maxspeed", "tracktype", "smoothness", "bridge", "tunnel", "toll", "access"}
 	for _, key := range relevantKeys {
 		if value := way.Tags.Find(key); value != "" {
 			tags[key] = value
@@ -277,6 +309,111 @@ func (p *Parser) extractTags(way *osm.Way) map[string]string {
 	return tags
 }
 
+// directionalKeys are tags that OSM allows to be split per direction of travel
+// using the ":forward" and ":backward" suffixes
+var directionalKeys = []string{"lanes", "turn:lanes", "destination", "destination:ref"}
+
+// forwardOnlyKeys are directional tags whose unsuffixed value describes the
+// forward direction of a two-way road (lanes counts the lanes of both)
+var forwardOnlyKeys = []string{"turn:lanes", "destination", "destination:ref"}
+
+// directionalTags returns the tags for one direction of travel ("forward" or
+// "backward"), overlaying suffixed values such as turn:lanes:forward on top of
+// the shared way tags. On a two-way road the backward direction does not get
+// the unsuffixed forward-only tags. The shared map is returned when nothing
+// differs.
+func (p *Parser) directionalTags(way *osm.Way, tags map[string]string, direction string, oneway bool) map[string]string {
+	var result map[string]string
+	override := func(key, value string) {
+		if result == nil {
+			result = make(map[string]string, len(tags)+len(directionalKeys))
+			for k, v := range tags {
+				result[k] = v
+			}
+		}
+		if value == "" {
+			delete(result, key)
+		} else {
+			result[key] = value
+		}
+	}
+
+	if direction == "backward" && !oneway {
+		for _, key := range forwardOnlyKeys {
+			if _, ok := tags[key]; ok {
+				override(key, "")
+			}
+		}
+	}
+	for _, key := range directionalKeys {
+		if value := way.Tags.Find(key + ":" + direction); value != "" {
+			override(key, value)
+		}
+	}
+
+	if result == nil {
+		return tags
+	}
+	return result
+}
+
+// parseChargingStation extracts an EV charging station from an amenity=charging_station node
+func (p *Parser) parseChargingStation(node *osm.Node) graph.ChargingStation {
+	station := graph.ChargingStation{
+		ID:   int64(node.ID),
+		Lat:  node.Lat,
+		Lon:  node.Lon,
+		Name: node.Tags.Find("name"),
+	}
+
+	// Sockets are tagged as socket:<type>=<count> with optional socket:<type>:output=<power>
+	for _, tag := range node.Tags {
+		if !strings.HasPrefix(tag.Key, "socket:") {
+			continue
+		}
+		parts := strings.Split(tag.Key, ":")
+		switch {
+		case len(parts) == 2 && tag.Value != "no" && tag.Value != "0":
+			station.Connectors = append(station.Connectors, parts[1])
+		case len(parts) == 3 && parts[2] == "output":
+			if power := parsePowerKW(tag.Value); power > station.PowerKW {
+				station.PowerKW = power
+			}
+		}
+	}
+
+	if station.PowerKW == 0 {
+		station.PowerKW = parsePowerKW(node.Tags.Find("charging_station:output"))
+	}
+
+	return station
+}
+
+// parsePowerKW parses power values such as "50 kW", "22kW" or "3700 W" into kilowatts
+func parsePowerKW(value string) float64 {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return 0
+	}
+
+	var power float64
+	var unit string
+	fmt.Sscanf(value, "%f %s", &power, &unit)
+	if unit == "" {
+		// Handle values without a space, e.g. "22kw"
+		fmt.Sscanf(strings.TrimLeft(value, "0123456789."), "%s", &unit)
+	}
+
+	switch unit {
+	case "w":
+		return power / 1000
+	case "mw":
+		return power * 1000
+	default:
+		return power
+	}
+}
+
 // isRestrictionRelation checks if a relation is a turn restriction
 func (p *Parser) isRestrictionRelation(relation *osm.Relation) bool {
 	relType := relation.Tags.Find("type")
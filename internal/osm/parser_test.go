@@ -0,0 +1,72 @@
+package osm
+
+import (
+	"testing"
+
+	"github.com/paulmach/osm"
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+func TestProcessWayDirectionalTags(t *testing.T) {
+	nodes := map[int64]*graph.Node{
+		1: {ID: 1, Lat: 43.73, Lon: 7.42},
+		2: {ID: 2, Lat: 43.74, Lon: 7.42},
+	}
+	tests := []struct {
+		name     string
+		tags     osm.Tags
+		forward  map[string]string // expected tags of the forward edge (nil: no edge)
+		backward map[string]string // expected tags of the backward edge (nil: no edge)
+	}{
+		{
+			name:     "two-way road keeps unsuffixed tags forward",
+			tags:     osm.Tags{{Key: "highway", Value: "primary"}, {Key: "lanes", Value: "3"}, {Key: "turn:lanes", Value: "left|through"}, {Key: "destination", Value: "Nice"}},
+			forward:  map[string]string{"lanes": "3", "turn:lanes": "left|through", "destination": "Nice"},
+			backward: map[string]string{"lanes": "3"},
+		},
+		{
+			name:     "suffixed tags override per direction",
+			tags:     osm.Tags{{Key: "highway", Value: "primary"}, {Key: "turn:lanes", Value: "left|through"}, {Key: "turn:lanes:backward", Value: "through|right"}, {Key: "destination:ref:forward", Value: "A8"}},
+			forward:  map[string]string{"turn:lanes": "left|through", "destination:ref": "A8"},
+			backward: map[string]string{"turn:lanes": "through|right"},
+		},
+		{
+			name:    "oneway applies unsuffixed tags",
+			tags:    osm.Tags{{Key: "highway", Value: "primary"}, {Key: "oneway", Value: "yes"}, {Key: "turn:lanes", Value: "left|through"}},
+			forward: map[string]string{"turn:lanes": "left|through"},
+		},
+		{
+			name:     "reverse oneway applies unsuffixed tags",
+			tags:     osm.Tags{{Key: "highway", Value: "primary"}, {Key: "oneway", Value: "-1"}, {Key: "destination", Value: "Menton"}},
+			backward: map[string]string{"destination": "Menton"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := graph.NewGraph()
+			p := NewParser(g)
+			p.processWay(&osm.Way{ID: 100, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}, Tags: tt.tags}, nodes)
+
+			check := func(from, to int64, want map[string]string) {
+				edge, ok := g.EdgeBetween(from, to)
+				if want == nil {
+					if ok {
+						t.Errorf("edge %d -> %d exists, want none", from, to)
+					}
+					return
+				}
+				if !ok {
+					t.Fatalf("edge %d -> %d is missing", from, to)
+				}
+				for _, key := range directionalKeys {
+					if edge.Tags[key] != want[key] {
+						t.Errorf("edge %d -> %d: %s = %q, want %q", from, to, key, edge.Tags[key], want[key])
+					}
+				}
+			}
+			check(1, 2, tt.forward)
+			check(2, 1, tt.backward)
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package parquet
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// field is a Thrift struct field for the test writer
+type field struct {
+	id    int16
+	typ   byte
+	value interface{} // int64, []byte, []field or list
+}
+
+type list struct {
+	elem  byte
+	items []interface{}
+}
+
+func writeVarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+}
+
+func writeValue(buf *bytes.Buffer, typ byte, value interface{}) {
+	switch typ {
+	case tI32, tI64:
+		v := value.(int64)
+		writeVarint(buf, uint64(v<<1^(v>>63)))
+	case tBinary:
+		b := value.([]byte)
+		writeVarint(buf, uint64(len(b)))
+		buf.Write(b)
+	case tStruct:
+		writeStruct(buf, value.([]field))
+	case tList:
+		l := value.(list)
+		buf.WriteByte(byte(len(l.items))<<4 | l.elem)
+		for _, item := range l.items {
+			writeValue(buf, l.elem, item)
+		}
+	}
+}
+
+func writeStruct(buf *bytes.Buffer, fields []field) {
+	var last int16
+	for _, f := range fields {
+		buf.WriteByte(byte(f.id-last)<<4 | f.typ)
+		last = f.id
+		if f.typ != tTrue && f.typ != tFalse {
+			writeValue(buf, f.typ, f.value)
+		}
+	}
+	buf.WriteByte(tStop)
+}
+
+// testColumn describes a column written by buildFile
+type testColumn struct {
+	name       string
+	physical   int64
+	converted  int64 // -1 for none
+	optional   bool
+	dictionary bool
+	pageV2     bool
+	codec      int64
+	numValues  int64         // value count in the chunk metadata, 0 for the number of rows
+	values     []interface{} // nil entries are nulls
+}
+
+func plain(physical int64, values []interface{}) []byte {
+	var buf bytes.Buffer
+	for _, v := range values {
+		switch physical {
+		case typeInt64:
+			if ts, ok := v.(time.Time); ok {
+				v = ts.UnixMilli()
+			}
+			binary.Write(&buf, binary.LittleEndian, v.(int64))
+		case typeDouble:
+			binary.Write(&buf, binary.LittleEndian, math.Float64bits(v.(float64)))
+		case typeByteArray:
+			binary.Write(&buf, binary.LittleEndian, uint32(len(v.(string))))
+			buf.WriteString(v.(string))
+		}
+	}
+	return buf.Bytes()
+}
+
+// bitPacked encodes values as a single bit-packed run
+func bitPacked(values []int, width int) []byte {
+	groups := (len(values) + 7) / 8
+	var buf bytes.Buffer
+	writeVarint(&buf, uint64(groups<<1|1))
+	packed := make([]byte, groups*width)
+	for i, v := range values {
+		for b := 0; b < width; b++ {
+			if v>>b&1 == 1 {
+				bit := i*width + b
+				packed[bit/8] |= 1 << (bit % 8)
+			}
+		}
+	}
+	buf.Write(packed)
+	return buf.Bytes()
+}
+
+// rleLevels encodes definition levels as RLE runs of length one
+func rleLevels(values []interface{}) []byte {
+	var buf bytes.Buffer
+	for _, v := range values {
+		writeVarint(&buf, 1<<1)
+		if v == nil {
+			buf.WriteByte(0)
+		} else {
+			buf.WriteByte(1)
+		}
+	}
+	return buf.Bytes()
+}
+
+func compress(codec int64, data []byte) []byte {
+	if codec == codecSnappy {
+		return snappy.Encode(nil, data)
+	}
+	return data
+}
+
+func page(out *bytes.Buffer, header []field, body []byte) {
+	writeStruct(out, header)
+	out.Write(body)
+}
+
+// buildFile writes a single row group Parquet file
+func buildFile(cols []testColumn) []byte {
+	var out bytes.Buffer
+	out.Write(magic)
+
+	rows := int64(len(cols[0].values))
+	var schema, chunks []interface{}
+	schema = append(schema, []field{
+		{id: 4, typ: tBinary, value: []byte("schema")},
+		{id: 5, typ: tI32, value: int64(len(cols))},
+	})
+
+	for _, col := range cols {
+		repetition := int64(repetitionRequired)
+		if col.optional {
+			repetition = repetitionOptional
+		}
+		element := []field{
+			{id: 1, typ: tI32, value: col.physical},
+			{id: 3, typ: tI32, value: repetition},
+			{id: 4, typ: tBinary, value: []byte(col.name)},
+		}
+		if col.converted >= 0 {
+			element = append(element, field{id: 6, typ: tI32, value: col.converted})
+		}
+		schema = append(schema, element)
+
+		var present []interface{}
+		for _, v := range col.values {
+			if v != nil {
+				present = append(present, v)
+			}
+		}
+
+		start := int64(out.Len())
+		dictOffset := int64(0)
+		encoding := int64(encodingPlain)
+		values := plain(col.physical, present)
+		if col.dictionary {
+			var dict []interface{}
+			index := map[interface{}]int{}
+			var indices []int
+			for _, v := range present {
+				if _, ok := index[v]; !ok {
+					index[v] = len(dict)
+					dict = append(dict, v)
+				}
+				indices = append(indices, index[v])
+			}
+			dictOffset = start
+			body := compress(col.codec, plain(col.physical, dict))
+			page(&out, []field{
+				{id: 1, typ: tI32, value: int64(pageDictionary)},
+				{id: 2, typ: tI32, value: int64(len(plain(col.physical, dict)))},
+				{id: 3, typ: tI32, value: int64(len(body))},
+				{id: 7, typ: tStruct, value: []field{
+					{id: 1, typ: tI32, value: int64(len(dict))},
+					{id: 2, typ: tI32, value: int64(encodingPlain)},
+				}},
+			}, body)
+			encoding = encodingRLEDictionary
+			values = append([]byte{2}, bitPacked(indices, 2)...)
+		}
+
+		dataOffset := int64(out.Len())
+		levels := []byte{}
+		if col.optional {
+			levels = rleLevels(col.values)
+		}
+		if col.pageV2 {
+			compressed := compress(col.codec, values)
+			page(&out, []field{
+				{id: 1, typ: tI32, value: int64(pageDataV2)},
+				{id: 2, typ: tI32, value: int64(len(levels) + len(values))},
+				{id: 3, typ: tI32, value: int64(len(levels) + len(compressed))},
+				{id: 8, typ: tStruct, value: []field{
+					{id: 1, typ: tI32, value: rows},
+					{id: 2, typ: tI32, value: rows - int64(len(present))},
+					{id: 3, typ: tI32, value: rows},
+					{id: 4, typ: tI32, value: encoding},
+					{id: 5, typ: tI32, value: int64(len(levels))},
+					{id: 6, typ: tI32, value: int64(0)},
+				}},
+			}, append(levels, compressed...))
+		} else {
+			var raw []byte
+			if col.optional {
+				raw = binary.LittleEndian.AppendUint32(raw, uint32(len(levels)))
+				raw = append(raw, levels...)
+			}
+			raw = append(raw, values...)
+			body := compress(col.codec, raw)
+			page(&out, []field{
+				{id: 1, typ: tI32, value: int64(pageData)},
+				{id: 2, typ: tI32, value: int64(len(raw))},
+				{id: 3, typ: tI32, value: int64(len(body))},
+				{id: 5, typ: tStruct, value: []field{
+					{id: 1, typ: tI32, value: rows},
+					{id: 2, typ: tI32, value: encoding},
+					{id: 3, typ: tI32, value: int64(encodingRLE)},
+					{id: 4, typ: tI32, value: int64(encodingRLE)},
+				}},
+			}, body)
+		}
+
+		meta := []field{
+			{id: 1, typ: tI32, value: col.physical},
+			{id: 2, typ: tList, value: list{elem: tI32, items: []interface{}{encoding}}},
+			{id: 3, typ: tList, value: list{elem: tBinary, items: []interface{}{[]byte(col.name)}}},
+			{id: 4, typ: tI32, value: col.codec},
+			{id: 5, typ: tI64, value: cmp.Or(col.numValues, rows)},
+			{id: 6, typ: tI64, value: int64(out.Len()) - start},
+			{id: 7, typ: tI64, value: int64(out.Len()) - start},
+			{id: 9, typ: tI64, value: dataOffset},
+		}
+		if dictOffset > 0 {
+			meta = append(meta, field{id: 11, typ: tI64, value: dictOffset})
+		}
+		chunks = append(chunks, []field{
+			{id: 2, typ: tI64, value: start},
+			{id: 3, typ: tStruct, value: meta},
+		})
+	}
+
+	var footer bytes.Buffer
+	writeStruct(&footer, []field{
+		{id: 1, typ: tI32, value: int64(1)},
+		{id: 2, typ: tList, value: list{elem: tStruct, items: schema}},
+		{id: 3, typ: tI64, value: rows},
+		{id: 4, typ: tList, value: list{elem: tStruct, items: []interface{}{[]field{
+			{id: 1, typ: tList, value: list{elem: tStruct, items: chunks}},
+			{id: 2, typ: tI64, value: int64(0)},
+			{id: 3, typ: tI64, value: rows},
+		}}}},
+	})
+	out.Write(footer.Bytes())
+	binary.Write(&out, binary.LittleEndian, uint32(footer.Len()))
+	out.Write(magic)
+	return out.Bytes()
+}
+
+func TestReadRows(t *testing.T) {
+	t0 := time.Date(2024, 5, 6, 8, 15, 0, 0, time.UTC)
+	data := buildFile([]testColumn{
+		{name: "way_id", physical: typeInt64, converted: -1,
+			values: []interface{}{int64(10), int64(10), int64(20)}},
+		{name: "direction", physical: typeByteArray, converted: 0, optional: true, dictionary: true, codec: codecSnappy,
+			values: []interface{}{"forward", nil, "backward"}},
+		{name: "timestamp", physical: typeInt64, converted: convertedTimestampMillis, codec: codecSnappy,
+			values: []interface{}{t0, t0.Add(time.Minute), t0.Add(time.Hour)}},
+		{name: "speed_kmh", physical: typeDouble, converted: -1, optional: true, pageV2: true, codec: codecSnappy,
+			values: []interface{}{42.5, 30.0, nil}},
+	})
+
+	f, err := Open(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if f.NumRows() != 3 {
+		t.Errorf("expected 3 rows, got %d", f.NumRows())
+	}
+	if got := strings.Join(f.Columns(), ","); got != "way_id,direction,timestamp,speed_kmh" {
+		t.Errorf("unexpected columns %s", got)
+	}
+
+	var rows [][]interface{}
+	err = f.Rows([]string{"speed_kmh", "way_id", "direction", "timestamp"}, func(row []interface{}) error {
+		rows = append(rows, append([]interface{}(nil), row...))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Rows failed: %v", err)
+	}
+
+	expected := [][]interface{}{
+		{42.5, int64(10), "forward", t0},
+		{30.0, int64(10), nil, t0.Add(time.Minute)},
+		{nil, int64(20), "backward", t0.Add(time.Hour)},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), len(rows))
+	}
+	for i := range expected {
+		for j := range expected[i] {
+			if rows[i][j] != expected[i][j] {
+				t.Errorf("row %d column %d: expected %v, got %v", i, j, expected[i][j], rows[i][j])
+			}
+		}
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	if _, err := Open(bytes.NewReader([]byte("way_id,speed_kmh\n1,2\n")), 21); err == nil {
+		t.Error("expected error for non-parquet data")
+	}
+
+	data := buildFile([]testColumn{
+		{name: "way_id", physical: typeInt64, converted: -1, codec: 6, values: []interface{}{int64(1)}},
+	})
+	f, err := Open(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := f.Rows([]string{"missing"}, func([]interface{}) error { return nil }); err == nil {
+		t.Error("expected error for missing column")
+	}
+	err = f.Rows([]string{"way_id"}, func([]interface{}) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "ZSTD") {
+		t.Errorf("expected unsupported ZSTD error, got %v", err)
+	}
+}
+
+func TestColumnChunkValueCount(t *testing.T) {
+	read := func(numValues int64) ([]interface{}, error) {
+		data := buildFile([]testColumn{
+			{name: "way_id", physical: typeInt64, converted: -1, numValues: numValues, values: []interface{}{int64(1)}},
+		})
+		f, err := Open(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		var values []interface{}
+		err = f.Rows([]string{"way_id"}, func(row []interface{}) error {
+			values = append(values, row[0])
+			return nil
+		})
+		return values, err
+	}
+
+	if _, err := read(-1); err == nil || !strings.Contains(err.Error(), "value count") {
+		t.Errorf("expected invalid value count error, got %v", err)
+	}
+	// A huge count must not be preallocated; the pages decide what is read
+	values, err := read(1 << 50)
+	if err != nil || len(values) != 1 || values[0] != int64(1) {
+		t.Errorf("expected [1], got %v (%v)", values, err)
+	}
+}
+
+func TestDecodeHybrid(t *testing.T) {
+	// RLE run of five 3s followed by a bit-packed group of 0..7 (width 3)
+	data := []byte{5 << 1, 3}
+	data = append(data, bitPacked([]int{0, 1, 2, 3, 4, 5, 6, 7}, 3)...)
+
+	got, err := decodeHybrid(data, 3, 13)
+	if err != nil {
+		t.Fatalf("decodeHybrid failed: %v", err)
+	}
+	expected := []int{3, 3, 3, 3, 3, 0, 1, 2, 3, 4, 5, 6, 7}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	}
+
+	if _, err := decodeHybrid(data[:3], 3, 13); err == nil {
+		t.Error("expected error for truncated data")
+	}
+}
@@ -0,0 +1,628 @@
+// Package parquet is a minimal reader for flat Parquet files. It supports the
+// encodings and codecs written by common tools by default (PLAIN and
+// dictionary encodings, uncompressed, Snappy or gzip pages) and returns
+// rows of plain Go values.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// Physical types
+const (
+	typeBoolean           = 0
+	typeInt32             = 1
+	typeInt64             = 2
+	typeInt96             = 3
+	typeFloat             = 4
+	typeDouble            = 5
+	typeByteArray         = 6
+	typeFixedLenByteArray = 7
+)
+
+// Field repetition types
+const (
+	repetitionRequired = 0
+	repetitionOptional = 1
+)
+
+// Converted (legacy logical) types
+const (
+	convertedTimestampMillis = 9
+	convertedTimestampMicros = 10
+)
+
+// Compression codecs
+const (
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+)
+
+// Value encodings
+const (
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingRLE             = 3
+	encodingRLEDictionary   = 8
+)
+
+// Page types
+const (
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+var (
+	magic        = []byte("PAR1")
+	errTruncated = errors.New("unexpected end of data")
+)
+
+var codecNames = map[int64]string{3: "LZO", 4: "BROTLI", 5: "LZ4", 6: "ZSTD", 7: "LZ4_RAW"}
+
+// column describes a leaf column of the schema
+type column struct {
+	name       string
+	index      int // Position of the column chunk within a row group
+	physical   int64
+	typeLength int
+	optional   bool
+	repeated   bool // Nested or repeated columns are not supported
+	timeUnit   time.Duration
+}
+
+// File is an open Parquet file
+type File struct {
+	r         io.ReaderAt
+	columns   []column
+	rowGroups []tstruct
+	numRows   int64
+}
+
+// Open reads the footer of a Parquet file
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	if size < 12 {
+		return nil, fmt.Errorf("not a parquet file (too small)")
+	}
+
+	head := make([]byte, 4)
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	tail := make([]byte, 8)
+	if _, err := r.ReadAt(tail, size-8); err != nil {
+		return nil, fmt.Errorf("failed to read footer: %w", err)
+	}
+	if !bytes.Equal(head, magic) || !bytes.Equal(tail[4:], magic) {
+		return nil, fmt.Errorf("not a parquet file (missing PAR1 magic)")
+	}
+
+	footerLen := int64(binary.LittleEndian.Uint32(tail))
+	if footerLen <= 0 || footerLen > size-12 {
+		return nil, fmt.Errorf("invalid footer length %d", footerLen)
+	}
+	footer := make([]byte, footerLen)
+	if _, err := r.ReadAt(footer, size-8-footerLen); err != nil {
+		return nil, fmt.Errorf("failed to read footer: %w", err)
+	}
+
+	meta, err := (&compactReader{data: footer}).readStruct()
+	if err != nil {
+		return nil, fmt.Errorf("invalid file metadata: %w", err)
+	}
+
+	f := &File{r: r, numRows: meta.int(3, 0)}
+	if err := f.readSchema(meta.list(2)); err != nil {
+		return nil, err
+	}
+	for _, rg := range meta.list(4) {
+		if s, ok := rg.(tstruct); ok {
+			f.rowGroups = append(f.rowGroups, s)
+		}
+	}
+	return f, nil
+}
+
+// NumRows returns the number of rows in the file
+func (f *File) NumRows() int64 {
+	return f.numRows
+}
+
+// Columns returns the names of the leaf columns (nested ones dot-separated)
+func (f *File) Columns() []string {
+	names := make([]string, len(f.columns))
+	for i, col := range f.columns {
+		names[i] = col.name
+	}
+	return names
+}
+
+// HasColumn reports whether the file has a column with the given name
+func (f *File) HasColumn(name string) bool {
+	_, ok := f.column(name)
+	return ok
+}
+
+// Rows calls fn for every row with the values of the named columns, in order.
+// Values are int64, float64, bool, string, time.Time or nil for nulls. The row
+// slice is reused between calls.
+func (f *File) Rows(names []string, fn func(row []interface{}) error) error {
+	cols := make([]column, len(names))
+	for i, name := range names {
+		col, ok := f.column(name)
+		if !ok {
+			return fmt.Errorf("no column %q", name)
+		}
+		if col.repeated {
+			return fmt.Errorf("column %q: nested and repeated columns are not supported", name)
+		}
+		cols[i] = col
+	}
+
+	row := make([]interface{}, len(cols))
+	for g, rg := range f.rowGroups {
+		numRows := rg.int(3, 0)
+		values := make([][]interface{}, len(cols))
+		for i, col := range cols {
+			v, err := f.readColumnChunk(rg, col)
+			if err != nil {
+				return fmt.Errorf("row group %d, column %q: %w", g, col.name, err)
+			}
+			if int64(len(v)) != numRows {
+				return fmt.Errorf("row group %d, column %q: expected %d values, got %d", g, col.name, numRows, len(v))
+			}
+			values[i] = v
+		}
+
+		for r := int64(0); r < numRows; r++ {
+			for i := range cols {
+				row[i] = values[i][r]
+			}
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *File) column(name string) (column, bool) {
+	for _, col := range f.columns {
+		if col.name == name {
+			return col, true
+		}
+	}
+	return column{}, false
+}
+
+// readSchema flattens the depth-first schema list into leaf columns
+func (f *File) readSchema(list []interface{}) error {
+	elements := make([]tstruct, len(list))
+	for i, e := range list {
+		s, ok := e.(tstruct)
+		if !ok {
+			return fmt.Errorf("invalid schema element %d", i)
+		}
+		elements[i] = s
+	}
+	if len(elements) == 0 {
+		return fmt.Errorf("empty schema")
+	}
+
+	pos := 1
+	var walk func(prefix string, nested bool) error
+	walk = func(prefix string, nested bool) error {
+		if pos >= len(elements) {
+			return fmt.Errorf("schema ends early")
+		}
+		el := elements[pos]
+		pos++
+
+		name := prefix + el.string(4)
+		repetition := el.int(3, repetitionRequired)
+		if children := int(el.int(5, 0)); children > 0 {
+			for i := 0; i < children; i++ {
+				if err := walk(name+".", true); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		col := column{
+			name:       name,
+			index:      len(f.columns),
+			physical:   el.int(1, -1),
+			typeLength: int(el.int(2, 0)),
+			optional:   repetition == repetitionOptional,
+			repeated:   nested || repetition > repetitionOptional,
+			timeUnit:   timestampUnit(el),
+		}
+		f.columns = append(f.columns, col)
+		return nil
+	}
+
+	for i := 0; i < int(elements[0].int(5, 0)); i++ {
+		if err := walk("", false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timestampUnit returns the unit of a timestamp column, or 0 if it is not one
+func timestampUnit(el tstruct) time.Duration {
+	if el.int(1, -1) == typeInt96 {
+		return time.Nanosecond
+	}
+	if el.int(1, -1) != typeInt64 {
+		return 0
+	}
+	if ts := el.child(10).child(8); ts != nil {
+		unit := ts.child(2)
+		switch {
+		case unit.child(1) != nil:
+			return time.Millisecond
+		case unit.child(2) != nil:
+			return time.Microsecond
+		case unit.child(3) != nil:
+			return time.Nanosecond
+		}
+	}
+	switch el.int(6, -1) {
+	case convertedTimestampMillis:
+		return time.Millisecond
+	case convertedTimestampMicros:
+		return time.Microsecond
+	}
+	return 0
+}
+
+// readColumnChunk decodes all values of a column within a row group
+func (f *File) readColumnChunk(rg tstruct, col column) ([]interface{}, error) {
+	chunks := rg.list(1)
+	if col.index >= len(chunks) {
+		return nil, fmt.Errorf("missing column chunk")
+	}
+	chunk, _ := chunks[col.index].(tstruct)
+	meta := chunk.child(3)
+	if meta == nil {
+		return nil, fmt.Errorf("column chunks in external files are not supported")
+	}
+
+	codec := meta.int(4, codecUncompressed)
+	numValues := meta.int(5, 0)
+	start := meta.int(9, 0)
+	if dict := meta.int(11, 0); dict > 0 && dict < start {
+		start = dict
+	}
+	length := meta.int(7, 0)
+	if start < 0 || length < 0 || length > 1<<31 {
+		return nil, fmt.Errorf("invalid column chunk bounds")
+	}
+	if numValues < 0 {
+		return nil, fmt.Errorf("invalid column chunk value count %d", numValues)
+	}
+
+	buf := make([]byte, length)
+	if _, err := f.r.ReadAt(buf, start); err != nil {
+		return nil, fmt.Errorf("failed to read column chunk: %w", err)
+	}
+
+	// The value count comes from the file: preallocate no more than one value
+	// per chunk byte and let the slice grow past that if pages hold more
+	values := make([]interface{}, 0, min(numValues, length))
+	var dict []interface{}
+	for pos := 0; int64(len(values)) < numValues && pos < len(buf); {
+		cr := &compactReader{data: buf[pos:]}
+		header, err := cr.readStruct()
+		if err != nil {
+			return nil, fmt.Errorf("invalid page header: %w", err)
+		}
+		pos += cr.pos
+
+		size := int(header.int(3, 0))
+		if size < 0 || pos+size > len(buf) {
+			return nil, errTruncated
+		}
+		body := buf[pos : pos+size]
+		pos += size
+
+		switch header.int(1, -1) {
+		case pageDictionary:
+			data, err := decompress(codec, body)
+			if err != nil {
+				return nil, err
+			}
+			if dict, err = decodePlain(data, col, int(header.child(7).int(1, 0))); err != nil {
+				return nil, fmt.Errorf("dictionary page: %w", err)
+			}
+
+		case pageData:
+			data, err := decompress(codec, body)
+			if err != nil {
+				return nil, err
+			}
+			dh := header.child(5)
+			count := int(dh.int(1, 0))
+
+			var defs []int
+			if col.optional {
+				if enc := dh.int(3, encodingRLE); enc != encodingRLE {
+					return nil, fmt.Errorf("unsupported definition level encoding %d", enc)
+				}
+				if len(data) < 4 {
+					return nil, errTruncated
+				}
+				n := int(binary.LittleEndian.Uint32(data))
+				if n < 0 || 4+n > len(data) {
+					return nil, errTruncated
+				}
+				if defs, err = decodeHybrid(data[4:4+n], 1, count); err != nil {
+					return nil, fmt.Errorf("definition levels: %w", err)
+				}
+				data = data[4+n:]
+			}
+			if values, err = appendPage(values, data, dh.int(2, encodingPlain), col, count, defs, dict); err != nil {
+				return nil, err
+			}
+
+		case pageDataV2:
+			dh := header.child(8)
+			count := int(dh.int(1, 0))
+			repLen := int(dh.int(6, 0))
+			defLen := int(dh.int(5, 0))
+			if repLen < 0 || defLen < 0 || repLen+defLen > len(body) {
+				return nil, errTruncated
+			}
+
+			var defs []int
+			if col.optional {
+				if defs, err = decodeHybrid(body[repLen:repLen+defLen], 1, count); err != nil {
+					return nil, fmt.Errorf("definition levels: %w", err)
+				}
+			}
+			data := body[repLen+defLen:]
+			if dh.bool(7, true) {
+				if data, err = decompress(codec, data); err != nil {
+					return nil, err
+				}
+			}
+			if values, err = appendPage(values, data, dh.int(4, encodingPlain), col, count, defs, dict); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return values, nil
+}
+
+// appendPage decodes the values of a data page and interleaves nulls
+func appendPage(values []interface{}, data []byte, encoding int64, col column, count int, defs []int, dict []interface{}) ([]interface{}, error) {
+	present := count
+	if defs != nil {
+		present = 0
+		for _, d := range defs {
+			present += d
+		}
+	}
+
+	var page []interface{}
+	var err error
+	switch encoding {
+	case encodingPlain:
+		page, err = decodePlain(data, col, present)
+	case encodingPlainDictionary, encodingRLEDictionary:
+		page, err = decodeDictionary(data, dict, present)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %d", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if defs == nil {
+		return append(values, page...), nil
+	}
+	next := 0
+	for _, d := range defs {
+		if d == 0 {
+			values = append(values, nil)
+			continue
+		}
+		values = append(values, page[next])
+		next++
+	}
+	return values, nil
+}
+
+// decodeDictionary resolves RLE/bit-packed dictionary indices
+func decodeDictionary(data []byte, dict []interface{}, count int) ([]interface{}, error) {
+	if count == 0 {
+		return nil, nil
+	}
+	if dict == nil {
+		return nil, fmt.Errorf("dictionary-encoded page without dictionary")
+	}
+	if len(data) == 0 {
+		return nil, errTruncated
+	}
+	indices, err := decodeHybrid(data[1:], int(data[0]), count)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, count)
+	for i, idx := range indices {
+		if idx >= len(dict) {
+			return nil, fmt.Errorf("dictionary index %d out of range", idx)
+		}
+		values[i] = dict[idx]
+	}
+	return values, nil
+}
+
+// decodePlain decodes count PLAIN-encoded values of a column
+func decodePlain(data []byte, col column, count int) ([]interface{}, error) {
+	values := make([]interface{}, 0, count)
+	pos := 0
+	need := func(n int) error {
+		if n < 0 || pos+n > len(data) {
+			return errTruncated
+		}
+		return nil
+	}
+
+	for i := 0; i < count; i++ {
+		switch col.physical {
+		case typeBoolean:
+			if i/8 >= len(data) {
+				return nil, errTruncated
+			}
+			values = append(values, data[i/8]>>(i%8)&1 == 1)
+		case typeInt32:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			values = append(values, int64(int32(binary.LittleEndian.Uint32(data[pos:]))))
+			pos += 4
+		case typeInt64:
+			if err := need(8); err != nil {
+				return nil, err
+			}
+			v := int64(binary.LittleEndian.Uint64(data[pos:]))
+			pos += 8
+			if col.timeUnit > 0 {
+				values = append(values, time.Unix(0, 0).Add(time.Duration(v)*col.timeUnit).UTC())
+			} else {
+				values = append(values, v)
+			}
+		case typeInt96:
+			if err := need(12); err != nil {
+				return nil, err
+			}
+			nanos := int64(binary.LittleEndian.Uint64(data[pos:]))
+			julianDay := int64(binary.LittleEndian.Uint32(data[pos+8:]))
+			pos += 12
+			values = append(values, time.Unix((julianDay-2440588)*86400, nanos).UTC())
+		case typeFloat:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			values = append(values, float64(math.Float32frombits(binary.LittleEndian.Uint32(data[pos:]))))
+			pos += 4
+		case typeDouble:
+			if err := need(8); err != nil {
+				return nil, err
+			}
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(data[pos:])))
+			pos += 8
+		case typeByteArray:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			n := int(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+			if err := need(n); err != nil {
+				return nil, err
+			}
+			values = append(values, string(data[pos:pos+n]))
+			pos += n
+		case typeFixedLenByteArray:
+			if err := need(col.typeLength); err != nil {
+				return nil, err
+			}
+			values = append(values, string(data[pos:pos+col.typeLength]))
+			pos += col.typeLength
+		default:
+			return nil, fmt.Errorf("unsupported physical type %d", col.physical)
+		}
+	}
+	return values, nil
+}
+
+// decodeHybrid decodes count values of the RLE/bit-packing hybrid encoding
+func decodeHybrid(data []byte, bitWidth, count int) ([]int, error) {
+	if bitWidth > 32 {
+		return nil, fmt.Errorf("invalid bit width %d", bitWidth)
+	}
+	byteWidth := (bitWidth + 7) / 8
+	out := make([]int, 0, count)
+	pos := 0
+
+	for len(out) < count {
+		header, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		pos += n
+
+		if header&1 == 0 {
+			// RLE run: one value repeated
+			if pos+byteWidth > len(data) {
+				return nil, errTruncated
+			}
+			v := 0
+			for i := 0; i < byteWidth; i++ {
+				v |= int(data[pos+i]) << (8 * i)
+			}
+			pos += byteWidth
+			for i := uint64(0); i < header>>1 && len(out) < count; i++ {
+				out = append(out, v)
+			}
+			continue
+		}
+
+		// Bit-packed run: groups of 8 values, least significant bit first
+		groups := int(header >> 1)
+		size := groups * bitWidth
+		if groups < 0 || pos+size > len(data) {
+			return nil, errTruncated
+		}
+		packed := data[pos : pos+size]
+		pos += size
+		for i := 0; i < groups*8 && len(out) < count; i++ {
+			v := 0
+			for b := 0; b < bitWidth; b++ {
+				bit := i*bitWidth + b
+				v |= int(packed[bit/8]>>(bit%8)&1) << b
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// decompress inflates a page body with the column chunk's codec
+func decompress(codec int64, data []byte) ([]byte, error) {
+	switch codec {
+	case codecUncompressed:
+		return data, nil
+	case codecSnappy:
+		out, err := snappy.Decode(nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("snappy: %w", err)
+		}
+		return out, nil
+	case codecGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	if name, ok := codecNames[codec]; ok {
+		return nil, fmt.Errorf("unsupported compression %s (rewrite the file with snappy, gzip or no compression)", name)
+	}
+	return nil, fmt.Errorf("unknown compression codec %d", codec)
+}
@@ -0,0 +1,218 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Thrift compact protocol type IDs
+const (
+	tStop   = 0
+	tTrue   = 1
+	tFalse  = 2
+	tByte   = 3
+	tI16    = 4
+	tI32    = 5
+	tI64    = 6
+	tDouble = 7
+	tBinary = 8
+	tList   = 9
+	tSet    = 10
+	tMap    = 11
+	tStruct = 12
+)
+
+// tstruct is a decoded Thrift struct keyed by field ID. Values are int64, bool,
+// float64, []byte, []interface{} or tstruct; maps are skipped.
+type tstruct map[int16]interface{}
+
+// int returns an integer field, or def when it is absent
+func (s tstruct) int(id int16, def int64) int64 {
+	if v, ok := s[id].(int64); ok {
+		return v
+	}
+	return def
+}
+
+// bool returns a boolean field, or def when it is absent
+func (s tstruct) bool(id int16, def bool) bool {
+	if v, ok := s[id].(bool); ok {
+		return v
+	}
+	return def
+}
+
+// string returns a binary field as a string
+func (s tstruct) string(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+// child returns a nested struct field, or nil when it is absent
+func (s tstruct) child(id int16) tstruct {
+	v, _ := s[id].(tstruct)
+	return v
+}
+
+// list returns a list field
+func (s tstruct) list(id int16) []interface{} {
+	v, _ := s[id].([]interface{})
+	return v
+}
+
+// compactReader decodes the Thrift compact protocol used by Parquet metadata
+type compactReader struct {
+	data []byte
+	pos  int
+}
+
+// readStruct decodes a struct up to its stop field
+func (r *compactReader) readStruct() (tstruct, error) {
+	s := tstruct{}
+	var lastID int16
+	for {
+		header, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if header == tStop {
+			return s, nil
+		}
+
+		fieldType := header & 0x0f
+		id := lastID + int16(header>>4)
+		if header>>4 == 0 {
+			v, err := r.readVarint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(zigzag(v))
+		}
+		lastID = id
+
+		var value interface{}
+		switch fieldType {
+		case tTrue:
+			value = true
+		case tFalse:
+			value = false
+		default:
+			if value, err = r.readValue(fieldType); err != nil {
+				return nil, fmt.Errorf("field %d: %w", id, err)
+			}
+		}
+		if value != nil {
+			s[id] = value
+		}
+	}
+}
+
+// readValue decodes a value of the given type (booleans as list elements)
+func (r *compactReader) readValue(fieldType byte) (interface{}, error) {
+	switch fieldType {
+	case tTrue, tFalse:
+		b, err := r.readByte()
+		return b == tTrue, err
+	case tByte:
+		b, err := r.readByte()
+		return int64(int8(b)), err
+	case tI16, tI32, tI64:
+		v, err := r.readVarint()
+		return zigzag(v), err
+	case tDouble:
+		if r.pos+8 > len(r.data) {
+			return nil, errTruncated
+		}
+		bits := binary.LittleEndian.Uint64(r.data[r.pos:])
+		r.pos += 8
+		return math.Float64frombits(bits), nil
+	case tBinary:
+		n, err := r.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(r.data)-r.pos) {
+			return nil, errTruncated
+		}
+		b := r.data[r.pos : r.pos+int(n)]
+		r.pos += int(n)
+		return b, nil
+	case tList, tSet:
+		return r.readList()
+	case tMap:
+		return nil, r.skipMap()
+	case tStruct:
+		return r.readStruct()
+	default:
+		return nil, fmt.Errorf("unknown thrift type %d", fieldType)
+	}
+}
+
+func (r *compactReader) readList() ([]interface{}, error) {
+	header, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(header >> 4)
+	if size == 15 {
+		if size, err = r.readVarint(); err != nil {
+			return nil, err
+		}
+	}
+	if size > uint64(len(r.data)-r.pos) {
+		return nil, errTruncated
+	}
+
+	list := make([]interface{}, 0, size)
+	for i := uint64(0); i < size; i++ {
+		v, err := r.readValue(header & 0x0f)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+func (r *compactReader) skipMap() error {
+	size, err := r.readVarint()
+	if err != nil || size == 0 {
+		return err
+	}
+	types, err := r.readByte()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < size; i++ {
+		if _, err := r.readValue(types >> 4); err != nil {
+			return err
+		}
+		if _, err := r.readValue(types & 0x0f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *compactReader) readByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errTruncated
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *compactReader) readVarint() (uint64, error) {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.pos += n
+	return v, nil
+}
+
+func zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
@@ -0,0 +1,135 @@
+// Package partition divides a road graph into nested cells for multi-level
+// route planning.
+package partition
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// Partition assigns every node index to one cell per level. Level 0 has the
+// smallest cells and every cell lies within one cell of the level above.
+type Partition struct {
+	cells  [][]uint32 // Cell of each node index, per level
+	counts []int      // Number of cells per level
+}
+
+// New partitions the nodes of x by recursive bisection at the median of the
+// wider side of their bounding box, until the cells of level l hold at most
+// cellSizes[l] nodes. Cell sizes must be increasing.
+func New(x *graph.Index, cellSizes []int) (*Partition, error) {
+	if len(cellSizes) == 0 {
+		return nil, fmt.Errorf("at least one cell size is required")
+	}
+	for i, size := range cellSizes {
+		if size < 2 {
+			return nil, fmt.Errorf("cell size must be at least 2, got %d", size)
+		}
+		if i > 0 && size <= cellSizes[i-1] {
+			return nil, fmt.Errorf("cell sizes must be increasing, got %d after %d", size, cellSizes[i-1])
+		}
+	}
+
+	b := &builder{
+		x:     x,
+		sizes: cellSizes,
+		p: &Partition{
+			cells:  make([][]uint32, len(cellSizes)),
+			counts: make([]int, len(cellSizes)),
+		},
+	}
+	nodes := make([]uint32, x.NodeCount())
+	for i := range nodes {
+		nodes[i] = uint32(i)
+	}
+	for level := range b.p.cells {
+		b.p.cells[level] = make([]uint32, len(nodes))
+	}
+	b.split(nodes, len(cellSizes)-1)
+	return b.p, nil
+}
+
+// Levels returns the number of levels
+func (p *Partition) Levels() int {
+	return len(p.cells)
+}
+
+// Cell returns the cell of a node index on a level
+func (p *Partition) Cell(level int, node uint32) uint32 {
+	return p.cells[level][node]
+}
+
+// CellCount returns the number of cells on a level
+func (p *Partition) CellCount(level int) int {
+	return p.counts[level]
+}
+
+type builder struct {
+	x     *graph.Index
+	sizes []int
+	p     *Partition
+}
+
+// split makes cells of level from nodes, bisecting them while they are too
+// large, and then splits each cell into the cells of the level below
+func (b *builder) split(nodes []uint32, level int) {
+	if level < 0 {
+		return
+	}
+	if len(nodes) <= b.sizes[level] {
+		cell := uint32(b.p.counts[level])
+		b.p.counts[level]++
+		for _, node := range nodes {
+			b.p.cells[level][node] = cell
+		}
+		b.split(nodes, level-1)
+		return
+	}
+
+	b.sortAlongWiderSide(nodes)
+	half := len(nodes) / 2
+	b.split(nodes[:half], level)
+	b.split(nodes[half:], level)
+}
+
+// sortAlongWiderSide sorts nodes by latitude or longitude, whichever their
+// bounding box is wider in
+func (b *builder) sortAlongWiderSide(nodes []uint32) {
+	minLat, minLon := math.Inf(1), math.Inf(1)
+	maxLat, maxLon := math.Inf(-1), math.Inf(-1)
+	for _, node := range nodes {
+		lat, lon := b.x.Coord(node)
+		minLat, maxLat = min(minLat, lat), max(maxLat, lat)
+		minLon, maxLon = min(minLon, lon), max(maxLon, lon)
+	}
+
+	// Degrees of longitude shrink towards the poles
+	width := (maxLon - minLon) * math.Cos((minLat+maxLat)/2*math.Pi/180)
+	byLon := width > maxLat-minLat
+	slices.SortFunc(nodes, func(a, c uint32) int {
+		aLat, aLon := b.x.Coord(a)
+		cLat, cLon := b.x.Coord(c)
+		if byLon {
+			return cmpFloat(aLon, cLon, a, c)
+		}
+		return cmpFloat(aLat, cLat, a, c)
+	})
+}
+
+// cmpFloat orders by coordinate and then by node index, so partitions are deterministic
+func cmpFloat(a, c float64, i, j uint32) int {
+	switch {
+	case a < c:
+		return -1
+	case a > c:
+		return 1
+	case i < j:
+		return -1
+	case i > j:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,83 @@
+package partition
+
+import (
+	"testing"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// createGrid creates an n x n grid of nodes about 100 m apart, connected to their right neighbours
+func createGrid(n int) *graph.Graph {
+	g := graph.NewGraph()
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			id := int64(row*n + col + 1)
+			g.AddNode(&graph.Node{ID: id, Lat: 43.0 + float64(row)*0.001, Lon: 7.0 + float64(col)*0.001})
+			if col > 0 {
+				g.AddEdge(graph.Edge{From: id - 1, To: id, Weight: 81})
+			}
+		}
+	}
+	return g
+}
+
+func TestPartitionCellSizesAndNesting(t *testing.T) {
+	x := createGrid(30).Index()
+	sizes := []int{16, 100, 400}
+	p, err := New(x, sizes)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if p.Levels() != len(sizes) {
+		t.Fatalf("Levels() = %d, want %d", p.Levels(), len(sizes))
+	}
+
+	for level, size := range sizes {
+		counts := make([]int, p.CellCount(level))
+		for node := uint32(0); node < uint32(x.NodeCount()); node++ {
+			counts[p.Cell(level, node)]++
+		}
+		for cell, count := range counts {
+			if count == 0 || count > size {
+				t.Errorf("level %d cell %d has %d nodes, want 1..%d", level, cell, count, size)
+			}
+		}
+	}
+
+	// Every cell lies within one cell of the level above
+	for level := 0; level+1 < p.Levels(); level++ {
+		parent := make(map[uint32]uint32)
+		for node := uint32(0); node < uint32(x.NodeCount()); node++ {
+			cell, up := p.Cell(level, node), p.Cell(level+1, node)
+			if seen, ok := parent[cell]; ok && seen != up {
+				t.Fatalf("level %d cell %d spans cells %d and %d above", level, cell, seen, up)
+			}
+			parent[cell] = up
+		}
+	}
+}
+
+func TestPartitionIsDeterministic(t *testing.T) {
+	x := createGrid(20).Index()
+	a, err := New(x, []int{10, 50})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	b, _ := New(x, []int{10, 50})
+	for level := 0; level < a.Levels(); level++ {
+		for node := uint32(0); node < uint32(x.NodeCount()); node++ {
+			if a.Cell(level, node) != b.Cell(level, node) {
+				t.Fatalf("node %d is in cell %d and %d on level %d", node, a.Cell(level, node), b.Cell(level, node), level)
+			}
+		}
+	}
+}
+
+func TestPartitionRejectsBadCellSizes(t *testing.T) {
+	x := createGrid(4).Index()
+	for _, sizes := range [][]int{nil, {1}, {8, 8}, {16, 4}} {
+		if _, err := New(x, sizes); err == nil {
+			t.Errorf("New(%v) succeeded", sizes)
+		}
+	}
+}
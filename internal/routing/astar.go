@@ -1,8 +1,12 @@
 package routing
 
 import (
-	"container/heap"
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"time"
 
 	"github.com/vamosdalian/nav/internal/graph"
 )
@@ -10,14 +14,55 @@ import (
 // Route represents a path from source to destination
 type Route struct {
 	Nodes    []int64
-	Distance float64
+	Distance float64 // Length of the path (m)
 	Duration float64
+	Weight   float64 // Profile cost the search minimized
 }
 
-// Router provides routing functionality
+// ErrNoRoute is returned when no path connects the start and end points
+var ErrNoRoute = errors.New("no route found")
+
+// ErrSearchAborted is returned when a search is cancelled or exceeds its node
+// or time budget before reaching the destination
+var ErrSearchAborted = errors.New("search aborted")
+
+// ClosureChecker reports whether an edge is currently closed to traffic
+type ClosureChecker interface {
+	IsClosed(edge *graph.Edge) bool
+}
+
+// ClosureSource provides the closures in effect when a search starts. Searches
+// query the returned checker for every edge they relax, so it should not lock.
+type ClosureSource interface {
+	Closures() ClosureChecker
+}
+
+// SpeedProvider supplies live speeds (m/s) that override the base edge speeds
+type SpeedProvider interface {
+	Speed(edge *graph.Edge) (float64, bool)
+}
+
+// SpeedSource provides the live speeds in effect when a search starts. Searches
+// query the returned provider several times per edge, so it should not lock.
+type SpeedSource interface {
+	Speeds() SpeedProvider
+}
+
+// HistoricalSpeeds supplies typical speeds (m/s) of an edge by time of week
+type HistoricalSpeeds interface {
+	SpeedAt(edge *graph.Edge, t time.Time) (float64, bool)
+}
+
+// Router provides routing functionality. Searches keep their state outside
+// the router, so it is safe for concurrent use once it is configured; the
+// setters must not be called while searches run.
 type Router struct {
-	graph   *graph.Graph
-	profile RoutingProfile
+	graph    *graph.Graph
+	profile  RoutingProfile
+	closures ClosureSource
+	traffic  SpeedSource
+	history  HistoricalSpeeds
+	pool     *workspacePool
 }
 
 // NewRouter creates a new router with default car profile
@@ -25,6 +70,7 @@ func NewRouter(g *graph.Graph) *Router {
 	return &Router{
 		graph:   g,
 		profile: CarProfile,
+		pool:    newWorkspacePool(0),
 	}
 }
 
@@ -33,285 +79,426 @@ func NewRouterWithProfile(g *graph.Graph, profile RoutingProfile) *Router {
 	return &Router{
 		graph:   g,
 		profile: profile,
+		pool:    newWorkspacePool(0),
 	}
 }
 
-// SetProfile sets the routing profile
+// WithGraph returns a router for another graph with the same profile,
+// closures and speed sources
+func (r *Router) WithGraph(g *graph.Graph) *Router {
+	copied := *r
+	copied.graph = g
+	return &copied
+}
+
+// SetProfile sets the default routing profile of searches without their own profile
 func (r *Router) SetProfile(profile RoutingProfile) {
 	r.profile = profile
 }
 
+// SetClosures sets the road closures honoured by all searches
+func (r *Router) SetClosures(closures ClosureSource) {
+	r.closures = closures
+}
+
+// SetTraffic sets the live speed source honoured by all searches
+func (r *Router) SetTraffic(traffic SpeedSource) {
+	r.traffic = traffic
+}
+
+// SetHistoricalSpeeds sets the typical speeds used where no live traffic is known
+func (r *Router) SetHistoricalSpeeds(history HistoricalSpeeds) {
+	r.history = history
+}
+
+// SetMaxSearches limits the number of searches that run at once, and so the
+// memory their workspaces take (see workspacePool). Further searches wait for
+// a free workspace until their context or time limit ends. 0 removes the limit.
+func (r *Router) SetMaxSearches(n int) {
+	r.pool = newWorkspacePool(n)
+}
+
 // FindRoute finds the shortest path using A* algorithm
-func (r *Router) FindRoute(fromLat, fromLon, toLat, toLon float64) (*Route, error) {
-	return r.FindRouteWithProfile(fromLat, fromLon, toLat, toLon, r.profile)
+func (r *Router) FindRoute(ctx context.Context, fromLat, fromLon, toLat, toLon float64) (*Route, error) {
+	return r.FindRouteWithProfile(ctx, fromLat, fromLon, toLat, toLon, r.profile)
 }
 
 // FindRouteWithProfile finds a route using a specific routing profile
-func (r *Router) FindRouteWithProfile(fromLat, fromLon, toLat, toLon float64, profile RoutingProfile) (*Route, error) {
+func (r *Router) FindRouteWithProfile(ctx context.Context, fromLat, fromLon, toLat, toLon float64, profile RoutingProfile) (*Route, error) {
+	s, err := r.newSearch(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	defer s.release()
+	x := s.x
+
 	// Find nearest nodes to start and end coordinates
-	startNode, err := r.graph.FindNearestNode(fromLat, fromLon)
+	start, err := x.Nearest(fromLat, fromLon)
 	if err != nil {
 		return nil, fmt.Errorf("cannot find start node: %w", err)
 	}
-	
-	endNode, err := r.graph.FindNearestNode(toLat, toLon)
+
+	end, err := x.Nearest(toLat, toLon)
 	if err != nil {
 		return nil, fmt.Errorf("cannot find end node: %w", err)
 	}
-	
-	if startNode.ID == endNode.ID {
+
+	if start == end {
 		return &Route{
-			Nodes:    []int64{startNode.ID},
+			Nodes:    []int64{x.NodeID(start)},
 			Distance: 0,
 			Duration: 0,
 		}, nil
 	}
-	
-	// Temporarily set profile for this routing
-	oldProfile := r.profile
-	r.profile = profile
-	defer func() { r.profile = oldProfile }()
-	
-	return r.astar(startNode.ID, endNode.ID)
+
+	return s.withTravelTime(s.astar(start, end, nil))
 }
 
 // FindMultipleRoutes finds alternative routes using penalty method
-func (r *Router) FindMultipleRoutes(fromLat, fromLon, toLat, toLon float64, numRoutes int) ([]*Route, error) {
+func (r *Router) FindMultipleRoutes(ctx context.Context, fromLat, fromLon, toLat, toLon float64, numRoutes int) ([]*Route, error) {
+	return r.FindMultipleRoutesWithProfile(ctx, fromLat, fromLon, toLat, toLon, numRoutes, r.profile)
+}
+
+// FindMultipleRoutesWithProfile finds alternative routes using a specific routing profile.
+// Each alternative is a search with the full budget of the profile.
+func (r *Router) FindMultipleRoutesWithProfile(ctx context.Context, fromLat, fromLon, toLat, toLon float64, numRoutes int, profile RoutingProfile) ([]*Route, error) {
 	if numRoutes < 1 {
 		numRoutes = 1
 	}
-	
+
+	s, err := r.newSearch(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	defer s.release()
+	x := s.x
 	routes := make([]*Route, 0, numRoutes)
 	penalizedEdges := make(map[edgeKey]float64)
-	
+
 	for i := 0; i < numRoutes; i++ {
-		route, err := r.findRouteWithPenalty(fromLat, fromLon, toLat, toLon, penalizedEdges)
+		route, err := s.findRouteWithPenalty(fromLat, fromLon, toLat, toLon, penalizedEdges)
 		if err != nil {
 			if i == 0 {
 				return nil, err
 			}
 			break // No more alternative routes found
 		}
-		
+
 		// Check if route is sufficiently different
 		if i > 0 && !r.isSufficientlyDifferent(route, routes) {
 			break
 		}
-		
+
 		routes = append(routes, route)
-		
+		s.withTravelTime(route, nil)
+
 		// Penalize edges used in this route for next iteration
 		for j := 0; j < len(route.Nodes)-1; j++ {
-			key := edgeKey{from: route.Nodes[j], to: route.Nodes[j+1]}
-			penalizedEdges[key] = 1.5 // 50% penalty
+			from, _ := x.Lookup(route.Nodes[j])
+			to, _ := x.Lookup(route.Nodes[j+1])
+			penalizedEdges[edgeKey{from: from, to: to}] = 1.5 // 50% penalty
 		}
 	}
-	
+
 	return routes, nil
 }
 
+// edgeKey identifies a penalized edge by its node indices
 type edgeKey struct {
-	from, to int64
-}
-
-// stateKey represents a routing state with node and previous way
-// Used for turn restriction checks
-type stateKey struct {
-	nodeID    int64
-	prevWayID int64
+	from, to uint32
 }
 
-func (r *Router) findRouteWithPenalty(fromLat, fromLon, toLat, toLon float64, penalties map[edgeKey]float64) (*Route, error) {
-	startNode, err := r.graph.FindNearestNode(fromLat, fromLon)
+func (s *search) findRouteWithPenalty(fromLat, fromLon, toLat, toLon float64, penalties map[edgeKey]float64) (*Route, error) {
+	start, err := s.x.Nearest(fromLat, fromLon)
 	if err != nil {
 		return nil, err
 	}
-	
-	endNode, err := r.graph.FindNearestNode(toLat, toLon)
+
+	end, err := s.x.Nearest(toLat, toLon)
 	if err != nil {
 		return nil, err
 	}
-	
-	return r.astarWithPenalty(startNode.ID, endNode.ID, penalties)
-}
 
-func (r *Router) astar(start, end int64) (*Route, error) {
-	return r.astarWithPenalty(start, end, nil)
+	return s.astar(start, end, penalties)
 }
 
-func (r *Router) astarWithPenalty(start, end int64, penalties map[edgeKey]float64) (*Route, error) {
-	endNode, err := r.graph.GetNode(end)
-	if err != nil {
-		return nil, err
-	}
-	
-	startNode, err := r.graph.GetNode(start)
-	if err != nil {
-		return nil, err
-	}
-	
-	// Priority queue for open set
-	openSet := &priorityQueue{}
-	heap.Init(openSet)
-	
-	// Track visited nodes with state (including previous way for turn restrictions)
-	type stateKey struct {
-		nodeID    int64
-		prevWayID int64
-	}
-	
-	cameFrom := make(map[stateKey]stateKey)
-	gScore := make(map[stateKey]float64)
-	
-	startState := stateKey{nodeID: start, prevWayID: 0}
-	gScore[startState] = 0
-	
-	// Track closed set to avoid revisiting
-	closedSet := make(map[stateKey]bool)
-	
-	h := graph.HaversineDistance(startNode.Lat, startNode.Lon, endNode.Lat, endNode.Lon)
-	
-	heap.Push(openSet, &item{
-		nodeID:   start,
-		priority: h,
-		gScore:   0,
-	})
-	
-	nodesExplored := 0
-	maxNodesToExplore := 100000 // Prevent infinite loops
-	
-	for openSet.Len() > 0 && nodesExplored < maxNodesToExplore {
-		current := heap.Pop(openSet).(*item)
-		
-		// Find best state for this node
-		var currentState stateKey
-		bestScore := float64(1e9)
-		for state, score := range gScore {
-			if state.nodeID == current.nodeID && score < bestScore {
-				bestScore = score
-				currentState = state
+// astar searches over node indices. Search states are the edges nodes are
+// reached by, so turns can be checked against the previous way: state 0 is
+// the start and state e+1 is reaching the head of edge e.
+func (s *search) astar(start, end uint32, penalties map[edgeKey]float64) (*Route, error) {
+	x, ws := s.x, s.ws
+	endLat, endLon := x.Coord(end)
+	startLat, startLon := x.Coord(start)
+
+	states := &ws.forward
+	states.reset(x.EdgeCount() + 1)
+	states.set(0, 0, 0)
+	ws.nodes.reset(x.NodeCount())
+	ws.open.reset(x.EdgeCount() + 1)
+
+	h := graph.HaversineDistance(startLat, startLon, endLat, endLon)
+	ws.open.push(item{node: start, priority: h})
+
+	s.explored = 0
+
+	for ws.open.len() > 0 {
+		current := ws.open.pop()
+		gScore := states.score[current.state]
+
+		// Each state is queued once, so it is settled when popped
+		states.settle(current.state)
+		if ws.nodes.settle(current.node) {
+			if err := s.explore(); err != nil {
+				return nil, err
 			}
 		}
-		
-		// Skip if already processed
-		if closedSet[currentState] {
-			continue
-		}
-		closedSet[currentState] = true
-		nodesExplored++
-		
-		if current.nodeID == end {
-			// Reconstruct path from states
-			path := []int64{currentState.nodeID}
-			curr := currentState
-			
-			for curr != startState {
-				curr = cameFrom[curr]
-				path = append([]int64{curr.nodeID}, path...)
-			}
-			
-			return &Route{
-				Nodes:    path,
-				Distance: gScore[currentState],
-				Duration: gScore[currentState] / 13.89,
-			}, nil
+
+		if current.node == end {
+			return s.newRoute(s.statePath(start, current.state), gScore), nil
 		}
-		
+
 		// Explore neighbors
-		edges := r.graph.GetEdges(current.nodeID)
-		for _, edge := range edges {
-			nextState := stateKey{nodeID: edge.To, prevWayID: edge.OSMWayID}
-			
-			if closedSet[nextState] {
+		ws.edges = x.OutEdges(ws.edges[:0], current.node)
+		for i := range ws.edges {
+			edge := &ws.edges[i]
+			next := edge.ID + 1
+			if states.isSettled(next) {
 				continue
 			}
-			
-			// Check if this road type is allowed by the profile
-			highway := edge.Tags["highway"]
-			if !r.profile.IsAllowed(highway) {
+
+			// Check if this road type and area are allowed by the profile
+			if !s.edgeAllowed(edge) {
 				continue
 			}
-			
+
 			// Check turn restrictions
-			if currentState.prevWayID != 0 {
-				if !r.graph.IsValidTurn(currentState.prevWayID, current.nodeID, edge.OSMWayID) {
+			if current.way != 0 {
+				if !x.IsValidTurn(current.way, edge.From, edge.OSMWayID) {
 					continue // Turn is restricted
 				}
 			}
-			
+
 			// Calculate weight based on profile
-			surface := edge.Tags["surface"]
-			weight := r.profile.CalculateWeight(edge.Weight, highway, surface)
-			
+			weight := s.edgeWeight(edge)
+			if math.IsInf(weight, 1) {
+				continue
+			}
+
 			// Apply penalty if exists
 			if penalties != nil {
-				if penalty, exists := penalties[edgeKey{from: edge.From, to: edge.To}]; exists {
+				if penalty, exists := penalties[edgeKey{from: edge.Tail, to: edge.Head}]; exists {
 					weight *= penalty
 				}
 			}
-			
-			tentativeGScore := gScore[currentState] + weight
-			
-			if currentGScore, exists := gScore[nextState]; !exists || tentativeGScore < currentGScore {
-				cameFrom[nextState] = currentState
-				gScore[nextState] = tentativeGScore
-				
-				neighbor, _ := r.graph.GetNode(edge.To)
-				h := graph.HaversineDistance(neighbor.Lat, neighbor.Lon, endNode.Lat, endNode.Lon)
+
+			tentativeGScore := gScore + weight
+
+			if currentGScore, exists := states.get(next); !exists || tentativeGScore < currentGScore {
+				states.set(next, tentativeGScore, current.state)
+
+				lat, lon := x.Coord(edge.Head)
+				h := graph.HaversineDistance(lat, lon, endLat, endLon)
 				fScore := tentativeGScore + h
-				
-				heap.Push(openSet, &item{
-					nodeID:   edge.To,
-					priority: fScore,
-					gScore:   tentativeGScore,
-				})
+
+				it := item{node: edge.Head, state: next, way: edge.OSMWayID, priority: fScore}
+				if exists {
+					ws.open.decrease(it)
+				} else {
+					ws.open.push(it)
+				}
 			}
 		}
 	}
-	
-	return nil, fmt.Errorf("no route found from %d to %d (explored %d nodes)", start, end, nodesExplored)
+
+	return nil, fmt.Errorf("%w from %d to %d (explored %d nodes)", ErrNoRoute, x.NodeID(start), x.NodeID(end), s.explored)
 }
 
-func (r *Router) reconstructPathWithStates(cameFrom interface{}, start, end interface{}, distance float64) *Route {
-	// Type assertion for the generic state key type
-	type stateKey struct {
-		nodeID    int64
-		prevWayID int64
+// statePath returns the node IDs along the chain of search states ending in state
+func (s *search) statePath(start, state uint32) []int64 {
+	var path []int64
+	for ; state != 0; state = s.ws.forward.parent[state] {
+		path = append(path, s.x.NodeID(s.x.Head(state-1)))
 	}
-	
-	cf := cameFrom.(map[stateKey]stateKey)
-	s := start.(stateKey)
-	e := end.(stateKey)
-	
-	path := []int64{e.nodeID}
-	current := e
-	
-	for current != s {
-		current = cf[current]
-		path = append([]int64{current.nodeID}, path...)
+	path = append(path, s.x.NodeID(start))
+	slices.Reverse(path)
+	return path
+}
+
+// edgeAllowed reports whether the profile of the search may use an edge.
+// Edges in hard avoid areas or forbidden by the custom model pass; edgeWeight
+// makes them +Inf, as it evaluates the areas and rules anyway for the weight.
+func (s *search) edgeAllowed(edge *graph.IndexedEdge) bool {
+	if !s.profile.IsAllowed(edge.Tags["highway"]) {
+		return false
 	}
-	
-	return &Route{
-		Nodes:    path,
-		Distance: distance,
-		Duration: distance / 13.89, // Assume average speed ~50 km/h (13.89 m/s)
+	if s.closed != nil && s.closed.IsClosed(&edge.Edge) {
+		return false
 	}
+	return true
 }
 
-func (r *Router) reconstructPath(cameFrom map[int64]int64, start, end int64, distance float64) *Route {
-	path := []int64{end}
-	current := end
-	
-	for current != start {
-		current = cameFrom[current]
-		path = append([]int64{current}, path...)
+// edgeWeight calculates the cost of traversing an edge with the profile of the
+// search, or +Inf if the edge lies in an area to avoid or the custom model forbids it
+func (s *search) edgeWeight(edge *graph.IndexedEdge) float64 {
+	var weight float64
+	if s.profile.IsEco() {
+		weight = s.ecoWeight(edge)
+	} else {
+		weight = s.profile.CalculateWeight(edge.Weight, edge.Tags["highway"], edge.Tags["surface"])
+
+		if s.profile.UsesElevation() && s.x.HasElevation() {
+			length, climb := s.edgeGeometry(edge)
+			weight = s.profile.ApplyElevation(weight, length, climb)
+		}
+
+		weight *= s.speedFactor(&edge.Edge)
 	}
-	
+
+	if s.profile.Avoid != nil {
+		blocked, factor := s.avoidEdge(edge)
+		if blocked {
+			return math.Inf(1)
+		}
+		weight *= factor
+	}
+
+	if s.profile.Custom != nil {
+		factor := s.customFactor(edge)
+		if math.IsInf(factor, 1) {
+			return math.Inf(1)
+		}
+		weight = weight*factor + s.distanceCost(edge)
+	}
+
+	return weight
+}
+
+// avoidEdge tests an edge against the avoid areas of the profile
+func (s *search) avoidEdge(edge *graph.IndexedEdge) (bool, float64) {
+	fromLat, fromLon := s.x.Coord(edge.Tail)
+	toLat, toLon := s.x.Coord(edge.Head)
+	return s.profile.Avoid.Check(fromLon, fromLat, toLon, toLat)
+}
+
+// ecoWeight expresses the estimated consumption of an edge in meters of the
+// vehicle's most economical driving. Energy recovered on descents can bring the
+// consumption below that, so the weight is floored at the straight-line length
+// of the edge to keep the distance heuristic a lower bound.
+func (s *search) ecoWeight(edge *graph.IndexedEdge) float64 {
+	vehicle := s.profile.Vehicle
+
+	length, climb := s.edgeGeometry(edge)
+	if !s.x.HasElevation() {
+		climb = 0
+	}
+
+	consumption := vehicle.SegmentConsumption(edge.Weight, s.edgeSpeed(&edge.Edge)*3.6, climb, s.x.HasTrafficSignal(edge.To))
+	weight := math.Max(consumption/vehicle.MinConsumptionPerMeter(), length)
+
+	if s.profile.ShouldAvoidSurface(edge.Tags["surface"]) {
+		weight *= 2.0
+	}
+
+	return weight
+}
+
+// edgeGeometry returns the length (m) and elevation change (m) of an edge
+func (s *search) edgeGeometry(edge *graph.IndexedEdge) (float64, float64) {
+	fromLat, fromLon := s.x.Coord(edge.Tail)
+	toLat, toLon := s.x.Coord(edge.Head)
+	return graph.HaversineDistance(fromLat, fromLon, toLat, toLon), s.x.ElevationChange(edge.Tail, edge.Head)
+}
+
+// edgeSpeed returns the expected travel speed (m/s) on an edge, capped by the profile.
+// Live traffic takes precedence over historical speeds, which take precedence over the base speed.
+func (s *search) edgeSpeed(edge *graph.Edge) float64 {
+	speed, ok := 0.0, false
+	if s.traffic != nil {
+		speed, ok = s.traffic.Speed(edge)
+	}
+	if !ok && s.r.history != nil {
+		speed, ok = s.r.history.SpeedAt(edge, s.departure())
+	}
+	if !ok {
+		return segmentSpeed(edge, s.profile.MaxSpeed)
+	}
+	if s.profile.MaxSpeed > 0 && speed > s.profile.MaxSpeed {
+		return s.profile.MaxSpeed
+	}
+	return speed
+}
+
+// speedFactor returns how much slower an edge is than its base speed due to live
+// traffic or historical speeds. It never drops below 1 so the distance heuristic stays a lower bound.
+func (s *search) speedFactor(edge *graph.Edge) float64 {
+	if s.r.traffic == nil && s.r.history == nil {
+		return 1.0
+	}
+	speed := s.edgeSpeed(edge)
+	base := segmentSpeed(edge, s.profile.MaxSpeed)
+	if speed <= 0 || speed >= base {
+		return 1.0
+	}
+	return base / speed
+}
+
+// departure returns the departure time of the search
+func (s *search) departure() time.Time {
+	if !s.profile.Departure.IsZero() {
+		return s.profile.Departure
+	}
+	return time.Now()
+}
+
+// newRoute returns the route of a path found with a weight. The distance is
+// measured along the path, as the weight may include consumption, penalties
+// and custom model factors.
+func (s *search) newRoute(nodes []int64, weight float64) *Route {
+	distance := s.pathLength(nodes)
 	return &Route{
-		Nodes:    path,
+		Nodes:    nodes,
 		Distance: distance,
-		Duration: distance / 13.89, // Assume average speed ~50 km/h (13.89 m/s)
+		Duration: distance / 13.89,
+		Weight:   weight,
+	}
+}
+
+// pathLength sums the lengths (m) of the segments of a path
+func (s *search) pathLength(nodes []int64) float64 {
+	total := 0.0
+	for i := 0; i < len(nodes)-1; i++ {
+		from, okFrom := s.x.Lookup(nodes[i])
+		to, okTo := s.x.Lookup(nodes[i+1])
+		if okFrom && okTo {
+			fromLat, fromLon := s.x.Coord(from)
+			toLat, toLon := s.x.Coord(to)
+			total += graph.HaversineDistance(fromLat, fromLon, toLat, toLon)
+		}
 	}
+	return total
+}
+
+// travelTime sums the expected time (s) to drive a path at the current edge speeds
+func (s *search) travelTime(nodes []int64) float64 {
+	total := 0.0
+	for i := 0; i < len(nodes)-1; i++ {
+		edge, exists := s.r.graph.EdgeBetween(nodes[i], nodes[i+1])
+		if !exists {
+			continue
+		}
+		length, _ := segmentGeometry(s.r.graph, &edge)
+		total += length / s.edgeSpeed(&edge)
+	}
+	return total
+}
+
+// withTravelTime replaces the average-speed duration of a route with the travel
+// time at historical speeds, when they are loaded
+func (s *search) withTravelTime(route *Route, err error) (*Route, error) {
+	if err == nil && s.r.history != nil {
+		route.Duration = s.travelTime(route.Nodes)
+	}
+	return route, err
 }
 
 func (r *Router) isSufficientlyDifferent(newRoute *Route, existingRoutes []*Route) bool {
@@ -338,43 +525,3 @@ func (r *Router) isSufficientlyDifferent(newRoute *Route, existingRoutes []*Rout
 	
 	return true
 }
-
-// Priority queue implementation for A*
-type item struct {
-	nodeID   int64
-	priority float64
-	gScore   float64
-	index    int
-}
-
-type priorityQueue []*item
-
-func (pq priorityQueue) Len() int { return len(pq) }
-
-func (pq priorityQueue) Less(i, j int) bool {
-	return pq[i].priority < pq[j].priority
-}
-
-func (pq priorityQueue) Swap(i, j int) {
-	pq[i], pq[j] = pq[j], pq[i]
-	pq[i].index = i
-	pq[j].index = j
-}
-
-func (pq *priorityQueue) Push(x interface{}) {
-	n := len(*pq)
-	item := x.(*item)
-	item.index = n
-	*pq = append(*pq, item)
-}
-
-func (pq *priorityQueue) Pop() interface{} {
-	old := *pq
-	n := len(old)
-	item := old[n-1]
-	old[n-1] = nil
-	item.index = -1
-	*pq = old[0 : n-1]
-	return item
-}
-
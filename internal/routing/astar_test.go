@@ -1,7 +1,13 @@
 package routing
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/vamosdalian/nav/internal/graph"
 )
@@ -13,7 +19,7 @@ func BenchmarkAStar(b *testing.B) {
 	
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = router.FindRoute(43.73, 7.42, 43.74, 7.43)
+		_, _ = router.FindRoute(context.Background(), 43.73, 7.42, 43.74, 7.43)
 	}
 }
 
@@ -35,7 +41,7 @@ func BenchmarkAStarWithProfile(b *testing.B) {
 		b.Run(p.name, func(b *testing.B) {
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				_, _ = router.FindRouteWithProfile(43.73, 7.42, 43.74, 7.43, p.profile)
+				_, _ = router.FindRouteWithProfile(context.Background(), 43.73, 7.42, 43.74, 7.43, p.profile)
 			}
 		})
 	}
@@ -52,12 +58,67 @@ func BenchmarkMultipleRoutes(b *testing.B) {
 		b.Run(string(rune('0'+alt))+"_routes", func(b *testing.B) {
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				_, _ = router.FindMultipleRoutes(43.73, 7.42, 43.74, 7.43, alt)
+				_, _ = router.FindMultipleRoutes(context.Background(), 43.73, 7.42, 43.74, 7.43, alt)
 			}
 		})
 	}
 }
 
+// BenchmarkGridRoutes routes corner to corner across generated grid graphs
+func BenchmarkGridRoutes(b *testing.B) {
+	for _, n := range []int{100, 300} {
+		router := NewRouter(createGridGraph(n))
+		toLat, toLon := 43.0+float64(n-1)*0.001, 7.0+float64(n-1)*0.001
+		searches := []struct {
+			name string
+			find func(ctx context.Context, fromLat, fromLon, toLat, toLon float64) (*Route, error)
+		}{
+			{"astar", router.FindRoute},
+			{"bidirectional", router.FindRouteBidirectional},
+		}
+		for _, search := range searches {
+			b.Run(fmt.Sprintf("%s/%dx%d", search.name, n, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := search.find(context.Background(), 43.0, 7.0, toLat, toLon); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// createGridGraph creates an n x n grid of two-way residential streets about
+// 100 m apart, with one way per row and column
+func createGridGraph(n int) *graph.Graph {
+	g := graph.NewGraph()
+	id := func(row, col int) int64 { return int64(row*n + col + 1) }
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			g.AddNode(&graph.Node{ID: id(row, col), Lat: 43.0 + float64(row)*0.001, Lon: 7.0 + float64(col)*0.001})
+		}
+	}
+
+	tags := map[string]string{"highway": "residential"}
+	addRoad := func(from, to, way int64, length float64) {
+		g.AddEdge(graph.Edge{From: from, To: to, Weight: length, OSMWayID: way, Tags: tags})
+		g.AddEdge(graph.Edge{From: to, To: from, Weight: length, OSMWayID: way, Tags: tags, Reverse: true})
+	}
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			if col+1 < n {
+				addRoad(id(row, col), id(row, col+1), int64(row+1), 81)
+			}
+			if row+1 < n {
+				addRoad(id(row, col), id(row+1, col), int64(n+col+1), 111)
+			}
+		}
+	}
+	g.Compact()
+	return g
+}
+
 // createTestGraph creates a simple test graph for benchmarking
 func createTestGraph() *graph.Graph {
 	g := graph.NewGraph()
@@ -98,3 +159,281 @@ func createTestGraph() *graph.Graph {
 	return g
 }
 
+
+// rushHour is a HistoricalSpeeds that slows one way down on weekday mornings
+type rushHour struct {
+	wayID int64
+	speed float64 // m/s
+}
+
+func (h rushHour) SpeedAt(edge *graph.Edge, t time.Time) (float64, bool) {
+	if edge.OSMWayID != h.wayID || t.Weekday() == time.Saturday || t.Weekday() == time.Sunday || t.Hour() < 7 || t.Hour() >= 10 {
+		return 0, false
+	}
+	return h.speed, true
+}
+
+func TestHistoricalSpeedsDependOnDeparture(t *testing.T) {
+	g := createDiamondGraph()
+	router := NewRouter(g)
+	router.SetHistoricalSpeeds(rushHour{wayID: 10, speed: 2.0})
+
+	profile := CarProfile
+	profile.Departure = time.Date(2024, 5, 5, 8, 0, 0, 0, time.UTC) // Sunday
+	route, err := router.FindRouteWithProfile(context.Background(), 43.0, 7.0, 43.0, 7.02, profile)
+	if err != nil {
+		t.Fatalf("Expected route, got error: %v", err)
+	}
+	if route.Nodes[1] != 2 {
+		t.Errorf("Expected route via node 2 on Sunday, got %v", route.Nodes)
+	}
+	freeFlow := route.Duration
+
+	profile.Departure = time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC) // Monday rush hour
+	route, err = router.FindRouteBidirectionalWithProfile(context.Background(), 43.0, 7.0, 43.0, 7.02, profile)
+	if err != nil {
+		t.Fatalf("Expected route, got error: %v", err)
+	}
+	if route.Nodes[1] != 3 {
+		t.Errorf("Expected route via node 3 in rush hour, got %v", route.Nodes)
+	}
+	if route.Duration <= freeFlow {
+		t.Errorf("Expected rush hour duration above %.1fs, got %.1fs", freeFlow, route.Duration)
+	}
+
+	// Duration follows the edge speeds (13.89 m/s without historical data)
+	length := 0.0
+	for i := 0; i < len(route.Nodes)-1; i++ {
+		edge, _ := g.EdgeBetween(route.Nodes[i], route.Nodes[i+1])
+		length += edge.Weight
+	}
+	if expected := length / 13.89; route.Duration < expected-0.1 || route.Duration > expected+0.1 {
+		t.Errorf("Expected duration %.1fs, got %.1fs", expected, route.Duration)
+	}
+}
+
+func TestTurnRestrictionsOnIndexedGraph(t *testing.T) {
+	g := createDiamondGraph()
+	g.AddRestriction(graph.TurnRestriction{FromWay: 10, ViaNode: 2, ToWay: 10, Type: graph.RestrictionNoStraightOn})
+	router := NewRouter(g)
+
+	route, err := router.FindRoute(context.Background(), 43.0, 7.0, 43.0, 7.02)
+	if err != nil {
+		t.Fatalf("Expected route, got error: %v", err)
+	}
+	if len(route.Nodes) != 3 || route.Nodes[1] != 3 {
+		t.Errorf("Expected route via node 3 around the restriction, got %v", route.Nodes)
+	}
+
+	// Routing compacts the graph; adding a road converts it back and the next search sees it
+	g.AddNode(&graph.Node{ID: 5, Lat: 43.0, Lon: 7.03})
+	g.AddEdge(graph.Edge{From: 4, To: 5, Weight: 800, OSMWayID: 30, Tags: map[string]string{"highway": "primary"}})
+	route, err = router.FindRoute(context.Background(), 43.0, 7.0, 43.0, 7.03)
+	if err != nil {
+		t.Fatalf("Expected route, got error: %v", err)
+	}
+	if want := []int64{1, 3, 4, 5}; !slices.Equal(route.Nodes, want) {
+		t.Errorf("Expected route %v, got %v", want, route.Nodes)
+	}
+}
+
+func TestSearchesDuringWeightChanges(t *testing.T) {
+	g := createDiamondGraph()
+	router := NewRouter(g)
+	viaTop := g.EdgesByWay(10)
+
+	// An index keeps the weights of its snapshot
+	x := g.Index()
+	if _, err := g.ApplyWeightChanges([]graph.WeightChange{{Edges: viaTop, Op: graph.WeightMultiply, Value: 10}}); err != nil {
+		t.Fatalf("ApplyWeightChanges: %v", err)
+	}
+	start, _ := x.Lookup(1)
+	if edges := x.OutEdges(nil, start); edges[0].Weight > 2000 {
+		t.Errorf("Index sees a later weight change: %v", edges[0].Weight)
+	}
+	if edge, _ := g.EdgeBetween(1, 2); edge.Weight < 2000 {
+		t.Errorf("Graph does not see the weight change: %v", edge.Weight)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				route, err := router.FindRouteBidirectional(context.Background(), 43.0, 7.0, 43.0, 7.02)
+				if err != nil || len(route.Nodes) != 3 {
+					t.Errorf("route = %v, %v", route, err)
+					return
+				}
+			}
+		}()
+	}
+	for j := 0; j < 200; j++ {
+		op := graph.WeightReset
+		if j%2 == 0 {
+			op = graph.WeightMultiply
+		}
+		if _, err := g.ApplyWeightChanges([]graph.WeightChange{{Edges: viaTop, Op: op, Value: 3}}); err != nil {
+			t.Fatalf("ApplyWeightChanges: %v", err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestConcurrentSearchesWithDifferentProfiles(t *testing.T) {
+	router := NewRouter(createDiamondGraph())
+	eco := CarProfile
+	eco.Weighting = WeightModeEco
+	eco.Vehicle = testVehicle()
+
+	// The shortest route passes the signal at node 2, the eco route avoids it
+	searches := []struct {
+		profile RoutingProfile
+		via     int64
+		find    func(ctx context.Context, fromLat, fromLon, toLat, toLon float64, profile RoutingProfile) (*Route, error)
+	}{
+		{CarProfile, 2, router.FindRouteWithProfile},
+		{eco, 3, router.FindRouteWithProfile},
+		{CarProfile, 2, router.FindRouteBidirectionalWithProfile},
+		{eco, 3, router.FindRouteBidirectionalWithProfile},
+	}
+
+	var wg sync.WaitGroup
+	for _, search := range searches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				route, err := search.find(context.Background(), 43.0, 7.0, 43.0, 7.02, search.profile)
+				if err != nil || route.Nodes[1] != search.via {
+					t.Errorf("Expected route via node %d, got %v, %v", search.via, route, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 50; j++ {
+			routes, err := router.FindMultipleRoutesWithProfile(context.Background(), 43.0, 7.0, 43.0, 7.02, 2, eco)
+			if err != nil || routes[0].Nodes[1] != 3 {
+				t.Errorf("Expected first alternative via node 3, got %v, %v", routes, err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestLabelsGenerations(t *testing.T) {
+	var l labels
+	l.reset(4)
+	l.set(1, 5, 0)
+	if !l.settle(1) || l.settle(1) {
+		t.Fatalf("Expected index 1 to settle once")
+	}
+
+	// A new search sees none of the previous labels
+	l.reset(4)
+	if _, ok := l.get(1); ok || l.isSettled(1) {
+		t.Errorf("Expected labels of the previous search to be unset")
+	}
+
+	// Wrapping the generation clears the stamps
+	l.gen = ^uint32(0)
+	l.set(3, 1, 0)
+	l.reset(4)
+	if _, ok := l.get(3); ok {
+		t.Errorf("Expected stamps to be cleared when the generation wraps")
+	}
+	if l.gen != 1 {
+		t.Errorf("gen = %d, want 1", l.gen)
+	}
+}
+
+func TestQueueDecreaseKey(t *testing.T) {
+	var q queue
+	q.reset(6)
+	for state, p := range []float64{5, 1, 4, 2, 3, 6} {
+		q.push(item{state: uint32(state), priority: p})
+	}
+	q.decrease(item{state: 5, priority: 0.5})
+	q.decrease(item{state: 2, priority: 1.5})
+
+	var got []uint32
+	for q.len() > 0 {
+		it := q.pop()
+		if q.items[it.state].index != -1 {
+			t.Errorf("Popped state %d still has heap index %d", it.state, q.items[it.state].index)
+		}
+		got = append(got, it.state)
+	}
+	if want := []uint32{5, 1, 2, 3, 4, 0}; !slices.Equal(got, want) {
+		t.Errorf("pop order = %v, want %v", got, want)
+	}
+}
+
+func TestSearchBudgets(t *testing.T) {
+	router := NewRouter(createDiamondGraph())
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	limited := CarProfile
+	limited.Limits = SearchLimits{MaxNodes: 1}
+
+	for name, find := range map[string]func(context.Context, float64, float64, float64, float64, RoutingProfile) (*Route, error){
+		"astar":         router.FindRouteWithProfile,
+		"bidirectional": router.FindRouteBidirectionalWithProfile,
+	} {
+		if _, err := find(context.Background(), 43.0, 7.0, 43.0, 7.02, limited); !errors.Is(err, ErrSearchAborted) {
+			t.Errorf("%s: expected ErrSearchAborted with a node budget of 1, got %v", name, err)
+		}
+		_, err := find(cancelled, 43.0, 7.0, 43.0, 7.02, CarProfile)
+		if !errors.Is(err, ErrSearchAborted) || !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected an aborted search on a cancelled context, got %v", name, err)
+		}
+		if _, err := find(context.Background(), 43.0, 7.0, 43.0, 7.02, CarProfile); err != nil {
+			t.Errorf("%s: expected route within the default budget, got %v", name, err)
+		}
+	}
+
+	if got := (SearchLimits{}).Cap(SearchLimits{MaxNodes: 500, TimeoutMs: 1000}); got != (SearchLimits{MaxNodes: 500, TimeoutMs: 1000}) {
+		t.Errorf("Cap of unset limits = %+v", got)
+	}
+	if got := (SearchLimits{MaxNodes: 100, TimeoutMs: 5000}).Cap(SearchLimits{MaxNodes: 500, TimeoutMs: 1000}); got != (SearchLimits{MaxNodes: 100, TimeoutMs: 1000}) {
+		t.Errorf("Cap = %+v", got)
+	}
+}
+
+func TestMaxSearches(t *testing.T) {
+	router := NewRouter(createDiamondGraph())
+	router.SetMaxSearches(1)
+
+	held, err := router.newSearch(context.Background(), CarProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The only workspace is taken, so the search waits out its time limit
+	limited := CarProfile
+	limited.Limits = SearchLimits{TimeoutMs: 20}
+	_, err = router.FindRouteWithProfile(context.Background(), 43.0, 7.0, 43.0, 7.02, limited)
+	if !errors.Is(err, ErrSearchAborted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected an aborted search while the workspace is taken, got %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := router.FindRouteWithProfile(context.Background(), 43.0, 7.0, 43.0, 7.02, CarProfile)
+		done <- err
+	}()
+	held.release()
+	if err := <-done; err != nil {
+		t.Errorf("expected route once the workspace is free, got %v", err)
+	}
+	if n := len(router.pool.idle); n != 1 {
+		t.Errorf("%d idle workspaces, want the one that was reused", n)
+	}
+}
@@ -0,0 +1,64 @@
+package routing
+
+import "github.com/vamosdalian/nav/internal/geo"
+
+// AvoidArea is an exclusion zone for a single request.
+// A Penalty of 0 forbids edges touching the area; values above 1 multiply their weight.
+type AvoidArea struct {
+	Polygon geo.Polygon
+	Penalty float64
+}
+
+// IsHard reports whether edges touching the area are forbidden
+func (a *AvoidArea) IsHard() bool {
+	return a.Penalty <= 0
+}
+
+// AvoidAreas is a set of exclusion zones with a spatial index over their bounds
+type AvoidAreas struct {
+	areas []AvoidArea
+	index *geo.Index
+}
+
+// NewAvoidAreas indexes a set of avoid areas (nil if there are none)
+func NewAvoidAreas(areas []AvoidArea) *AvoidAreas {
+	if len(areas) == 0 {
+		return nil
+	}
+
+	bounds := make([]geo.BBox, len(areas))
+	for i := range areas {
+		bounds[i] = areas[i].Polygon.Bounds()
+	}
+
+	return &AvoidAreas{areas: areas, index: geo.NewIndex(bounds)}
+}
+
+// Len returns the number of avoid areas
+func (a *AvoidAreas) Len() int {
+	return len(a.areas)
+}
+
+// Check tests a segment against the areas. It returns whether the segment is
+// blocked by a hard area, and otherwise the largest penalty factor (1 = none).
+func (a *AvoidAreas) Check(lon1, lat1, lon2, lat2 float64) (bool, float64) {
+	blocked := false
+	factor := 1.0
+
+	a.index.Search(geo.SegmentBBox(lon1, lat1, lon2, lat2), func(item int) bool {
+		area := &a.areas[item]
+		if !area.Polygon.IntersectsSegment(lon1, lat1, lon2, lat2) {
+			return true
+		}
+		if area.IsHard() {
+			blocked = true
+			return false
+		}
+		if area.Penalty > factor {
+			factor = area.Penalty
+		}
+		return true
+	})
+
+	return blocked, factor
+}
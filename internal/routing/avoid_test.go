@@ -0,0 +1,60 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/vamosdalian/nav/internal/geo"
+)
+
+func TestRouteAvoidsAreas(t *testing.T) {
+	g := createDiamondGraph()
+	router := NewRouter(g)
+
+	// Small box around node 2 on the shortest route
+	area := geo.PolygonFromBBox(geo.BBox{MinLon: 7.009, MinLat: 43.0005, MaxLon: 7.011, MaxLat: 43.0015})
+
+	tests := []struct {
+		name    string
+		penalty float64
+		via     int64
+	}{
+		{"hard", 0, 3},
+		{"large penalty", 5, 3},
+		{"small penalty", 1.01, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := CarProfile
+			profile.Avoid = NewAvoidAreas([]AvoidArea{{Polygon: area, Penalty: tt.penalty}})
+
+			for _, find := range []func(context.Context, float64, float64, float64, float64, RoutingProfile) (*Route, error){
+				router.FindRouteWithProfile,
+				router.FindRouteBidirectionalWithProfile,
+			} {
+				route, err := find(context.Background(), 43.0, 7.0, 43.0, 7.02, profile)
+				if err != nil {
+					t.Fatalf("Expected route, got error: %v", err)
+				}
+				if route.Nodes[1] != tt.via {
+					t.Errorf("Expected route via node %d, got %v", tt.via, route.Nodes)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteBlockedByHardArea(t *testing.T) {
+	router := NewRouter(createDiamondGraph())
+
+	profile := CarProfile
+	profile.Avoid = NewAvoidAreas([]AvoidArea{
+		{Polygon: geo.PolygonFromBBox(geo.BBox{MinLon: 7.015, MinLat: 42.9, MaxLon: 7.016, MaxLat: 43.1})},
+	})
+
+	if _, err := router.FindRouteWithProfile(context.Background(), 43.0, 7.0, 43.0, 7.02, profile); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("Expected ErrNoRoute when every road crosses a hard avoid area, got %v", err)
+	}
+}
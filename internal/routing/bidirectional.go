@@ -1,8 +1,9 @@
 package routing
 
 import (
-	"container/heap"
+	"context"
 	"fmt"
+	"math"
 
 	"github.com/vamosdalian/nav/internal/graph"
 )
@@ -10,262 +11,232 @@ import (
 // FindRouteBidirectional finds a route using bidirectional A* search
 // This searches from both start and end simultaneously, meeting in the middle
 // Typically 2-3x faster than unidirectional A* for long distances
-func (r *Router) FindRouteBidirectional(fromLat, fromLon, toLat, toLon float64) (*Route, error) {
-	return r.FindRouteBidirectionalWithProfile(fromLat, fromLon, toLat, toLon, r.profile)
+func (r *Router) FindRouteBidirectional(ctx context.Context, fromLat, fromLon, toLat, toLon float64) (*Route, error) {
+	return r.FindRouteBidirectionalWithProfile(ctx, fromLat, fromLon, toLat, toLon, r.profile)
 }
 
 // FindRouteBidirectionalWithProfile finds a route using bidirectional search with a specific profile
-func (r *Router) FindRouteBidirectionalWithProfile(fromLat, fromLon, toLat, toLon float64, profile RoutingProfile) (*Route, error) {
+func (r *Router) FindRouteBidirectionalWithProfile(ctx context.Context, fromLat, fromLon, toLat, toLon float64, profile RoutingProfile) (*Route, error) {
+	s, err := r.newSearch(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	defer s.release()
+	x := s.x
+
 	// Find nearest nodes to start and end coordinates
-	startNode, err := r.graph.FindNearestNode(fromLat, fromLon)
+	start, err := x.Nearest(fromLat, fromLon)
 	if err != nil {
 		return nil, fmt.Errorf("cannot find start node: %w", err)
 	}
 
-	endNode, err := r.graph.FindNearestNode(toLat, toLon)
+	end, err := x.Nearest(toLat, toLon)
 	if err != nil {
 		return nil, fmt.Errorf("cannot find end node: %w", err)
 	}
 
-	if startNode.ID == endNode.ID {
+	if start == end {
 		return &Route{
-			Nodes:    []int64{startNode.ID},
+			Nodes:    []int64{x.NodeID(start)},
 			Distance: 0,
 			Duration: 0,
 		}, nil
 	}
 
-	// Temporarily set profile
-	oldProfile := r.profile
-	r.profile = profile
-	defer func() { r.profile = oldProfile }()
-
-	return r.bidirectionalAStar(startNode.ID, endNode.ID)
+	return s.withTravelTime(s.bidirectionalAStar(start, end))
 }
 
-func (r *Router) bidirectionalAStar(start, end int64) (*Route, error) {
-	startNode, _ := r.graph.GetNode(start)
-	endNode, _ := r.graph.GetNode(end)
+func (s *search) bidirectionalAStar(start, end uint32) (*Route, error) {
+	x, ws := s.x, s.ws
+	startLat, startLon := x.Coord(start)
+	endLat, endLon := x.Coord(end)
 
 	// Simplified bidirectional search (without turn restrictions for performance)
-	// Forward search structures
-	forwardOpenSet := &priorityQueue{}
-	heap.Init(forwardOpenSet)
-	forwardCameFrom := make(map[int64]int64)
-	forwardGScore := make(map[int64]float64)
-	forwardClosed := make(map[int64]bool)
-
-	// Backward search structures
-	backwardOpenSet := &priorityQueue{}
-	heap.Init(backwardOpenSet)
-	backwardCameFrom := make(map[int64]int64)
-	backwardGScore := make(map[int64]float64)
-	backwardClosed := make(map[int64]bool)
+	forward, backward := &ws.forward, &ws.backward
+	forward.reset(x.NodeCount())
+	backward.reset(x.NodeCount())
+	ws.open.reset(x.NodeCount())
+	ws.backOpen.reset(x.NodeCount())
 
 	// Initialize
-	forwardGScore[start] = 0
-	backwardGScore[end] = 0
+	forward.set(start, 0, start)
+	backward.set(end, 0, end)
 
-	hStart := graph.HaversineDistance(startNode.Lat, startNode.Lon, endNode.Lat, endNode.Lon)
+	hStart := graph.HaversineDistance(startLat, startLon, endLat, endLon)
 
-	heap.Push(forwardOpenSet, &item{
-		nodeID:   start,
-		priority: hStart,
-		gScore:   0,
-	})
-
-	heap.Push(backwardOpenSet, &item{
-		nodeID:   end,
-		priority: hStart,
-		gScore:   0,
-	})
+	ws.open.push(item{node: start, state: start, priority: hStart})
+	ws.backOpen.push(item{node: end, state: end, priority: hStart})
 
 	// Track best meeting point
 	bestDistance := float64(1e9)
-	var meetingNode int64
+	var meetingNode uint32
+	met := false
 
-	maxIterations := 100000
 	iterations := 0
 
-	for forwardOpenSet.Len() > 0 && backwardOpenSet.Len() > 0 && iterations < maxIterations {
+	for ws.open.len() > 0 && ws.backOpen.len() > 0 {
 		iterations++
 
 		// Alternate between forward and backward search
 		if iterations%2 == 0 {
 			// Forward step
-			if forwardOpenSet.Len() > 0 {
-				current := heap.Pop(forwardOpenSet).(*item)
+			current := ws.open.pop()
+			forward.settle(current.node)
+			if err := s.explore(); err != nil {
+				return nil, err
+			}
 
-				if forwardClosed[current.nodeID] {
-					continue
-				}
-				forwardClosed[current.nodeID] = true
-
-				// Check if backward search has reached this node
-				if backDist, exists := backwardGScore[current.nodeID]; exists {
-					totalDist := forwardGScore[current.nodeID] + backDist
-					if totalDist < bestDistance {
-						bestDistance = totalDist
-						meetingNode = current.nodeID
-					}
+			// Check if backward search has reached this node
+			if backDist, exists := backward.get(current.node); exists {
+				totalDist := forward.score[current.node] + backDist
+				if totalDist < bestDistance {
+					bestDistance = totalDist
+					meetingNode = current.node
+					met = true
 				}
+			}
 
-				// Expand forward
-				edges := r.graph.GetEdges(current.nodeID)
-				for _, edge := range edges {
-					if forwardClosed[edge.To] {
-						continue
-					}
+			// Expand forward
+			ws.edges = x.OutEdges(ws.edges[:0], current.node)
+			for i := range ws.edges {
+				edge := &ws.edges[i]
+				if forward.isSettled(edge.Head) {
+					continue
+				}
 
-					// Check profile
-					highway := edge.Tags["highway"]
-					if !r.profile.IsAllowed(highway) {
-						continue
-					}
+				// Check profile
+				if !s.edgeAllowed(edge) {
+					continue
+				}
 
-					surface := edge.Tags["surface"]
-					weight := r.profile.CalculateWeight(edge.Weight, highway, surface)
+				weight := s.edgeWeight(edge)
+				if math.IsInf(weight, 1) {
+					continue
+				}
 
-					tentativeGScore := forwardGScore[current.nodeID] + weight
+				tentativeGScore := forward.score[current.node] + weight
 
-					if currentGScore, exists := forwardGScore[edge.To]; !exists || tentativeGScore < currentGScore {
-						forwardCameFrom[edge.To] = current.nodeID
-						forwardGScore[edge.To] = tentativeGScore
+				if currentGScore, exists := forward.get(edge.Head); !exists || tentativeGScore < currentGScore {
+					forward.set(edge.Head, tentativeGScore, current.node)
 
-						neighbor, _ := r.graph.GetNode(edge.To)
-						h := graph.HaversineDistance(neighbor.Lat, neighbor.Lon, endNode.Lat, endNode.Lon)
-						fScore := tentativeGScore + h
+					lat, lon := x.Coord(edge.Head)
+					h := graph.HaversineDistance(lat, lon, endLat, endLon)
+					fScore := tentativeGScore + h
 
-						heap.Push(forwardOpenSet, &item{
-							nodeID:   edge.To,
-							priority: fScore,
-							gScore:   tentativeGScore,
-						})
+					it := item{node: edge.Head, state: edge.Head, priority: fScore}
+					if exists {
+						ws.open.decrease(it)
+					} else {
+						ws.open.push(it)
 					}
 				}
 			}
 		} else {
 			// Backward step
-			if backwardOpenSet.Len() > 0 {
-				current := heap.Pop(backwardOpenSet).(*item)
+			current := ws.backOpen.pop()
+			backward.settle(current.node)
+			if err := s.explore(); err != nil {
+				return nil, err
+			}
 
-				if backwardClosed[current.nodeID] {
-					continue
-				}
-				backwardClosed[current.nodeID] = true
-
-				// Check if forward search has reached this node
-				if fwdDist, exists := forwardGScore[current.nodeID]; exists {
-					totalDist := fwdDist + backwardGScore[current.nodeID]
-					if totalDist < bestDistance {
-						bestDistance = totalDist
-						meetingNode = current.nodeID
-					}
+			// Check if forward search has reached this node
+			if fwdDist, exists := forward.get(current.node); exists {
+				totalDist := fwdDist + backward.score[current.node]
+				if totalDist < bestDistance {
+					bestDistance = totalDist
+					meetingNode = current.node
+					met = true
 				}
-
-				// Expand backward (find incoming edges)
-				r.expandBackward(current.nodeID, startNode, backwardOpenSet, backwardCameFrom, backwardGScore, backwardClosed)
 			}
+
+			// Expand backward (find incoming edges)
+			s.expandBackward(current.node, start)
 		}
 
 		// Early termination if we found a path and searches have progressed
-		if meetingNode != 0 && iterations > 50 {
+		if met && iterations > 50 {
 			break
 		}
 	}
 
-	if meetingNode == 0 {
-		return nil, fmt.Errorf("no route found from %d to %d", start, end)
+	if !met {
+		return nil, fmt.Errorf("%w from %d to %d", ErrNoRoute, x.NodeID(start), x.NodeID(end))
 	}
 
 	// Reconstruct path from both directions
-	return r.reconstructBidirectionalPath(
-		forwardCameFrom, backwardCameFrom,
-		start, end, meetingNode,
-		bestDistance,
-	), nil
+	return s.reconstructBidirectionalPath(start, end, meetingNode, bestDistance), nil
 }
 
-// expandBackward expands backward search using reverse adjacency list
-func (r *Router) expandBackward(nodeID int64, targetNode *graph.Node,
-	openSet *priorityQueue, cameFrom map[int64]int64,
-	gScore map[int64]float64, closed map[int64]bool) {
+// expandBackward expands backward search using the incoming edges of a node
+func (s *search) expandBackward(node, target uint32) {
+	x, ws := s.x, s.ws
+	backward := &ws.backward
 
-	// Get incoming edges using reverse adjacency list (much faster!)
-	reverseEdges := r.graph.GetReverseEdges(nodeID)
+	targetLat, targetLon := x.Coord(target)
+	ws.edges = x.InEdges(ws.edges[:0], node)
 
-	for _, edge := range reverseEdges {
-		fromNodeID := edge.From
+	for i := range ws.edges {
+		edge := &ws.edges[i]
+		fromNode := edge.Tail
 
-		if closed[fromNodeID] {
+		if backward.isSettled(fromNode) {
 			continue
 		}
 
 		// Check profile
-		highway := edge.Tags["highway"]
-		if !r.profile.IsAllowed(highway) {
+		if !s.edgeAllowed(edge) {
 			continue
 		}
 
-		surface := edge.Tags["surface"]
-		weight := r.profile.CalculateWeight(edge.Weight, highway, surface)
+		weight := s.edgeWeight(edge)
+		if math.IsInf(weight, 1) {
+			continue
+		}
 
-		tentativeGScore := gScore[nodeID] + weight
+		tentativeGScore := backward.score[node] + weight
 
-		if currentGScore, exists := gScore[fromNodeID]; !exists || tentativeGScore < currentGScore {
-			cameFrom[fromNodeID] = nodeID
-			gScore[fromNodeID] = tentativeGScore
+		if currentGScore, exists := backward.get(fromNode); !exists || tentativeGScore < currentGScore {
+			backward.set(fromNode, tentativeGScore, node)
 
-			neighbor, _ := r.graph.GetNode(fromNodeID)
-			h := graph.HaversineDistance(neighbor.Lat, neighbor.Lon, targetNode.Lat, targetNode.Lon)
+			lat, lon := x.Coord(fromNode)
+			h := graph.HaversineDistance(lat, lon, targetLat, targetLon)
 			fScore := tentativeGScore + h
 
-			heap.Push(openSet, &item{
-				nodeID:   fromNodeID,
-				priority: fScore,
-				gScore:   tentativeGScore,
-			})
+			it := item{node: fromNode, state: fromNode, priority: fScore}
+			if exists {
+				ws.backOpen.decrease(it)
+			} else {
+				ws.backOpen.push(it)
+			}
 		}
 	}
 }
 
-func (r *Router) reconstructBidirectionalPath(
-	forwardCameFrom, backwardCameFrom map[int64]int64,
-	start, end, meeting int64,
-	distance float64) *Route {
+func (s *search) reconstructBidirectionalPath(start, end, meeting uint32, distance float64) *Route {
+	x, forward, backward := s.x, &s.ws.forward, &s.ws.backward
 
 	// Build forward path: start -> meeting
-	forwardPath := []int64{meeting}
+	forwardPath := []int64{x.NodeID(meeting)}
 	curr := meeting
 	for curr != start {
-		curr = forwardCameFrom[curr]
-		forwardPath = append([]int64{curr}, forwardPath...)
+		curr = forward.parent[curr]
+		forwardPath = append([]int64{x.NodeID(curr)}, forwardPath...)
 	}
 
-	// Build backward path: meeting -> end
+	// Build backward path: meeting -> end (backward parents point towards the end)
 	backwardPath := []int64{}
 	curr = meeting
 	for curr != end {
-		next := int64(0)
-		for node, parent := range backwardCameFrom {
-			if parent == curr {
-				next = node
-				break
-			}
-		}
-		if next == 0 {
+		if _, exists := backward.get(curr); !exists {
 			break
 		}
-		backwardPath = append(backwardPath, next)
+		next := backward.parent[curr]
+		backwardPath = append(backwardPath, x.NodeID(next))
 		curr = next
 	}
 
 	// Combine paths
 	fullPath := append(forwardPath, backwardPath...)
 
-	return &Route{
-		Nodes:    fullPath,
-		Distance: distance,
-		Duration: distance / 13.89,
-	}
+	return s.newRoute(fullPath, distance)
 }
@@ -0,0 +1,209 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/vamosdalian/nav/internal/geo"
+	"github.com/vamosdalian/nav/internal/graph"
+	"github.com/vamosdalian/nav/internal/tagexpr"
+)
+
+// CustomModel adjusts the weighting of a profile for a single request. Rule
+// conditions are tag expressions over the edge tags (see package tagexpr);
+// `in_<name>` is true for edges crossing the area called name. Every rule
+// whose condition matches applies, in order.
+type CustomModel struct {
+	Speed             []CustomRule               `json:"speed,omitempty"`
+	Priority          []CustomRule               `json:"priority,omitempty"`
+	DistanceInfluence float64                    `json:"distance_influence,omitempty"` // Extra cost per km of edge length, in meters of weight
+	Areas             map[string]json.RawMessage `json:"areas,omitempty"`              // GeoJSON Polygon, MultiPolygon or Feature by name
+}
+
+// CustomRule changes the speed or priority of the edges matching If.
+// Factors are at most 1: a rule can make roads slower or less preferred than
+// the profile has them, never cheaper than their length. 0 forbids the edges.
+type CustomRule struct {
+	If         string   `json:"if"`
+	MultiplyBy *float64 `json:"multiply_by,omitempty"`
+	LimitTo    *float64 `json:"limit_to,omitempty"` // Speed cap in km/h (speed rules only)
+}
+
+// CompiledModel is a validated custom model with parsed conditions and areas
+type CompiledModel struct {
+	speed             []customRule
+	priority          []customRule
+	distanceInfluence float64
+	areas             map[string]*customArea // By condition key (in_<name>)
+}
+
+type customRule struct {
+	expr       *tagexpr.Expr
+	multiplyBy float64 // 1 if the rule has no factor
+	limitTo    float64 // km/h, 0 if the rule has no limit
+}
+
+type customArea struct {
+	polygons []geo.Polygon
+	bounds   geo.BBox
+}
+
+// Compile validates a custom model and prepares it for searches. Errors name
+// the offending field, e.g. `priority[1].if: unexpected "&&" at position 0`.
+func (m *CustomModel) Compile() (*CompiledModel, error) {
+	c := &CompiledModel{
+		distanceInfluence: m.DistanceInfluence,
+		areas:             make(map[string]*customArea, len(m.Areas)),
+	}
+	if m.DistanceInfluence < 0 {
+		return nil, fmt.Errorf("distance_influence must not be negative")
+	}
+
+	for name, geometry := range m.Areas {
+		if !validAreaName(name) {
+			return nil, fmt.Errorf("areas: name %q may only contain letters, digits and underscores", name)
+		}
+		polygons, err := geo.ParsePolygons(geometry)
+		if err != nil {
+			return nil, fmt.Errorf("areas.%s: %w", name, err)
+		}
+		area := &customArea{polygons: polygons, bounds: geo.EmptyBBox()}
+		for i := range polygons {
+			area.bounds = area.bounds.Union(polygons[i].Bounds())
+		}
+		c.areas["in_"+name] = area
+	}
+
+	var err error
+	if c.speed, err = c.compileRules("speed", m.Speed, true); err != nil {
+		return nil, err
+	}
+	if c.priority, err = c.compileRules("priority", m.Priority, false); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// validAreaName reports whether an area name can be used in an in_<name> condition
+func validAreaName(name string) bool {
+	for _, r := range name {
+		if r != '_' && (r < '0' || r > '9') && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// compileRules parses the conditions of speed or priority rules and checks their values
+func (c *CompiledModel) compileRules(field string, rules []CustomRule, isSpeed bool) ([]customRule, error) {
+	compiled := make([]customRule, 0, len(rules))
+	for i, rule := range rules {
+		if strings.TrimSpace(rule.If) == "" {
+			return nil, fmt.Errorf("%s[%d].if: condition is required", field, i)
+		}
+		expr, err := tagexpr.Parse(rule.If)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d].if: %w", field, i, err)
+		}
+		for _, key := range expr.Keys() {
+			if strings.HasPrefix(key, "in_") && c.areas[key] == nil {
+				return nil, fmt.Errorf("%s[%d].if: unknown area %q", field, i, strings.TrimPrefix(key, "in_"))
+			}
+		}
+
+		r := customRule{expr: expr, multiplyBy: 1}
+		switch {
+		case rule.MultiplyBy != nil && rule.LimitTo != nil:
+			return nil, fmt.Errorf("%s[%d]: use either multiply_by or limit_to", field, i)
+		case rule.MultiplyBy != nil:
+			if *rule.MultiplyBy < 0 || *rule.MultiplyBy > 1 {
+				return nil, fmt.Errorf("%s[%d].multiply_by must be between 0 and 1, got %v", field, i, *rule.MultiplyBy)
+			}
+			r.multiplyBy = *rule.MultiplyBy
+		case rule.LimitTo != nil:
+			if !isSpeed {
+				return nil, fmt.Errorf("%s[%d]: limit_to is only allowed in speed rules", field, i)
+			}
+			if *rule.LimitTo <= 0 {
+				return nil, fmt.Errorf("%s[%d].limit_to must be positive, got %v", field, i, *rule.LimitTo)
+			}
+			r.limitTo = *rule.LimitTo
+		default:
+			return nil, fmt.Errorf("%s[%d]: multiply_by or limit_to is required", field, i)
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled, nil
+}
+
+// customFactor returns how much the custom model of the profile multiplies
+// the weight of an edge, or +Inf if it forbids the edge
+func (s *search) customFactor(edge *graph.IndexedEdge) float64 {
+	c := s.profile.Custom
+	lookup := func(key string) (string, bool) {
+		if area, ok := c.areas[key]; ok {
+			if s.crossesArea(edge, area) {
+				return "yes", true
+			}
+			return "", false
+		}
+		value, ok := edge.Tags[key]
+		return value, ok
+	}
+
+	factor := 1.0
+	for i := range c.priority {
+		if c.priority[i].expr.Eval(lookup) {
+			factor *= c.priority[i].multiplyBy
+		}
+	}
+
+	if len(c.speed) > 0 {
+		base := s.edgeSpeed(&edge.Edge) * 3.6
+		speed := base
+		for i := range c.speed {
+			rule := &c.speed[i]
+			if !rule.expr.Eval(lookup) {
+				continue
+			}
+			speed *= rule.multiplyBy
+			if rule.limitTo > 0 {
+				speed = min(speed, rule.limitTo)
+			}
+		}
+		if base > 0 {
+			factor *= speed / base
+		}
+	}
+
+	if factor <= 0 {
+		return math.Inf(1)
+	}
+	return 1 / factor
+}
+
+// distanceCost returns the extra weight of an edge for the distance influence of the custom model
+func (s *search) distanceCost(edge *graph.IndexedEdge) float64 {
+	if s.profile.Custom.distanceInfluence == 0 {
+		return 0
+	}
+	length, _ := s.edgeGeometry(edge)
+	return length / 1000 * s.profile.Custom.distanceInfluence
+}
+
+// crossesArea reports whether an edge touches a custom model area
+func (s *search) crossesArea(edge *graph.IndexedEdge, area *customArea) bool {
+	fromLat, fromLon := s.x.Coord(edge.Tail)
+	toLat, toLon := s.x.Coord(edge.Head)
+	if !area.bounds.Intersects(geo.SegmentBBox(fromLon, fromLat, toLon, toLat)) {
+		return false
+	}
+	for i := range area.polygons {
+		if area.polygons[i].IntersectsSegment(fromLon, fromLat, toLon, toLat) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// topArea covers node 2 of the diamond graph
+const topArea = `{"type": "Polygon", "coordinates": [[[7.009, 43.0005], [7.011, 43.0005], [7.011, 43.0015], [7.009, 43.0015], [7.009, 43.0005]]]}`
+
+func parseCustomModel(t *testing.T, source string) *CompiledModel {
+	t.Helper()
+	var model CustomModel
+	if err := json.Unmarshal([]byte(source), &model); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	compiled, err := model.Compile()
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	return compiled
+}
+
+func TestCustomModelChangesRoute(t *testing.T) {
+	router := NewRouter(createDiamondGraph())
+
+	tests := []struct {
+		name  string
+		model string
+		via   int64
+	}{
+		{"none", `{}`, 2},
+		{"priority zero in area", `{"areas": {"top": ` + topArea + `}, "priority": [{"if": "in_top", "multiply_by": 0}]}`, 3},
+		{"slower in area", `{"areas": {"top": ` + topArea + `}, "speed": [{"if": "highway==primary && in_top", "multiply_by": 0.5}]}`, 3},
+		{"speed limit", `{"areas": {"top": ` + topArea + `}, "speed": [{"if": "in_top", "limit_to": 20}]}`, 3},
+		{"rule not matching", `{"priority": [{"if": "highway==residential", "multiply_by": 0}]}`, 2},
+	}
+	for _, tt := range tests {
+		profile := CarProfile
+		profile.Custom = parseCustomModel(t, tt.model)
+		route, err := router.FindRouteWithProfile(context.Background(), 43.0, 7.0, 43.0, 7.02, profile)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if route.Nodes[1] != tt.via {
+			t.Errorf("%s: route %v, want one via node %d", tt.name, route.Nodes, tt.via)
+		}
+	}
+}
+
+func TestCustomModelDistanceInfluence(t *testing.T) {
+	router := NewRouter(createDiamondGraph())
+	plain, err := router.FindRouteWithProfile(context.Background(), 43.0, 7.0, 43.0, 7.02, CarProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := CarProfile
+	profile.Custom = parseCustomModel(t, `{"distance_influence": 100}`)
+	route, err := router.FindRouteWithProfile(context.Background(), 43.0, 7.0, 43.0, 7.02, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// About 1.6 km of road at 100 per km
+	if extra := route.Weight - plain.Weight; extra < 150 || extra > 180 {
+		t.Errorf("distance influence added %v, want about 160", extra)
+	}
+	// The distance stays the length of the road
+	if route.Distance != plain.Distance {
+		t.Errorf("distance = %v, want %v", route.Distance, plain.Distance)
+	}
+}
+
+func TestCustomModelValidation(t *testing.T) {
+	tests := []struct {
+		model string
+		err   string
+	}{
+		{`{"priority": [{"if": "highway==primary &&", "multiply_by": 0.5}]}`, "priority[0].if: unexpected end of expression"},
+		{`{"speed": [{"if": "", "multiply_by": 0.5}]}`, "speed[0].if: condition is required"},
+		{`{"speed": [{"if": "surface=gravel", "multiply_by": 1.5}]}`, "speed[0].multiply_by must be between 0 and 1"},
+		{`{"speed": [{"if": "surface=gravel"}]}`, "speed[0]: multiply_by or limit_to is required"},
+		{`{"priority": [{"if": "surface=gravel", "limit_to": 30}]}`, "priority[0]: limit_to is only allowed in speed rules"},
+		{`{"priority": [{"if": "in_city", "multiply_by": 0}]}`, `priority[0].if: unknown area "city"`},
+		{`{"areas": {"bad name": ` + topArea + `}}`, `areas: name "bad name"`},
+		{`{"areas": {"top": {"type": "Point", "coordinates": [7, 43]}}}`, "areas.top:"},
+		{`{"distance_influence": -1}`, "distance_influence must not be negative"},
+	}
+	for _, tt := range tests {
+		var model CustomModel
+		if err := json.Unmarshal([]byte(tt.model), &model); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", tt.model, err)
+		}
+		_, err := model.Compile()
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Compile(%s) = %v, want %q", tt.model, err, tt.err)
+		}
+	}
+}
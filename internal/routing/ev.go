@@ -0,0 +1,286 @@
+package routing
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/vamosdalian/nav/internal/ev"
+)
+
+// ChargingStop describes a charging stop inserted into an EV route
+type ChargingStop struct {
+	Station      ev.Station `json:"station"`
+	ArrivalSoC   float64    `json:"arrival_soc"`
+	DepartureSoC float64    `json:"departure_soc"`
+	ChargeTime   float64    `json:"charge_time"` // Seconds
+}
+
+// EVRoute is a route for an electric vehicle including charging stops
+type EVRoute struct {
+	Route
+	Stops      []ChargingStop
+	SoC        []float64 // State of charge at each route node
+	EnergyUsed float64   // kWh consumed (net of regeneration)
+	ChargeTime float64   // Total charging time in seconds
+}
+
+// evLabel is a path found by a single-leg EV search. A node keeps every
+// path that no other path to it beats in both weight and energy, so a longer
+// path that uses less energy is not lost.
+type evLabel struct {
+	weight float64 // Profile cost from the leg start
+	energy float64 // kWh used from the leg start
+	time   float64 // Driving time (s) from the leg start
+	node   uint32  // Node index
+	prev   int32   // Previous label, -1 for the leg start
+}
+
+// evLeg holds the labels of a leg search. It outlives the search of its leg.
+type evLeg struct {
+	labels []evLabel
+	byNode map[uint32][]int32 // Settled labels per node, by rising weight and falling energy
+}
+
+// evQueue orders the labels of a leg search by weight
+type evQueue struct {
+	leg *evLeg
+	ids []int32
+}
+
+func (q *evQueue) Len() int { return len(q.ids) }
+func (q *evQueue) Less(i, j int) bool {
+	return q.leg.labels[q.ids[i]].weight < q.leg.labels[q.ids[j]].weight
+}
+func (q *evQueue) Swap(i, j int) { q.ids[i], q.ids[j] = q.ids[j], q.ids[i] }
+func (q *evQueue) Push(x any)    { q.ids = append(q.ids, x.(int32)) }
+func (q *evQueue) Pop() any {
+	id := q.ids[len(q.ids)-1]
+	q.ids = q.ids[:len(q.ids)-1]
+	return id
+}
+
+// evHub is a point where a leg can start or end: origin, charging station or destination
+type evHub struct {
+	node    uint32 // Node index
+	station *ev.Station
+
+	// Best known arrival
+	time      float64
+	soc       float64
+	prev      int     // Previous hub index (-1 for the origin)
+	label     int32   // Label of the leg from the previous hub that ends here
+	departSoC float64 // SoC when leaving the previous hub
+	charge    float64 // Charging time at the previous hub
+	settled   bool
+}
+
+// FindEVRoute finds the fastest route for an electric vehicle, inserting
+// charging stops when the battery would otherwise drop below its reserve.
+// Stations must have been snapped to the graph (see ev.Snap). The node budget
+// of the profile covers the searches of all legs.
+func (r *Router) FindEVRoute(ctx context.Context, fromLat, fromLon, toLat, toLon float64, profile RoutingProfile, vehicle *ev.Vehicle, stations []ev.Station) (*EVRoute, error) {
+	s, err := r.newSearch(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	defer s.release()
+	x := s.x
+	startNode, err := x.Nearest(fromLat, fromLon)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find start node: %w", err)
+	}
+
+	endNode, err := x.Nearest(toLat, toLon)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find end node: %w", err)
+	}
+
+	// Hubs: origin, compatible stations, destination
+	hubs := []*evHub{{node: startNode, prev: -1}}
+	for i := range stations {
+		node, ok := x.Lookup(stations[i].NodeID)
+		if ok && vehicle.Compatible(&stations[i]) {
+			hubs = append(hubs, &evHub{node: node, station: &stations[i]})
+		}
+	}
+	hubs = append(hubs, &evHub{node: endNode})
+	target := len(hubs) - 1
+
+	for _, hub := range hubs[1:] {
+		hub.time = math.Inf(1)
+	}
+	hubs[0].soc = vehicle.InitialSoC
+
+	// Dijkstra over hubs; each settled hub runs an energy-bounded search on the road graph
+	legs := make(map[int]*evLeg)
+	for {
+		current := -1
+		for i, hub := range hubs {
+			if !hub.settled && !math.IsInf(hub.time, 1) && (current < 0 || hub.time < hubs[current].time) {
+				current = i
+			}
+		}
+		if current < 0 {
+			return nil, fmt.Errorf("%w within battery range (consider lowering min_soc or adding charging stations)", ErrNoRoute)
+		}
+
+		hub := hubs[current]
+		hub.settled = true
+		if current == target {
+			break
+		}
+
+		// The origin departs with its initial charge; stations may charge up to the maximum
+		maxDepart := hub.soc
+		if hub.station != nil {
+			maxDepart = math.Max(hub.soc, vehicle.MaxChargeSoC)
+		}
+		budget := vehicle.UsableEnergy(maxDepart, vehicle.MinSoC)
+		if budget <= 0 {
+			continue
+		}
+
+		leg, err := s.evSearch(hub.node, budget, vehicle)
+		if err != nil {
+			return nil, err
+		}
+		legs[current] = leg
+
+		for _, candidate := range hubs {
+			if candidate.settled {
+				continue
+			}
+			for _, id := range leg.byNode[candidate.node] {
+				label := &leg.labels[id]
+				needed := math.Max(vehicle.MinSoC+label.energy/vehicle.BatteryCapacityKWh, vehicle.MinSoC)
+				departSoC := hub.soc
+				chargeTime := 0.0
+				if needed > hub.soc {
+					if hub.station == nil {
+						continue // Cannot charge at the origin
+					}
+					departSoC = needed
+					chargeTime = vehicle.ChargeTime(hub.soc, needed, hub.station.PowerKW)
+				}
+
+				arrival := hub.time + chargeTime + label.time
+				if arrival < candidate.time {
+					candidate.time = arrival
+					candidate.soc = math.Min(departSoC-label.energy/vehicle.BatteryCapacityKWh, 1)
+					candidate.prev = current
+					candidate.label = id
+					candidate.departSoC = departSoC
+					candidate.charge = chargeTime
+				}
+			}
+		}
+	}
+
+	return s.buildEVRoute(hubs, legs, target, vehicle), nil
+}
+
+// evSearch runs a multi-criteria Dijkstra search from a node over weight and
+// energy. Paths that would use more than the energy budget (kWh) are dropped.
+// Labels are settled by rising weight, so a label is dominated exactly when a
+// label settled at its node before uses no more energy.
+func (s *search) evSearch(source uint32, budget float64, vehicle *ev.Vehicle) (*evLeg, error) {
+	x, ws := s.x, s.ws
+	leg := &evLeg{labels: []evLabel{{node: source, prev: -1}}, byNode: make(map[uint32][]int32)}
+	dominated := func(node uint32, energy float64) bool {
+		settled := leg.byNode[node]
+		return len(settled) > 0 && leg.labels[settled[len(settled)-1]].energy <= energy
+	}
+	open := &evQueue{leg: leg, ids: []int32{0}}
+
+	for open.Len() > 0 {
+		id := heap.Pop(open).(int32)
+		label := leg.labels[id]
+		if dominated(label.node, label.energy) {
+			continue
+		}
+		leg.byNode[label.node] = append(leg.byNode[label.node], id)
+		if err := s.explore(); err != nil {
+			return nil, err
+		}
+
+		ws.edges = x.OutEdges(ws.edges[:0], label.node)
+		for i := range ws.edges {
+			edge := &ws.edges[i]
+			if !s.edgeAllowed(edge) {
+				continue
+			}
+
+			cost := s.edgeWeight(edge)
+			if math.IsInf(cost, 1) {
+				continue
+			}
+			length, climb := s.edgeGeometry(edge)
+			speed := s.edgeSpeed(&edge.Edge)
+			energy := label.energy + vehicle.EdgeEnergy(length, speed, climb)
+			if energy > budget || dominated(edge.Head, energy) {
+				continue // Battery exhausted or a better path is known
+			}
+
+			leg.labels = append(leg.labels, evLabel{
+				weight: label.weight + cost,
+				energy: energy,
+				time:   label.time + length/speed,
+				node:   edge.Head,
+				prev:   id,
+			})
+			heap.Push(open, int32(len(leg.labels)-1))
+		}
+	}
+
+	return leg, nil
+}
+
+// buildEVRoute reconstructs the node path, charging stops and SoC profile
+func (s *search) buildEVRoute(hubs []*evHub, legs map[int]*evLeg, target int, vehicle *ev.Vehicle) *EVRoute {
+	x := s.x
+
+	// Collect hub chain from origin to destination
+	chain := []int{target}
+	for i := target; hubs[i].prev >= 0; i = hubs[i].prev {
+		chain = append([]int{hubs[i].prev}, chain...)
+	}
+
+	result := &EVRoute{}
+	result.Nodes = []int64{x.NodeID(hubs[0].node)}
+	result.SoC = []float64{hubs[0].soc}
+
+	for i := 0; i < len(chain)-1; i++ {
+		from, to := hubs[chain[i]], hubs[chain[i+1]]
+		labels := legs[chain[i]].labels
+
+		// Walk the leg backwards from its end
+		leg := []int32{}
+		for id := to.label; labels[id].prev >= 0; id = labels[id].prev {
+			leg = append([]int32{id}, leg...)
+		}
+
+		for _, id := range leg {
+			label := &labels[id]
+			result.Nodes = append(result.Nodes, x.NodeID(label.node))
+			result.SoC = append(result.SoC, to.departSoC-label.energy/vehicle.BatteryCapacityKWh)
+		}
+		result.EnergyUsed += labels[to.label].energy
+
+		if from.station != nil {
+			result.Stops = append(result.Stops, ChargingStop{
+				Station:      *from.station,
+				ArrivalSoC:   from.soc,
+				DepartureSoC: to.departSoC,
+				ChargeTime:   to.charge,
+			})
+			result.ChargeTime += to.charge
+		}
+	}
+
+	result.Distance = s.pathLength(result.Nodes)
+	result.Duration = hubs[target].time
+
+	return result
+}
@@ -0,0 +1,117 @@
+package routing
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/vamosdalian/nav/internal/ev"
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// createLineGraph creates a straight two-way road of n nodes spaced ~8 km apart
+func createLineGraph(n int) *graph.Graph {
+	g := graph.NewGraph()
+	for i := 1; i <= n; i++ {
+		g.AddNode(&graph.Node{ID: int64(i), Lat: 43.0, Lon: 7.0 + float64(i-1)*0.1})
+	}
+	for i := 1; i < n; i++ {
+		from, _ := g.GetNode(int64(i))
+		to, _ := g.GetNode(int64(i + 1))
+		distance := graph.HaversineDistance(from.Lat, from.Lon, to.Lat, to.Lon)
+		tags := map[string]string{"highway": "primary"}
+		g.AddEdge(graph.Edge{From: int64(i), To: int64(i + 1), Weight: distance, OSMWayID: int64(100 + i), MaxSpeed: 22.22, Tags: tags})
+		g.AddEdge(graph.Edge{From: int64(i + 1), To: int64(i), Weight: distance, OSMWayID: int64(100 + i), MaxSpeed: 22.22, Tags: tags})
+	}
+	return g
+}
+
+func TestFindEVRouteInsertsChargingStop(t *testing.T) {
+	g := createLineGraph(11)
+	router := NewRouter(g)
+
+	vehicle := &ev.Vehicle{BatteryCapacityKWh: 10, InitialSoC: 0.8, MinSoC: 0.1, Connectors: []string{"ccs"}}
+	if err := vehicle.Normalize(); err != nil {
+		t.Fatalf("Invalid vehicle: %v", err)
+	}
+
+	stations := ev.Snap(g, []ev.Station{
+		{ID: "incompatible", Lat: 43.0, Lon: 7.3, PowerKW: 150, Connectors: []string{"chademo"}},
+		{ID: "midway", Lat: 43.0, Lon: 7.4, PowerKW: 50, Connectors: []string{"ccs"}},
+	})
+
+	route, err := router.FindEVRoute(context.Background(), 43.0, 7.0, 43.0, 8.0, CarProfile, vehicle, stations)
+	if err != nil {
+		t.Fatalf("Expected EV route, got error: %v", err)
+	}
+
+	if len(route.Stops) != 1 || route.Stops[0].Station.ID != "midway" {
+		t.Fatalf("Expected a single stop at 'midway', got %+v", route.Stops)
+	}
+	if route.Stops[0].ChargeTime <= 0 || route.Stops[0].DepartureSoC <= route.Stops[0].ArrivalSoC {
+		t.Errorf("Expected charging at stop, got %+v", route.Stops[0])
+	}
+	if len(route.SoC) != len(route.Nodes) {
+		t.Fatalf("Expected SoC for each of %d nodes, got %d", len(route.Nodes), len(route.SoC))
+	}
+	for i, soc := range route.SoC {
+		if soc < vehicle.MinSoC-1e-9 {
+			t.Errorf("SoC at node %d dropped below reserve: %.3f", i, soc)
+		}
+	}
+	if route.Nodes[len(route.Nodes)-1] != 11 {
+		t.Errorf("Expected route to end at node 11, got %d", route.Nodes[len(route.Nodes)-1])
+	}
+}
+
+func TestFindEVRouteOutOfRange(t *testing.T) {
+	g := createLineGraph(11)
+	router := NewRouter(g)
+
+	vehicle := &ev.Vehicle{BatteryCapacityKWh: 10, InitialSoC: 0.5, MinSoC: 0.1}
+	if err := vehicle.Normalize(); err != nil {
+		t.Fatalf("Invalid vehicle: %v", err)
+	}
+
+	if _, err := router.FindEVRoute(context.Background(), 43.0, 7.0, 43.0, 8.0, CarProfile, vehicle, nil); err == nil {
+		t.Error("Expected error when destination is out of range without stations")
+	}
+}
+
+func TestFindEVRouteTakesLongerPathWithinRange(t *testing.T) {
+	// From 1 to 3 the short road dips through a valley at node 2, the longer
+	// road over node 4 stays level. Only the level road fits the battery.
+	g := graph.NewGraph()
+	g.AddNode(&graph.Node{ID: 1, Lat: 43.0, Lon: 7.0})
+	g.AddNode(&graph.Node{ID: 2, Lat: 43.0, Lon: 7.01})
+	g.AddNode(&graph.Node{ID: 3, Lat: 43.0, Lon: 7.02})
+	g.AddNode(&graph.Node{ID: 4, Lat: 43.005, Lon: 7.01})
+	for _, id := range []int64{1, 3, 4} {
+		g.SetElevation(id, 300)
+	}
+	g.SetElevation(2, 0)
+	tags := map[string]string{"highway": "primary"}
+	for i, pair := range [][2]int64{{1, 2}, {2, 3}, {1, 4}, {4, 3}} {
+		from, _ := g.GetNode(pair[0])
+		to, _ := g.GetNode(pair[1])
+		distance := graph.HaversineDistance(from.Lat, from.Lon, to.Lat, to.Lon)
+		g.AddEdge(graph.Edge{From: pair[0], To: pair[1], Weight: distance, OSMWayID: int64(100 + i), MaxSpeed: 22.22, Tags: tags})
+	}
+	router := NewRouter(g)
+
+	vehicle := &ev.Vehicle{BatteryCapacityKWh: 10, InitialSoC: 0.15, MinSoC: 0.1}
+	if err := vehicle.Normalize(); err != nil {
+		t.Fatalf("Invalid vehicle: %v", err)
+	}
+
+	route, err := router.FindEVRoute(context.Background(), 43.0, 7.0, 43.0, 7.02, CarProfile, vehicle, nil)
+	if err != nil {
+		t.Fatalf("Expected EV route over the level road, got error: %v", err)
+	}
+	if want := []int64{1, 4, 3}; !slices.Equal(route.Nodes, want) {
+		t.Errorf("Expected nodes %v, got %v", want, route.Nodes)
+	}
+	if route.EnergyUsed > vehicle.UsableEnergy(vehicle.InitialSoC, vehicle.MinSoC) {
+		t.Errorf("Route uses %.3f kWh, more than the battery allows", route.EnergyUsed)
+	}
+}
@@ -0,0 +1,317 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// ErrNotCustomized is returned by MLD queries when the overlay has not been
+// customized for the profile and the current graph snapshot yet
+var ErrNotCustomized = errors.New("overlay not customized for the current graph")
+
+// MLD answers route queries on a customized multi-level overlay (multi-level
+// Dijkstra). Customization runs in the background after Refresh and whenever
+// a query finds that the graph snapshot changed. Until it has finished,
+// FindRoute returns ErrNotCustomized and callers fall back to the regular searches.
+type MLD struct {
+	router  *Router
+	overlay *Overlay
+
+	generation atomic.Uint64                      // Incremented by Refresh; older metrics are stale
+	metrics    atomic.Pointer[map[string]*Metric] // Customized profiles by name
+
+	mutex    sync.Mutex // Guards the fields below
+	profiles map[string]RoutingProfile
+	running  bool // A customization goroutine is running
+	pending  bool // Customize again when the running customization ends
+	status   MLDStatus
+}
+
+// MLDStatus describes the overlay and its last customization
+type MLDStatus struct {
+	CellSizes       []int      `json:"cell_sizes"`
+	Cells           []int      `json:"cells"`          // Cells per level
+	BoundaryNodes   []int      `json:"boundary_nodes"` // Boundary nodes per level
+	Profiles        []string   `json:"profiles"`       // Profiles with a usable customization
+	Customizing     bool       `json:"customizing"`
+	CustomizedAt    *time.Time `json:"customized_at,omitempty"`
+	CustomizeTimeMs int64      `json:"customize_time_ms"` // Duration of the last customization
+	LastError       string     `json:"last_error,omitempty"`
+}
+
+// NewMLD builds the overlay of the router's graph. Cell sizes give the most
+// nodes per cell on each level, smallest first. No profile is customized
+// until SetProfiles is called.
+func NewMLD(r *Router, cellSizes []int) (*MLD, error) {
+	o, err := NewOverlay(r.graph.Index(), cellSizes)
+	if err != nil {
+		return nil, err
+	}
+	m := &MLD{router: r, overlay: o}
+	m.metrics.Store(&map[string]*Metric{})
+	m.status.CellSizes = slices.Clone(cellSizes)
+	for k := range o.Levels() {
+		m.status.Cells = append(m.status.Cells, o.CellCount(k))
+		m.status.BoundaryNodes = append(m.status.BoundaryNodes, o.BoundaryCount(k))
+	}
+	return m, nil
+}
+
+// SetProfiles sets the profiles to customize, by name, and customizes them in the background
+func (m *MLD) SetProfiles(profiles map[string]RoutingProfile) {
+	m.mutex.Lock()
+	m.profiles = maps.Clone(profiles)
+	m.mutex.Unlock()
+	m.Refresh()
+}
+
+// Refresh discards the current customization and customizes all profiles
+// again in the background, e.g. after closures changed, so that no query uses
+// weights routes must not miss. Refreshes during a running customization are
+// coalesced into one more run.
+func (m *MLD) Refresh() {
+	m.generation.Add(1)
+	m.schedule()
+}
+
+// Update customizes all profiles again in the background like Refresh, but
+// queries keep using the current customization until the new one replaces
+// it. It suits changes that only make routes less accurate for a moment, such
+// as live traffic speeds, which would otherwise keep the overlay unused.
+func (m *MLD) Update() {
+	m.schedule()
+}
+
+// schedule starts a background customization unless one is running, in which
+// case another one follows it
+func (m *MLD) schedule() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.running {
+		m.pending = true
+		return
+	}
+	m.running = true
+	m.status.Customizing = true
+	go func() {
+		for {
+			if err := m.Customize(); err != nil {
+				log.Printf("Overlay customization failed: %v", err)
+			}
+			m.mutex.Lock()
+			if !m.pending {
+				m.running = false
+				m.status.Customizing = false
+				m.mutex.Unlock()
+				return
+			}
+			m.pending = false
+			m.mutex.Unlock()
+		}
+	}()
+}
+
+// Customize computes the metrics of all profiles on the current graph
+// snapshot and publishes them
+func (m *MLD) Customize() error {
+	m.mutex.Lock()
+	profiles := m.profiles
+	m.mutex.Unlock()
+
+	generation := m.generation.Load()
+	start := time.Now()
+	metrics := make(map[string]*Metric, len(profiles))
+	var err error
+	for name, profile := range profiles {
+		s, searchErr := m.router.newSearch(context.Background(), profile)
+		if searchErr != nil {
+			err = fmt.Errorf("profile %s: %w", name, searchErr)
+			break
+		}
+		metric, customizeErr := m.overlay.customize(s)
+		s.release()
+		if customizeErr != nil {
+			err = fmt.Errorf("profile %s: %w", name, customizeErr)
+			break
+		}
+		metric.generation = generation
+		metrics[name] = metric
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err != nil {
+		m.status.LastError = err.Error()
+		return err
+	}
+	m.metrics.Store(&metrics)
+	now := time.Now().UTC()
+	m.status.CustomizedAt = &now
+	m.status.CustomizeTimeMs = time.Since(start).Milliseconds()
+	m.status.LastError = ""
+	return nil
+}
+
+// Status returns the state of the overlay
+func (m *MLD) Status() MLDStatus {
+	m.mutex.Lock()
+	status := m.status
+	m.mutex.Unlock()
+
+	x := m.router.graph.Index()
+	status.Profiles = []string{}
+	for name, metric := range *m.metrics.Load() {
+		if m.valid(metric, x) {
+			status.Profiles = append(status.Profiles, name)
+		}
+	}
+	slices.Sort(status.Profiles)
+	return status
+}
+
+// valid reports whether a metric is up to date for a graph snapshot
+func (m *MLD) valid(metric *Metric, x *graph.Index) bool {
+	return metric != nil && metric.generation == m.generation.Load() && metric.x.SameSnapshot(x)
+}
+
+// FindRoute finds a route on the overlay customized for the profile of the
+// same name. The profile must not differ from the customized one except in
+// its search limits. Until a customization for the current graph snapshot is
+// available, FindRoute returns ErrNotCustomized.
+func (m *MLD) FindRoute(ctx context.Context, fromLat, fromLon, toLat, toLon float64, profile RoutingProfile) (*Route, error) {
+	s, err := m.router.newSearch(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	defer s.release()
+
+	metric := (*m.metrics.Load())[profile.Name]
+	if !m.valid(metric, s.x) {
+		if metric == nil || metric.generation != m.generation.Load() {
+			return nil, ErrNotCustomized
+		}
+
+		// Weights changed: customize again unless that is already under way
+		m.mutex.Lock()
+		running := m.running
+		m.mutex.Unlock()
+		if !running {
+			m.schedule()
+		}
+		return nil, ErrNotCustomized
+	}
+
+	start, err := s.x.Nearest(fromLat, fromLon)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find start node: %w", err)
+	}
+	end, err := s.x.Nearest(toLat, toLon)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find end node: %w", err)
+	}
+	if start == end {
+		return &Route{Nodes: []int64{s.x.NodeID(start)}}, nil
+	}
+	return s.withTravelTime(s.overlayRoute(metric, start, end))
+}
+
+// overlayRoute runs a bidirectional Dijkstra on the overlay. Near the start
+// and end it relaxes road edges; elsewhere it crosses whole cells by their
+// cliques, on the highest level whose cells contain neither endpoint.
+func (s *search) overlayRoute(m *Metric, start, end uint32) (*Route, error) {
+	o, ws := m.overlay, s.ws
+	n := m.x.NodeCount()
+	forward, backward := &ws.forward, &ws.backward
+	forward.reset(n)
+	backward.reset(n)
+	ws.open.reset(n)
+	ws.backOpen.reset(n)
+
+	forward.set(start, 0, start)
+	backward.set(end, 0, end)
+	ws.open.push(item{node: start, state: start})
+	ws.backOpen.push(item{node: end, state: end})
+
+	best := math.Inf(1)
+	var meeting uint32
+	for ws.open.len() > 0 || ws.backOpen.len() > 0 {
+		// Stop once no path through unsettled nodes can be shorter
+		minForward, minBackward := ws.open.min(), ws.backOpen.min()
+		if minForward+minBackward >= best {
+			break
+		}
+
+		isBackward := minBackward < minForward
+		labels, other, open := forward, backward, &ws.open
+		if isBackward {
+			labels, other, open = backward, forward, &ws.backOpen
+		}
+		u := open.pop().node
+		labels.settle(u)
+		if err := s.explore(); err != nil {
+			return nil, err
+		}
+
+		ws.arcs = m.arcs(ws.arcs[:0], o.queryLevel(start, end, u), u, isBackward)
+		for _, a := range ws.arcs {
+			if labels.isSettled(a.to) {
+				continue
+			}
+			score := labels.score[u] + a.cost
+			old, exists := labels.get(a.to)
+			if exists && score >= old {
+				continue
+			}
+			labels.set(a.to, score, u)
+			it := item{node: a.to, state: a.to, priority: score}
+			if exists {
+				open.decrease(it)
+			} else {
+				open.push(it)
+			}
+			if rest, ok := other.get(a.to); ok && score+rest < best {
+				best = score + rest
+				meeting = a.to
+			}
+		}
+	}
+	if math.IsInf(best, 1) {
+		return nil, ErrNoRoute
+	}
+
+	// Overlay path: start -> meeting by forward parents, meeting -> end by backward parents
+	var hops []uint32
+	for v := meeting; v != start; v = forward.parent[v] {
+		hops = append(hops, v)
+	}
+	hops = append(hops, start)
+	slices.Reverse(hops)
+	for v := meeting; v != end; {
+		v = backward.parent[v]
+		hops = append(hops, v)
+	}
+
+	// Replace clique arcs by the road nodes they stand for
+	path := []uint32{start}
+	for i := 0; i+1 < len(hops); i++ {
+		a, b := hops[i], hops[i+1]
+		k := max(o.queryLevel(start, end, a), o.queryLevel(start, end, b))
+		path = m.unpack(ws, path, k, a, b)
+	}
+
+	nodes := make([]int64, len(path))
+	for i, v := range path {
+		nodes[i] = m.x.NodeID(v)
+	}
+	return s.newRoute(nodes, best), nil
+}
@@ -0,0 +1,187 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// dijkstraCost returns the cost of the shortest path on the road edges of a metric
+func dijkstraCost(m *Metric, start, end uint32) float64 {
+	var l labels
+	var q queue
+	l.reset(m.x.NodeCount())
+	q.reset(m.x.NodeCount())
+	l.set(start, 0, start)
+	q.push(item{node: start, state: start})
+	for q.len() > 0 {
+		u := q.pop().node
+		l.settle(u)
+		if u == end {
+			return l.score[u]
+		}
+		for _, a := range m.arcs(nil, -1, u, false) {
+			score := l.score[u] + a.cost
+			if old, exists := l.get(a.to); !exists {
+				l.set(a.to, score, u)
+				q.push(item{node: a.to, state: a.to, priority: score})
+			} else if score < old && !l.isSettled(a.to) {
+				l.set(a.to, score, u)
+				q.decrease(item{node: a.to, state: a.to, priority: score})
+			}
+		}
+	}
+	return math.Inf(1)
+}
+
+// pathCost adds up the cheapest edge costs between consecutive route nodes
+func pathCost(t *testing.T, m *Metric, nodes []int64) float64 {
+	total := 0.0
+	for i := 0; i+1 < len(nodes); i++ {
+		from, _ := m.x.Lookup(nodes[i])
+		to, _ := m.x.Lookup(nodes[i+1])
+		cost := math.Inf(1)
+		for _, edge := range m.x.OutEdges(nil, from) {
+			if edge.Head == to {
+				cost = min(cost, m.edges[edge.ID])
+			}
+		}
+		if math.IsInf(cost, 1) {
+			t.Fatalf("route uses missing edge %d -> %d", nodes[i], nodes[i+1])
+		}
+		total += cost
+	}
+	return total
+}
+
+func TestMLDRoutesAreShortest(t *testing.T) {
+	g := createGridGraph(20)
+	rng := rand.New(rand.NewSource(1))
+	var changes []graph.WeightChange
+	for way := int64(1); way <= 40; way++ {
+		changes = append(changes, graph.WeightChange{Edges: g.EdgesByWay(way), Op: graph.WeightMultiply, Value: 1 + 3*rng.Float64()})
+	}
+	if _, err := g.ApplyWeightChanges(changes); err != nil {
+		t.Fatalf("ApplyWeightChanges: %v", err)
+	}
+
+	router := NewRouter(g)
+	mld, err := NewMLD(router, []int{8, 32, 128})
+	if err != nil {
+		t.Fatalf("NewMLD: %v", err)
+	}
+	profile := CarProfile
+	mld.SetProfiles(map[string]RoutingProfile{profile.Name: profile})
+	if err := mld.Customize(); err != nil {
+		t.Fatalf("Customize: %v", err)
+	}
+	metric := (*mld.metrics.Load())[profile.Name]
+
+	for i := 0; i < 50; i++ {
+		fromLat, fromLon := 43.0+float64(rng.Intn(20))*0.001, 7.0+float64(rng.Intn(20))*0.001
+		toLat, toLon := 43.0+float64(rng.Intn(20))*0.001, 7.0+float64(rng.Intn(20))*0.001
+		route, err := mld.FindRoute(context.Background(), fromLat, fromLon, toLat, toLon, profile)
+		if err != nil {
+			t.Fatalf("FindRoute: %v", err)
+		}
+		start, _ := metric.x.Nearest(fromLat, fromLon)
+		end, _ := metric.x.Nearest(toLat, toLon)
+		want := dijkstraCost(metric, start, end)
+		if math.Abs(route.Weight-want) > 1e-6 {
+			t.Errorf("route %d cost = %v, want %v", i, route.Weight, want)
+		}
+		if got := pathCost(t, metric, route.Nodes); math.Abs(got-want) > 1e-6 {
+			t.Errorf("route %d unpacks to a path of cost %v, want %v", i, got, want)
+		}
+		if route.Nodes[0] != metric.x.NodeID(start) || route.Nodes[len(route.Nodes)-1] != metric.x.NodeID(end) {
+			t.Errorf("route %d runs from %d to %d", i, route.Nodes[0], route.Nodes[len(route.Nodes)-1])
+		}
+	}
+}
+
+func TestMLDCustomizesAfterChanges(t *testing.T) {
+	g := createDiamondGraph()
+	router := NewRouter(g)
+	mld, err := NewMLD(router, []int{2, 3})
+	if err != nil {
+		t.Fatalf("NewMLD: %v", err)
+	}
+	profile := CarProfile
+	if _, err := mld.FindRoute(context.Background(), 43.0, 7.0, 43.0, 7.02, profile); !errors.Is(err, ErrNotCustomized) {
+		t.Fatalf("FindRoute before customization: %v, want ErrNotCustomized", err)
+	}
+
+	mld.SetProfiles(map[string]RoutingProfile{profile.Name: profile})
+	if err := mld.Customize(); err != nil {
+		t.Fatalf("Customize: %v", err)
+	}
+	route, err := mld.FindRoute(context.Background(), 43.0, 7.0, 43.0, 7.02, profile)
+	if err != nil || route.Nodes[1] != 2 {
+		t.Fatalf("route = %v, %v, want one via node 2", route, err)
+	}
+
+	// Weight changes make a new snapshot, so the metric is stale until customized again
+	if _, err := g.ApplyWeightChanges([]graph.WeightChange{{Edges: g.EdgesByWay(10), Op: graph.WeightMultiply, Value: 10}}); err != nil {
+		t.Fatalf("ApplyWeightChanges: %v", err)
+	}
+	if _, err := mld.FindRoute(context.Background(), 43.0, 7.0, 43.0, 7.02, profile); !errors.Is(err, ErrNotCustomized) {
+		t.Fatalf("FindRoute after weight change: %v, want ErrNotCustomized", err)
+	}
+	if err := mld.Customize(); err != nil {
+		t.Fatalf("Customize: %v", err)
+	}
+	route, err = mld.FindRoute(context.Background(), 43.0, 7.0, 43.0, 7.02, profile)
+	if err != nil || route.Nodes[1] != 3 {
+		t.Fatalf("route = %v, %v, want one via node 3", route, err)
+	}
+
+	// Update keeps the metric in use until the new customization replaces it
+	metric := (*mld.metrics.Load())[profile.Name]
+	mld.Update()
+	if !mld.valid(metric, g.Index()) {
+		t.Errorf("metric invalid after Update")
+	}
+
+	// Refresh invalidates the metric, e.g. for closures the snapshot does not show
+	mld.Refresh()
+	if mld.valid(metric, g.Index()) {
+		t.Errorf("metric still valid after Refresh")
+	}
+}
+
+// BenchmarkMLDRoutes routes corner to corner on the overlay of grid graphs
+func BenchmarkMLDRoutes(b *testing.B) {
+	for _, n := range []int{100, 300} {
+		router := NewRouter(createGridGraph(n))
+		mld, err := NewMLD(router, []int{64, 1024, 16384})
+		if err != nil {
+			b.Fatal(err)
+		}
+		profile := CarProfile
+		mld.SetProfiles(map[string]RoutingProfile{profile.Name: profile})
+		if err := mld.Customize(); err != nil {
+			b.Fatal(err)
+		}
+		toLat, toLon := 43.0+float64(n-1)*0.001, 7.0+float64(n-1)*0.001
+		b.Run(fmt.Sprintf("query/%dx%d", n, n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := mld.FindRoute(context.Background(), 43.0, 7.0, toLat, toLon, profile); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("customize/%dx%d", n, n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := mld.Customize(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
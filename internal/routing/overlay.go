@@ -0,0 +1,386 @@
+package routing
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/vamosdalian/nav/internal/graph"
+	"github.com/vamosdalian/nav/internal/partition"
+)
+
+// Overlay is the profile independent part of a multi-level overlay graph
+// (customizable route planning): a nested partition of the road graph and the
+// boundary nodes of its cells. A Metric adds the costs of one profile.
+type Overlay struct {
+	x         *graph.Index // Topology the overlay was built for
+	partition *partition.Partition
+	tail      []uint32 // Source node of each edge
+	levels    []overlayLevel
+}
+
+// overlayLevel describes the cells of one level. A node is a boundary node of
+// its cell when one of its edges leads to or comes from another cell of the
+// level. Boundary nodes of a level are boundary nodes of all levels below.
+type overlayLevel struct {
+	boundary [][]uint32 // Boundary nodes of each cell
+	members  [][]uint32 // Nodes a search inside each cell visits: boundary nodes of the level below, or all nodes on level 0
+	slot     []int32    // Position of each node in the boundary list of its cell, -1 for inner nodes
+	offset   []int      // Start of the clique matrix of each cell
+	size     int        // Total size of the clique matrices
+}
+
+// NewOverlay partitions the graph of x with the given cell sizes and finds
+// the boundary nodes of all cells
+func NewOverlay(x *graph.Index, cellSizes []int) (*Overlay, error) {
+	p, err := partition.New(x, cellSizes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to partition graph: %w", err)
+	}
+
+	n := x.NodeCount()
+	o := &Overlay{
+		x:         x,
+		partition: p,
+		tail:      make([]uint32, x.EdgeCount()),
+		levels:    make([]overlayLevel, p.Levels()),
+	}
+	for v := uint32(0); v < uint32(n); v++ {
+		first, end := x.OutEdgeRange(v)
+		for e := first; e < end; e++ {
+			o.tail[e] = v
+		}
+	}
+
+	for k := range o.levels {
+		level := &o.levels[k]
+		level.boundary = make([][]uint32, p.CellCount(k))
+		level.slot = make([]int32, n)
+		for v := range level.slot {
+			level.slot[v] = -1
+		}
+		mark := func(v uint32) {
+			if level.slot[v] < 0 {
+				cell := p.Cell(k, v)
+				level.slot[v] = int32(len(level.boundary[cell]))
+				level.boundary[cell] = append(level.boundary[cell], v)
+			}
+		}
+		for e, tail := range o.tail {
+			head := x.Head(uint32(e))
+			if p.Cell(k, tail) != p.Cell(k, head) {
+				mark(tail)
+				mark(head)
+			}
+		}
+
+		level.members = make([][]uint32, p.CellCount(k))
+		if k == 0 {
+			for v := uint32(0); v < uint32(n); v++ {
+				cell := p.Cell(0, v)
+				level.members[cell] = append(level.members[cell], v)
+			}
+		} else {
+			for _, nodes := range o.levels[k-1].boundary {
+				for _, v := range nodes {
+					cell := p.Cell(k, v)
+					level.members[cell] = append(level.members[cell], v)
+				}
+			}
+		}
+
+		level.offset = make([]int, len(level.boundary))
+		for cell, nodes := range level.boundary {
+			level.offset[cell] = level.size
+			level.size += len(nodes) * len(nodes)
+		}
+	}
+	return o, nil
+}
+
+// Levels returns the number of overlay levels
+func (o *Overlay) Levels() int {
+	return len(o.levels)
+}
+
+// CellCount returns the number of cells on a level
+func (o *Overlay) CellCount(level int) int {
+	return o.partition.CellCount(level)
+}
+
+// BoundaryCount returns the number of boundary nodes on a level
+func (o *Overlay) BoundaryCount(level int) int {
+	count := 0
+	for _, nodes := range o.levels[level].boundary {
+		count += len(nodes)
+	}
+	return count
+}
+
+// queryLevel returns the overlay level a query from start to end uses at node
+// v: one below the lowest level on which v shares a cell with start or end, or
+// the top level if it shares none. Level -1 means the road graph.
+func (o *Overlay) queryLevel(start, end, v uint32) int {
+	p := o.partition
+	for k := range o.levels {
+		cell := p.Cell(k, v)
+		if cell == p.Cell(k, start) || cell == p.Cell(k, end) {
+			return k - 1
+		}
+	}
+	return len(o.levels) - 1
+}
+
+// Metric is an overlay customized for one profile: the cost of every edge
+// and, for each cell, the costs of the shortest paths inside the cell between
+// its boundary nodes (the clique of the cell)
+type Metric struct {
+	overlay    *Overlay
+	x          *graph.Index // Snapshot the costs were taken from
+	generation uint64       // Customization round of the MLD the metric belongs to
+	edges      []float64    // Cost of each edge, +Inf where the profile may not drive
+	cliques    [][]float64  // Clique matrices of all cells, per level
+}
+
+// arc is a step of an overlay search
+type arc struct {
+	to   uint32
+	cost float64
+}
+
+// customize computes the metric of the profile of s on the snapshot of s. The
+// cells of a level are customized in parallel and each level builds on the
+// cliques of the level below.
+func (o *Overlay) customize(s *search) (*Metric, error) {
+	x := s.x
+	if x.NodeCount() != o.x.NodeCount() || x.EdgeCount() != o.x.EdgeCount() {
+		return nil, fmt.Errorf("graph topology changed since the overlay was built")
+	}
+	m := &Metric{
+		overlay: o,
+		x:       x,
+		edges:   make([]float64, x.EdgeCount()),
+		cliques: make([][]float64, len(o.levels)),
+	}
+
+	n := x.NodeCount()
+	chunk := 4096
+	parallel(s.pool, (n+chunk-1)/chunk, func(ws *workspace, i int) {
+		for v := uint32(i * chunk); v < uint32(min(n, (i+1)*chunk)); v++ {
+			ws.edges = x.OutEdges(ws.edges[:0], v)
+			for j := range ws.edges {
+				edge := &ws.edges[j]
+				if s.edgeAllowed(edge) {
+					m.edges[edge.ID] = s.edgeWeight(edge)
+				} else {
+					m.edges[edge.ID] = math.Inf(1)
+				}
+			}
+		}
+	})
+
+	for k := range o.levels {
+		level := &o.levels[k]
+		m.cliques[k] = make([]float64, level.size)
+		parallel(s.pool, len(level.boundary), func(ws *workspace, cell int) {
+			boundary := level.boundary[cell]
+			clique := m.cliques[k][level.offset[cell] : level.offset[cell]+len(boundary)*len(boundary)]
+			cs := m.enterCell(ws, k, uint32(cell))
+			defer cs.leave()
+			for i, from := range boundary {
+				cs.run(from, math.MaxUint32)
+				for j, to := range boundary {
+					clique[i*len(boundary)+j] = cs.cost(to)
+				}
+			}
+		})
+	}
+	return m, nil
+}
+
+// parallel calls work for 0..n-1 on all CPUs, giving each goroutine its own
+// workspace from the pool
+func parallel(pool *workspacePool, n int, work func(ws *workspace, i int)) {
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for range min(n, runtime.GOMAXPROCS(0)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ws := pool.get()
+			for i := range next {
+				work(ws, i)
+			}
+			pool.put(ws)
+		}()
+	}
+	for i := range n {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// arcs appends the arcs leaving u (entering u if backward) on overlay level
+// k: the clique of the level k cell of u and the road edges between that cell
+// and other cells. On level -1 these are all road edges of u.
+func (m *Metric) arcs(buf []arc, k int, u uint32, backward bool) []arc {
+	o, x := m.overlay, m.x
+	cell := uint32(0)
+	if k >= 0 {
+		cell = o.partition.Cell(k, u)
+	}
+
+	if backward {
+		for _, e := range x.InEdgeIDs(u) {
+			v := o.tail[e]
+			if (k < 0 || o.partition.Cell(k, v) != cell) && !math.IsInf(m.edges[e], 1) {
+				buf = append(buf, arc{to: v, cost: m.edges[e]})
+			}
+		}
+	} else {
+		first, end := x.OutEdgeRange(u)
+		for e := first; e < end; e++ {
+			v := x.Head(e)
+			if (k < 0 || o.partition.Cell(k, v) != cell) && !math.IsInf(m.edges[e], 1) {
+				buf = append(buf, arc{to: v, cost: m.edges[e]})
+			}
+		}
+	}
+	if k < 0 {
+		return buf
+	}
+
+	level := &o.levels[k]
+	i := int(level.slot[u])
+	if i < 0 {
+		return buf
+	}
+	boundary := level.boundary[cell]
+	clique := m.cliques[k][level.offset[cell]:]
+	for j, v := range boundary {
+		cost := clique[i*len(boundary)+j]
+		if backward {
+			cost = clique[j*len(boundary)+i]
+		}
+		if j != i && !math.IsInf(cost, 1) {
+			buf = append(buf, arc{to: v, cost: cost})
+		}
+	}
+	return buf
+}
+
+// cellSearch runs Dijkstra searches restricted to one cell, on the arcs of
+// the level below. It works on cell-local indices so its arrays stay small.
+type cellSearch struct {
+	m       *Metric
+	ws      *workspace
+	k       int
+	members []uint32
+}
+
+// enterCell prepares searches inside a cell of level k. Call leave when done
+// so the workspace can be used for another cell.
+func (m *Metric) enterCell(ws *workspace, k int, cell uint32) *cellSearch {
+	if len(ws.local) < m.x.NodeCount() {
+		ws.local = make([]int32, m.x.NodeCount())
+		for v := range ws.local {
+			ws.local[v] = -1
+		}
+	}
+	members := m.overlay.levels[k].members[cell]
+	for i, v := range members {
+		ws.local[v] = int32(i)
+	}
+	return &cellSearch{m: m, ws: ws, k: k, members: members}
+}
+
+// leave restores the local indices of the workspace
+func (cs *cellSearch) leave() {
+	for _, v := range cs.members {
+		cs.ws.local[v] = -1
+	}
+}
+
+// run searches from source until target is settled, or the whole cell if
+// target is not a member
+func (cs *cellSearch) run(source, target uint32) {
+	ws := cs.ws
+	l, q := &ws.inner, &ws.innerOpen
+	l.reset(len(cs.members))
+	q.reset(len(cs.members))
+
+	src := uint32(ws.local[source])
+	l.set(src, 0, src)
+	q.push(item{node: src, state: src})
+	for q.len() > 0 {
+		current := q.pop()
+		u := current.node
+		l.settle(u)
+		if cs.members[u] == target {
+			return
+		}
+
+		ws.arcs = cs.m.arcs(ws.arcs[:0], cs.k-1, cs.members[u], false)
+		for _, a := range ws.arcs {
+			local := ws.local[a.to]
+			if local < 0 || l.isSettled(uint32(local)) {
+				continue // Outside the cell
+			}
+			v := uint32(local)
+			score := l.score[u] + a.cost
+			old, exists := l.get(v)
+			if exists && score >= old {
+				continue
+			}
+			l.set(v, score, u)
+			it := item{node: v, state: v, priority: score}
+			if exists {
+				q.decrease(it)
+			} else {
+				q.push(it)
+			}
+		}
+	}
+}
+
+// cost returns the cost of the last run to a member, +Inf if unreachable
+func (cs *cellSearch) cost(v uint32) float64 {
+	if score, ok := cs.ws.inner.get(uint32(cs.ws.local[v])); ok {
+		return score
+	}
+	return math.Inf(1)
+}
+
+// path returns the members on the path of the last run from its source to v
+func (cs *cellSearch) path(v uint32) []uint32 {
+	l := &cs.ws.inner
+	i := uint32(cs.ws.local[v])
+	path := []uint32{v}
+	for l.parent[i] != i {
+		i = l.parent[i]
+		path = append(path, cs.members[i])
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// unpack appends the road nodes after from on the way to to, for an arc of
+// overlay level k
+func (m *Metric) unpack(ws *workspace, path []uint32, k int, from, to uint32) []uint32 {
+	p := m.overlay.partition
+	if k < 0 || p.Cell(k, from) != p.Cell(k, to) {
+		return append(path, to) // Road edge
+	}
+
+	cs := m.enterCell(ws, k, p.Cell(k, from))
+	cs.run(from, to)
+	hops := cs.path(to)
+	cs.leave()
+	for i := 0; i+1 < len(hops); i++ {
+		path = m.unpack(ws, path, k-1, hops[i], hops[i+1])
+	}
+	return path
+}
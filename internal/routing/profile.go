@@ -1,15 +1,21 @@
 package routing
 
+import "time"
+
 // ProfileConfig represents a complete routing profile configuration
 type ProfileConfig struct {
 	Name          string                   `yaml:"name" json:"name"`
 	Description   string                   `yaml:"description" json:"description"`
 	Version       string                   `yaml:"version" json:"version"`
+	Extends       string                   `yaml:"extends,omitempty" json:"extends,omitempty"` // Parent profile this one is merged onto
 	Settings      Settings                 `yaml:"settings" json:"settings"`
 	Highways      map[string]HighwayConfig `yaml:"highways" json:"highways"`
 	Surfaces      map[string]SurfaceConfig `yaml:"surfaces" json:"surfaces"`
 	Features      Features                 `yaml:"features" json:"features"`
 	WeightFormula WeightFormula            `yaml:"weight_formula" json:"weight_formula"`
+	Elevation     ElevationConfig          `yaml:"elevation" json:"elevation"`
+	Vehicle       *VehicleModel            `yaml:"vehicle,omitempty" json:"vehicle,omitempty"`
+	Limits        SearchLimits             `yaml:"limits,omitempty" json:"limits,omitempty"`
 }
 
 // Settings contains basic routing settings
@@ -41,11 +47,47 @@ type Features struct {
 
 // WeightFormula defines how edge weights are calculated
 type WeightFormula struct {
+	Mode           string  `yaml:"mode" json:"mode"` // "" blends distance and time, "eco" minimises consumption
 	UseTime        bool    `yaml:"use_time" json:"use_time"`
 	DistanceWeight float64 `yaml:"distance_weight" json:"distance_weight"`
 	TimeWeight     float64 `yaml:"time_weight" json:"time_time_weight"`
 }
 
+// ElevationConfig defines how climbs and grades affect edge weights.
+// It only has an effect when the graph carries elevation data.
+type ElevationConfig struct {
+	AscentFactor  float64 `yaml:"ascent_factor" json:"ascent_factor"`   // Extra cost (in meters) per meter climbed
+	DescentFactor float64 `yaml:"descent_factor" json:"descent_factor"` // Extra cost (in meters) per meter descended
+	MaxGrade      float64 `yaml:"max_grade" json:"max_grade"`           // Uphill grade (%) above which steep_penalty applies
+	SteepPenalty  float64 `yaml:"steep_penalty" json:"steep_penalty"`   // Weight multiplier for segments steeper than max_grade
+}
+
+// SearchLimits bound the work of a route search. Zero fields mean no limit of
+// their own; the router falls back to DefaultMaxNodes.
+type SearchLimits struct {
+	MaxNodes  int `yaml:"max_nodes,omitempty" json:"max_nodes,omitempty"`   // Nodes a search may settle
+	TimeoutMs int `yaml:"timeout_ms,omitempty" json:"timeout_ms,omitempty"` // Wall-clock time a search may take
+}
+
+// DefaultMaxNodes is the node budget of searches without a MaxNodes limit
+const DefaultMaxNodes = 1000000
+
+// Timeout returns the time budget, or 0 for none
+func (l SearchLimits) Timeout() time.Duration {
+	return time.Duration(l.TimeoutMs) * time.Millisecond
+}
+
+// Cap returns the limits bounded by max. Unset fields take the value of max.
+func (l SearchLimits) Cap(max SearchLimits) SearchLimits {
+	if max.MaxNodes > 0 && (l.MaxNodes <= 0 || l.MaxNodes > max.MaxNodes) {
+		l.MaxNodes = max.MaxNodes
+	}
+	if max.TimeoutMs > 0 && (l.TimeoutMs <= 0 || l.TimeoutMs > max.TimeoutMs) {
+		l.TimeoutMs = max.TimeoutMs
+	}
+	return l
+}
+
 // Legacy RoutingProfile for backward compatibility
 type RoutingProfile struct {
 	Name            string
@@ -53,6 +95,13 @@ type RoutingProfile struct {
 	SpeedFactors    map[string]float64
 	AvoidSurfaces   map[string]bool
 	MaxSpeed        float64
+	Elevation       ElevationConfig
+	Weighting       string         // WeightModeEco minimises the consumption of Vehicle
+	Vehicle         *VehicleModel  // Consumption model (optional)
+	Avoid           *AvoidAreas    // Per-request exclusion zones (optional)
+	Custom          *CompiledModel // Per-request custom model (optional)
+	Departure       time.Time      // Departure time for historical speeds (zero = now)
+	Limits          SearchLimits   // Node and time budget of a search
 }
 
 // Predefined routing profiles
@@ -197,6 +246,35 @@ func (p *RoutingProfile) CalculateWeight(distance float64, highway string, surfa
 	return weight
 }
 
+// UsesElevation reports whether the profile penalises climbs or grades
+func (p *RoutingProfile) UsesElevation() bool {
+	e := p.Elevation
+	return e.AscentFactor > 0 || e.DescentFactor > 0 || (e.MaxGrade > 0 && e.SteepPenalty > 1)
+}
+
+// ApplyElevation adjusts an edge weight for the climb over a segment of the given length (in meters)
+func (p *RoutingProfile) ApplyElevation(weight, length, elevationChange float64) float64 {
+	if elevationChange > 0 {
+		weight += elevationChange * p.Elevation.AscentFactor
+
+		if p.Elevation.MaxGrade > 0 && p.Elevation.SteepPenalty > 1 && length > 0 {
+			grade := elevationChange / length * 100
+			if grade > p.Elevation.MaxGrade {
+				weight *= p.Elevation.SteepPenalty
+			}
+		}
+	} else {
+		weight -= elevationChange * p.Elevation.DescentFactor
+	}
+
+	return weight
+}
+
+// IsEco reports whether the profile minimises fuel/energy consumption
+func (p *RoutingProfile) IsEco() bool {
+	return p.Weighting == WeightModeEco && p.Vehicle != nil && p.Vehicle.MinConsumptionPerMeter() > 0
+}
+
 // ProfileConfig methods
 
 // Clone creates a deep copy of the profile
@@ -205,9 +283,16 @@ func (p *ProfileConfig) Clone() *ProfileConfig {
 		Name:          p.Name,
 		Description:   p.Description,
 		Version:       p.Version,
+		Extends:       p.Extends,
 		Settings:      p.Settings,
 		Features:      p.Features,
 		WeightFormula: p.WeightFormula,
+		Elevation:     p.Elevation,
+		Limits:        p.Limits,
+	}
+
+	if p.Vehicle != nil {
+		clone.Vehicle = p.Vehicle.Clone()
 	}
 
 	// Deep copy maps
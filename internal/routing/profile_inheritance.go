@@ -0,0 +1,132 @@
+package routing
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profileDocument is a profile file as written, before inheritance is resolved.
+// Keeping the raw document tells settings left out of a file apart from
+// settings set to zero.
+type profileDocument = map[string]interface{}
+
+// profileResolver resolves `extends` chains between profile documents. Each
+// profile is merged onto its resolved parent, so chains of any length work.
+type profileResolver struct {
+	docs     map[string]profileDocument // By profile name
+	resolved map[string]profileDocument
+	failed   map[string]error
+	chain    []string // Profiles being resolved, outermost first
+}
+
+func newProfileResolver(docs map[string]profileDocument) *profileResolver {
+	return &profileResolver{
+		docs:     docs,
+		resolved: make(map[string]profileDocument),
+		failed:   make(map[string]error),
+	}
+}
+
+// resolve returns the document of a profile merged with all its ancestors
+func (r *profileResolver) resolve(name string) (profileDocument, error) {
+	if doc, ok := r.resolved[name]; ok {
+		return doc, nil
+	}
+	if err, ok := r.failed[name]; ok {
+		return nil, err
+	}
+	for i, seen := range r.chain {
+		if seen == name {
+			cycle := append(append([]string{}, r.chain[i:]...), name)
+			return nil, fmt.Errorf("inheritance cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	doc := r.docs[name]
+	parentName, err := documentExtends(doc)
+	if err != nil {
+		r.failed[name] = err
+		return nil, err
+	}
+	if parentName == "" {
+		r.resolved[name] = doc
+		return doc, nil
+	}
+	if _, ok := r.docs[parentName]; !ok {
+		err := fmt.Errorf("profile '%s' extends unknown profile '%s'", name, parentName)
+		r.failed[name] = err
+		return nil, err
+	}
+
+	r.chain = append(r.chain, name)
+	parent, err := r.resolve(parentName)
+	r.chain = r.chain[:len(r.chain)-1]
+	if err != nil {
+		r.failed[name] = err
+		return nil, err
+	}
+
+	merged := mergeDocuments(parent, doc)
+	r.resolved[name] = merged
+	return merged, nil
+}
+
+// documentName returns the name a profile document declares
+func documentName(doc profileDocument) (string, error) {
+	name, ok := doc["name"].(string)
+	if !ok || name == "" {
+		return "", fmt.Errorf("profile name is required")
+	}
+	return name, nil
+}
+
+// documentExtends returns the parent a profile document extends, or "" if none
+func documentExtends(doc profileDocument) (string, error) {
+	switch parent := doc["extends"].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return parent, nil
+	default:
+		return "", fmt.Errorf("extends must be a profile name")
+	}
+}
+
+// mergeDocuments deep-merges a child profile onto its parent: mappings such as
+// highways, surfaces, features and weight_formula merge key by key, other
+// values replace the parent's, and null removes the key (as in JSON Merge
+// Patch). Neither document is modified.
+func mergeDocuments(parent, child map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(parent)+len(child))
+	for key, value := range parent {
+		merged[key] = value
+	}
+	for key, value := range child {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		if childMap, ok := value.(map[string]interface{}); ok {
+			parentMap, _ := merged[key].(map[string]interface{})
+			merged[key] = mergeDocuments(parentMap, childMap)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// decodeProfile converts a resolved profile document into its configuration
+func decodeProfile(doc profileDocument) (*ProfileConfig, error) {
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var profile ProfileConfig
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	return &profile, nil
+}
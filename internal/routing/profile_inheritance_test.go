@@ -0,0 +1,164 @@
+package routing
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const bikeProfileYAML = `
+name: bike
+settings:
+  max_speed_kmh: 30
+  default_speed_kmh: 15
+highways:
+  cycleway: {allowed: true, speed_factor: 1.0, preference: 1.2}
+  footway: {allowed: true, speed_factor: 0.5, preference: 0.8}
+  primary: {allowed: true, speed_factor: 0.8, preference: 0.6}
+surfaces:
+  gravel: {penalty: 1.3}
+features:
+  avoid_highways: true
+  allow_uturns: true
+weight_formula:
+  use_time: true
+  distance_weight: 0.5
+  time_weight: 0.5
+`
+
+const ebikeProfileYAML = `
+name: ebike
+extends: bike
+settings:
+  max_speed_kmh: 45
+highways:
+  cycleway: {speed_factor: 1.4}
+  footway: ~
+surfaces:
+  sett: {penalty: 1.5}
+features:
+  allow_uturns: false
+weight_formula:
+  distance_weight: 0.3
+  time_weight: 0.7
+`
+
+const cargoBikeProfileYAML = `
+name: cargo_bike
+extends: ebike
+highways:
+  primary: ~
+surfaces: ~
+`
+
+// writeProfiles writes profile files into a new directory and returns a manager loading it
+func writeProfiles(t *testing.T, files map[string]string) *ProfileManager {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name+".yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewProfileManager(dir)
+}
+
+func TestProfileInheritanceMerges(t *testing.T) {
+	pm := writeProfiles(t, map[string]string{"bike": bikeProfileYAML, "ebike": ebikeProfileYAML, "cargo": cargoBikeProfileYAML})
+	if err := pm.LoadProfiles(); err != nil {
+		t.Fatalf("LoadProfiles: %v", err)
+	}
+
+	ebike, err := pm.GetProfile("ebike")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ebike.Extends != "bike" || ebike.Settings.MaxSpeedKmh != 45 || ebike.Settings.DefaultSpeedKmh != 15 {
+		t.Errorf("settings = %+v extending %q, want max 45 and default 15 from bike", ebike.Settings, ebike.Extends)
+	}
+	if got := ebike.Highways["cycleway"]; got != (HighwayConfig{Allowed: true, SpeedFactor: 1.4, Preference: 1.2}) {
+		t.Errorf("cycleway = %+v, want speed factor 1.4 merged onto bike", got)
+	}
+	if _, ok := ebike.Highways["footway"]; ok {
+		t.Errorf("footway not removed")
+	}
+	if len(ebike.Surfaces) != 2 || ebike.Surfaces["gravel"].Penalty != 1.3 || ebike.Surfaces["sett"].Penalty != 1.5 {
+		t.Errorf("surfaces = %v, want gravel from bike and sett", ebike.Surfaces)
+	}
+	if !ebike.Features.AvoidHighways || ebike.Features.AllowUturns {
+		t.Errorf("features = %+v, want avoid_highways from bike and no u-turns", ebike.Features)
+	}
+	if wf := ebike.WeightFormula; !wf.UseTime || wf.DistanceWeight != 0.3 || wf.TimeWeight != 0.7 {
+		t.Errorf("weight_formula = %+v", wf)
+	}
+
+	// Grandchildren inherit the merged parent
+	cargo, err := pm.GetProfile("cargo_bike")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cargo.Highways) != 1 || cargo.Highways["cycleway"].SpeedFactor != 1.4 || cargo.Surfaces != nil || cargo.Settings.MaxSpeedKmh != 45 {
+		t.Errorf("cargo_bike = %+v", cargo)
+	}
+
+	// The parent is unchanged and definitions are kept as written
+	bike, _ := pm.GetProfile("bike")
+	if len(bike.Highways) != 3 || bike.Highways["cycleway"].SpeedFactor != 1.0 {
+		t.Errorf("bike highways = %v", bike.Highways)
+	}
+	definition, err := pm.GetProfileDefinition("cargo_bike")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := definition["settings"]; ok || definition["extends"] != "ebike" {
+		t.Errorf("definition = %v, want the file as written", definition)
+	}
+}
+
+func TestProfileInheritanceErrors(t *testing.T) {
+	pm := writeProfiles(t, map[string]string{
+		"bike":    bikeProfileYAML,
+		"a":       "name: a\nextends: b\n",
+		"b":       "name: b\nextends: c\n",
+		"c":       "name: c\nextends: a\n",
+		"d":       "name: d\nextends: c\n",
+		"self":    "name: self\nextends: self\n",
+		"orphan":  "name: orphan\nextends: tandem\n",
+		"invalid": "name: invalid\nextends: [bike]\n",
+	})
+	if err := pm.LoadProfiles(); err != nil {
+		t.Fatalf("LoadProfiles: %v", err)
+	}
+	if names := pm.ListProfiles(); len(names) != 1 || names[0] != "bike" {
+		t.Errorf("loaded %v, want only bike", names)
+	}
+
+	docs := map[string]profileDocument{
+		"a":       {"name": "a", "extends": "b"},
+		"b":       {"name": "b", "extends": "c"},
+		"c":       {"name": "c", "extends": "a"},
+		"d":       {"name": "d", "extends": "c"},
+		"self":    {"name": "self", "extends": "self"},
+		"orphan":  {"name": "orphan", "extends": "tandem"},
+		"invalid": {"name": "invalid", "extends": []interface{}{"bike"}},
+	}
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"a", "inheritance cycle: a -> b -> c -> a"},
+		{"c", "inheritance cycle: a -> b -> c -> a"},
+		{"d", "inheritance cycle: a -> b -> c -> a"}, // The failure of the cycle it extends
+		{"self", "inheritance cycle: self -> self"},
+		{"orphan", "profile 'orphan' extends unknown profile 'tandem'"},
+		{"invalid", "extends must be a profile name"},
+	}
+	resolver := newProfileResolver(docs)
+	for _, tt := range tests {
+		_, err := resolver.resolve(tt.name)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("resolve(%s) = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
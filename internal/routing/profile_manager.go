@@ -5,23 +5,57 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // ProfileManager manages routing profiles
 type ProfileManager struct {
-	profiles  map[string]*ProfileConfig
-	mutex     sync.RWMutex
-	configDir string
+	profiles    map[string]*ProfileConfig
+	definitions map[string]profileDocument // Profiles as written, before inheritance
+	sources     map[string]string          // Profile file by profile name
+	etags       map[string]string          // Entity tag of each profile file
+	files       map[string]string          // Entity tag of every file last read, including broken ones, by path
+	status      ProfileStatus
+	mutex       sync.RWMutex
+	configDir   string
+}
+
+// ProfileStatus reports the outcome of the last profile load or reload
+type ProfileStatus struct {
+	Directory     string            `json:"directory"`
+	Profiles      []string          `json:"profiles"`
+	Watch         string            `json:"watch"`     // fsnotify, polling or off
+	LoadedAt      time.Time         `json:"loaded_at"` // Last time the loaded profiles were replaced
+	LastAttemptAt time.Time         `json:"last_attempt_at"`
+	LastError     string            `json:"last_error,omitempty"`
+	Failures      map[string]string `json:"failures,omitempty"` // Error by file of the last attempt
+}
+
+// profileSet holds the profiles read from the profile directory
+type profileSet struct {
+	profiles    map[string]*ProfileConfig
+	definitions map[string]profileDocument
+	sources     map[string]string
+	etags       map[string]string
+	files       map[string]string
+	failures    map[string]string // Error by file
 }
 
 // NewProfileManager creates a new profile manager
 func NewProfileManager(configDir string) *ProfileManager {
 	return &ProfileManager{
-		profiles:  make(map[string]*ProfileConfig),
-		configDir: configDir,
+		profiles:    make(map[string]*ProfileConfig),
+		definitions: make(map[string]profileDocument),
+		sources:     make(map[string]string),
+		etags:       make(map[string]string),
+		files:       make(map[string]string),
+		status:      ProfileStatus{Directory: configDir, Watch: "off"},
+		configDir:   configDir,
 	}
 }
 
@@ -40,63 +74,176 @@ func (pm *ProfileManager) LoadProfiles() error {
 		return fmt.Errorf("profile directory '%s' does not exist", pm.configDir)
 	}
 
-	// Load from config files
-	if err := pm.loadFromDirectory(); err != nil {
+	// Load from config files, skipping broken ones
+	set, err := pm.readDirectory()
+	if err != nil {
 		return fmt.Errorf("failed to load profiles from directory: %w", err)
 	}
+	for _, file := range sortedKeys(set.failures) {
+		log.Printf("Warning: failed to load profile %s: %s", file, set.failures[file])
+	}
+	for _, name := range sortedKeys(set.sources) {
+		if set.profiles[name] != nil {
+			log.Printf("Loaded profile from: %s", set.sources[name])
+		}
+	}
 
 	// Check if at least one profile was loaded
-	if len(pm.profiles) == 0 {
+	if len(set.profiles) == 0 {
 		return fmt.Errorf("no valid profiles found in directory '%s'", pm.configDir)
 	}
 
+	pm.install(set, set.err())
 	log.Printf("Loaded %d profile(s): %v", len(pm.profiles), pm.listProfileNames())
 	return nil
 }
 
-// loadFromDirectory loads all YAML files from the config directory
-func (pm *ProfileManager) loadFromDirectory() error {
+// readDirectory reads all YAML files from the config directory without
+// changing the loaded profiles. Profiles that extend another one are merged
+// onto their resolved parent; profiles in an inheritance cycle or extending
+// an unknown profile fail.
+func (pm *ProfileManager) readDirectory() (*profileSet, error) {
 	files, err := filepath.Glob(filepath.Join(pm.configDir, "*.yaml"))
 	if err != nil {
-		return fmt.Errorf("failed to list profile files: %w", err)
+		return nil, fmt.Errorf("failed to list profile files: %w", err)
 	}
 
-	loadedCount := 0
+	set := &profileSet{
+		definitions: make(map[string]profileDocument),
+		sources:     make(map[string]string),
+		etags:       make(map[string]string),
+		files:       make(map[string]string),
+		failures:    make(map[string]string),
+	}
 	for _, file := range files {
-		if err := pm.loadProfileFromFile(file); err != nil {
-			log.Printf("Warning: failed to load profile %s: %v", file, err)
-		} else {
-			log.Printf("Loaded profile from: %s", file)
-			loadedCount++
+		data, err := os.ReadFile(file)
+		if err != nil {
+			set.failures[file] = err.Error()
+			continue
 		}
+		set.files[file] = profileETag(data)
+		doc, err := parseProfileDocument(data)
+		if err != nil {
+			set.failures[file] = err.Error()
+			continue
+		}
+		name, _ := documentName(doc)
+		if previous, ok := set.sources[name]; ok {
+			set.failures[previous] = fmt.Sprintf("profile '%s' is also defined in %s", name, file)
+		}
+		set.definitions[name] = doc
+		set.sources[name] = file
+		set.etags[name] = set.files[file]
 	}
 
-	if loadedCount == 0 {
-		return fmt.Errorf("no valid YAML files found in %s", pm.configDir)
+	profiles, errs := pm.resolveProfiles(set.definitions)
+	for name, err := range errs {
+		set.failures[set.sources[name]] = err.Error()
 	}
+	set.profiles = profiles
+	return set, nil
+}
 
+// err returns an error describing the files of a set that failed to load
+func (set *profileSet) err() error {
+	if len(set.failures) > 0 {
+		files := sortedKeys(set.failures)
+		messages := make([]string, len(files))
+		for i, file := range files {
+			messages[i] = file + ": " + set.failures[file]
+		}
+		return fmt.Errorf("%d profile file(s) failed to load: %s", len(files), strings.Join(messages, "; "))
+	}
+	if len(set.profiles) == 0 {
+		return fmt.Errorf("no valid profiles found")
+	}
 	return nil
 }
 
-// loadProfileFromFile loads a single profile from a YAML file
-func (pm *ProfileManager) loadProfileFromFile(path string) error {
-	data, err := os.ReadFile(path)
+// install replaces the loaded profiles with a set read from disk (must be
+// called with lock held)
+func (pm *ProfileManager) install(set *profileSet, err error) {
+	pm.profiles = set.profiles
+	pm.definitions = set.definitions
+	pm.sources = set.sources
+	pm.etags = set.etags
+	pm.files = set.files
+
+	now := time.Now().UTC()
+	pm.status.LoadedAt = now
+	pm.status.LastAttemptAt = now
+	pm.status.LastError = ""
 	if err != nil {
-		return err
+		pm.status.LastError = err.Error()
+	}
+	pm.status.Failures = set.failures
+}
+
+// parseProfileDocument parses a profile in YAML or JSON
+func parseProfileDocument(data []byte) (profileDocument, error) {
+	var doc profileDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if _, err := documentName(doc); err != nil {
+		return nil, fmt.Errorf("invalid profile: %w", err)
 	}
+	return doc, nil
+}
 
-	var profile ProfileConfig
-	if err := yaml.Unmarshal(data, &profile); err != nil {
-		return fmt.Errorf("failed to parse YAML: %w", err)
+// resolveProfiles resolves, decodes and validates profile documents. It
+// returns the profiles that load and the errors of those that do not.
+func (pm *ProfileManager) resolveProfiles(docs map[string]profileDocument) (map[string]*ProfileConfig, map[string]error) {
+	profiles := make(map[string]*ProfileConfig)
+	errs := make(map[string]error)
+	resolver := newProfileResolver(docs)
+	for _, name := range sortedNames(docs) {
+		profile, err := pm.resolveProfile(resolver, name)
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		profiles[name] = profile
+	}
+	return profiles, errs
+}
+
+// resolveProfile resolves, decodes and validates a single profile
+func (pm *ProfileManager) resolveProfile(resolver *profileResolver, name string) (*ProfileConfig, error) {
+	doc, err := resolver.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := decodeProfile(doc)
+	if err != nil {
+		return nil, err
 	}
 
 	// Validate profile
-	if err := pm.validateProfile(&profile); err != nil {
-		return fmt.Errorf("invalid profile: %w", err)
+	if err := pm.validateProfile(profile); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
 	}
+	return profile, nil
+}
 
-	pm.profiles[profile.Name] = &profile
-	return nil
+// sortedNames returns the profile names of documents in order
+func sortedNames(docs map[string]profileDocument) []string {
+	names := make([]string, 0, len(docs))
+	for name := range docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedKeys returns the keys of a string map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // validateProfile validates profile configuration
@@ -113,7 +260,39 @@ func (pm *ProfileManager) validateProfile(p *ProfileConfig) error {
 		return fmt.Errorf("default_speed_kmh must be positive")
 	}
 
+	// Validate elevation settings
+	if p.Elevation.AscentFactor < 0 || p.Elevation.DescentFactor < 0 {
+		return fmt.Errorf("elevation ascent_factor and descent_factor must not be negative")
+	}
+	if p.Elevation.MaxGrade < 0 {
+		return fmt.Errorf("elevation max_grade must not be negative")
+	}
+	if p.Elevation.SteepPenalty != 0 && p.Elevation.SteepPenalty < 1 {
+		return fmt.Errorf("elevation steep_penalty must be at least 1.0 (got %.2f)", p.Elevation.SteepPenalty)
+	}
+
+	// Validate vehicle model
+	if p.Vehicle != nil {
+		if err := p.Vehicle.Validate(); err != nil {
+			return fmt.Errorf("invalid vehicle: %w", err)
+		}
+	}
+
+	// Validate search limits
+	if p.Limits.MaxNodes < 0 || p.Limits.TimeoutMs < 0 {
+		return fmt.Errorf("limits max_nodes and timeout_ms must not be negative")
+	}
+
 	// Validate weight formula
+	switch p.WeightFormula.Mode {
+	case "":
+	case WeightModeEco:
+		if p.Vehicle == nil {
+			return fmt.Errorf("weight_formula mode %q requires a vehicle section", WeightModeEco)
+		}
+	default:
+		return fmt.Errorf("unknown weight_formula mode %q", p.WeightFormula.Mode)
+	}
 	if p.WeightFormula.UseTime {
 		total := p.WeightFormula.DistanceWeight + p.WeightFormula.TimeWeight
 		if total < 0.99 || total > 1.01 {
@@ -137,6 +316,20 @@ func (pm *ProfileManager) GetProfile(name string) (*ProfileConfig, error) {
 	return profile, nil
 }
 
+// GetProfileDefinition retrieves a profile as written in its file, without
+// the settings it inherits
+func (pm *ProfileManager) GetProfileDefinition(name string) (map[string]interface{}, error) {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	definition, exists := pm.definitions[name]
+	if _, loaded := pm.profiles[name]; !exists || !loaded {
+		return nil, fmt.Errorf("profile '%s' not found", name)
+	}
+
+	return definition, nil
+}
+
 // ListProfiles returns all available profile names
 func (pm *ProfileManager) ListProfiles() []string {
 	pm.mutex.RLock()
@@ -153,29 +346,45 @@ func (pm *ProfileManager) listProfileNames() []string {
 	return names
 }
 
-// Reload reloads all profiles from disk
+// Reload reloads all profiles from disk. All files are read and validated
+// first; if any fails, the loaded profiles stay as they are.
 func (pm *ProfileManager) Reload() error {
 	pm.mutex.Lock()
 	defer pm.mutex.Unlock()
 
-	// Clear existing profiles
-	pm.profiles = make(map[string]*ProfileConfig)
-
 	// Require profile directory
 	if pm.configDir == "" {
 		return fmt.Errorf("profile directory is required")
 	}
 
-	// Reload from files
-	if err := pm.loadFromDirectory(); err != nil {
-		return fmt.Errorf("failed to reload profiles: %w", err)
+	set, err := pm.readDirectory()
+	if err == nil {
+		err = set.err()
 	}
-
-	// Check if at least one profile was loaded
-	if len(pm.profiles) == 0 {
-		return fmt.Errorf("no valid profiles found after reload")
+	if err != nil {
+		pm.status.LastAttemptAt = time.Now().UTC()
+		pm.status.LastError = err.Error()
+		pm.status.Failures = nil
+		if set != nil {
+			// Remember the broken files, so watchers do not retry them until they change
+			pm.files = set.files
+			pm.status.Failures = set.failures
+		}
+		return fmt.Errorf("failed to reload profiles: %w", err)
 	}
 
+	pm.install(set, nil)
 	log.Printf("Reloaded %d profile(s)", len(pm.profiles))
 	return nil
 }
+
+// Status reports the loaded profiles and the outcome of the last load or reload
+func (pm *ProfileManager) Status() ProfileStatus {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	status := pm.status
+	status.Profiles = pm.listProfileNames()
+	sort.Strings(status.Profiles)
+	return status
+}
@@ -0,0 +1,408 @@
+package routing
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/atomicfile"
+	"gopkg.in/yaml.v3"
+)
+
+// profileHistoryLimit is the number of previous versions kept per profile
+const profileHistoryLimit = 20
+
+// Errors of profile changes
+var (
+	ErrProfileNotFound = errors.New("profile not found")
+	ErrInvalidProfile  = errors.New("invalid profile")
+	ErrProfileInUse    = errors.New("profile in use")
+	ErrProfileModified = errors.New("profile was modified") // The If-Match ETag is outdated
+)
+
+// ProfileCondition holds the preconditions of a profile change, as in the
+// HTTP If-Match and If-None-Match headers. "*" in IfMatch requires the
+// profile to exist, in IfNoneMatch requires it not to.
+type ProfileCondition struct {
+	IfMatch     string
+	IfNoneMatch string
+}
+
+// ProfileChange is the outcome of a profile change
+type ProfileChange struct {
+	Profile *ProfileConfig // Resolved profile after the change
+	ETag    string
+	Created bool
+}
+
+// ProfileRevision describes a previous version of a profile kept for rollback
+type ProfileRevision struct {
+	Revision int       `json:"revision"`
+	Version  string    `json:"version,omitempty"`
+	ETag     string    `json:"etag"`
+	SavedAt  time.Time `json:"saved_at"`
+}
+
+// ProfileETag returns the entity tag of a loaded profile, which changes
+// whenever its file does
+func (pm *ProfileManager) ProfileETag(name string) (string, error) {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	if _, exists := pm.profiles[name]; !exists {
+		return "", fmt.Errorf("profile '%s' not found", name)
+	}
+	return pm.etags[name], nil
+}
+
+// SaveProfile creates or replaces a profile from a YAML or JSON document.
+// The document may leave out the name, which then comes from the argument.
+func (pm *ProfileManager) SaveProfile(name string, data []byte, cond ProfileCondition) (*ProfileChange, error) {
+	var doc profileDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("%w: document is empty", ErrInvalidProfile)
+	}
+	if _, ok := doc["name"]; !ok {
+		doc["name"] = name
+	}
+
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if err := pm.checkCondition(name, cond); err != nil {
+		return nil, err
+	}
+	return pm.commit(name, doc)
+}
+
+// PatchProfile changes a profile with a merge patch in YAML or JSON: mappings
+// are merged key by key and null removes a key, as with profile inheritance.
+// The patch applies to the profile as written, not to what it inherits.
+func (pm *ProfileManager) PatchProfile(name string, patch []byte, cond ProfileCondition) (*ProfileChange, error) {
+	var changes map[string]interface{}
+	if err := yaml.Unmarshal(patch, &changes); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if _, exists := pm.profiles[name]; !exists {
+		return nil, fmt.Errorf("%w: '%s'", ErrProfileNotFound, name)
+	}
+	if err := pm.checkCondition(name, cond); err != nil {
+		return nil, err
+	}
+	return pm.commit(name, mergeDocuments(pm.definitions[name], changes))
+}
+
+// DeleteProfile removes a profile and its file. Its last version is kept in
+// the history, so it can be restored with RollbackProfile.
+func (pm *ProfileManager) DeleteProfile(name string, cond ProfileCondition) error {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if _, exists := pm.profiles[name]; !exists {
+		return fmt.Errorf("%w: '%s'", ErrProfileNotFound, name)
+	}
+	if err := pm.checkCondition(name, cond); err != nil {
+		return err
+	}
+	for _, other := range sortedNames(pm.definitions) {
+		if parent, _ := documentExtends(pm.definitions[other]); parent == name {
+			return fmt.Errorf("%w: '%s' is extended by '%s'", ErrProfileInUse, name, other)
+		}
+	}
+	if len(pm.profiles) == 1 {
+		return fmt.Errorf("%w: '%s' is the last profile", ErrProfileInUse, name)
+	}
+
+	path := pm.sources[name]
+	if err := pm.archive(name, path); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to delete profile file: %w", err)
+	}
+
+	delete(pm.profiles, name)
+	delete(pm.definitions, name)
+	delete(pm.sources, name)
+	delete(pm.etags, name)
+	delete(pm.files, path)
+	return nil
+}
+
+// ProfileHistory lists the previous versions of a profile, oldest first
+func (pm *ProfileManager) ProfileHistory(name string) ([]ProfileRevision, error) {
+	if !validProfileName(name) {
+		return nil, fmt.Errorf("%w: '%s'", ErrProfileNotFound, name)
+	}
+
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	revisions, err := pm.revisions(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		if _, exists := pm.profiles[name]; !exists {
+			return nil, fmt.Errorf("%w: '%s'", ErrProfileNotFound, name)
+		}
+	}
+
+	history := make([]ProfileRevision, 0, len(revisions))
+	for _, revision := range revisions {
+		path := pm.revisionPath(name, revision)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read profile history: %w", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read profile history: %w", err)
+		}
+		entry := ProfileRevision{Revision: revision, ETag: profileETag(data), SavedAt: info.ModTime().UTC()}
+		if doc, err := parseProfileDocument(data); err == nil && doc["version"] != nil {
+			entry.Version = fmt.Sprint(doc["version"])
+		}
+		history = append(history, entry)
+	}
+	return history, nil
+}
+
+// RollbackProfile restores a previous version of a profile. The version it
+// replaces goes to the history in turn.
+func (pm *ProfileManager) RollbackProfile(name string, revision int, cond ProfileCondition) (*ProfileChange, error) {
+	if !validProfileName(name) {
+		return nil, fmt.Errorf("%w: '%s'", ErrProfileNotFound, name)
+	}
+
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	data, err := os.ReadFile(pm.revisionPath(name, revision))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: '%s' has no revision %d", ErrProfileNotFound, name, revision)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile history: %w", err)
+	}
+	doc, err := parseProfileDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: revision %d: %v", ErrInvalidProfile, revision, err)
+	}
+
+	if err := pm.checkCondition(name, cond); err != nil {
+		return nil, err
+	}
+	return pm.commit(name, doc)
+}
+
+// checkCondition checks the preconditions of a change (must be called with lock held)
+func (pm *ProfileManager) checkCondition(name string, cond ProfileCondition) error {
+	etag, exists := pm.etags[name]
+	if _, loaded := pm.profiles[name]; !loaded {
+		exists = false
+	}
+	switch {
+	case cond.IfMatch == "*" && !exists:
+		return fmt.Errorf("%w: '%s' does not exist", ErrProfileModified, name)
+	case cond.IfMatch != "" && cond.IfMatch != "*" && cond.IfMatch != etag:
+		return fmt.Errorf("%w: ETag %s does not match", ErrProfileModified, cond.IfMatch)
+	case cond.IfNoneMatch == "*" && exists:
+		return fmt.Errorf("%w: '%s' already exists", ErrProfileModified, name)
+	}
+	return nil
+}
+
+// commit validates a new version of a profile together with the profiles
+// extending it, then writes it (must be called with lock held)
+func (pm *ProfileManager) commit(name string, doc profileDocument) (*ProfileChange, error) {
+	if !validProfileName(name) {
+		return nil, fmt.Errorf("%w: name '%s' may only contain letters, digits, '-' and '_'", ErrInvalidProfile, name)
+	}
+	if docName, err := documentName(doc); err != nil || docName != name {
+		return nil, fmt.Errorf("%w: name must be '%s'", ErrInvalidProfile, name)
+	}
+
+	docs := make(map[string]profileDocument, len(pm.definitions)+1)
+	for other, definition := range pm.definitions {
+		docs[other] = definition
+	}
+	docs[name] = doc
+	profiles, errs := pm.resolveProfiles(docs)
+	if err := errs[name]; errors.Is(err, ErrInvalidProfile) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+	for _, other := range pm.listProfileNames() {
+		if err := errs[other]; err != nil {
+			return nil, fmt.Errorf("%w: profile '%s' would fail to load: %v", ErrInvalidProfile, other, err)
+		}
+	}
+
+	data, err := encodeProfileDocument(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode profile: %w", err)
+	}
+	path, exists := pm.sources[name]
+	if !exists {
+		path = filepath.Join(pm.configDir, name+".yaml")
+		for other, source := range pm.sources {
+			if source == path {
+				return nil, fmt.Errorf("%w: %s holds profile '%s'", ErrProfileInUse, path, other)
+			}
+		}
+	}
+	if exists {
+		if err := pm.archive(name, path); err != nil {
+			return nil, err
+		}
+	}
+	if err := atomicfile.WriteFile(path, data); err != nil {
+		return nil, fmt.Errorf("failed to write profile: %w", err)
+	}
+
+	_, existed := pm.profiles[name]
+	pm.profiles = profiles
+	pm.definitions = docs
+	pm.sources[name] = path
+	pm.etags[name] = profileETag(data)
+	pm.files[path] = pm.etags[name]
+	return &ProfileChange{Profile: profiles[name], ETag: pm.etags[name], Created: !existed}, nil
+}
+
+// archive copies the current file of a profile into its history, dropping
+// the oldest versions beyond profileHistoryLimit
+func (pm *ProfileManager) archive(name, path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read profile: %w", err)
+	}
+
+	revisions, err := pm.revisions(name)
+	if err != nil {
+		return err
+	}
+	next := 1
+	if len(revisions) > 0 {
+		next = revisions[len(revisions)-1] + 1
+	}
+	if err := os.MkdirAll(pm.historyDir(name), 0o755); err != nil {
+		return fmt.Errorf("failed to write profile history: %w", err)
+	}
+	if err := atomicfile.WriteFile(pm.revisionPath(name, next), data); err != nil {
+		return fmt.Errorf("failed to write profile history: %w", err)
+	}
+
+	for len(revisions) >= profileHistoryLimit {
+		os.Remove(pm.revisionPath(name, revisions[0]))
+		revisions = revisions[1:]
+	}
+	return nil
+}
+
+// revisions returns the revision numbers in the history of a profile, in order
+func (pm *ProfileManager) revisions(name string) ([]int, error) {
+	entries, err := os.ReadDir(pm.historyDir(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile history: %w", err)
+	}
+
+	var revisions []int
+	for _, entry := range entries {
+		revision, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".yaml"))
+		if err == nil && strings.HasSuffix(entry.Name(), ".yaml") {
+			revisions = append(revisions, revision)
+		}
+	}
+	sort.Ints(revisions)
+	return revisions, nil
+}
+
+// historyDir returns the directory holding the previous versions of a profile
+func (pm *ProfileManager) historyDir(name string) string {
+	return filepath.Join(pm.configDir, ".history", name)
+}
+
+func (pm *ProfileManager) revisionPath(name string, revision int) string {
+	return filepath.Join(pm.historyDir(name), strconv.Itoa(revision)+".yaml")
+}
+
+// validProfileName reports whether a profile name can be used as a file name
+func validProfileName(name string) bool {
+	for _, r := range name {
+		if r != '_' && r != '-' && (r < '0' || r > '9') && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// profileETag returns the entity tag of a profile file
+func profileETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// profileKeyOrder is the order of the top-level keys in written profile files
+var profileKeyOrder = []string{"name", "extends", "description", "version", "settings", "highways",
+	"surfaces", "features", "weight_formula", "elevation", "vehicle", "limits"}
+
+// encodeProfileDocument encodes a profile as YAML with the top-level keys in
+// the usual order; nested keys are sorted
+func encodeProfileDocument(doc profileDocument) ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(doc); err != nil {
+		return nil, err
+	}
+
+	rank := func(key string) int {
+		for i, k := range profileKeyOrder {
+			if k == key {
+				return i
+			}
+		}
+		return len(profileKeyOrder)
+	}
+	pairs := make([][2]*yaml.Node, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return rank(pairs[i][0].Value) < rank(pairs[j][0].Value) })
+	node.Content = node.Content[:0]
+	for _, pair := range pairs {
+		node.Content = append(node.Content, pair[0], pair[1])
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,127 @@
+package routing
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadProfiles(t *testing.T, files map[string]string) *ProfileManager {
+	t.Helper()
+	pm := writeProfiles(t, files)
+	if err := pm.LoadProfiles(); err != nil {
+		t.Fatalf("LoadProfiles: %v", err)
+	}
+	return pm
+}
+
+func TestSaveProfileWritesAndVersions(t *testing.T) {
+	pm := loadProfiles(t, map[string]string{"bike": bikeProfileYAML})
+
+	// Create from JSON; the name comes from the path
+	change, err := pm.SaveProfile("ebike", []byte(`{"extends": "bike", "version": "1.0", "settings": {"max_speed_kmh": 45}}`), ProfileCondition{IfNoneMatch: "*"})
+	if err != nil {
+		t.Fatalf("SaveProfile: %v", err)
+	}
+	if !change.Created || change.Profile.Settings.MaxSpeedKmh != 45 || change.Profile.Settings.DefaultSpeedKmh != 15 || change.Profile.Version != "1.0" {
+		t.Errorf("change = %+v, profile %+v", change, change.Profile)
+	}
+	if _, err := pm.SaveProfile("ebike", []byte(`name: ebike`), ProfileCondition{IfNoneMatch: "*"}); !errors.Is(err, ErrProfileModified) {
+		t.Errorf("second create: %v, want ErrProfileModified", err)
+	}
+
+	// A patch with an outdated ETag is refused
+	patch := []byte("version: \"1.1\"\nhighways:\n  cycleway: {speed_factor: 1.4}\n")
+	if _, err := pm.PatchProfile("ebike", patch, ProfileCondition{IfMatch: `"outdated"`}); !errors.Is(err, ErrProfileModified) {
+		t.Errorf("PatchProfile with outdated ETag: %v, want ErrProfileModified", err)
+	}
+	patched, err := pm.PatchProfile("ebike", patch, ProfileCondition{IfMatch: change.ETag})
+	if err != nil {
+		t.Fatalf("PatchProfile: %v", err)
+	}
+	if patched.Created || patched.ETag == change.ETag || patched.Profile.Version != "1.1" || patched.Profile.Highways["cycleway"].SpeedFactor != 1.4 {
+		t.Errorf("patched = %+v, profile %+v", patched, patched.Profile)
+	}
+
+	// Invalid changes leave profile and file as they are
+	if _, err := pm.PatchProfile("ebike", []byte(`settings: {max_speed_kmh: -1}`), ProfileCondition{}); !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("invalid patch: %v, want ErrInvalidProfile", err)
+	}
+	if _, err := pm.PatchProfile("bike", []byte(`settings: {default_speed_kmh: ~}`), ProfileCondition{}); !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("patch breaking ebike: %v, want ErrInvalidProfile", err)
+	}
+	if etag, _ := pm.ProfileETag("ebike"); etag != patched.ETag {
+		t.Errorf("ETag = %s after failed patch, want %s", etag, patched.ETag)
+	}
+
+	// Files on disk load to the same profiles
+	reloaded := NewProfileManager(pm.configDir)
+	if err := reloaded.LoadProfiles(); err != nil {
+		t.Fatalf("LoadProfiles: %v", err)
+	}
+	ebike, err := reloaded.GetProfile("ebike")
+	if err != nil || ebike.Version != "1.1" || ebike.Highways["cycleway"].SpeedFactor != 1.4 {
+		t.Errorf("reloaded ebike = %+v, %v", ebike, err)
+	}
+	if etag, _ := reloaded.ProfileETag("ebike"); etag != patched.ETag {
+		t.Errorf("reloaded ETag = %s, want %s", etag, patched.ETag)
+	}
+
+	// The first version is kept and can be restored
+	history, err := pm.ProfileHistory("ebike")
+	if err != nil || len(history) != 1 || history[0].Version != "1.0" || history[0].ETag != change.ETag {
+		t.Fatalf("history = %+v, %v", history, err)
+	}
+	restored, err := pm.RollbackProfile("ebike", history[0].Revision, ProfileCondition{IfMatch: patched.ETag})
+	if err != nil {
+		t.Fatalf("RollbackProfile: %v", err)
+	}
+	if restored.ETag != change.ETag || restored.Profile.Version != "1.0" || restored.Profile.Highways["cycleway"].SpeedFactor != 1.0 {
+		t.Errorf("restored = %+v, profile %+v", restored, restored.Profile)
+	}
+	if history, _ := pm.ProfileHistory("ebike"); len(history) != 2 {
+		t.Errorf("history has %d revisions after rollback, want 2", len(history))
+	}
+}
+
+func TestDeleteProfile(t *testing.T) {
+	pm := loadProfiles(t, map[string]string{"bike": bikeProfileYAML, "ebike": ebikeProfileYAML})
+
+	if err := pm.DeleteProfile("bike", ProfileCondition{}); !errors.Is(err, ErrProfileInUse) {
+		t.Errorf("deleting extended profile: %v, want ErrProfileInUse", err)
+	}
+	if err := pm.DeleteProfile("tandem", ProfileCondition{}); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("deleting unknown profile: %v, want ErrProfileNotFound", err)
+	}
+	if err := pm.DeleteProfile("ebike", ProfileCondition{}); err != nil {
+		t.Fatalf("DeleteProfile: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(pm.configDir, "ebike.yaml")); !os.IsNotExist(err) {
+		t.Errorf("profile file still exists: %v", err)
+	}
+	if err := pm.DeleteProfile("bike", ProfileCondition{}); !errors.Is(err, ErrProfileInUse) {
+		t.Errorf("deleting last profile: %v, want ErrProfileInUse", err)
+	}
+
+	// Deleted profiles can be restored from their history
+	if _, err := pm.RollbackProfile("ebike", 1, ProfileCondition{}); err != nil {
+		t.Fatalf("RollbackProfile: %v", err)
+	}
+	if _, err := pm.GetProfile("ebike"); err != nil {
+		t.Errorf("ebike not restored: %v", err)
+	}
+}
+
+func TestSaveProfileRejectsBadNames(t *testing.T) {
+	pm := loadProfiles(t, map[string]string{"bike": bikeProfileYAML})
+	for _, tt := range []struct{ name, doc string }{
+		{"../bike", `extends: bike`},
+		{"ebike", `{"name": "other", "extends": "bike"}`},
+		{"ebike", `extends: ebike`},
+	} {
+		if _, err := pm.SaveProfile(tt.name, []byte(tt.doc), ProfileCondition{}); !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("SaveProfile(%q, %s) = %v, want ErrInvalidProfile", tt.name, tt.doc, err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package routing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProfileConfigClone(t *testing.T) {
+	profile := &ProfileConfig{
+		Name:          "hilly_car",
+		Description:   "Car avoiding climbs",
+		Version:       "2",
+		Extends:       "car",
+		Settings:      Settings{MaxSpeedKmh: 120, DefaultSpeedKmh: 50},
+		Highways:      map[string]HighwayConfig{"primary": {Allowed: true, SpeedFactor: 1, Preference: 1}},
+		Surfaces:      map[string]SurfaceConfig{"gravel": {Penalty: 1.5}},
+		Features:      Features{AvoidTolls: true},
+		WeightFormula: WeightFormula{UseTime: true, DistanceWeight: 0.5, TimeWeight: 0.5},
+		Elevation:     ElevationConfig{AscentFactor: 2, DescentFactor: 0.5, MaxGrade: 8, SteepPenalty: 1.5},
+		Vehicle:       testVehicle(),
+		Limits:        SearchLimits{MaxNodes: 1000, TimeoutMs: 500},
+	}
+
+	// Every field is set, so a field Clone forgets shows up as a difference
+	fields := reflect.ValueOf(profile).Elem()
+	for i := range fields.NumField() {
+		if fields.Field(i).IsZero() {
+			t.Fatalf("Test profile does not set %s", fields.Type().Field(i).Name)
+		}
+	}
+
+	clone := profile.Clone()
+	if !reflect.DeepEqual(clone, profile) {
+		t.Errorf("Clone = %+v, want %+v", clone, profile)
+	}
+
+	clone.Highways["primary"] = HighwayConfig{}
+	clone.Surfaces["gravel"] = SurfaceConfig{}
+	clone.Vehicle.StopPenalty = 1
+	if profile.Highways["primary"].SpeedFactor != 1 || profile.Surfaces["gravel"].Penalty != 1.5 || profile.Vehicle.StopPenalty != 0.05 {
+		t.Error("Changing the clone changed the original profile")
+	}
+}
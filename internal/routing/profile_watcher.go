@@ -0,0 +1,139 @@
+package routing
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// profileSettleDelay is how long the watcher waits for further file events
+// before reloading, so an editor saving a file in several steps causes one reload
+const profileSettleDelay = 250 * time.Millisecond
+
+// Watch reloads the profiles whenever the YAML files in the profile directory
+// change and calls onReload after each successful reload. It is notified by
+// the file system (inotify on Linux) and polls every pollInterval instead if
+// poll is set or notifications are unavailable, e.g. on network file systems.
+// It returns a function that stops watching.
+func (pm *ProfileManager) Watch(pollInterval time.Duration, poll bool, onReload func()) func() {
+	var watcher *fsnotify.Watcher
+	if !poll {
+		var err error
+		if watcher, err = fsnotify.NewWatcher(); err == nil {
+			if err = watcher.Add(pm.configDir); err != nil {
+				watcher.Close()
+				watcher = nil
+			}
+		}
+		if err != nil {
+			log.Printf("Warning: Cannot watch profile directory %s, polling every %v: %v", pm.configDir, pollInterval, err)
+		}
+	}
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	var ticks <-chan time.Time
+	var ticker *time.Ticker
+	if watcher != nil {
+		events, errs = watcher.Events, watcher.Errors
+		pm.setWatchMode("fsnotify")
+	} else {
+		ticker = time.NewTicker(pollInterval)
+		ticks = ticker.C
+		pm.setWatchMode("polling")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		if watcher != nil {
+			defer watcher.Close()
+		} else {
+			defer ticker.Stop()
+		}
+		defer pm.setWatchMode("off")
+
+		var settle <-chan time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-events:
+				if !ok {
+					events = nil
+				} else if watchedProfileFile(event.Name) {
+					settle = time.After(profileSettleDelay)
+				}
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+				} else {
+					log.Printf("Warning: Profile watcher: %v", err)
+				}
+			case <-settle:
+				settle = nil
+				pm.reloadIfChanged(onReload)
+			case <-ticks:
+				pm.reloadIfChanged(onReload)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// watchedProfileFile reports whether a change to a file in the profile
+// directory may change the profiles. Besides YAML files this includes the
+// symlinks through which e.g. Kubernetes ConfigMaps swap files, but not the
+// temporary files and history written by the profile API.
+func watchedProfileFile(path string) bool {
+	name := filepath.Base(path)
+	return name != ".history" && !strings.Contains(name, ".tmp-")
+}
+
+// reloadIfChanged reloads the profiles if the YAML files differ from those last read
+func (pm *ProfileManager) reloadIfChanged(onReload func()) {
+	if !pm.changedOnDisk() {
+		return
+	}
+	if err := pm.Reload(); err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	if onReload != nil {
+		onReload()
+	}
+}
+
+// changedOnDisk reports whether the YAML files in the profile directory
+// differ from those last read, by contents
+func (pm *ProfileManager) changedOnDisk() bool {
+	files, err := filepath.Glob(filepath.Join(pm.configDir, "*.yaml"))
+	if err != nil {
+		return false
+	}
+
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	if len(files) != len(pm.files) {
+		return true
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil || pm.files[file] != profileETag(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// setWatchMode records how the profile directory is watched
+func (pm *ProfileManager) setWatchMode(mode string) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	pm.status.Watch = mode
+}
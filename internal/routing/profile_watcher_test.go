@@ -0,0 +1,82 @@
+package routing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadKeepsProfilesOnFailure(t *testing.T) {
+	pm := loadProfiles(t, map[string]string{"bike": bikeProfileYAML, "ebike": ebikeProfileYAML})
+	path := filepath.Join(pm.configDir, "ebike.yaml")
+
+	if err := os.WriteFile(path, []byte("name: ebike\nextends: bike\nsettings: {max_speed_kmh: -5}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.Reload(); err == nil {
+		t.Fatalf("Reload succeeded with a broken profile")
+	}
+	ebike, err := pm.GetProfile("ebike")
+	if err != nil || ebike.Settings.MaxSpeedKmh != 45 {
+		t.Errorf("ebike = %+v, %v after failed reload, want the loaded profile", ebike, err)
+	}
+	status := pm.Status()
+	if status.LastError == "" || status.Failures[path] == "" || len(status.Profiles) != 2 {
+		t.Errorf("status = %+v, want the failure of %s", status, path)
+	}
+
+	if err := os.WriteFile(path, []byte("name: ebike\nextends: bike\nsettings: {max_speed_kmh: 40}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if ebike, _ := pm.GetProfile("ebike"); ebike.Settings.MaxSpeedKmh != 40 {
+		t.Errorf("ebike max speed = %v, want 40", ebike.Settings.MaxSpeedKmh)
+	}
+	if status := pm.Status(); status.LastError != "" || len(status.Failures) != 0 {
+		t.Errorf("status = %+v after successful reload", status)
+	}
+}
+
+func TestWatchReloadsProfiles(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		pm := loadProfiles(t, map[string]string{"bike": bikeProfileYAML})
+		reloaded := make(chan struct{}, 10)
+		stop := pm.Watch(20*time.Millisecond, poll, func() { reloaded <- struct{}{} })
+
+		if mode := pm.Status().Watch; (poll && mode != "polling") || (!poll && mode != "fsnotify") {
+			t.Errorf("poll %v: watch mode %q", poll, mode)
+		}
+		if err := os.WriteFile(filepath.Join(pm.configDir, "ebike.yaml"), []byte(ebikeProfileYAML), 0644); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-reloaded:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("poll %v: profiles not reloaded", poll)
+		}
+		if _, err := pm.GetProfile("ebike"); err != nil {
+			t.Errorf("poll %v: %v", poll, err)
+		}
+
+		// Broken files are reported and leave the profiles as they are
+		if err := os.WriteFile(filepath.Join(pm.configDir, "bike.yaml"), []byte("name: bike\nsettings: ["), 0644); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for pm.Status().LastError == "" && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if status := pm.Status(); status.LastError == "" || len(status.Profiles) != 2 {
+			t.Errorf("poll %v: status = %+v, want the failure and both profiles", poll, status)
+		}
+		select {
+		case <-reloaded:
+			t.Errorf("poll %v: reloaded after a broken change", poll)
+		default:
+		}
+		stop()
+	}
+}
@@ -11,6 +11,13 @@ type RouteOptions struct {
 
 	// Speed overrides
 	MaxSpeed *float64 `json:"max_speed,omitempty"` // km/h
+
+	// Weighting override ("eco" to minimise consumption)
+	Weighting *string `json:"weighting,omitempty"`
+
+	// Search budget overrides
+	MaxNodes  *int `json:"max_nodes,omitempty"`
+	TimeoutMs *int `json:"timeout_ms,omitempty"`
 }
 
 // ApplyOptions applies route options to a profile (modifies the profile)
@@ -40,6 +47,19 @@ func (p *ProfileConfig) ApplyOptions(opts *RouteOptions) {
 	if opts.MaxSpeed != nil && *opts.MaxSpeed > 0 {
 		p.Settings.MaxSpeedKmh = *opts.MaxSpeed
 	}
+
+	// Apply weighting override
+	if opts.Weighting != nil {
+		p.WeightFormula.Mode = *opts.Weighting
+	}
+
+	// Apply search budget overrides
+	if opts.MaxNodes != nil && *opts.MaxNodes > 0 {
+		p.Limits.MaxNodes = *opts.MaxNodes
+	}
+	if opts.TimeoutMs != nil && *opts.TimeoutMs > 0 {
+		p.Limits.TimeoutMs = *opts.TimeoutMs
+	}
 }
 
 // GetEffectiveProfile returns a profile with options applied
@@ -0,0 +1,181 @@
+package routing
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// WeightModeEco makes the router minimise estimated fuel/energy consumption
+const WeightModeEco = "eco"
+
+// Fuel types supported by the vehicle model
+const (
+	FuelPetrol   = "petrol"
+	FuelDiesel   = "diesel"
+	FuelElectric = "electric"
+)
+
+// Default CO2 emissions in grams per liter (fuels) or kWh (electricity)
+var defaultCO2PerUnit = map[string]float64{
+	FuelPetrol:   2310,
+	FuelDiesel:   2650,
+	FuelElectric: 0,
+}
+
+// ConsumptionPoint is the consumption per 100 km when driving at a constant speed
+type ConsumptionPoint struct {
+	SpeedKmh    float64 `yaml:"speed_kmh" json:"speed_kmh"`
+	Consumption float64 `yaml:"consumption" json:"consumption"`
+}
+
+// VehicleModel estimates fuel or energy consumption of a vehicle.
+// Consumption is expressed in liters for fuels and kWh for electric vehicles.
+type VehicleModel struct {
+	FuelType          string             `yaml:"fuel_type" json:"fuel_type"`                   // petrol, diesel or electric
+	SpeedCurve        []ConsumptionPoint `yaml:"speed_curve" json:"speed_curve"`               // Consumption per 100 km by speed
+	StopPenalty       float64            `yaml:"stop_penalty" json:"stop_penalty"`             // Extra consumption per stop at traffic signals
+	AscentConsumption float64            `yaml:"ascent_consumption" json:"ascent_consumption"` // Extra consumption per meter climbed
+	DescentRecovery   float64            `yaml:"descent_recovery" json:"descent_recovery"`     // Consumption saved per meter descended
+	CO2PerUnit        float64            `yaml:"co2_per_unit" json:"co2_per_unit"`             // Grams of CO2 per liter or kWh (0 = fuel default)
+}
+
+// Validate checks the vehicle model and sorts its speed curve
+func (v *VehicleModel) Validate() error {
+	if _, known := defaultCO2PerUnit[v.FuelType]; !known {
+		return fmt.Errorf("unknown fuel_type %q (expected petrol, diesel or electric)", v.FuelType)
+	}
+	if len(v.SpeedCurve) == 0 {
+		return fmt.Errorf("speed_curve needs at least one point")
+	}
+	for _, point := range v.SpeedCurve {
+		if point.SpeedKmh < 0 || point.Consumption <= 0 {
+			return fmt.Errorf("speed_curve points need a non-negative speed and positive consumption")
+		}
+	}
+	if v.StopPenalty < 0 || v.AscentConsumption < 0 || v.DescentRecovery < 0 || v.CO2PerUnit < 0 {
+		return fmt.Errorf("vehicle penalties and co2_per_unit must not be negative")
+	}
+
+	sort.Slice(v.SpeedCurve, func(i, j int) bool {
+		return v.SpeedCurve[i].SpeedKmh < v.SpeedCurve[j].SpeedKmh
+	})
+	return nil
+}
+
+// Unit returns the consumption unit of the vehicle
+func (v *VehicleModel) Unit() string {
+	if v.FuelType == FuelElectric {
+		return "kWh"
+	}
+	return "l"
+}
+
+// ConsumptionAt returns the consumption per 100 km at a constant speed (linear interpolation)
+func (v *VehicleModel) ConsumptionAt(speedKmh float64) float64 {
+	curve := v.SpeedCurve
+	if len(curve) == 0 {
+		return 0
+	}
+	if speedKmh <= curve[0].SpeedKmh {
+		return curve[0].Consumption
+	}
+	for i := 1; i < len(curve); i++ {
+		if speedKmh <= curve[i].SpeedKmh {
+			lo, hi := curve[i-1], curve[i]
+			t := (speedKmh - lo.SpeedKmh) / (hi.SpeedKmh - lo.SpeedKmh)
+			return lo.Consumption + t*(hi.Consumption-lo.Consumption)
+		}
+	}
+	return curve[len(curve)-1].Consumption
+}
+
+// MinConsumptionPerMeter returns the lowest consumption per meter on the speed curve
+func (v *VehicleModel) MinConsumptionPerMeter() float64 {
+	min := 0.0
+	for i, point := range v.SpeedCurve {
+		if i == 0 || point.Consumption < min {
+			min = point.Consumption
+		}
+	}
+	return min / 100000
+}
+
+// SegmentConsumption estimates the consumption of driving a segment.
+// The result never drops below zero, even on long descents.
+func (v *VehicleModel) SegmentConsumption(length, speedKmh, elevationChange float64, stop bool) float64 {
+	consumption := v.ConsumptionAt(speedKmh) * length / 100000
+
+	if stop {
+		consumption += v.StopPenalty
+	}
+
+	if elevationChange > 0 {
+		consumption += elevationChange * v.AscentConsumption
+	} else {
+		consumption += elevationChange * v.DescentRecovery
+	}
+
+	if consumption < 0 {
+		return 0
+	}
+	return consumption
+}
+
+// CO2 returns the grams of CO2 emitted for the given consumption
+func (v *VehicleModel) CO2(consumption float64) float64 {
+	perUnit := v.CO2PerUnit
+	if perUnit == 0 {
+		perUnit = defaultCO2PerUnit[v.FuelType]
+	}
+	return consumption * perUnit
+}
+
+// Clone creates a deep copy of the vehicle model
+func (v *VehicleModel) Clone() *VehicleModel {
+	clone := *v
+	clone.SpeedCurve = append([]ConsumptionPoint(nil), v.SpeedCurve...)
+	return &clone
+}
+
+// EstimateConsumption sums the consumption of a vehicle along a path of node IDs.
+// maxSpeed (m/s) caps the edge speeds like the routing profile does; 0 disables the cap.
+func EstimateConsumption(g *graph.Graph, nodes []int64, vehicle *VehicleModel, maxSpeed float64) float64 {
+	total := 0.0
+	for i := 0; i < len(nodes)-1; i++ {
+		edge, exists := g.EdgeBetween(nodes[i], nodes[i+1])
+		if !exists {
+			continue
+		}
+		length, climb := segmentGeometry(g, &edge)
+		if !g.HasElevation() {
+			climb = 0
+		}
+		speed := segmentSpeed(&edge, maxSpeed) * 3.6
+		total += vehicle.SegmentConsumption(length, speed, climb, g.HasTrafficSignal(edge.To))
+	}
+	return total
+}
+
+// segmentGeometry returns the length (m) and elevation change (m) of an edge
+func segmentGeometry(g *graph.Graph, edge *graph.Edge) (float64, float64) {
+	from, errFrom := g.GetNode(edge.From)
+	to, errTo := g.GetNode(edge.To)
+	if errFrom != nil || errTo != nil {
+		return edge.Weight, 0
+	}
+	return graph.HaversineDistance(from.Lat, from.Lon, to.Lat, to.Lon), graph.ElevationChange(from.Elevation, to.Elevation)
+}
+
+// segmentSpeed returns the expected travel speed (m/s) on an edge, capped by maxSpeed
+func segmentSpeed(edge *graph.Edge, maxSpeed float64) float64 {
+	speed := edge.MaxSpeed
+	if speed <= 0 {
+		speed = 13.89 // ~50 km/h
+	}
+	if maxSpeed > 0 && speed > maxSpeed {
+		speed = maxSpeed
+	}
+	return speed
+}
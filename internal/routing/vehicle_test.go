@@ -0,0 +1,156 @@
+package routing
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+func testVehicle() *VehicleModel {
+	return &VehicleModel{
+		FuelType: FuelPetrol,
+		SpeedCurve: []ConsumptionPoint{
+			{SpeedKmh: 90, Consumption: 5.5},
+			{SpeedKmh: 20, Consumption: 9.0},
+			{SpeedKmh: 50, Consumption: 6.0},
+		},
+		StopPenalty:     0.05,
+		DescentRecovery: 0.001,
+	}
+}
+
+func TestVehicleModelConsumption(t *testing.T) {
+	v := testVehicle()
+	if err := v.Validate(); err != nil {
+		t.Fatalf("Invalid vehicle: %v", err)
+	}
+
+	if got := v.ConsumptionAt(35); math.Abs(got-7.5) > 1e-9 {
+		t.Errorf("Expected interpolated 7.5 l/100km at 35 km/h, got %.3f", got)
+	}
+	if got := v.ConsumptionAt(130); got != 5.5 {
+		t.Errorf("Expected curve to clamp at 5.5, got %.3f", got)
+	}
+
+	base := v.SegmentConsumption(1000, 50, 0, false)
+	if math.Abs(base-0.06) > 1e-9 {
+		t.Errorf("Expected 0.06 l for 1 km at 50 km/h, got %.4f", base)
+	}
+	if got := v.SegmentConsumption(1000, 50, 0, true); math.Abs(got-base-0.05) > 1e-9 {
+		t.Errorf("Expected stop penalty to be added, got %.4f", got)
+	}
+	if got := v.SegmentConsumption(100, 50, -500, false); got != 0 {
+		t.Errorf("Expected consumption to be clamped at zero on descents, got %.4f", got)
+	}
+	if got := v.CO2(1); got != 2310 {
+		t.Errorf("Expected default petrol CO2 of 2310 g/l, got %.1f", got)
+	}
+}
+
+// createDiamondGraph creates two one-way roads from node 1 to node 4: a short
+// one via node 2 (with traffic signals) and a slightly longer one via node 3
+func createDiamondGraph() *graph.Graph {
+	g := graph.NewGraph()
+	g.AddNode(&graph.Node{ID: 1, Lat: 43.0, Lon: 7.0})
+	g.AddNode(&graph.Node{ID: 2, Lat: 43.001, Lon: 7.01})
+	g.AddNode(&graph.Node{ID: 3, Lat: 42.998, Lon: 7.01})
+	g.AddNode(&graph.Node{ID: 4, Lat: 43.0, Lon: 7.02})
+	g.AddTrafficSignal(2)
+
+	addRoad := func(from, to, way int64) {
+		a, _ := g.GetNode(from)
+		b, _ := g.GetNode(to)
+		distance := graph.HaversineDistance(a.Lat, a.Lon, b.Lat, b.Lon)
+		g.AddEdge(graph.Edge{From: from, To: to, Weight: distance, OSMWayID: way, MaxSpeed: 13.89, Tags: map[string]string{"highway": "primary"}})
+	}
+	addRoad(1, 2, 10)
+	addRoad(2, 4, 10)
+	addRoad(1, 3, 20)
+	addRoad(3, 4, 20)
+	return g
+}
+
+func TestEcoRouteAvoidsTrafficSignals(t *testing.T) {
+	g := createDiamondGraph()
+	router := NewRouter(g)
+	shortest, err := router.FindRouteWithProfile(context.Background(), 43.0, 7.0, 43.0, 7.02, CarProfile)
+	if err != nil {
+		t.Fatalf("Expected route, got error: %v", err)
+	}
+	if shortest.Nodes[1] != 2 {
+		t.Fatalf("Expected shortest route via node 2, got %v", shortest.Nodes)
+	}
+
+	vehicle := testVehicle()
+	if err := vehicle.Validate(); err != nil {
+		t.Fatalf("Invalid vehicle: %v", err)
+	}
+	eco := CarProfile
+	eco.Weighting = WeightModeEco
+	eco.Vehicle = vehicle
+
+	route, err := router.FindRouteWithProfile(context.Background(), 43.0, 7.0, 43.0, 7.02, eco)
+	if err != nil {
+		t.Fatalf("Expected eco route, got error: %v", err)
+	}
+	if route.Nodes[1] != 3 {
+		t.Errorf("Expected eco route to avoid the signal at node 2, got %v", route.Nodes)
+	}
+
+	// The distance is the length of the road, not the consumption weight
+	length := 0.0
+	for i := 0; i+1 < len(route.Nodes); i++ {
+		a, _ := g.GetNode(route.Nodes[i])
+		b, _ := g.GetNode(route.Nodes[i+1])
+		length += graph.HaversineDistance(a.Lat, a.Lon, b.Lat, b.Lon)
+	}
+	if math.Abs(route.Distance-length) > 1e-6 || route.Weight <= route.Distance {
+		t.Errorf("Expected distance %.1f below the eco weight, got distance %.1f and weight %.1f", length, route.Distance, route.Weight)
+	}
+
+	if EstimateConsumption(g, route.Nodes, vehicle, 0) >= EstimateConsumption(g, shortest.Nodes, vehicle, 0) {
+		t.Errorf("Expected eco route to consume less than the shortest route")
+	}
+}
+
+func TestEcoRouteDownhillDetourLoses(t *testing.T) {
+	// A flat direct road from node 1 to node 3, and a longer detour that
+	// descends steeply to node 2 before climbing back to the destination
+	g := graph.NewGraph()
+	g.AddNode(&graph.Node{ID: 1, Lat: 43.0, Lon: 7.0})
+	g.AddNode(&graph.Node{ID: 2, Lat: 43.0027, Lon: 7.011})
+	g.AddNode(&graph.Node{ID: 3, Lat: 43.0, Lon: 7.0123})
+	for id, elevation := range map[int64]float64{1: 100, 2: 0, 3: 100} {
+		if err := g.SetElevation(id, elevation); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addRoad := func(from, to, way int64) {
+		a, _ := g.GetNode(from)
+		b, _ := g.GetNode(to)
+		distance := graph.HaversineDistance(a.Lat, a.Lon, b.Lat, b.Lon)
+		g.AddEdge(graph.Edge{From: from, To: to, Weight: distance, OSMWayID: way, MaxSpeed: 13.89, Tags: map[string]string{"highway": "primary"}})
+	}
+	addRoad(1, 3, 10)
+	addRoad(1, 2, 20)
+	addRoad(2, 3, 20)
+
+	vehicle := testVehicle()
+	vehicle.DescentRecovery = 0.01
+	if err := vehicle.Validate(); err != nil {
+		t.Fatalf("Invalid vehicle: %v", err)
+	}
+	eco := CarProfile
+	eco.Weighting = WeightModeEco
+	eco.Vehicle = vehicle
+
+	route, err := NewRouter(g).FindRouteWithProfile(context.Background(), 43.0, 7.0, 43.0, 7.0123, eco)
+	if err != nil {
+		t.Fatalf("Expected eco route, got error: %v", err)
+	}
+	if len(route.Nodes) != 2 || route.Nodes[1] != 3 {
+		t.Errorf("Expected the direct road, got %v", route.Nodes)
+	}
+}
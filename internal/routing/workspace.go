@@ -0,0 +1,336 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// search is the state of a single route search: the profile, the graph
+// snapshot, its budget and a pooled workspace. Searches never modify the
+// router, so searches with different profiles can run concurrently.
+type search struct {
+	r       *Router
+	profile *RoutingProfile
+	x       *graph.Index
+	ws      *workspace
+	pool    *workspacePool // Pool the workspace is returned to
+	closed  ClosureChecker // Closures in effect when the search started
+	traffic SpeedProvider  // Live speeds in effect when the search started
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	maxNodes int
+	explored int // Nodes settled so far
+}
+
+// newSearch prepares a search of the current graph snapshot with a profile.
+// The search ends with ctx or when the time limit of the profile runs out,
+// which also bounds the wait for a workspace. Call release when done so the
+// workspace can be reused.
+func (r *Router) newSearch(ctx context.Context, profile RoutingProfile) (*search, error) {
+	s := &search{
+		r:        r,
+		profile:  &profile,
+		x:        r.graph.Index(),
+		pool:     r.pool,
+		maxNodes: profile.Limits.MaxNodes,
+	}
+	if r.closures != nil {
+		s.closed = r.closures.Closures()
+	}
+	if r.traffic != nil {
+		s.traffic = r.traffic.Speeds()
+	}
+	if s.maxNodes <= 0 {
+		s.maxNodes = DefaultMaxNodes
+	}
+	if timeout := profile.Limits.Timeout(); timeout > 0 {
+		s.ctx, s.cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		s.ctx, s.cancel = context.WithCancel(ctx)
+	}
+
+	ws, err := s.pool.acquire(s.ctx)
+	if err != nil {
+		s.cancel()
+		return nil, fmt.Errorf("%w while waiting for a free workspace: %w", ErrSearchAborted, err)
+	}
+	s.ws = ws
+	return s, nil
+}
+
+// explore counts a settled node against the budget of the search. It returns
+// an error wrapping ErrSearchAborted once the node budget is used up or the
+// context is done. The context is checked on the first and then every 256th node.
+func (s *search) explore() error {
+	s.explored++
+	if s.explored > s.maxNodes {
+		return fmt.Errorf("%w: node budget of %d exhausted", ErrSearchAborted, s.maxNodes)
+	}
+	if s.explored%256 == 1 {
+		if err := s.ctx.Err(); err != nil {
+			return fmt.Errorf("%w after %d nodes: %w", ErrSearchAborted, s.explored, err)
+		}
+	}
+	return nil
+}
+
+// release ends the search and returns its workspace to the pool
+func (s *search) release() {
+	s.cancel()
+	s.pool.release(s.ws)
+	s.ws = nil
+}
+
+// workspace holds the arrays and heaps of a search. Workspaces are pooled and
+// keep the size of the largest graph they have searched.
+type workspace struct {
+	forward  labels
+	backward labels
+	nodes    labels // Nodes settled in any state
+	open     queue
+	backOpen queue
+	edges    []graph.IndexedEdge
+
+	// Searches inside overlay cells
+	inner     labels
+	innerOpen queue
+	local     []int32 // Cell-local index of each node, -1 outside the current cell
+	arcs      []arc
+}
+
+// workspacePool keeps idle workspaces for reuse and limits how many searches
+// hold one at a time. Workspace arrays are sized by the graph, not by the area
+// a search explores: a unidirectional search keeps labels and queue items of
+// its edge-based states (about 52 bytes per edge) plus 20 bytes per node, a
+// bidirectional search about 104 bytes per node. On a continental graph that
+// is gigabytes per search in progress, so the limit bounds search memory.
+// Unlike a sync.Pool, idle workspaces survive garbage collection; as many as
+// the limit (or GOMAXPROCS without one) are kept.
+type workspacePool struct {
+	mutex sync.Mutex
+	idle  []*workspace
+	slots chan struct{} // One token per search in progress, nil without a limit
+}
+
+// newWorkspacePool creates a pool for at most limit concurrent searches (0 = no limit)
+func newWorkspacePool(limit int) *workspacePool {
+	p := &workspacePool{}
+	if limit > 0 {
+		p.slots = make(chan struct{}, limit)
+	}
+	return p
+}
+
+// acquire waits until a search may start and returns its workspace
+func (p *workspacePool) acquire(ctx context.Context) (*workspace, error) {
+	if p.slots != nil {
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return p.get(), nil
+}
+
+// release returns the workspace of a search started with acquire
+func (p *workspacePool) release(ws *workspace) {
+	p.put(ws)
+	if p.slots != nil {
+		<-p.slots
+	}
+}
+
+// get returns an idle or new workspace without taking a slot, for work that
+// runs on a bounded number of goroutines such as overlay customization
+func (p *workspacePool) get() *workspace {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if n := len(p.idle); n > 0 {
+		ws := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		return ws
+	}
+	return new(workspace)
+}
+
+// put makes a workspace idle, or drops it if enough workspaces are idle
+func (p *workspacePool) put(ws *workspace) {
+	clear(ws.edges[:cap(ws.edges)]) // Do not keep tag maps of old snapshots alive
+	ws.edges = ws.edges[:0]
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.idle) < max(cap(p.slots), runtime.GOMAXPROCS(0)) {
+		p.idle = append(p.idle, ws)
+	}
+}
+
+// labels are the scores of a search over dense indices. Instead of clearing
+// the arrays, reset starts a new generation; entries stamped with an older
+// generation count as unset.
+type labels struct {
+	gen     uint32
+	reached []uint32 // Generation an index was reached in
+	settled []uint32 // Generation an index was settled in
+	score   []float64
+	parent  []uint32
+}
+
+// reset prepares the labels for a new search over n indices
+func (l *labels) reset(n int) {
+	if len(l.reached) < n {
+		l.reached = make([]uint32, n)
+		l.settled = make([]uint32, n)
+		l.score = make([]float64, n)
+		l.parent = make([]uint32, n)
+		l.gen = 0
+	}
+	l.gen++
+	if l.gen == 0 {
+		// The generation wrapped around, so stale stamps could match again
+		clear(l.reached)
+		clear(l.settled)
+		l.gen = 1
+	}
+}
+
+// get returns the score of an index if it was reached in this search
+func (l *labels) get(i uint32) (float64, bool) {
+	if l.reached[i] != l.gen {
+		return 0, false
+	}
+	return l.score[i], true
+}
+
+// set records the score of an index and the index it was reached from
+func (l *labels) set(i uint32, score float64, parent uint32) {
+	l.reached[i] = l.gen
+	l.score[i] = score
+	l.parent[i] = parent
+}
+
+// settle marks an index as settled and reports whether it was not already
+func (l *labels) settle(i uint32) bool {
+	if l.settled[i] == l.gen {
+		return false
+	}
+	l.settled[i] = l.gen
+	return true
+}
+
+// isSettled reports whether an index was settled in this search
+func (l *labels) isSettled(i uint32) bool {
+	return l.settled[i] == l.gen
+}
+
+// item is the queue entry of a search state
+type item struct {
+	node     uint32 // Node index
+	state    uint32 // Search state, the key of the item in its queue
+	index    int32  // Position in the heap, -1 once popped
+	way      int64  // OSM way the node was reached by (0 for none)
+	priority float64
+}
+
+// queue is an indexed binary min-heap of search states. Items live in a slice
+// keyed by state and the heap orders state numbers, with item.index tracking
+// where a state sits. A state is queued at most once: finding a cheaper path
+// to it lowers its priority in place (decrease-key). Callers know from their
+// labels whether a state is queued, which it is from being reached until it
+// is settled.
+type queue struct {
+	heap  []uint32
+	items []item
+}
+
+// reset empties the queue for a search over n states
+func (q *queue) reset(n int) {
+	q.heap = q.heap[:0]
+	if len(q.items) < n {
+		q.items = make([]item, n)
+	}
+}
+
+// len returns the number of queued states
+func (q *queue) len() int {
+	return len(q.heap)
+}
+
+// min returns the lowest priority in the queue, or +Inf if it is empty
+func (q *queue) min() float64 {
+	if len(q.heap) == 0 {
+		return math.Inf(1)
+	}
+	return q.items[q.heap[0]].priority
+}
+
+// push queues a state that is not queued yet
+func (q *queue) push(it item) {
+	it.index = int32(len(q.heap))
+	q.items[it.state] = it
+	q.heap = append(q.heap, it.state)
+	q.up(int(it.index))
+}
+
+// decrease replaces the item of a queued state with one of lower priority
+func (q *queue) decrease(it item) {
+	it.index = q.items[it.state].index
+	q.items[it.state] = it
+	q.up(int(it.index))
+}
+
+// pop removes and returns the item with the lowest priority
+func (q *queue) pop() item {
+	last := len(q.heap) - 1
+	q.swap(0, last)
+	top := &q.items[q.heap[last]]
+	top.index = -1
+	q.heap = q.heap[:last]
+	q.down(0)
+	return *top
+}
+
+func (q *queue) less(i, j int) bool {
+	return q.items[q.heap[i]].priority < q.items[q.heap[j]].priority
+}
+
+func (q *queue) swap(i, j int) {
+	q.heap[i], q.heap[j] = q.heap[j], q.heap[i]
+	q.items[q.heap[i]].index = int32(i)
+	q.items[q.heap[j]].index = int32(j)
+}
+
+func (q *queue) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !q.less(i, parent) {
+			break
+		}
+		q.swap(i, parent)
+		i = parent
+	}
+}
+
+func (q *queue) down(i int) {
+	for n := len(q.heap); ; {
+		child := 2*i + 1
+		if child >= n {
+			break
+		}
+		if right := child + 1; right < n && q.less(right, child) {
+			child = right
+		}
+		if !q.less(child, i) {
+			break
+		}
+		q.swap(i, child)
+		i = child
+	}
+}
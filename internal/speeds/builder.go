@@ -0,0 +1,157 @@
+package speeds
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Directions of a probe record
+const (
+	DirectionBoth     = ""
+	DirectionForward  = "forward"  // Along the node order of the way
+	DirectionBackward = "backward" // Against the node order of the way
+)
+
+// fallbackWindow is how many neighbouring buckets on each side are pooled
+// when a bucket has too few samples of its own (1 hour)
+const fallbackWindow = 60 / BucketMinutes
+
+// maxSpeedKmh is the largest speed a profile can hold
+const maxSpeedKmh = math.MaxUint8
+
+// accumulator collects the samples of one road direction. Speeds are averaged
+// harmonically (by summing pace) so that the result reflects travel times.
+type accumulator struct {
+	pace  [BucketsPerWeek]float64 // Sum of 1/speed
+	count [BucketsPerWeek]uint32
+}
+
+// Builder aggregates probe records into weekly speed profiles
+type Builder struct {
+	location *time.Location
+	acc      map[Key]*accumulator
+	records  int
+}
+
+// NewBuilder creates a builder that buckets probe timestamps in the given time zone
+func NewBuilder(location *time.Location) *Builder {
+	if location == nil {
+		location = time.UTC
+	}
+	return &Builder{
+		location: location,
+		acc:      make(map[Key]*accumulator),
+	}
+}
+
+// Records returns the number of probe records added so far
+func (b *Builder) Records() int {
+	return b.records
+}
+
+// Add records a probe speed. Records without direction count for both directions.
+func (b *Builder) Add(rec Record) error {
+	if err := rec.Validate(); err != nil {
+		return err
+	}
+
+	bucket := Bucket(rec.Timestamp.In(b.location))
+	add := func(key Key) {
+		acc, ok := b.acc[key]
+		if !ok {
+			acc = &accumulator{}
+			b.acc[key] = acc
+		}
+		acc.pace[bucket] += 1 / rec.SpeedKmh
+		acc.count[bucket]++
+	}
+
+	if rec.Direction != DirectionBackward {
+		add(Key{WayID: rec.WayID})
+	}
+	if rec.Direction != DirectionForward {
+		add(Key{WayID: rec.WayID, Reverse: true})
+	}
+	b.records++
+	return nil
+}
+
+// Build computes the profiles. Buckets with fewer than minSamples samples pool
+// their neighbours up to an hour away, then the whole week; road directions
+// with fewer than minSamples samples in total get no profile.
+func (b *Builder) Build(minSamples int) *Profiles {
+	if minSamples < 1 {
+		minSamples = 1
+	}
+
+	profiles := New(b.location)
+	for key, acc := range b.acc {
+		var weekPace float64
+		var weekCount uint32
+		for i := range acc.count {
+			weekPace += acc.pace[i]
+			weekCount += acc.count[i]
+		}
+		if weekCount < uint32(minSamples) {
+			continue
+		}
+
+		profile := &Profile{}
+		for i := range profile {
+			pace, count := acc.pace[i], acc.count[i]
+			for d := 1; d <= fallbackWindow && count < uint32(minSamples); d++ {
+				for _, j := range []int{i - d, i + d} {
+					j = (j + BucketsPerWeek) % BucketsPerWeek // The week wraps around
+					pace += acc.pace[j]
+					count += acc.count[j]
+				}
+			}
+			if count < uint32(minSamples) {
+				pace, count = weekPace, weekCount
+			}
+			profile[i] = encodeSpeed(float64(count) / pace)
+		}
+		profiles.Set(key, profile)
+	}
+	return profiles
+}
+
+// encodeSpeed rounds a speed to whole km/h within the range of a profile
+func encodeSpeed(kmh float64) uint8 {
+	rounded := math.Round(kmh)
+	if rounded < 1 {
+		return 1
+	}
+	if rounded > maxSpeedKmh {
+		return maxSpeedKmh
+	}
+	return uint8(rounded)
+}
+
+// Record is a map-matched probe measurement
+type Record struct {
+	WayID     int64
+	Direction string
+	Timestamp time.Time
+	SpeedKmh  float64
+}
+
+// Validate checks that the record is usable for aggregation
+func (r *Record) Validate() error {
+	if r.WayID == 0 {
+		return fmt.Errorf("record needs a way_id")
+	}
+	switch r.Direction {
+	case DirectionBoth, DirectionForward, DirectionBackward:
+	default:
+		return fmt.Errorf("invalid direction %q (expected forward or backward)", r.Direction)
+	}
+	if r.Timestamp.IsZero() {
+		return fmt.Errorf("record needs a timestamp")
+	}
+	if r.SpeedKmh <= 0 || math.IsInf(r.SpeedKmh, 0) || math.IsNaN(r.SpeedKmh) {
+		return fmt.Errorf("speed_kmh must be positive")
+	}
+	return nil
+}
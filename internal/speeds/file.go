@@ -0,0 +1,164 @@
+package speeds
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/vamosdalian/nav/internal/atomicfile"
+)
+
+const (
+	// Sidecar file magic number and version
+	magicNumber   uint32 = 0x4E415653 // "NAVS" in hex
+	formatVersion uint32 = 1
+)
+
+// SidecarPath returns the default profile file stored next to a graph file
+func SidecarPath(graphPath string) string {
+	return graphPath + ".speeds"
+}
+
+// Save writes the profiles to path, replacing any existing file atomically
+func (p *Profiles) Save(path string) error {
+	var encodeErr error
+	err := atomicfile.Write(path, func(w io.Writer) error {
+		bufWriter := bufio.NewWriterSize(w, 1024*1024)
+		snappyWriter := snappy.NewBufferedWriter(bufWriter)
+		if encodeErr = p.Encode(snappyWriter); encodeErr == nil {
+			encodeErr = snappyWriter.Close()
+		}
+		if encodeErr != nil {
+			return encodeErr
+		}
+		return bufWriter.Flush()
+	})
+	if encodeErr != nil {
+		return fmt.Errorf("failed to encode speed profiles: %w", encodeErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write speed profiles: %w", err)
+	}
+	return nil
+}
+
+// Load reads profiles written by Save
+func Load(path string) (*Profiles, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	profiles, err := Decode(snappy.NewReader(bufio.NewReader(file)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode speed profiles: %w", err)
+	}
+	return profiles, nil
+}
+
+// Encode writes the header followed by the profiles sorted by key, uncompressed.
+// Save and graph file sections compress the output.
+func (p *Profiles) Encode(w io.Writer) error {
+	keys := make([]Key, 0, len(p.profiles))
+	for key := range p.profiles {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].WayID != keys[j].WayID {
+			return keys[i].WayID < keys[j].WayID
+		}
+		return !keys[i].Reverse && keys[j].Reverse
+	})
+
+	zone := p.location.String()
+	header := []interface{}{magicNumber, formatVersion, int32(len(zone)), []byte(zone), int32(len(keys))}
+	for _, v := range header {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range keys {
+		var reverse uint8
+		if key.Reverse {
+			reverse = 1
+		}
+		if err := binary.Write(w, binary.LittleEndian, key.WayID); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, reverse); err != nil {
+			return err
+		}
+		if _, err := w.Write(p.profiles[key][:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode reads profiles written by Encode
+func Decode(r io.Reader) (*Profiles, error) {
+	var magic, version uint32
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil {
+		return nil, err
+	}
+	if magic != magicNumber {
+		return nil, fmt.Errorf("invalid file format (magic: %x)", magic)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != formatVersion {
+		return nil, fmt.Errorf("unsupported version: %d", version)
+	}
+
+	var zoneLen int32
+	if err := binary.Read(r, binary.LittleEndian, &zoneLen); err != nil {
+		return nil, err
+	}
+	if zoneLen < 0 || zoneLen > 256 {
+		return nil, fmt.Errorf("invalid time zone length %d", zoneLen)
+	}
+	zone := make([]byte, zoneLen)
+	if _, err := io.ReadFull(r, zone); err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(string(zone))
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q: %w", zone, err)
+	}
+
+	var count int32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("invalid profile count %d", count)
+	}
+
+	profiles := New(location)
+	for i := int32(0); i < count; i++ {
+		var key Key
+		var reverse uint8
+		if err := binary.Read(r, binary.LittleEndian, &key.WayID); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &reverse); err != nil {
+			return nil, err
+		}
+		key.Reverse = reverse == 1
+
+		profile := &Profile{}
+		if _, err := io.ReadFull(r, profile[:]); err != nil {
+			return nil, err
+		}
+		profiles.Set(key, profile)
+	}
+	return profiles, nil
+}
@@ -0,0 +1,151 @@
+package speeds
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/parquet"
+)
+
+// Probe file columns; direction is optional
+const (
+	columnWayID     = "way_id"
+	columnDirection = "direction"
+	columnTimestamp = "timestamp"
+	columnSpeed     = "speed_kmh"
+)
+
+// ReadCSV streams probe records from CSV with a header row. Columns are way_id,
+// direction (optional), timestamp (RFC 3339 or Unix seconds) and speed_kmh.
+func ReadCSV(r io.Reader, fn func(Record) error) error {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{columnWayID, columnTimestamp, columnSpeed} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("CSV header needs a %s column", name)
+		}
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		var rec Record
+		if rec.WayID, err = strconv.ParseInt(field(columnWayID), 10, 64); err != nil {
+			return fmt.Errorf("line %d: invalid way_id: %w", line, err)
+		}
+		if rec.SpeedKmh, err = strconv.ParseFloat(field(columnSpeed), 64); err != nil {
+			return fmt.Errorf("line %d: invalid speed_kmh: %w", line, err)
+		}
+		if rec.Timestamp, err = parseTimestamp(field(columnTimestamp)); err != nil {
+			return fmt.Errorf("line %d: invalid timestamp: %w", line, err)
+		}
+		rec.Direction = strings.ToLower(field(columnDirection))
+
+		if err := fn(rec); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+// ReadParquet streams probe records from a flat Parquet file with the same
+// columns as ReadCSV. Timestamps may be timestamp, Unix seconds or string columns.
+func ReadParquet(r io.ReaderAt, size int64, fn func(Record) error) error {
+	file, err := parquet.Open(r, size)
+	if err != nil {
+		return err
+	}
+
+	names := []string{columnWayID, columnTimestamp, columnSpeed}
+	for _, name := range names {
+		if !file.HasColumn(name) {
+			return fmt.Errorf("parquet file needs a %s column", name)
+		}
+	}
+	if file.HasColumn(columnDirection) {
+		names = append(names, columnDirection)
+	}
+
+	row := 0
+	return file.Rows(names, func(values []interface{}) error {
+		row++
+		var rec Record
+		var ok bool
+		var err error
+		if rec.WayID, ok = values[0].(int64); !ok {
+			return fmt.Errorf("row %d: invalid way_id %v", row, values[0])
+		}
+
+		switch v := values[1].(type) {
+		case time.Time:
+			rec.Timestamp = v
+		case int64:
+			rec.Timestamp = time.Unix(v, 0).UTC()
+		case string:
+			if rec.Timestamp, err = parseTimestamp(v); err != nil {
+				return fmt.Errorf("row %d: invalid timestamp: %w", row, err)
+			}
+		default:
+			return fmt.Errorf("row %d: invalid timestamp %v", row, v)
+		}
+
+		switch v := values[2].(type) {
+		case float64:
+			rec.SpeedKmh = v
+		case int64:
+			rec.SpeedKmh = float64(v)
+		default:
+			return fmt.Errorf("row %d: invalid speed_kmh %v", row, v)
+		}
+
+		if len(values) > 3 {
+			direction, _ := values[3].(string)
+			rec.Direction = strings.ToLower(strings.TrimSpace(direction))
+		}
+
+		if err := fn(rec); err != nil {
+			return fmt.Errorf("row %d: %w", row, err)
+		}
+		return nil
+	})
+}
+
+// parseTimestamp accepts RFC 3339 or Unix seconds
+func parseTimestamp(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,88 @@
+// Package speeds provides weekly historical speed profiles per road direction,
+// aggregated offline from map-matched probe data.
+package speeds
+
+import (
+	"time"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// Profile resolution
+const (
+	BucketMinutes  = 15
+	BucketsPerDay  = 24 * 60 / BucketMinutes
+	BucketsPerWeek = 7 * BucketsPerDay
+)
+
+// Key identifies one direction of an OSM way
+type Key struct {
+	WayID   int64
+	Reverse bool // Against the node order of the way
+}
+
+// KeyOf returns the profile key of an edge
+func KeyOf(edge *graph.Edge) Key {
+	return Key{WayID: edge.OSMWayID, Reverse: edge.Reverse}
+}
+
+// Profile holds the typical speed (km/h) of a road direction for every
+// 15-minute bucket of the week, starting Monday 00:00. 0 means no data.
+type Profile [BucketsPerWeek]uint8
+
+// Bucket returns the bucket of the week that t falls into, in t's location
+func Bucket(t time.Time) int {
+	day := (int(t.Weekday()) + 6) % 7 // Monday first
+	return day*BucketsPerDay + (t.Hour()*60+t.Minute())/BucketMinutes
+}
+
+// Profiles is a set of weekly speed profiles keyed by road direction
+type Profiles struct {
+	location *time.Location // Time zone the buckets are expressed in
+	profiles map[Key]*Profile
+}
+
+// New creates an empty profile set whose buckets are in the given time zone
+func New(location *time.Location) *Profiles {
+	if location == nil {
+		location = time.UTC
+	}
+	return &Profiles{
+		location: location,
+		profiles: make(map[Key]*Profile),
+	}
+}
+
+// Location returns the time zone of the buckets
+func (p *Profiles) Location() *time.Location {
+	return p.location
+}
+
+// Len returns the number of road directions with a profile
+func (p *Profiles) Len() int {
+	return len(p.profiles)
+}
+
+// Set stores the profile of a road direction
+func (p *Profiles) Set(key Key, profile *Profile) {
+	p.profiles[key] = profile
+}
+
+// Get returns the profile of a road direction
+func (p *Profiles) Get(key Key) (*Profile, bool) {
+	profile, ok := p.profiles[key]
+	return profile, ok
+}
+
+// SpeedAt returns the typical speed (m/s) on an edge at time t
+func (p *Profiles) SpeedAt(edge *graph.Edge, t time.Time) (float64, bool) {
+	profile, ok := p.profiles[KeyOf(edge)]
+	if !ok {
+		return 0, false
+	}
+	kmh := profile[Bucket(t.In(p.location))]
+	if kmh == 0 {
+		return 0, false
+	}
+	return float64(kmh) / 3.6, true
+}
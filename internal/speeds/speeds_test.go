@@ -0,0 +1,172 @@
+package speeds
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// monday is 2024-05-06 00:00 UTC
+var monday = time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+
+func TestBucket(t *testing.T) {
+	tests := []struct {
+		time     time.Time
+		expected int
+	}{
+		{monday, 0},
+		{monday.Add(14 * time.Minute), 0},
+		{monday.Add(15 * time.Minute), 1},
+		{monday.Add(8 * time.Hour), 32},
+		{monday.Add(24 * time.Hour), BucketsPerDay},
+		{monday.Add(7*24*time.Hour - time.Minute), BucketsPerWeek - 1},
+	}
+	for _, tt := range tests {
+		if got := Bucket(tt.time); got != tt.expected {
+			t.Errorf("Bucket(%v) = %d, expected %d", tt.time, got, tt.expected)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	b := NewBuilder(time.UTC)
+	add := func(way int64, direction string, at time.Time, speed float64) {
+		if err := b.Add(Record{WayID: way, Direction: direction, Timestamp: at, SpeedKmh: speed}); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	// Way 1 forward: Monday 08:00 is slow, the rest of the week is free-flowing
+	for i := 0; i < 3; i++ {
+		add(1, DirectionForward, monday.Add(8*time.Hour), 20)
+		add(1, DirectionForward, monday.Add(8*time.Hour+5*time.Minute), 60)
+	}
+	for i := 0; i < 30; i++ {
+		add(1, DirectionForward, monday.Add(time.Duration(i)*5*time.Hour), 90)
+	}
+	// Way 2 in both directions, too few samples
+	add(2, DirectionBoth, monday, 50)
+
+	if err := b.Add(Record{WayID: 3, Timestamp: monday, SpeedKmh: -5}); err == nil {
+		t.Error("Expected error for negative speed")
+	}
+	if err := b.Add(Record{WayID: 3, Direction: "north", Timestamp: monday, SpeedKmh: 5}); err == nil {
+		t.Error("Expected error for invalid direction")
+	}
+
+	profiles := b.Build(3)
+	if profiles.Len() != 1 {
+		t.Fatalf("Expected 1 profile, got %d", profiles.Len())
+	}
+	if _, ok := profiles.Get(Key{WayID: 1, Reverse: true}); ok {
+		t.Error("Expected no backward profile for way 1")
+	}
+
+	edge := &graph.Edge{OSMWayID: 1}
+	speed, ok := profiles.SpeedAt(edge, monday.Add(8*time.Hour+10*time.Minute))
+	if !ok {
+		t.Fatal("Expected a speed at Monday 08:10")
+	}
+	// Harmonic mean of 20 and 60 km/h is 30 km/h
+	if kmh := speed * 3.6; math.Abs(kmh-30) > 0.5 {
+		t.Errorf("Expected 30 km/h at Monday 08:10, got %.1f", kmh)
+	}
+
+	// Sparse buckets fall back to the weekly harmonic mean: 36 / (3/20 + 3/60 + 30/90) = 67.5
+	speed, _ = profiles.SpeedAt(edge, monday.Add(3*24*time.Hour+time.Hour))
+	if kmh := speed * 3.6; math.Abs(kmh-67.5) > 1 {
+		t.Errorf("Expected weekly mean speed of 67.5 km/h for a sparse bucket, got %.1f", kmh)
+	}
+
+	if _, ok := profiles.SpeedAt(&graph.Edge{OSMWayID: 1, Reverse: true}, monday); ok {
+		t.Error("Expected no speed against the way direction")
+	}
+}
+
+func TestTimeZone(t *testing.T) {
+	zone := time.FixedZone("UTC+2", 2*3600)
+	b := NewBuilder(zone)
+	for i := 0; i < 3; i++ {
+		// Sunday 23:00 UTC is Monday 01:00 in UTC+2
+		b.Add(Record{WayID: 1, Timestamp: monday.Add(-time.Hour), SpeedKmh: 40})
+	}
+	profile, _ := b.Build(3).Get(Key{WayID: 1})
+	if profile[4] != 40 {
+		t.Errorf("Expected bucket Monday 01:00 to be 40 km/h, got %d", profile[4])
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	profiles := New(location)
+	forward := &Profile{}
+	backward := &Profile{}
+	for i := range forward {
+		forward[i] = uint8(20 + i%50)
+		backward[i] = 70
+	}
+	profiles.Set(Key{WayID: 42}, forward)
+	profiles.Set(Key{WayID: 42, Reverse: true}, backward)
+
+	path := filepath.Join(t.TempDir(), "graph.bin.snappy.speeds")
+	if err := profiles.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if loaded.Location().String() != "Europe/Berlin" {
+		t.Errorf("Expected Europe/Berlin, got %s", loaded.Location())
+	}
+	if loaded.Len() != 2 {
+		t.Fatalf("Expected 2 profiles, got %d", loaded.Len())
+	}
+	got, _ := loaded.Get(Key{WayID: 42})
+	if *got != *forward {
+		t.Error("Forward profile differs after reload")
+	}
+	got, _ = loaded.Get(Key{WayID: 42, Reverse: true})
+	if *got != *backward {
+		t.Error("Backward profile differs after reload")
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	input := `way_id,direction,timestamp,speed_kmh
+10,forward,2024-05-06T08:00:00Z,42.5
+10,,1714982400,30
+`
+	var records []Record
+	err := ReadCSV(strings.NewReader(input), func(rec Record) error {
+		records = append(records, rec)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadCSV failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if records[0].Direction != DirectionForward || records[0].SpeedKmh != 42.5 || !records[0].Timestamp.Equal(monday.Add(8*time.Hour)) {
+		t.Errorf("Unexpected first record %+v", records[0])
+	}
+	if records[1].Direction != DirectionBoth || !records[1].Timestamp.Equal(time.Unix(1714982400, 0)) {
+		t.Errorf("Unexpected second record %+v", records[1])
+	}
+
+	if err := ReadCSV(strings.NewReader("way_id,speed_kmh\n1,2\n"), func(Record) error { return nil }); err == nil {
+		t.Error("Expected error for missing timestamp column")
+	}
+	if err := ReadCSV(strings.NewReader("way_id,timestamp,speed_kmh\nx,0,2\n"), func(Record) error { return nil }); err == nil {
+		t.Error("Expected error for invalid way_id")
+	}
+}
@@ -0,0 +1,373 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// Version 2 file layout (all integers little endian):
+//
+//	magic uint32, version uint32
+//	header length uint32, header (JSON Metadata), header CRC32 uint32
+//	section payloads
+//	section table: count uint32, count × sectionEntrySize bytes
+//	trailer: table offset uint64, table CRC32 uint32, magic uint32
+//
+// Each payload is checksummed on its stored bytes, so a section can be
+// verified, skipped or copied into another file without decoding it.
+const (
+	formatVersion2   uint32 = 2
+	sectionEntrySize        = 36
+	trailerSize             = 16
+)
+
+// Section flags
+const (
+	flagSnappy   uint32 = 1 << 0 // Payload is a snappy stream
+	flagRequired uint32 = 1 << 1 // Readers that do not know the section must reject the file
+)
+
+// Section IDs of the graph data
+const (
+	SectionNodes        = "NODE"
+	SectionEdges        = "EDGE"
+	SectionRestrictions = "TURN"
+	SectionDirections   = "EDIR"
+	SectionElevation    = "ELEV"
+	SectionStations     = "EVCS"
+	SectionSignals      = "SIGN"
+	SectionSpeeds       = "SPED" // Historical speed profiles embedded by cmd/speedprofiles
+)
+
+// ParserVersion identifies the OSM import logic a graph was built with.
+// Bump it when parsing changes the graph content.
+const ParserVersion = 1
+
+// Metadata is the header of a version 2 graph file
+type Metadata struct {
+	Source        string     `json:"source,omitempty"`         // PBF file the graph was built from
+	CreatedAt     time.Time  `json:"created_at"`               // When the file was written
+	BBox          [4]float64 `json:"bbox"`                     // minLon, minLat, maxLon, maxLat
+	ParserVersion int        `json:"parser_version,omitempty"` // ParserVersion at import time
+	Profiles      []string   `json:"profiles,omitempty"`       // Routing profiles available at import time
+	Nodes         int        `json:"nodes"`
+	Edges         int        `json:"edges"`
+}
+
+// SectionInfo describes one entry of the section table
+type SectionInfo struct {
+	ID        string `json:"id"`
+	Flags     uint32 `json:"flags"`
+	Offset    int64  `json:"offset"`
+	Length    int64  `json:"length"`     // Stored (possibly compressed) bytes
+	RawLength int64  `json:"raw_length"` // Decoded bytes
+	CRC       uint32 `json:"crc32"`      // CRC32 (IEEE) of the stored bytes
+}
+
+// Required reports whether readers must understand the section
+func (si SectionInfo) Required() bool {
+	return si.Flags&flagRequired != 0
+}
+
+// FileInfo describes a graph file without loading its data
+type FileInfo struct {
+	Version  int           `json:"version"`
+	Layout   Layout        `json:"layout"`
+	Metadata *Metadata     `json:"metadata,omitempty"` // Only version 2 files carry metadata
+	Sections []SectionInfo `json:"sections,omitempty"`
+}
+
+// knownSections are the sections this version can decode or carries through
+var knownSections = map[string]bool{
+	SectionNodes: true, SectionEdges: true, SectionRestrictions: true, SectionDirections: true,
+	SectionElevation: true, SectionStations: true, SectionSignals: true, SectionSpeeds: true,
+}
+
+func init() {
+	for _, section := range mappedSections {
+		knownSections[section.id] = true
+	}
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// fileWriter writes a version 2 file sequentially, recording the section table
+type fileWriter struct {
+	out   *countingWriter
+	table []SectionInfo
+}
+
+// newFileWriter writes the file header and returns a writer for the sections
+func newFileWriter(w io.Writer, meta *Metadata) (*fileWriter, error) {
+	header, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	fw := &fileWriter{out: &countingWriter{w: w}}
+	for _, v := range []uint32{magicNumber, formatVersion2, uint32(len(header))} {
+		if err := binary.Write(fw.out, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := fw.out.Write(header); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(fw.out, binary.LittleEndian, crc32.ChecksumIEEE(header)); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+// writeSection encodes a snappy-compressed section
+func (fw *fileWriter) writeSection(id string, flags uint32, encode func(io.Writer) error) error {
+	flags |= flagSnappy
+	info := SectionInfo{ID: id, Flags: flags, Offset: fw.out.n}
+	checksum := crc32.NewIEEE()
+	stored := io.MultiWriter(fw.out, checksum)
+
+	snappyWriter := snappy.NewBufferedWriter(stored)
+	raw := &countingWriter{w: snappyWriter}
+	if err := encode(raw); err != nil {
+		return fmt.Errorf("section %s: %w", id, err)
+	}
+	if err := snappyWriter.Close(); err != nil {
+		return fmt.Errorf("section %s: %w", id, err)
+	}
+
+	info.Length = fw.out.n - info.Offset
+	info.RawLength = raw.n
+	info.CRC = checksum.Sum32()
+	fw.table = append(fw.table, info)
+	return nil
+}
+
+// writeArraySection writes an uncompressed section starting at an 8-byte
+// boundary, so a memory-mapped file can use it as an array in place
+func (fw *fileWriter) writeArraySection(id string, flags uint32, encode func(io.Writer) error) error {
+	if err := fw.align(); err != nil {
+		return err
+	}
+
+	info := SectionInfo{ID: id, Flags: flags &^ flagSnappy, Offset: fw.out.n}
+	checksum := crc32.NewIEEE()
+	if err := encode(io.MultiWriter(fw.out, checksum)); err != nil {
+		return fmt.Errorf("section %s: %w", id, err)
+	}
+	info.Length = fw.out.n - info.Offset
+	info.RawLength = info.Length
+	info.CRC = checksum.Sum32()
+	fw.table = append(fw.table, info)
+	return nil
+}
+
+// align pads the file to an 8-byte boundary
+func (fw *fileWriter) align() error {
+	if pad := (8 - fw.out.n%8) % 8; pad > 0 {
+		_, err := fw.out.Write(make([]byte, pad))
+		return err
+	}
+	return nil
+}
+
+// copySection copies the stored bytes of a section from another file unchanged
+func (fw *fileWriter) copySection(src SectionInfo, r io.ReaderAt) error {
+	if src.Flags&flagSnappy == 0 {
+		if err := fw.align(); err != nil {
+			return err
+		}
+	}
+	info := src
+	info.Offset = fw.out.n
+	if _, err := io.Copy(fw.out, io.NewSectionReader(r, src.Offset, src.Length)); err != nil {
+		return fmt.Errorf("section %s: %w", src.ID, err)
+	}
+	fw.table = append(fw.table, info)
+	return nil
+}
+
+// finish writes the section table and the trailer
+func (fw *fileWriter) finish() error {
+	tableOffset := fw.out.n
+	checksum := crc32.NewIEEE()
+	w := io.MultiWriter(fw.out, checksum)
+
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(fw.table))); err != nil {
+		return err
+	}
+	for _, info := range fw.table {
+		var id [4]byte
+		copy(id[:], info.ID)
+		entry := []any{id, info.Flags, uint64(info.Offset), uint64(info.Length), uint64(info.RawLength), info.CRC}
+		for _, v := range entry {
+			if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	trailer := []any{uint64(tableOffset), checksum.Sum32(), magicNumber}
+	for _, v := range trailer {
+		if err := binary.Write(fw.out, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileReader gives access to the sections of a version 2 file
+type fileReader struct {
+	r        io.ReaderAt
+	meta     Metadata
+	sections []SectionInfo
+}
+
+// openFile reads and verifies the header and section table of a version 2 file
+func openFile(r io.ReaderAt, size int64) (*fileReader, error) {
+	if size < 12+4+trailerSize {
+		return nil, fmt.Errorf("file too short (%d bytes)", size)
+	}
+
+	// Header
+	var fixed [12]byte
+	if _, err := r.ReadAt(fixed[:], 0); err != nil {
+		return nil, err
+	}
+	if magic := binary.LittleEndian.Uint32(fixed[0:]); magic != magicNumber {
+		return nil, fmt.Errorf("invalid file format (magic: %x)", magic)
+	}
+	if version := binary.LittleEndian.Uint32(fixed[4:]); version != formatVersion2 {
+		return nil, fmt.Errorf("unsupported version: %d", version)
+	}
+	headerLen := int64(binary.LittleEndian.Uint32(fixed[8:]))
+	if 12+headerLen+4 > size-trailerSize {
+		return nil, fmt.Errorf("header length %d exceeds file size", headerLen)
+	}
+	header := make([]byte, headerLen+4)
+	if _, err := r.ReadAt(header, 12); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(header[:headerLen]) != binary.LittleEndian.Uint32(header[headerLen:]) {
+		return nil, fmt.Errorf("header: checksum mismatch")
+	}
+	fr := &fileReader{r: r}
+	if err := json.Unmarshal(header[:headerLen], &fr.meta); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+
+	// Trailer and section table
+	var trailer [trailerSize]byte
+	if _, err := r.ReadAt(trailer[:], size-trailerSize); err != nil {
+		return nil, err
+	}
+	if magic := binary.LittleEndian.Uint32(trailer[12:]); magic != magicNumber {
+		return nil, fmt.Errorf("missing trailer (file truncated?)")
+	}
+	tableOffset := int64(binary.LittleEndian.Uint64(trailer[0:]))
+	if tableOffset < 12+headerLen+4 || tableOffset+4 > size-trailerSize {
+		return nil, fmt.Errorf("section table offset %d out of range", tableOffset)
+	}
+	table := make([]byte, size-trailerSize-tableOffset)
+	if _, err := r.ReadAt(table, tableOffset); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(table) != binary.LittleEndian.Uint32(trailer[8:]) {
+		return nil, fmt.Errorf("section table: checksum mismatch")
+	}
+	count := int(binary.LittleEndian.Uint32(table))
+	if len(table) != 4+count*sectionEntrySize {
+		return nil, fmt.Errorf("section table: %d bytes for %d sections", len(table), count)
+	}
+
+	for i := 0; i < count; i++ {
+		entry := table[4+i*sectionEntrySize:]
+		info := SectionInfo{
+			ID:        string(entry[0:4]),
+			Flags:     binary.LittleEndian.Uint32(entry[4:]),
+			Offset:    int64(binary.LittleEndian.Uint64(entry[8:])),
+			Length:    int64(binary.LittleEndian.Uint64(entry[16:])),
+			RawLength: int64(binary.LittleEndian.Uint64(entry[24:])),
+			CRC:       binary.LittleEndian.Uint32(entry[32:]),
+		}
+		if info.Offset < 12+headerLen+4 || info.Length < 0 || info.Offset+info.Length > tableOffset {
+			return nil, fmt.Errorf("section %s: out of range", info.ID)
+		}
+		if info.Required() && !knownSections[info.ID] {
+			return nil, fmt.Errorf("section %s is required but not supported by this version", info.ID)
+		}
+		fr.sections = append(fr.sections, info)
+	}
+	return fr, nil
+}
+
+// section returns the table entry of a section
+func (fr *fileReader) section(id string) (SectionInfo, bool) {
+	for _, info := range fr.sections {
+		if info.ID == id {
+			return info, true
+		}
+	}
+	return SectionInfo{}, false
+}
+
+// readSection decodes a section and verifies its checksum. It reports false
+// if the file has no such section.
+func (fr *fileReader) readSection(id string, decode func(io.Reader) error) (bool, error) {
+	info, ok := fr.section(id)
+	if !ok {
+		return false, nil
+	}
+
+	checksum := crc32.NewIEEE()
+	stored := bufio.NewReaderSize(io.TeeReader(io.NewSectionReader(fr.r, info.Offset, info.Length), checksum), 1024*1024)
+	var payload io.Reader = stored
+	if info.Flags&flagSnappy != 0 {
+		payload = snappy.NewReader(stored)
+	}
+
+	if err := decode(payload); err != nil {
+		// Corruption usually surfaces as a decode error; report it as such
+		if _, drainErr := io.Copy(io.Discard, stored); drainErr == nil && checksum.Sum32() != info.CRC {
+			return true, fmt.Errorf("section %s: checksum mismatch", id)
+		}
+		return true, fmt.Errorf("section %s: %w", id, err)
+	}
+	if _, err := io.Copy(io.Discard, stored); err != nil {
+		return true, fmt.Errorf("section %s: %w", id, err)
+	}
+	if checksum.Sum32() != info.CRC {
+		return true, fmt.Errorf("section %s: checksum mismatch", id)
+	}
+	return true, nil
+}
+
+// verify checks the checksums of all sections without decoding them
+func (fr *fileReader) verify() error {
+	for _, info := range fr.sections {
+		checksum := crc32.NewIEEE()
+		if _, err := io.Copy(checksum, io.NewSectionReader(fr.r, info.Offset, info.Length)); err != nil {
+			return fmt.Errorf("section %s: %w", info.ID, err)
+		}
+		if checksum.Sum32() != info.CRC {
+			return fmt.Errorf("section %s: checksum mismatch", info.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+func TestMetadataHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.bin.snappy")
+	g := createTestGraph()
+
+	store := NewStorage(path)
+	store.SetMetadata(Metadata{Source: "monaco.osm.pbf", ParserVersion: ParserVersion, Profiles: []string{"foot", "car"}})
+	if err := store.Save(g); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	info, err := Info(path)
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.Version != 2 || info.Metadata == nil {
+		t.Fatalf("info = %+v, want version 2 with metadata", info)
+	}
+	meta := info.Metadata
+	if meta.Source != "monaco.osm.pbf" || meta.ParserVersion != ParserVersion || meta.CreatedAt.IsZero() {
+		t.Errorf("metadata = %+v", meta)
+	}
+	if strings.Join(meta.Profiles, ",") != "car,foot" {
+		t.Errorf("profiles = %v, want sorted", meta.Profiles)
+	}
+	if meta.Nodes != g.NodeCount() || meta.Edges != g.EdgeCount() {
+		t.Errorf("counts = %d/%d, want %d/%d", meta.Nodes, meta.Edges, g.NodeCount(), g.EdgeCount())
+	}
+	if meta.BBox != [4]float64{100.5018, 13.7563, 100.5318, 13.7863} {
+		t.Errorf("bbox = %v", meta.BBox)
+	}
+	if err := Verify(path); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	loaded := NewStorage(path)
+	if _, err := loaded.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.FormatVersion() != 2 || loaded.Metadata().Source != "monaco.osm.pbf" {
+		t.Errorf("loaded version %d, metadata %+v", loaded.FormatVersion(), loaded.Metadata())
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.bin.snappy")
+	if err := NewStorage(path).Save(createTestGraph()); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	info, err := Info(path)
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+
+	// Flip a byte in the middle of the edge section
+	var edges SectionInfo
+	for _, section := range info.Sections {
+		if section.ID == SectionEdges {
+			edges = section
+		}
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[edges.Offset+edges.Length/2] ^= 0xff
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Verify(path); err == nil || !strings.Contains(err.Error(), "section EDGE") {
+		t.Errorf("Verify error = %v, want EDGE checksum mismatch", err)
+	}
+	if _, err := NewStorage(path).Load(); err == nil {
+		t.Error("Load succeeded on a corrupt file")
+	}
+}
+
+func TestLoadVersion1AndMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.bin.snappy")
+	g := createTestGraph()
+	g.AddTrafficSignal(1)
+	writeVersion1(t, path, g)
+
+	store := NewStorage(path)
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load v1: %v", err)
+	}
+	if store.FormatVersion() != 1 {
+		t.Errorf("version = %d, want 1", store.FormatVersion())
+	}
+	verifyGraphsEqual(t, g, loaded)
+
+	migrated, err := Migrate(path, Metadata{Source: "berlin.osm.pbf"})
+	if err != nil || !migrated {
+		t.Fatalf("Migrate = %v, %v", migrated, err)
+	}
+	if backup, err := Info(path + ".v1"); err != nil || backup.Version != 1 {
+		t.Errorf("v1 backup = %+v, %v", backup, err)
+	}
+	info, err := Info(path)
+	if err != nil || info.Version != 2 || info.Metadata.Source != "berlin.osm.pbf" {
+		t.Fatalf("Info after migrate = %+v, %v", info, err)
+	}
+	loaded, err = NewStorage(path).Load()
+	if err != nil {
+		t.Fatalf("Load v2: %v", err)
+	}
+	verifyGraphsEqual(t, g, loaded)
+	if !loaded.HasTrafficSignal(1) {
+		t.Error("signal lost in migration")
+	}
+
+	if migrated, err := Migrate(path, Metadata{}); err != nil || migrated {
+		t.Errorf("second Migrate = %v, %v, want no-op", migrated, err)
+	}
+}
+
+func TestExtraSections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.bin.snappy")
+	store := NewStorage(path)
+	if err := store.Save(createTestGraph()); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	payload := []byte("speed profiles")
+	if err := store.WriteSection(SectionSpeeds, func(w io.Writer) error {
+		_, err := w.Write(payload)
+		return err
+	}); err != nil {
+		t.Fatalf("WriteSection: %v", err)
+	}
+	if err := store.WriteSection(SectionEdges, func(io.Writer) error { return nil }); err == nil {
+		t.Error("WriteSection replaced a graph section")
+	}
+
+	// Saving the graph again keeps the extra section
+	if err := store.Save(createTestGraph()); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	var got []byte
+	found, err := store.ReadSection(SectionSpeeds, func(r io.Reader) error {
+		var err error
+		got, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil || !found || !bytes.Equal(got, payload) {
+		t.Errorf("ReadSection = %q, %v, %v", got, found, err)
+	}
+	if found, err := store.ReadSection("NONE", func(io.Reader) error { return nil }); found || err != nil {
+		t.Errorf("missing section = %v, %v", found, err)
+	}
+
+	// Unknown optional sections are skipped, unknown required ones rejected
+	if err := store.WriteSection("XTRA", func(w io.Writer) error {
+		_, err := w.Write([]byte("future data"))
+		return err
+	}); err != nil {
+		t.Fatalf("WriteSection: %v", err)
+	}
+	if _, err := store.Load(); err != nil {
+		t.Errorf("Load with unknown optional section: %v", err)
+	}
+	setSectionFlags(t, path, "XTRA", flagSnappy|flagRequired)
+	if _, err := store.Load(); err == nil || !strings.Contains(err.Error(), "XTRA") {
+		t.Errorf("Load with unknown required section = %v", err)
+	}
+}
+
+// setSectionFlags rewrites the flags of a section table entry in place
+func setSectionFlags(t *testing.T, path, id string, flags uint32) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr, err := openVersion2(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	fw := &fileWriter{out: &countingWriter{w: &out}}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerEnd := fr.sections[0].Offset
+	fw.out.Write(raw[:headerEnd])
+	for _, info := range fr.sections {
+		if info.ID == id {
+			info.Flags = flags
+		}
+		if err := fw.copySection(info, bytes.NewReader(raw)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fw.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeVersion1 writes a graph in the version 1 format: a single snappy
+// stream with the header, nodes, edges, reverse edges, restrictions and the
+// trailing optional sections
+func writeVersion1(t *testing.T, path string, g *graph.Graph) {
+	t.Helper()
+	data := g.Export()
+
+	var buf bytes.Buffer
+	w := snappy.NewBufferedWriter(&buf)
+	steps := []func() error{
+		func() error { return binary.Write(w, binary.LittleEndian, magicNumber) },
+		func() error { return binary.Write(w, binary.LittleEndian, formatVersion) },
+		func() error { return writeNodes(w, data) },
+		func() error { return writeEdgeList(w, data.Edges) },
+		func() error { return writeEdgeList(w, data.ReverseEdges) },
+		func() error { return writeRestrictions(w, data) },
+		func() error { return writeElevations(w, data) },
+		func() error { return writeStations(w, data) },
+		func() error { return writeSignals(w, data) },
+		func() error { return writeEdgeDirections(w, data) },
+		w.Close,
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("write v1: %v", err)
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadStationsRejectsCorruptCounts(t *testing.T) {
+	encode := func(values ...any) *bytes.Reader {
+		var buf bytes.Buffer
+		for _, v := range values {
+			if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return bytes.NewReader(buf.Bytes())
+	}
+
+	tests := []struct {
+		name string
+		r    io.Reader
+		err  string
+	}{
+		{"negative count", encode(int32(-1)), "invalid station count"},
+		{"count beyond data", encode(int32(math.MaxInt32)), "EOF"},
+		{"negative connector count", encode(int32(1), int64(7), 43.0, 7.0, 22.0, int32(0), int32(-2)), "invalid connector count"},
+		{"negative name length", encode(int32(1), int64(7), 43.0, 7.0, 22.0, int32(-5)), "invalid string length"},
+	}
+	for _, tt := range tests {
+		var data graph.ExportData
+		if err := readStations(tt.r, &data); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got %v, want error containing %q", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+	"unsafe"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// Layout selects how the graph data of a version 2 file is stored
+type Layout string
+
+const (
+	// LayoutCompressed stores snappy-compressed sections that are decoded on load
+	LayoutCompressed Layout = "compressed"
+	// LayoutMapped stores uncompressed CSR arrays that are memory-mapped and
+	// used in place: loading takes no decoding, and processes serving the same
+	// file share its pages
+	LayoutMapped Layout = "mapped"
+)
+
+// ParseLayout parses a layout name; an empty name is the compressed layout
+func ParseLayout(name string) (Layout, error) {
+	switch Layout(name) {
+	case "", LayoutCompressed:
+		return LayoutCompressed, nil
+	case LayoutMapped:
+		return LayoutMapped, nil
+	}
+	return "", fmt.Errorf("unknown graph layout %q (want %s or %s)", name, LayoutCompressed, LayoutMapped)
+}
+
+// mappedSection stores one CSR array
+type mappedSection struct {
+	id       string
+	optional bool
+	field    func(c *graph.CSR) any // Pointer to the array
+}
+
+// mappedSections are the arrays of the mapped layout. Turn restrictions,
+// stations and signals are small and stored as compressed sections.
+var mappedSections = []mappedSection{
+	{"NIDS", false, func(c *graph.CSR) any { return &c.NodeIDs }},
+	{"NLAT", false, func(c *graph.CSR) any { return &c.Lat }},
+	{"NLON", false, func(c *graph.CSR) any { return &c.Lon }},
+	{"NELE", true, func(c *graph.CSR) any { return &c.Elevation }},
+	{"EOUT", false, func(c *graph.CSR) any { return &c.FirstOut }},
+	{"EHED", false, func(c *graph.CSR) any { return &c.Head }},
+	{"EWGT", false, func(c *graph.CSR) any { return &c.Weight }},
+	{"EATR", false, func(c *graph.CSR) any { return &c.Attr }},
+	{"EFLG", false, func(c *graph.CSR) any { return &c.Flags }},
+	{"EINO", false, func(c *graph.CSR) any { return &c.FirstIn }},
+	{"EINE", false, func(c *graph.CSR) any { return &c.InEdge }},
+	{"AWAY", false, func(c *graph.CSR) any { return &c.AttrWay }},
+	{"ASPD", false, func(c *graph.CSR) any { return &c.AttrMaxSpeed }},
+	{"ATAG", false, func(c *graph.CSR) any { return &c.AttrTags }},
+	{"TOFF", false, func(c *graph.CSR) any { return &c.TagStart }},
+	{"TPRS", false, func(c *graph.CSR) any { return &c.TagPairs }},
+	{"SOFF", false, func(c *graph.CSR) any { return &c.StrStart }},
+	{"SDAT", false, func(c *graph.CSR) any { return &c.StrData }},
+	{"WIDS", false, func(c *graph.CSR) any { return &c.WayIDs }},
+	{"WOFF", false, func(c *graph.CSR) any { return &c.WayStart }},
+	{"WEDG", false, func(c *graph.CSR) any { return &c.WayEdges }},
+}
+
+// mappedExtras are the compressed sections of the mapped layout
+var mappedExtras = []graphSection{
+	{SectionRestrictions, flagRequired, writeRestrictions, readRestrictions},
+	{SectionStations, 0, writeStations, readStations},
+	{SectionSignals, 0, writeSignals, readSignals},
+}
+
+// isMapped reports whether a file uses the mapped layout
+func (fr *fileReader) isMapped() bool {
+	_, ok := fr.section(mappedSections[0].id)
+	return ok
+}
+
+// writeMapped writes a graph in the mapped layout to a temporary file and
+// renames it to path, carrying over extra sections like writeFile
+func writeMapped(path string, c *graph.CSR, extras *graph.ExportData, meta Metadata, carry string) error {
+	return replaceFile(path, func(w io.Writer) error {
+		meta.CreatedAt = time.Now().UTC()
+		meta.Profiles = append([]string(nil), meta.Profiles...)
+		sort.Strings(meta.Profiles)
+		describeCSR(&meta, c)
+		fw, err := newFileWriter(w, &meta)
+		if err != nil {
+			return err
+		}
+		for _, section := range mappedSections {
+			field := section.field(c)
+			if section.optional && arrayLen(field) == 0 {
+				continue
+			}
+			if err := fw.writeArraySection(section.id, flagRequired, func(w io.Writer) error {
+				return writeArrayField(w, field)
+			}); err != nil {
+				return err
+			}
+		}
+		for _, section := range mappedExtras {
+			write := section.write
+			if err := fw.writeSection(section.id, section.flags, func(w io.Writer) error {
+				return write(w, extras)
+			}); err != nil {
+				return err
+			}
+		}
+		if err := carrySections(fw, carry, ""); err != nil {
+			return err
+		}
+		return fw.finish()
+	})
+}
+
+// describeCSR fills in the counts and bounding box of the metadata
+func describeCSR(meta *Metadata, c *graph.CSR) {
+	meta.Nodes = len(c.NodeIDs)
+	meta.Edges = len(c.Head)
+	meta.BBox = [4]float64{}
+	if len(c.NodeIDs) == 0 {
+		return
+	}
+	meta.BBox = [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for i := range c.NodeIDs {
+		meta.BBox[0] = math.Min(meta.BBox[0], c.Lon[i])
+		meta.BBox[1] = math.Min(meta.BBox[1], c.Lat[i])
+		meta.BBox[2] = math.Max(meta.BBox[2], c.Lon[i])
+		meta.BBox[3] = math.Max(meta.BBox[3], c.Lat[i])
+	}
+}
+
+// loadMapped maps a file in the mapped layout and builds a graph that reads
+// its arrays in place. Checksums of the arrays are not verified here, as that
+// would read the whole file; use Verify (cmd/migrate -info) for that.
+func loadMapped(path string) (*graph.Graph, Metadata, error) {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		return nil, Metadata{}, fmt.Errorf("mapped graphs need a little-endian host")
+	}
+
+	m, err := mapFile(path)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	g, meta, err := m.graph()
+	if err != nil {
+		m.unmap()
+		return nil, Metadata{}, err
+	}
+	return g, meta, nil
+}
+
+// graph builds a graph on the mapped arrays
+func (m *mapping) graph() (*graph.Graph, Metadata, error) {
+	fr, err := openFile(bytes.NewReader(m.data), int64(len(m.data)))
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	c := &graph.CSR{Owner: m}
+	for _, section := range mappedSections {
+		info, ok := fr.section(section.id)
+		if !ok {
+			if section.optional {
+				continue
+			}
+			return nil, Metadata{}, fmt.Errorf("missing section %s", section.id)
+		}
+		if info.Flags&flagSnappy != 0 {
+			return nil, Metadata{}, fmt.Errorf("section %s: compressed in a mapped file", section.id)
+		}
+		if err := mapArrayField(m.data[info.Offset:info.Offset+info.Length], section.field(c)); err != nil {
+			return nil, Metadata{}, fmt.Errorf("section %s: %w", section.id, err)
+		}
+	}
+
+	extras := &graph.ExportData{Restrictions: make(map[int64][]graph.TurnRestriction)}
+	for _, section := range mappedExtras {
+		read := section.read
+		if _, err := fr.readSection(section.id, func(r io.Reader) error {
+			return read(r, extras)
+		}); err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	g, err := graph.NewGraphFromCSR(c, extras)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return g, fr.meta, nil
+}
+
+// writeArrayField writes a CSR array in little endian order
+func writeArrayField(w io.Writer, field any) error {
+	switch v := field.(type) {
+	case *[]int64:
+		return writeArray(w, *v)
+	case *[]uint32:
+		return writeArray(w, *v)
+	case *[]float64:
+		return writeArray(w, *v)
+	case *[]float32:
+		return writeArray(w, *v)
+	case *[]uint8:
+		_, err := w.Write(*v)
+		return err
+	}
+	return fmt.Errorf("unsupported array type %T", field)
+}
+
+// mapArrayField points a CSR array at the bytes of a section
+func mapArrayField(b []byte, field any) (err error) {
+	switch v := field.(type) {
+	case *[]int64:
+		*v, err = arrayOf[int64](b)
+	case *[]uint32:
+		*v, err = arrayOf[uint32](b)
+	case *[]float64:
+		*v, err = arrayOf[float64](b)
+	case *[]float32:
+		*v, err = arrayOf[float32](b)
+	case *[]uint8:
+		*v = b[:len(b):len(b)]
+	default:
+		err = fmt.Errorf("unsupported array type %T", field)
+	}
+	return err
+}
+
+// arrayLen returns the length of a CSR array
+func arrayLen(field any) int {
+	switch v := field.(type) {
+	case *[]int64:
+		return len(*v)
+	case *[]uint32:
+		return len(*v)
+	case *[]float64:
+		return len(*v)
+	case *[]float32:
+		return len(*v)
+	case *[]uint8:
+		return len(*v)
+	}
+	return 0
+}
+
+// writeArray writes values in chunks, so encoding needs little extra memory
+func writeArray[T int64 | uint32 | float64 | float32](w io.Writer, values []T) error {
+	const chunk = 64 * 1024
+	for len(values) > 0 {
+		n := min(chunk, len(values))
+		if err := binary.Write(w, binary.LittleEndian, values[:n]); err != nil {
+			return err
+		}
+		values = values[n:]
+	}
+	return nil
+}
+
+// arrayOf reinterprets bytes as an array without copying
+func arrayOf[T int64 | uint32 | float64 | float32](b []byte) ([]T, error) {
+	var zero T
+	size := int(unsafe.Sizeof(zero))
+	if len(b)%size != 0 {
+		return nil, fmt.Errorf("%d bytes is not a multiple of %d", len(b), size)
+	}
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if uintptr(unsafe.Pointer(&b[0]))%unsafe.Alignof(zero) != 0 {
+		return nil, fmt.Errorf("array is not aligned")
+	}
+	return unsafe.Slice((*T)(unsafe.Pointer(&b[0])), len(b)/size), nil
+}
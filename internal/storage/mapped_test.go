@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+func TestSaveAndLoadMapped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.bin")
+	g := createTestGraph()
+	g.AddEdge(graph.Edge{From: 2, To: 1, Weight: 1234.56, OSMWayID: 100, MaxSpeed: 30.0, Reverse: true,
+		Tags: map[string]string{"highway": "primary", "name": "Test Street"}})
+	g.AddTrafficSignal(3)
+	g.SetElevation(2, 41.5)
+
+	store := NewStorage(path)
+	store.SetLayout(LayoutMapped)
+	if err := store.Save(g); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if info, err := Info(path); err != nil || info.Layout != LayoutMapped {
+		t.Fatalf("Info = %+v, %v", info, err)
+	}
+	if err := Verify(path); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	loaded, err := NewStorage(path).Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	verifyGraphsEqual(t, g, loaded)
+	if err := loaded.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	node, err := loaded.GetNode(2)
+	if err != nil || node.Elevation != 41.5 {
+		t.Errorf("node 2 = %+v, %v", node, err)
+	}
+	if !loaded.HasTrafficSignal(3) || loaded.IsValidTurn(100, 2, 101) {
+		t.Error("signals or restrictions lost")
+	}
+	if refs := loaded.EdgesByWay(100); len(refs) != 2 {
+		t.Errorf("way 100 has %d edges, want 2", len(refs))
+	}
+	if back, ok := loaded.EdgeBetween(2, 1); !ok || !back.Reverse {
+		t.Errorf("edge 2->1 = %+v, %v", back, ok)
+	}
+	incoming := loaded.GetReverseEdges(2)
+	if len(incoming) != 1 || incoming[0].From != 1 {
+		t.Errorf("incoming edges of 2 = %+v", incoming)
+	}
+}
+
+func TestMappedWeightChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.bin")
+	store := NewStorage(path)
+	store.SetLayout(LayoutMapped)
+	if err := store.Save(createTestGraph()); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	refs := loaded.EdgesByWay(101)
+	if _, err := loaded.ApplyWeightChanges([]graph.WeightChange{{Edges: refs, Op: graph.WeightMultiply, Value: 2}}); err != nil {
+		t.Fatalf("ApplyWeightChanges: %v", err)
+	}
+	if edge, _ := loaded.EdgeBetween(2, 3); edge.Weight != 2345.67*2 {
+		t.Errorf("weight = %v, want doubled", edge.Weight)
+	}
+	if incoming := loaded.GetReverseEdges(3); incoming[0].Weight != 2345.67*2 {
+		t.Errorf("reverse weight = %v, want doubled", incoming[0].Weight)
+	}
+
+	// Weight changes never reach the file
+	again, err := NewStorage(path).Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if edge, _ := again.EdgeBetween(2, 3); edge.Weight != 2345.67 {
+		t.Errorf("file weight = %v, want unchanged", edge.Weight)
+	}
+
+	// Snapshots of a mapped graph keep the layout and the changed weights
+	snapshot, err := store.SaveSnapshot(loaded)
+	if err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	fromSnapshot, err := NewStorage(snapshot).Load()
+	if err != nil {
+		t.Fatalf("Load snapshot: %v", err)
+	}
+	if edge, _ := fromSnapshot.EdgeBetween(2, 3); edge.Weight != 2345.67*2 {
+		t.Errorf("snapshot weight = %v, want doubled", edge.Weight)
+	}
+
+	// Structural changes convert the graph to adjacency maps
+	loaded.AddEdge(graph.Edge{From: 4, To: 1, Weight: 10, OSMWayID: 103})
+	if loaded.EdgeCount() != 4 {
+		t.Errorf("edge count = %d, want 4", loaded.EdgeCount())
+	}
+	if edge, _ := loaded.EdgeBetween(2, 3); edge.Weight != 2345.67*2 {
+		t.Errorf("weight after thaw = %v, want doubled", edge.Weight)
+	}
+	if original, _ := loaded.OriginalWeight(refs[0]); original != 2345.67 {
+		t.Errorf("original weight = %v", original)
+	}
+}
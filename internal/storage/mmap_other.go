@@ -0,0 +1,28 @@
+//go:build !unix
+
+package storage
+
+import (
+	"fmt"
+	"os"
+)
+
+// mapping holds a graph file read into memory on platforms without mmap.
+// Loading still needs no decoding, but pages are not shared between processes.
+type mapping struct {
+	data []byte
+}
+
+// mapFile reads a whole file
+func mapFile(path string) (*mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return &mapping{data: data}, nil
+}
+
+// unmap releases the data
+func (m *mapping) unmap() {
+	m.data = nil
+}
@@ -0,0 +1,52 @@
+//go:build unix
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// mapping is a read-only memory-mapped graph file. Weight changes copy the
+// chunks of weights they modify to the heap, so all pages stay shared with
+// other processes mapping the same file.
+type mapping struct {
+	data []byte
+}
+
+// mapFile maps a whole file. It is unmapped once the graph using it is
+// garbage collected.
+func mapFile(path string) (*mapping, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	if stat.Size() == 0 || stat.Size() != int64(int(stat.Size())) {
+		return nil, fmt.Errorf("cannot map a file of %d bytes", stat.Size())
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map file: %w", err)
+	}
+	m := &mapping{data: data}
+	runtime.SetFinalizer(m, (*mapping).unmap)
+	return m, nil
+}
+
+// unmap releases the mapping
+func (m *mapping) unmap() {
+	if m.data != nil {
+		syscall.Munmap(m.data)
+		m.data = nil
+	}
+	runtime.SetFinalizer(m, nil)
+}
@@ -3,23 +3,41 @@ package storage
 import (
 	"bufio"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang/snappy"
+	"github.com/vamosdalian/nav/internal/atomicfile"
 	"github.com/vamosdalian/nav/internal/graph"
 )
 
 const (
-	// File format magic number and version
+	// File format magic number and the version 1 format, which is still read
 	magicNumber   uint32 = 0x4E415647 // "NAVG" in hex
 	formatVersion uint32 = 1
 )
 
+// snapshotTimeFormat names snapshot files so they sort chronologically
+const snapshotTimeFormat = "20060102T150405Z"
+
 // Storage handles graph persistence
 type Storage struct {
 	filepath string
+	mutex    sync.Mutex // Serializes snapshot writes
+
+	metaMutex sync.Mutex
+	meta      Metadata // Written by Save; read by Load
+	version   int      // Format version of the loaded file
+	layout    Layout   // Written by Save; read by Load
 }
 
 // NewStorage creates a new storage handler
@@ -27,34 +45,382 @@ func NewStorage(filepath string) *Storage {
 	return &Storage{filepath: filepath}
 }
 
-// Save serializes and saves the graph to disk using custom binary format
+// Path returns the graph file path
+func (s *Storage) Path() string {
+	return s.filepath
+}
+
+// SetMetadata sets the header written by Save. Counts, bounding box and
+// creation time are filled in from the graph.
+func (s *Storage) SetMetadata(meta Metadata) {
+	s.metaMutex.Lock()
+	defer s.metaMutex.Unlock()
+	s.meta = meta
+}
+
+// Metadata returns the header of the last loaded or saved file
+func (s *Storage) Metadata() Metadata {
+	s.metaMutex.Lock()
+	defer s.metaMutex.Unlock()
+	return s.meta
+}
+
+// FormatVersion returns the format version of the last loaded file
+func (s *Storage) FormatVersion() int {
+	s.metaMutex.Lock()
+	defer s.metaMutex.Unlock()
+	return s.version
+}
+
+// SetLayout sets the layout written by Save and SaveSnapshot
+func (s *Storage) SetLayout(layout Layout) {
+	s.metaMutex.Lock()
+	defer s.metaMutex.Unlock()
+	s.layout = layout
+}
+
+// Layout returns the layout of the last loaded file, or the one set for saving
+func (s *Storage) Layout() Layout {
+	s.metaMutex.Lock()
+	defer s.metaMutex.Unlock()
+	if s.layout == "" {
+		return LayoutCompressed
+	}
+	return s.layout
+}
+
+// setLoaded records the version, layout and header of a loaded file
+func (s *Storage) setLoaded(version int, layout Layout, meta Metadata) {
+	s.metaMutex.Lock()
+	defer s.metaMutex.Unlock()
+	s.version = version
+	s.layout = layout
+	s.meta = meta
+}
+
+// write saves a graph to path in the storage's layout. Weight changes publish
+// new graph snapshots instead of modifying the current one, so the exported
+// data stays consistent while it is written.
+func (s *Storage) write(path string, g *graph.Graph, meta Metadata) error {
+	if s.Layout() == LayoutMapped {
+		return writeMapped(path, g.CSR(), g.ExportExtras(), meta, s.filepath)
+	}
+	return writeFile(path, g.Export(), meta, s.filepath)
+}
+
+// Save serializes and saves the graph to disk in the current format.
+// The file is replaced atomically, so a crash never leaves a partial graph.
 func (s *Storage) Save(g *graph.Graph) error {
-	file, err := os.Create(s.filepath)
+	return s.write(s.filepath, g, s.Metadata())
+}
+
+// SaveSnapshot writes the current graph, including runtime weight changes, to
+// a new versioned file next to the graph file and returns its path. Routing
+// reads continue while the file is written.
+func (s *Storage) SaveSnapshot(g *graph.Graph) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	base := s.filepath + "." + time.Now().UTC().Format(snapshotTimeFormat)
+	path := base
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		path = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	// Snapshots keep the header of the graph file they derive from
+	meta := s.Metadata()
+	if info, err := Info(s.filepath); err == nil && info.Metadata != nil {
+		meta = *info.Metadata
+	}
+	if err := s.write(path, g, meta); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Info reads the format version, header and section table of a graph file
+// without loading the graph
+func Info(path string) (*FileInfo, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	// Use buffered writer for better I/O performance
-	bufWriter := bufio.NewWriterSize(file, 2*1024*1024) // 2MB buffer
-	defer bufWriter.Flush()
+	fr, err := openVersion2(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read graph file: %w", err)
+	}
+	if fr == nil {
+		return &FileInfo{Version: int(formatVersion), Layout: LayoutCompressed}, nil
+	}
+	info := &FileInfo{Version: int(formatVersion2), Layout: LayoutCompressed, Metadata: &fr.meta, Sections: fr.sections}
+	if fr.isMapped() {
+		info.Layout = LayoutMapped
+	}
+	return info, nil
+}
+
+// Verify checks the checksums of every section of a version 2 file
+func Verify(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	fr, err := openVersion2(file)
+	if err != nil {
+		return fmt.Errorf("failed to read graph file: %w", err)
+	}
+	if fr == nil {
+		return fmt.Errorf("version 1 files have no checksums")
+	}
+	return fr.verify()
+}
+
+// Migrate rewrites a graph file in the current format, keeping a copy of
+// the original at path+".v1". It reports false if the file is already current.
+func Migrate(path string, meta Metadata) (bool, error) {
+	info, err := Info(path)
+	if err != nil {
+		return false, err
+	}
+	if info.Version == int(formatVersion2) {
+		return false, nil
+	}
+
+	s := NewStorage(path)
+	g, err := s.Load()
+	if err != nil {
+		return false, err
+	}
+	original, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer original.Close()
+	err = atomicfile.Write(path+".v1", func(w io.Writer) error {
+		_, err := io.Copy(w, original)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to back up graph: %w", err)
+	}
+	s.SetMetadata(meta)
+	if err := s.Save(g); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WriteSection adds or replaces an extra section (for example SectionSpeeds)
+// in the graph file. The other sections are copied without being decoded.
+func (s *Storage) WriteSection(id string, encode func(io.Writer) error) error {
+	if len(id) != 4 || isGraphSection(id) {
+		return fmt.Errorf("invalid section id %q", id)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.Open(s.filepath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	fr, err := openVersion2(file)
+	if err != nil {
+		return fmt.Errorf("failed to read graph file: %w", err)
+	}
+	if fr == nil {
+		return fmt.Errorf("%s uses format version 1; migrate it first", s.filepath)
+	}
+
+	return replaceFile(s.filepath, func(w io.Writer) error {
+		fw, err := newFileWriter(w, &fr.meta)
+		if err != nil {
+			return err
+		}
+		for _, info := range fr.sections {
+			if info.ID == id {
+				continue
+			}
+			if err := fw.copySection(info, file); err != nil {
+				return err
+			}
+		}
+		if err := fw.writeSection(id, 0, encode); err != nil {
+			return err
+		}
+		return fw.finish()
+	})
+}
+
+// ReadSection decodes an extra section of the graph file, verifying its
+// checksum. It reports false if the file has no such section.
+func (s *Storage) ReadSection(id string, decode func(io.Reader) error) (bool, error) {
+	file, err := os.Open(s.filepath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	fr, err := openVersion2(file)
+	if err != nil {
+		return false, fmt.Errorf("failed to read graph file: %w", err)
+	}
+	if fr == nil {
+		return false, nil
+	}
+	return fr.readSection(id, decode)
+}
+
+// Snapshots returns the snapshot files of the graph, oldest first
+func (s *Storage) Snapshots() ([]string, error) {
+	matches, err := filepath.Glob(s.filepath + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []string
+	for _, path := range matches {
+		if isSnapshotSuffix(strings.TrimPrefix(path, s.filepath+".")) {
+			snapshots = append(snapshots, path)
+		}
+	}
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+// isSnapshotSuffix reports whether suffix is a snapshot time, optionally
+// followed by a "-N" counter
+func isSnapshotSuffix(suffix string) bool {
+	if len(suffix) < len(snapshotTimeFormat) {
+		return false
+	}
+	if _, err := time.Parse(snapshotTimeFormat, suffix[:len(snapshotTimeFormat)]); err != nil {
+		return false
+	}
+	counter := suffix[len(snapshotTimeFormat):]
+	if counter == "" {
+		return true
+	}
+	_, err := strconv.Atoi(strings.TrimPrefix(counter, "-"))
+	return strings.HasPrefix(counter, "-") && err == nil
+}
 
-	// Use snappy compression for fast compression/decompression
-	snappyWriter := snappy.NewBufferedWriter(bufWriter)
-	defer snappyWriter.Close()
+// writeFile encodes graph data to a temporary file and renames it to path.
+// Sections other than the graph data (embedded speed profiles, sections
+// added by newer versions) are carried over from the file at carry.
+func writeFile(path string, data *graph.ExportData, meta Metadata, carry string) error {
+	return replaceFile(path, func(w io.Writer) error {
+		meta.CreatedAt = time.Now().UTC()
+		meta.Profiles = append([]string(nil), meta.Profiles...)
+		sort.Strings(meta.Profiles)
+		describeData(&meta, data)
+		fw, err := newFileWriter(w, &meta)
+		if err != nil {
+			return err
+		}
+		for _, section := range graphSections {
+			if section.id == SectionElevation && !data.HasElevation {
+				continue
+			}
+			write := section.write
+			if err := fw.writeSection(section.id, section.flags, func(w io.Writer) error {
+				return write(w, data)
+			}); err != nil {
+				return err
+			}
+		}
+		if err := carrySections(fw, carry, ""); err != nil {
+			return err
+		}
+		return fw.finish()
+	})
+}
 
-	// Export graph data
-	data := g.Export()
+// replaceFile replaces a graph file atomically (see atomicfile.Write), so a
+// crash never leaves a partial file
+func replaceFile(path string, write func(io.Writer) error) error {
+	var encodeErr error
+	err := atomicfile.Write(path, func(w io.Writer) error {
+		// Use buffered writer for better I/O performance
+		bufWriter := bufio.NewWriterSize(w, 2*1024*1024) // 2MB buffer
+		if encodeErr = write(bufWriter); encodeErr != nil {
+			return encodeErr
+		}
+		return bufWriter.Flush()
+	})
+	if encodeErr != nil {
+		return fmt.Errorf("failed to encode graph: %w", encodeErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write graph: %w", err)
+	}
+	return nil
+}
 
-	// Write using custom binary format
-	if err := writeBinary(snappyWriter, data); err != nil {
-		return fmt.Errorf("failed to encode graph: %w", err)
+// carrySections copies the non-graph sections of a version 2 file, except
+// the one named by skip. A missing or version 1 file has none.
+func carrySections(fw *fileWriter, path, skip string) error {
+	if path == "" {
+		return nil
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
 	}
+	defer file.Close()
 
+	fr, err := openVersion2(file)
+	if err != nil || fr == nil {
+		return nil // Unreadable or version 1: nothing to carry over
+	}
+	for _, info := range fr.sections {
+		if isGraphSection(info.ID) || info.ID == skip {
+			continue
+		}
+		if err := fw.copySection(info, file); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// Load deserializes and loads the graph from disk using custom binary format
+// describeData fills in the counts and bounding box of the metadata
+func describeData(meta *Metadata, data *graph.ExportData) {
+	meta.Nodes = len(data.Nodes)
+	meta.Edges = 0
+	for _, edges := range data.Edges {
+		meta.Edges += len(edges)
+	}
+
+	meta.BBox = [4]float64{}
+	first := true
+	for _, node := range data.Nodes {
+		if first {
+			meta.BBox = [4]float64{node.Lon, node.Lat, node.Lon, node.Lat}
+			first = false
+			continue
+		}
+		meta.BBox[0] = math.Min(meta.BBox[0], node.Lon)
+		meta.BBox[1] = math.Min(meta.BBox[1], node.Lat)
+		meta.BBox[2] = math.Max(meta.BBox[2], node.Lon)
+		meta.BBox[3] = math.Max(meta.BBox[3], node.Lat)
+	}
+}
+
+// Load deserializes and loads the graph from disk. Files in the mapped layout
+// are memory-mapped instead of decoded. Version 1 files are still read;
+// Migrate rewrites them in the current format.
 func (s *Storage) Load() (*graph.Graph, error) {
 	file, err := os.Open(s.filepath)
 	if err != nil {
@@ -62,36 +428,124 @@ func (s *Storage) Load() (*graph.Graph, error) {
 	}
 	defer file.Close()
 
-	// Use buffered reader for better I/O performance
-	bufReader := bufio.NewReader(file)
-
-	// Use snappy decompression for fast decompression
-	snappyReader := snappy.NewReader(bufReader)
-
-	// Read using custom binary format
-	data, err := readBinary(snappyReader)
+	fr, err := openVersion2(file)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode graph: %w", err)
 	}
 
+	var data *graph.ExportData
+	switch {
+	case fr == nil:
+		// Version 1: a single snappy stream
+		data, err = readBinary(snappy.NewReader(bufio.NewReader(file)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode graph: %w", err)
+		}
+		s.setLoaded(1, LayoutCompressed, Metadata{})
+	case fr.isMapped():
+		g, meta, err := loadMapped(s.filepath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to map graph: %w", err)
+		}
+		s.setLoaded(2, LayoutMapped, meta)
+		return g, nil
+	default:
+		data, err = readSections(fr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode graph: %w", err)
+		}
+		s.setLoaded(2, LayoutCompressed, fr.meta)
+	}
+
 	// Reconstruct graph
 	g := graph.NewGraph()
 	g.Import(data)
+	if err := g.Compact(); err != nil {
+		return nil, fmt.Errorf("failed to compact graph: %w", err)
+	}
 
 	return g, nil
 }
 
-// writeBinary writes graph data in custom binary format (10-20x faster than gob)
-func writeBinary(w io.Writer, data *graph.ExportData) error {
-	// Write header
-	if err := binary.Write(w, binary.LittleEndian, magicNumber); err != nil {
-		return err
+// openVersion2 opens a version 2 file, or returns nil if the file is in the
+// version 1 format (which starts with a snappy stream identifier)
+func openVersion2(file *os.File) (*fileReader, error) {
+	var magic [4]byte
+	if _, err := file.ReadAt(magic[:], 0); err != nil {
+		return nil, err
 	}
-	if err := binary.Write(w, binary.LittleEndian, formatVersion); err != nil {
-		return err
+	if binary.LittleEndian.Uint32(magic[:]) != magicNumber {
+		return nil, nil
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
 	}
+	return openFile(file, stat.Size())
+}
 
-	// Write nodes
+// readSections decodes the graph sections of a version 2 file
+func readSections(fr *fileReader) (*graph.ExportData, error) {
+	data := &graph.ExportData{
+		Nodes:        make(map[int64]*graph.Node),
+		Edges:        make(map[int64][]graph.Edge),
+		Restrictions: make(map[int64][]graph.TurnRestriction),
+	}
+
+	// Fixed order: elevations need the nodes, directions need the edges
+	for _, section := range graphSections {
+		read := section.read
+		found, err := fr.readSection(section.id, func(r io.Reader) error {
+			return read(r, data)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !found && section.flags&flagRequired != 0 {
+			return nil, fmt.Errorf("missing section %s", section.id)
+		}
+	}
+	return data, nil
+}
+
+// graphSection encodes one part of the graph data
+type graphSection struct {
+	id    string
+	flags uint32
+	write func(io.Writer, *graph.ExportData) error
+	read  func(io.Reader, *graph.ExportData) error
+}
+
+// graphSections are written in this order and decoded in this order.
+// Reverse edges are not stored; Import rebuilds them from the edges.
+var graphSections = []graphSection{
+	{SectionNodes, flagRequired, writeNodes, readNodes},
+	{SectionEdges, flagRequired, writeEdges, readEdges},
+	{SectionRestrictions, flagRequired, writeRestrictions, readRestrictions},
+	{SectionDirections, flagRequired, writeEdgeDirections, readEdgeDirections},
+	{SectionElevation, 0, writeElevations, readElevations},
+	{SectionStations, 0, writeStations, readStations},
+	{SectionSignals, 0, writeSignals, readSignals},
+}
+
+// isGraphSection reports whether a section is part of the graph data in
+// either layout
+func isGraphSection(id string) bool {
+	for _, section := range graphSections {
+		if section.id == id {
+			return true
+		}
+	}
+	for _, section := range mappedSections {
+		if section.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNodes writes node IDs and coordinates
+func writeNodes(w io.Writer, data *graph.ExportData) error {
 	if err := binary.Write(w, binary.LittleEndian, int32(len(data.Nodes))); err != nil {
 		return err
 	}
@@ -106,40 +560,35 @@ func writeBinary(w io.Writer, data *graph.ExportData) error {
 			return err
 		}
 	}
+	return nil
+}
 
-	// Write edges
-	totalEdges := 0
-	for _, edgeList := range data.Edges {
-		totalEdges += len(edgeList)
-	}
-	if err := binary.Write(w, binary.LittleEndian, int32(totalEdges)); err != nil {
-		return err
-	}
-	for _, edgeList := range data.Edges {
-		for _, edge := range edgeList {
-			if err := writeEdge(w, &edge); err != nil {
-				return err
-			}
-		}
-	}
+// writeEdges writes the forward edges
+func writeEdges(w io.Writer, data *graph.ExportData) error {
+	return writeEdgeList(w, data.Edges)
+}
 
-	// Write reverse edges
-	totalReverseEdges := 0
-	for _, edgeList := range data.ReverseEdges {
-		totalReverseEdges += len(edgeList)
+// writeEdgeList writes the edges of an adjacency map
+func writeEdgeList(w io.Writer, edges map[int64][]graph.Edge) error {
+	total := 0
+	for _, edgeList := range edges {
+		total += len(edgeList)
 	}
-	if err := binary.Write(w, binary.LittleEndian, int32(totalReverseEdges)); err != nil {
+	if err := binary.Write(w, binary.LittleEndian, int32(total)); err != nil {
 		return err
 	}
-	for _, edgeList := range data.ReverseEdges {
+	for _, edgeList := range edges {
 		for _, edge := range edgeList {
 			if err := writeEdge(w, &edge); err != nil {
 				return err
 			}
 		}
 	}
+	return nil
+}
 
-	// Write restrictions
+// writeRestrictions writes turn restrictions
+func writeRestrictions(w io.Writer, data *graph.ExportData) error {
 	totalRestrictions := 0
 	for _, resList := range data.Restrictions {
 		totalRestrictions += len(resList)
@@ -163,7 +612,100 @@ func writeBinary(w io.Writer, data *graph.ExportData) error {
 			}
 		}
 	}
+	return nil
+}
+
+// writeEdgeDirections writes the edges that run against the node order of their way
+func writeEdgeDirections(w io.Writer, data *graph.ExportData) error {
+	var reversed []graph.Edge
+	for _, edges := range data.Edges {
+		for _, edge := range edges {
+			if edge.Reverse {
+				reversed = append(reversed, edge)
+			}
+		}
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, int32(len(reversed))); err != nil {
+		return err
+	}
+	for _, edge := range reversed {
+		for _, v := range []int64{edge.From, edge.To, edge.OSMWayID} {
+			if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
+// writeSignals writes the IDs of nodes with traffic signals
+func writeSignals(w io.Writer, data *graph.ExportData) error {
+	if err := binary.Write(w, binary.LittleEndian, int32(len(data.Signals))); err != nil {
+		return err
+	}
+	for id := range data.Signals {
+		if err := binary.Write(w, binary.LittleEndian, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeElevations writes node elevations (count 0 if the graph has none)
+func writeElevations(w io.Writer, data *graph.ExportData) error {
+	count := 0
+	if data.HasElevation {
+		count = len(data.Nodes)
+	}
+	if err := binary.Write(w, binary.LittleEndian, int32(count)); err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	for id, node := range data.Nodes {
+		if err := binary.Write(w, binary.LittleEndian, id); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, float32(node.Elevation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeStations writes EV charging stations
+func writeStations(w io.Writer, data *graph.ExportData) error {
+	if err := binary.Write(w, binary.LittleEndian, int32(len(data.Stations))); err != nil {
+		return err
+	}
+	for _, station := range data.Stations {
+		if err := binary.Write(w, binary.LittleEndian, station.ID); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, station.Lat); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, station.Lon); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, station.PowerKW); err != nil {
+			return err
+		}
+		if err := writeString(w, station.Name); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, int32(len(station.Connectors))); err != nil {
+			return err
+		}
+		for _, connector := range station.Connectors {
+			if err := writeString(w, connector); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -210,7 +752,8 @@ func writeString(w io.Writer, s string) error {
 	return err
 }
 
-// readBinary reads graph data in custom binary format
+// readBinary reads graph data in the version 1 format: one stream with a
+// header, fixed sections and optional trailing sections
 func readBinary(r io.Reader) (*graph.ExportData, error) {
 	data := &graph.ExportData{
 		Nodes:        make(map[int64]*graph.Node),
@@ -234,71 +777,106 @@ func readBinary(r io.Reader) (*graph.ExportData, error) {
 		return nil, fmt.Errorf("unsupported version: %d", version)
 	}
 
-	// Read nodes
+	if err := readNodes(r, data); err != nil {
+		return nil, err
+	}
+	if err := readEdges(r, data); err != nil {
+		return nil, err
+	}
+
+	// Read reverse edges
+	var reverseEdgeCount int32
+	if err := binary.Read(r, binary.LittleEndian, &reverseEdgeCount); err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(reverseEdgeCount); i++ {
+		edge, err := readEdge(r)
+		if err != nil {
+			return nil, err
+		}
+		data.ReverseEdges[edge.To] = append(data.ReverseEdges[edge.To], *edge)
+	}
+
+	if err := readRestrictions(r, data); err != nil {
+		return nil, err
+	}
+
+	// Optional trailing sections
+	if err := readElevations(r, data); err != nil {
+		return nil, err
+	}
+	if err := readStations(r, data); err != nil {
+		return nil, err
+	}
+	if err := readSignals(r, data); err != nil {
+		return nil, err
+	}
+	if err := readEdgeDirections(r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// readNodes reads node IDs and coordinates
+func readNodes(r io.Reader, data *graph.ExportData) error {
 	var nodeCount int32
 	if err := binary.Read(r, binary.LittleEndian, &nodeCount); err != nil {
-		return nil, err
+		return err
 	}
 	for i := 0; i < int(nodeCount); i++ {
 		var id int64
 		var lat, lon float64
 		if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
-			return nil, err
+			return err
 		}
 		if err := binary.Read(r, binary.LittleEndian, &lat); err != nil {
-			return nil, err
+			return err
 		}
 		if err := binary.Read(r, binary.LittleEndian, &lon); err != nil {
-			return nil, err
+			return err
 		}
 		data.Nodes[id] = &graph.Node{ID: id, Lat: lat, Lon: lon}
 	}
+	return nil
+}
 
-	// Read edges
+// readEdges reads the forward edges
+func readEdges(r io.Reader, data *graph.ExportData) error {
 	var edgeCount int32
 	if err := binary.Read(r, binary.LittleEndian, &edgeCount); err != nil {
-		return nil, err
+		return err
 	}
 	for i := 0; i < int(edgeCount); i++ {
 		edge, err := readEdge(r)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		data.Edges[edge.From] = append(data.Edges[edge.From], *edge)
 	}
+	return nil
+}
 
-	// Read reverse edges
-	var reverseEdgeCount int32
-	if err := binary.Read(r, binary.LittleEndian, &reverseEdgeCount); err != nil {
-		return nil, err
-	}
-	for i := 0; i < int(reverseEdgeCount); i++ {
-		edge, err := readEdge(r)
-		if err != nil {
-			return nil, err
-		}
-		data.ReverseEdges[edge.To] = append(data.ReverseEdges[edge.To], *edge)
-	}
-
-	// Read restrictions
+// readRestrictions reads turn restrictions
+func readRestrictions(r io.Reader, data *graph.ExportData) error {
 	var restrictionCount int32
 	if err := binary.Read(r, binary.LittleEndian, &restrictionCount); err != nil {
-		return nil, err
+		return err
 	}
 	for i := 0; i < int(restrictionCount); i++ {
 		var fromWay, viaNode, toWay int64
 		if err := binary.Read(r, binary.LittleEndian, &fromWay); err != nil {
-			return nil, err
+			return err
 		}
 		if err := binary.Read(r, binary.LittleEndian, &viaNode); err != nil {
-			return nil, err
+			return err
 		}
 		if err := binary.Read(r, binary.LittleEndian, &toWay); err != nil {
-			return nil, err
+			return err
 		}
 		resType, err := readString(r)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		data.Restrictions[viaNode] = append(data.Restrictions[viaNode], graph.TurnRestriction{
 			FromWay: fromWay,
@@ -307,8 +885,142 @@ func readBinary(r io.Reader) (*graph.ExportData, error) {
 			Type:    resType,
 		})
 	}
+	return nil
+}
 
-	return data, nil
+// readElevations reads node elevations; a missing section (older file) is not an error
+func readElevations(r io.Reader, data *graph.ExportData) error {
+	var count int32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+
+	for i := 0; i < int(count); i++ {
+		var id int64
+		var elevation float32
+		if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
+			return err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &elevation); err != nil {
+			return err
+		}
+		if node, exists := data.Nodes[id]; exists {
+			node.Elevation = float64(elevation)
+		}
+	}
+	data.HasElevation = count > 0
+
+	return nil
+}
+
+// readStations reads EV charging stations; a missing section (older file) is not an error
+func readStations(r io.Reader, data *graph.ExportData) error {
+	var count int32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+	if count < 0 {
+		return fmt.Errorf("invalid station count %d", count)
+	}
+
+	for i := 0; i < int(count); i++ {
+		var station graph.ChargingStation
+		if err := binary.Read(r, binary.LittleEndian, &station.ID); err != nil {
+			return err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &station.Lat); err != nil {
+			return err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &station.Lon); err != nil {
+			return err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &station.PowerKW); err != nil {
+			return err
+		}
+		name, err := readString(r)
+		if err != nil {
+			return err
+		}
+		station.Name = name
+
+		var connectorCount int32
+		if err := binary.Read(r, binary.LittleEndian, &connectorCount); err != nil {
+			return err
+		}
+		if connectorCount < 0 {
+			return fmt.Errorf("invalid connector count %d for station %d", connectorCount, station.ID)
+		}
+		for j := 0; j < int(connectorCount); j++ {
+			connector, err := readString(r)
+			if err != nil {
+				return err
+			}
+			station.Connectors = append(station.Connectors, connector)
+		}
+
+		data.Stations = append(data.Stations, station)
+	}
+
+	return nil
+}
+
+// readSignals reads traffic signal node IDs; a missing section (older file) is not an error
+func readSignals(r io.Reader, data *graph.ExportData) error {
+	var count int32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+
+	data.Signals = make(map[int64]bool, count)
+	for i := 0; i < int(count); i++ {
+		var id int64
+		if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
+			return err
+		}
+		data.Signals[id] = true
+	}
+	return nil
+}
+
+// readEdgeDirections marks reversed edges; a missing section (older file) is not an error
+func readEdgeDirections(r io.Reader, data *graph.ExportData) error {
+	var count int32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+
+	for i := 0; i < int(count); i++ {
+		var from, to, wayID int64
+		for _, v := range []*int64{&from, &to, &wayID} {
+			if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+		markReversed(data.Edges[from], from, to, wayID)
+		markReversed(data.ReverseEdges[to], from, to, wayID)
+	}
+	return nil
+}
+
+// markReversed sets Reverse on the matching edges of a way
+func markReversed(edges []graph.Edge, from, to, wayID int64) {
+	for i := range edges {
+		if edges[i].OSMWayID == wayID && edges[i].From == from && edges[i].To == to {
+			edges[i].Reverse = true
+		}
+	}
 }
 
 // readEdge reads a single edge
@@ -359,6 +1071,9 @@ func readString(r io.Reader) (string, error) {
 	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
 		return "", err
 	}
+	if length < 0 {
+		return "", fmt.Errorf("invalid string length %d", length)
+	}
 	buf := make([]byte, length)
 	if _, err := io.ReadFull(r, buf); err != nil {
 		return "", err
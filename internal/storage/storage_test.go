@@ -2,6 +2,7 @@ package storage
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/vamosdalian/nav/internal/graph"
@@ -243,6 +244,110 @@ func TestSaveAndLoadWithComplexTags(t *testing.T) {
 	}
 }
 
+func TestSaveAndLoadWithElevation(t *testing.T) {
+	g := createTestGraph()
+	g.SetElevation(1, 12.5)
+	g.SetElevation(2, 48.0)
+
+	tmpFile := "test_elevation.bin.snappy"
+	defer os.Remove(tmpFile)
+
+	store := NewStorage(tmpFile)
+	if err := store.Save(g); err != nil {
+		t.Fatalf("Failed to save graph: %v", err)
+	}
+
+	loadedGraph, err := store.Load()
+	if err != nil {
+		t.Fatalf("Failed to load graph: %v", err)
+	}
+
+	if !loadedGraph.HasElevation() {
+		t.Fatal("Expected loaded graph to have elevation data")
+	}
+	node, _ := loadedGraph.GetNode(2)
+	if node.Elevation != 48.0 {
+		t.Errorf("Expected elevation 48.0 for node 2, got %.2f", node.Elevation)
+	}
+}
+
+func TestSaveAndLoadSignalsAndDirections(t *testing.T) {
+	g := createTestGraph()
+	g.AddTrafficSignal(3)
+	g.AddEdge(graph.Edge{From: 2, To: 1, Weight: 1234.56, OSMWayID: 100, MaxSpeed: 30.0, Reverse: true})
+
+	tmpFile := "test_signals.bin.snappy"
+	defer os.Remove(tmpFile)
+
+	store := NewStorage(tmpFile)
+	if err := store.Save(g); err != nil {
+		t.Fatalf("Failed to save graph: %v", err)
+	}
+
+	loadedGraph, err := store.Load()
+	if err != nil {
+		t.Fatalf("Failed to load graph: %v", err)
+	}
+
+	if !loadedGraph.HasTrafficSignal(3) || loadedGraph.HasTrafficSignal(2) {
+		t.Error("Expected only node 3 to have a traffic signal")
+	}
+
+	forward, _ := loadedGraph.EdgeBetween(1, 2)
+	backward, _ := loadedGraph.EdgeBetween(2, 1)
+	if forward.Reverse || !backward.Reverse {
+		t.Errorf("Expected only edge 2->1 to be reversed, got forward=%v backward=%v", forward.Reverse, backward.Reverse)
+	}
+	for _, edge := range loadedGraph.GetReverseEdges(1) {
+		if edge.From == 2 && !edge.Reverse {
+			t.Error("Expected reverse adjacency of edge 2->1 to be reversed")
+		}
+	}
+}
+
+func TestSaveSnapshot(t *testing.T) {
+	g := createTestGraph()
+	if err := g.UpdateEdgeWeight(1, 2, 99); err != nil {
+		t.Fatalf("Failed to update weight: %v", err)
+	}
+
+	dir := t.TempDir()
+	store := NewStorage(filepath.Join(dir, "graph.bin.snappy"))
+	first, err := store.SaveSnapshot(g)
+	if err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+	second, err := store.SaveSnapshot(g)
+	if err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+	if first == second {
+		t.Errorf("Expected distinct snapshot files, got %s twice", first)
+	}
+
+	// Unrelated files next to the graph are not snapshots
+	os.WriteFile(filepath.Join(dir, "graph.bin.snappy.speeds"), nil, 0o644)
+	snapshots, err := store.Snapshots()
+	if err != nil {
+		t.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0] != first || snapshots[1] != second {
+		t.Errorf("Expected snapshots [%s %s], got %v", first, second, snapshots)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Errorf("Expected no temporary files to be left behind, got %d files", len(entries))
+	}
+
+	loaded, err := NewStorage(second).Load()
+	if err != nil {
+		t.Fatalf("Failed to load snapshot: %v", err)
+	}
+	if edge, _ := loaded.EdgeBetween(1, 2); edge.Weight != 99 {
+		t.Errorf("Expected runtime weight 99 in snapshot, got %v", edge.Weight)
+	}
+	verifyGraphsEqual(t, g, loaded)
+}
+
 func TestInvalidFileFormat(t *testing.T) {
 	// Create file with invalid magic number
 	tmpFile := "test_invalid.bin.snappy"
@@ -0,0 +1,339 @@
+// Package tagexpr parses and evaluates boolean expressions over OSM tags, e.g.
+//
+//	highway=residential AND (surface=gravel OR surface=dirt) AND NOT bridge
+//
+// Conditions are `key` (tag present and not "no"), `key=value` (or `==`), `key!=value` and numeric
+// comparisons (`maxspeed>=80`). They combine with AND/&&, OR/|| and NOT/!
+// (keywords are case-insensitive) and parentheses. Values containing spaces
+// or operators can be quoted with single or double quotes.
+package tagexpr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Lookup returns the value of a tag and whether it is present
+type Lookup func(key string) (string, bool)
+
+// Expr is a parsed tag expression
+type Expr struct {
+	source string
+	root   node
+}
+
+// Parse parses a tag expression
+func Parse(source string) (*Expr, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.tokens[p.pos].text, p.tokens[p.pos].offset)
+	}
+	return &Expr{source: strings.TrimSpace(source), root: root}, nil
+}
+
+// String returns the expression as written
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Match evaluates the expression against a tag map
+func (e *Expr) Match(tags map[string]string) bool {
+	return e.Eval(func(key string) (string, bool) {
+		value, ok := tags[key]
+		return value, ok
+	})
+}
+
+// Eval evaluates the expression with a custom tag lookup
+func (e *Expr) Eval(lookup Lookup) bool {
+	return e.root.eval(lookup)
+}
+
+// Keys returns the tag keys the expression refers to
+func (e *Expr) Keys() []string {
+	seen := map[string]bool{}
+	var keys []string
+	e.root.keys(func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	})
+	return keys
+}
+
+// node is an element of the expression tree
+type node interface {
+	eval(lookup Lookup) bool
+	keys(fn func(string))
+}
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ inner node }
+
+// condition compares a tag with a value (op "" tests presence)
+type condition struct {
+	key   string
+	op    string
+	value string
+	num   float64 // Parsed value for numeric comparisons
+}
+
+func (n andNode) eval(l Lookup) bool { return n.left.eval(l) && n.right.eval(l) }
+func (n orNode) eval(l Lookup) bool  { return n.left.eval(l) || n.right.eval(l) }
+func (n notNode) eval(l Lookup) bool { return !n.inner.eval(l) }
+
+func (n andNode) keys(fn func(string)) { n.left.keys(fn); n.right.keys(fn) }
+func (n orNode) keys(fn func(string))  { n.left.keys(fn); n.right.keys(fn) }
+func (n notNode) keys(fn func(string)) { n.inner.keys(fn) }
+func (c condition) keys(fn func(string)) {
+	fn(c.key)
+}
+
+func (c condition) eval(lookup Lookup) bool {
+	value, ok := lookup(c.key)
+	switch c.op {
+	case "":
+		return ok && value != "no"
+	case "=":
+		return ok && value == c.value
+	case "!=":
+		return !ok || value != c.value
+	}
+
+	if !ok {
+		return false
+	}
+	num, err := parseNumber(value)
+	if err != nil {
+		return false
+	}
+	switch c.op {
+	case "<":
+		return num < c.num
+	case "<=":
+		return num <= c.num
+	case ">":
+		return num > c.num
+	case ">=":
+		return num >= c.num
+	}
+	return false
+}
+
+// parseNumber reads the leading number of a tag value ("50", "50 mph", "3.5")
+func parseNumber(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	end := 0
+	for end < len(value) && (value[end] == '.' || value[end] == '-' || (value[end] >= '0' && value[end] <= '9')) {
+		end++
+	}
+	return strconv.ParseFloat(value[:end], 64)
+}
+
+// Token kinds
+const (
+	tokenWord = iota
+	tokenString
+	tokenOp
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind   int
+	text   string
+	offset int
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenOpen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenClose, ")", i})
+			i++
+		case strings.HasPrefix(source[i:], "&&"):
+			tokens = append(tokens, token{tokenAnd, "&&", i})
+			i += 2
+		case strings.HasPrefix(source[i:], "||"):
+			tokens = append(tokens, token{tokenOr, "||", i})
+			i += 2
+		case strings.HasPrefix(source[i:], "=="):
+			tokens = append(tokens, token{tokenOp, "=", i})
+			i += 2
+		case strings.HasPrefix(source[i:], "!="), strings.HasPrefix(source[i:], "<="), strings.HasPrefix(source[i:], ">="):
+			tokens = append(tokens, token{tokenOp, source[i : i+2], i})
+			i += 2
+		case c == '!':
+			tokens = append(tokens, token{tokenNot, "!", i})
+			i++
+		case c == '=' || c == '<' || c == '>':
+			tokens = append(tokens, token{tokenOp, string(c), i})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(source[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, token{tokenString, source[i+1 : i+1+end], i})
+			i += end + 2
+		default:
+			start := i
+			for i < len(source) && isWordChar(rune(source[i])) {
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+			word := source[start:i]
+			kind := tokenWord
+			switch strings.ToUpper(word) {
+			case "AND":
+				kind = tokenAnd
+			case "OR":
+				kind = tokenOr
+			case "NOT":
+				kind = tokenNot
+			}
+			tokens = append(tokens, token{kind, word, start})
+		}
+	}
+	return tokens, nil
+}
+
+// isWordChar reports whether c can appear in an unquoted tag key or value
+func isWordChar(c rune) bool {
+	if unicode.IsLetter(c) || unicode.IsDigit(c) || c >= 0x80 {
+		return true
+	}
+	return strings.ContainsRune("_:.-+*/;@#", c)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() *token {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == tokenOr; t = p.peek() {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == tokenAnd; t = p.peek() {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if t := p.peek(); t != nil && t.kind == tokenNot {
+		p.pos++
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	switch t.kind {
+	case tokenOpen:
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.peek(); closing == nil || closing.kind != tokenClose {
+			return nil, fmt.Errorf("missing closing parenthesis for position %d", t.offset)
+		}
+		p.pos++
+		return inner, nil
+
+	case tokenWord, tokenString:
+		p.pos++
+		cond := condition{key: t.text}
+		op := p.peek()
+		if op == nil || op.kind != tokenOp {
+			return cond, nil
+		}
+		p.pos++
+
+		value := p.peek()
+		if value == nil || (value.kind != tokenWord && value.kind != tokenString) {
+			return nil, fmt.Errorf("missing value after %q at position %d", op.text, op.offset)
+		}
+		p.pos++
+		cond.op = op.text
+		cond.value = value.text
+
+		if cond.op != "=" && cond.op != "!=" {
+			num, err := parseNumber(value.text)
+			if err != nil {
+				return nil, fmt.Errorf("%s needs a number, got %q", cond.op, value.text)
+			}
+			cond.num = num
+		}
+		return cond, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.offset)
+}
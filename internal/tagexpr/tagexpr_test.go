@@ -0,0 +1,84 @@
+package tagexpr
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tags := map[string]string{
+		"highway":  "residential",
+		"surface":  "gravel",
+		"maxspeed": "30 mph",
+		"bridge":   "no",
+		"name":     "Rue de la Paix",
+	}
+
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{"highway=residential", true},
+		{"highway=primary", false},
+		{"highway==residential && surface==gravel", true},
+		{"highway=residential AND surface=gravel", true},
+		{"highway=residential && surface=asphalt", false},
+		{"highway=primary OR surface=gravel", true},
+		{"highway=primary || surface=asphalt", false},
+		{"NOT highway=primary", true},
+		{"!surface", false},
+		{"surface", true},
+		{"bridge", false},
+		{"tunnel", false},
+		{"tunnel!=yes", true},
+		{"highway!=residential", false},
+		{"maxspeed>=30 AND maxspeed<31", true},
+		{"maxspeed>50", false},
+		{"lanes>1", false},
+		{"name='Rue de la Paix'", true},
+		{`name="Rue de la Paix" and not (highway=primary or highway=trunk)`, true},
+		{"highway=residential AND (surface=asphalt OR surface=gravel)", true},
+		{"highway=residential AND surface=asphalt OR surface=gravel", true}, // AND binds tighter
+		{"highway=primary AND (surface=asphalt OR surface=gravel)", false},
+	}
+
+	for _, tt := range tests {
+		expr, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got := expr.Match(tags); got != tt.expected {
+			t.Errorf("%q: expected %v, got %v", tt.expr, tt.expected, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, source := range []string{
+		"",
+		"highway=",
+		"(highway=primary",
+		"highway=primary)",
+		"highway=primary AND",
+		"maxspeed>fast",
+		"name='unterminated",
+		"highway===primary",
+		"AND highway=primary",
+	} {
+		if _, err := Parse(source); err == nil {
+			t.Errorf("Parse(%q): expected error", source)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	expr, err := Parse("highway=residential AND (surface=gravel OR NOT highway=track) AND maxspeed>30")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	keys := expr.Keys()
+	if len(keys) != 3 || keys[0] != "highway" || keys[1] != "surface" || keys[2] != "maxspeed" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	if expr.String() != "highway=residential AND (surface=gravel OR NOT highway=track) AND maxspeed>30" {
+		t.Errorf("unexpected string %q", expr.String())
+	}
+}
@@ -0,0 +1,157 @@
+package traffic
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directions of an observation keyed by way ID
+const (
+	DirectionBoth     = ""
+	DirectionForward  = "forward"  // Along the node order of the way
+	DirectionBackward = "backward" // Against the node order of the way
+)
+
+// Observation is a measured speed on a road, keyed either by OSM way ID
+// (+ optional direction) or by a pair of adjacent node IDs
+type Observation struct {
+	WayID     int64     `json:"way_id,omitempty"`
+	Direction string    `json:"direction,omitempty"`
+	From      int64     `json:"from,omitempty"`
+	To        int64     `json:"to,omitempty"`
+	SpeedKmh  float64   `json:"speed_kmh"`
+	Timestamp time.Time `json:"timestamp,omitempty"` // Measurement time (default: time of ingestion)
+	TTL       float64   `json:"ttl,omitempty"`       // Seconds the observation stays valid (default: store TTL)
+}
+
+// Validate checks that the observation is keyed and has a sensible speed
+func (o *Observation) Validate() error {
+	if o.WayID == 0 && (o.From == 0 || o.To == 0) {
+		return fmt.Errorf("observation needs way_id or from/to node IDs")
+	}
+	switch o.Direction {
+	case DirectionBoth, DirectionForward, DirectionBackward:
+	default:
+		return fmt.Errorf("invalid direction %q (expected forward or backward)", o.Direction)
+	}
+	if o.SpeedKmh < 0 {
+		return fmt.Errorf("speed_kmh must not be negative")
+	}
+	if o.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+	return nil
+}
+
+// ParseJSON reads observations from a JSON array or an object with an "observations" array
+func ParseJSON(r io.Reader) ([]Observation, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Observation
+	if err := json.Unmarshal(data, &list); err == nil {
+		return list, nil
+	}
+
+	var batch struct {
+		Observations []Observation `json:"observations"`
+	}
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, fmt.Errorf("invalid JSON observations: %w", err)
+	}
+	return batch.Observations, nil
+}
+
+// ParseCSV reads observations from CSV with a header row. Known columns are
+// way_id, direction, from, to, speed_kmh, timestamp (RFC 3339 or Unix seconds) and ttl.
+func ParseCSV(r io.Reader) ([]Observation, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["speed_kmh"]; !ok {
+		return nil, fmt.Errorf("CSV header needs a speed_kmh column")
+	}
+
+	var list []Observation
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		var obs Observation
+		if obs.WayID, err = parseInt(field("way_id")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid way_id: %w", line, err)
+		}
+		if obs.From, err = parseInt(field("from")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid from: %w", line, err)
+		}
+		if obs.To, err = parseInt(field("to")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid to: %w", line, err)
+		}
+		if obs.SpeedKmh, err = strconv.ParseFloat(field("speed_kmh"), 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid speed_kmh: %w", line, err)
+		}
+		if obs.Timestamp, err = parseTimestamp(field("timestamp")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid timestamp: %w", line, err)
+		}
+		if ttl := field("ttl"); ttl != "" {
+			if obs.TTL, err = strconv.ParseFloat(ttl, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid ttl: %w", line, err)
+			}
+		}
+		obs.Direction = strings.ToLower(field("direction"))
+
+		list = append(list, obs)
+	}
+	return list, nil
+}
+
+func parseInt(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// parseTimestamp accepts RFC 3339 or Unix seconds; empty means unset
+func parseTimestamp(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
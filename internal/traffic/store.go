@@ -0,0 +1,345 @@
+package traffic
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// minSpeedKmh is the lowest speed applied, so standstill traffic stays routable at a high cost
+const minSpeedKmh = 1.0
+
+// Store holds time-expiring speed overrides on top of the base edge speeds.
+// Each observation replaces the previous override of its edges, so repeated
+// updates never compound, and expired or reset overrides fall back to the baseline.
+type Store struct {
+	graph      *graph.Graph
+	ttl        time.Duration
+	wayEdges   map[int64][]wayEdge
+	overrides  map[edgeKey]override
+	lastUpdate time.Time // Ingestion time of the last batch
+	newest     time.Time // Newest observation timestamp
+	mutex      sync.RWMutex
+	now        func() time.Time
+	onChange   func()
+	timer      *time.Timer            // Fires when the next override expires
+	speeds     atomic.Pointer[Speeds] // Overrides in effect; nil after a change
+}
+
+// Speeds is an immutable set of the speed overrides in effect at a point in
+// time. Lookups take no lock, so a search takes the set once and queries it per edge.
+type Speeds struct {
+	speeds map[edgeKey]float64 // m/s
+	from   time.Time           // The set is valid from this time until the first override expires
+	until  time.Time           // Zero if there are no overrides
+}
+
+// edgeKey identifies a directed edge
+type edgeKey struct {
+	from, to int64
+}
+
+// wayEdge is an edge of a way with its direction
+type wayEdge struct {
+	key     edgeKey
+	reverse bool
+}
+
+// override is an observed speed on an edge
+type override struct {
+	speed      float64 // m/s
+	observedAt time.Time
+	expiresAt  time.Time
+}
+
+// Result summarises the ingestion of a batch
+type Result struct {
+	Received     int `json:"received"`
+	Applied      int `json:"applied"`       // Observations that matched at least one edge
+	EdgesUpdated int `json:"edges_updated"` // Edges that got a new override
+	Unmatched    int `json:"unmatched"`     // Observations without matching edges
+	Stale        int `json:"stale"`         // Expired or older than the current override
+}
+
+// Status describes the freshness of the traffic data
+type Status struct {
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`  // Ingestion time of the last batch
+	ObservedAt      *time.Time `json:"observed_at,omitempty"` // Newest observation timestamp
+	AgeSeconds      *float64   `json:"age_seconds,omitempty"` // Age of the newest observation
+	ActiveOverrides int        `json:"active_overrides"`
+}
+
+// NewStore creates a traffic store for a graph; ttl is the default validity of observations
+func NewStore(g *graph.Graph, ttl time.Duration) *Store {
+	return &Store{
+		graph:     g,
+		ttl:       ttl,
+		wayEdges:  indexWays(g),
+		overrides: make(map[edgeKey]override),
+		now:       time.Now,
+	}
+}
+
+// SetGraph switches the store to a new graph. Overrides are kept for edges
+// that still exist in it.
+func (s *Store) SetGraph(g *graph.Graph) {
+	wayEdges := indexWays(g)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.graph = g
+	s.wayEdges = wayEdges
+	for key := range s.overrides {
+		if _, exists := g.EdgeBetween(key.from, key.to); !exists {
+			delete(s.overrides, key)
+		}
+	}
+	s.changed()
+}
+
+// OnChange sets a function called whenever the speed overrides change:
+// observations are applied, overrides are reset or expire, or the store is
+// rebound to a new graph. It is called on its own goroutine.
+func (s *Store) OnChange(fn func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onChange = fn
+	s.schedule()
+}
+
+// indexWays groups the edges of a graph by OSM way
+func indexWays(g *graph.Graph) map[int64][]wayEdge {
+	wayEdges := make(map[int64][]wayEdge)
+	for _, nodeID := range g.NodeIDs() {
+		for _, edge := range g.GetEdges(nodeID) {
+			wayEdges[edge.OSMWayID] = append(wayEdges[edge.OSMWayID], wayEdge{
+				key:     edgeKey{from: edge.From, to: edge.To},
+				reverse: edge.Reverse,
+			})
+		}
+	}
+	return wayEdges
+}
+
+// Apply validates a batch of observations and applies them as speed overrides
+func (s *Store) Apply(observations []Observation) (Result, error) {
+	for i := range observations {
+		if err := observations[i].Validate(); err != nil {
+			return Result{}, fmt.Errorf("observation %d: %w", i, err)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	result := Result{Received: len(observations)}
+
+	for _, obs := range observations {
+		observedAt := obs.Timestamp
+		if observedAt.IsZero() {
+			observedAt = now
+		}
+		ttl := s.ttl
+		if obs.TTL > 0 {
+			ttl = time.Duration(obs.TTL * float64(time.Second))
+		}
+		expiresAt := observedAt.Add(ttl)
+		if !expiresAt.After(now) {
+			result.Stale++
+			continue
+		}
+
+		keys := s.resolve(&obs)
+		if len(keys) == 0 {
+			result.Unmatched++
+			continue
+		}
+
+		speed := obs.SpeedKmh
+		if speed < minSpeedKmh {
+			speed = minSpeedKmh
+		}
+
+		updated := 0
+		for _, key := range keys {
+			if current, exists := s.overrides[key]; exists && current.observedAt.After(observedAt) {
+				continue
+			}
+			s.overrides[key] = override{speed: speed / 3.6, observedAt: observedAt, expiresAt: expiresAt}
+			updated++
+		}
+		if updated == 0 {
+			result.Stale++
+			continue
+		}
+
+		result.Applied++
+		result.EdgesUpdated += updated
+		if observedAt.After(s.newest) {
+			s.newest = observedAt
+		}
+	}
+
+	s.lastUpdate = now
+	purged := s.purgeExpired(now)
+	if result.EdgesUpdated > 0 || purged > 0 {
+		s.changed()
+	}
+	return result, nil
+}
+
+// Speed returns the observed speed (m/s) of an edge if an override is active.
+// Searches should take the Speeds set once instead.
+func (s *Store) Speed(edge *graph.Edge) (float64, bool) {
+	return s.Speeds().Speed(edge)
+}
+
+// Speeds returns the overrides in effect now. The set is shared until the
+// overrides change or one of them expires.
+func (s *Store) Speeds() *Speeds {
+	now := s.now()
+	if sp := s.speeds.Load(); sp != nil && !now.Before(sp.from) && (sp.until.IsZero() || now.Before(sp.until)) {
+		return sp
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	sp := &Speeds{speeds: make(map[edgeKey]float64, len(s.overrides)), from: now}
+	for key, o := range s.overrides {
+		if !now.Before(o.expiresAt) {
+			continue
+		}
+		sp.speeds[key] = o.speed
+		if sp.until.IsZero() || o.expiresAt.Before(sp.until) {
+			sp.until = o.expiresAt
+		}
+	}
+	s.speeds.Store(sp)
+	return sp
+}
+
+// Speed returns the observed speed (m/s) of an edge if it has an override
+func (sp *Speeds) Speed(edge *graph.Edge) (float64, bool) {
+	speed, exists := sp.speeds[edgeKey{from: edge.From, to: edge.To}]
+	return speed, exists
+}
+
+// Reset removes all overrides so every edge is back at its base speed
+func (s *Store) Reset() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := len(s.overrides)
+	s.overrides = make(map[edgeKey]override)
+	s.newest = time.Time{}
+	if count > 0 {
+		s.changed()
+	}
+	return count
+}
+
+// Status returns the age of the traffic data and the number of active overrides
+func (s *Store) Status() Status {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := s.now()
+	status := Status{}
+	for _, o := range s.overrides {
+		if now.Before(o.expiresAt) {
+			status.ActiveOverrides++
+		}
+	}
+
+	if !s.lastUpdate.IsZero() {
+		updatedAt := s.lastUpdate.UTC()
+		status.UpdatedAt = &updatedAt
+	}
+	if !s.newest.IsZero() {
+		observedAt := s.newest.UTC()
+		age := now.Sub(s.newest).Seconds()
+		status.ObservedAt = &observedAt
+		status.AgeSeconds = &age
+	}
+	return status
+}
+
+// resolve returns the edges an observation applies to (caller holds the lock)
+func (s *Store) resolve(obs *Observation) []edgeKey {
+	if obs.From != 0 && obs.To != 0 {
+		if _, exists := s.graph.EdgeBetween(obs.From, obs.To); exists {
+			return []edgeKey{{from: obs.From, to: obs.To}}
+		}
+		return nil
+	}
+
+	var keys []edgeKey
+	for _, e := range s.wayEdges[obs.WayID] {
+		switch {
+		case obs.Direction == DirectionForward && e.reverse:
+		case obs.Direction == DirectionBackward && !e.reverse:
+		default:
+			keys = append(keys, e.key)
+		}
+	}
+	return keys
+}
+
+// purgeExpired drops overrides that are no longer valid and returns their
+// number (caller holds the lock)
+func (s *Store) purgeExpired(now time.Time) int {
+	count := 0
+	for key, o := range s.overrides {
+		if !now.Before(o.expiresAt) {
+			delete(s.overrides, key)
+			count++
+		}
+	}
+	return count
+}
+
+// changed notifies the change listener and schedules the next notification
+// (caller holds the lock)
+func (s *Store) changed() {
+	s.speeds.Store(nil)
+	if s.onChange != nil {
+		go s.onChange()
+	}
+	s.schedule()
+}
+
+// schedule sets the timer to the next expiry of an override, when the
+// speeds change without a call to the store (caller holds the lock)
+func (s *Store) schedule() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.onChange == nil {
+		return
+	}
+
+	var next time.Time
+	for _, o := range s.overrides {
+		if next.IsZero() || o.expiresAt.Before(next) {
+			next = o.expiresAt
+		}
+	}
+	if !next.IsZero() {
+		s.timer = time.AfterFunc(next.Sub(s.now()), s.expire)
+	}
+}
+
+// expire drops the expired overrides and notifies the change listener
+func (s *Store) expire() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.purgeExpired(s.now())
+	s.changed()
+}
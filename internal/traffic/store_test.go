@@ -0,0 +1,173 @@
+package traffic
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// createTestGraph creates a two-way road 1-2-3 (way 100) and a one-way road 3-4 (way 200)
+func createTestGraph() *graph.Graph {
+	g := graph.NewGraph()
+	for i := int64(1); i <= 4; i++ {
+		g.AddNode(&graph.Node{ID: i, Lat: 43.0, Lon: 7.0 + float64(i)*0.01})
+	}
+	g.AddEdge(graph.Edge{From: 1, To: 2, Weight: 800, OSMWayID: 100, MaxSpeed: 13.89})
+	g.AddEdge(graph.Edge{From: 2, To: 1, Weight: 800, OSMWayID: 100, MaxSpeed: 13.89, Reverse: true})
+	g.AddEdge(graph.Edge{From: 2, To: 3, Weight: 800, OSMWayID: 100, MaxSpeed: 13.89})
+	g.AddEdge(graph.Edge{From: 3, To: 2, Weight: 800, OSMWayID: 100, MaxSpeed: 13.89, Reverse: true})
+	g.AddEdge(graph.Edge{From: 3, To: 4, Weight: 800, OSMWayID: 200, MaxSpeed: 13.89})
+	return g
+}
+
+func TestApplyByWayDirectionAndNodePair(t *testing.T) {
+	store := NewStore(createTestGraph(), 10*time.Minute)
+
+	result, err := store.Apply([]Observation{
+		{WayID: 100, Direction: DirectionBackward, SpeedKmh: 18},
+		{From: 3, To: 4, SpeedKmh: 9},
+		{WayID: 999, SpeedKmh: 30},
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply observations: %v", err)
+	}
+	if result.Applied != 2 || result.Unmatched != 1 || result.EdgesUpdated != 3 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	if speed, ok := store.Speed(&graph.Edge{From: 2, To: 1}); !ok || speed != 5 {
+		t.Errorf("Expected 5 m/s on backward edge 2->1, got %.2f (%v)", speed, ok)
+	}
+	if _, ok := store.Speed(&graph.Edge{From: 1, To: 2}); ok {
+		t.Error("Expected no override on forward edge 1->2")
+	}
+	if speed, ok := store.Speed(&graph.Edge{From: 3, To: 4}); !ok || speed != 2.5 {
+		t.Errorf("Expected 2.5 m/s on edge 3->4, got %.2f (%v)", speed, ok)
+	}
+}
+
+func TestOverridesReplaceAndExpire(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := NewStore(createTestGraph(), 10*time.Minute)
+	store.now = func() time.Time { return now }
+
+	edge := &graph.Edge{From: 3, To: 4}
+	for _, speed := range []float64{36, 36, 18} {
+		if _, err := store.Apply([]Observation{{From: 3, To: 4, SpeedKmh: speed, Timestamp: now}}); err != nil {
+			t.Fatalf("Failed to apply observation: %v", err)
+		}
+	}
+	if speed, _ := store.Speed(edge); speed != 5 {
+		t.Errorf("Expected the latest observation (5 m/s) without compounding, got %.2f", speed)
+	}
+
+	// Older observations do not replace newer ones
+	result, _ := store.Apply([]Observation{{From: 3, To: 4, SpeedKmh: 90, Timestamp: now.Add(-time.Minute)}})
+	if result.Stale != 1 {
+		t.Errorf("Expected older observation to be stale, got %+v", result)
+	}
+
+	status := store.Status()
+	if status.ActiveOverrides != 1 || status.AgeSeconds == nil || *status.AgeSeconds != 0 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if _, ok := store.Speed(edge); ok {
+		t.Error("Expected override to expire after the TTL")
+	}
+
+	store.now = func() time.Time { return now.Add(-5 * time.Minute) }
+	if store.Reset() != 1 {
+		t.Error("Expected reset to remove the override")
+	}
+	if _, ok := store.Speed(edge); ok {
+		t.Error("Expected no override after reset")
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	input := "way_id,direction,speed_kmh,timestamp\n100,forward,25,1717243200\n,,,\n"
+	if _, err := ParseCSV(strings.NewReader(input)); err == nil {
+		t.Error("Expected error for a row without speed")
+	}
+
+	input = "from,to,speed_kmh,ttl\n3,4,12.5,60\n"
+	observations, err := ParseCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(observations) != 1 || observations[0].From != 3 || observations[0].SpeedKmh != 12.5 || observations[0].TTL != 60 {
+		t.Errorf("Unexpected observations: %+v", observations)
+	}
+}
+
+func TestSpeedsSnapshots(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := NewStore(createTestGraph(), 10*time.Minute)
+	store.now = func() time.Time { return now }
+
+	if _, err := store.Apply([]Observation{{From: 3, To: 4, SpeedKmh: 18, Timestamp: now}}); err != nil {
+		t.Fatalf("Failed to apply observation: %v", err)
+	}
+	speeds := store.Speeds()
+	if store.Speeds() != speeds {
+		t.Error("Expected the set to be shared until an override changes or expires")
+	}
+	edge := &graph.Edge{From: 3, To: 4}
+	if speed, ok := speeds.Speed(edge); !ok || speed != 5 {
+		t.Errorf("Expected 5 m/s, got %.2f (%v)", speed, ok)
+	}
+
+	// A set taken earlier is not affected by updates
+	if _, err := store.Apply([]Observation{{From: 3, To: 4, SpeedKmh: 36, Timestamp: now}}); err != nil {
+		t.Fatalf("Failed to apply observation: %v", err)
+	}
+	if speed, _ := speeds.Speed(edge); speed != 5 {
+		t.Errorf("Expected a taken set not to change, got %.2f", speed)
+	}
+	if speed, _ := store.Speeds().Speed(edge); speed != 10 {
+		t.Errorf("Expected the update in a new set, got %.2f", speed)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if _, ok := store.Speeds().Speed(edge); ok {
+		t.Error("Expected no override in the set once it expired")
+	}
+}
+
+func TestStoreNotifiesChanges(t *testing.T) {
+	store := NewStore(createTestGraph(), 50*time.Millisecond)
+	changes := make(chan struct{}, 10)
+	store.OnChange(func() { changes <- struct{}{} })
+
+	wait := func(what string) {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected a change notification when %s", what)
+		}
+	}
+
+	if _, err := store.Apply([]Observation{{WayID: 999, SpeedKmh: 30}}); err != nil {
+		t.Fatalf("Failed to apply observation: %v", err)
+	}
+	if _, err := store.Apply([]Observation{{From: 3, To: 4, SpeedKmh: 18}}); err != nil {
+		t.Fatalf("Failed to apply observation: %v", err)
+	}
+	wait("an override is applied")
+
+	wait("the override expires")
+	if status := store.Status(); status.ActiveOverrides != 0 {
+		t.Errorf("Expected the override to be purged, got %+v", status)
+	}
+
+	select {
+	case <-changes:
+		t.Error("Expected no notification for unmatched observations or after expiry")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,62 @@
+package traffic
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LoadFile reads observations from a .csv or .json file
+func LoadFile(path string) ([]Observation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open traffic file: %w", err)
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return ParseCSV(file)
+	}
+	return ParseJSON(file)
+}
+
+// Watch polls a local file and applies its observations whenever it changes.
+// It returns a function that stops watching.
+func Watch(path string, interval time.Duration, store *Store) func() {
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var lastMod time.Time
+		var lastSize int64 = -1
+
+		for {
+			if info, err := os.Stat(path); err == nil && (!info.ModTime().Equal(lastMod) || info.Size() != lastSize) {
+				lastMod, lastSize = info.ModTime(), info.Size()
+
+				observations, err := LoadFile(path)
+				if err != nil {
+					log.Printf("Warning: Failed to read traffic file: %v", err)
+				} else if result, err := store.Apply(observations); err != nil {
+					log.Printf("Warning: Invalid traffic file %s: %v", path, err)
+				} else {
+					log.Printf("Traffic file %s: %d/%d observations applied (%d edges)",
+						path, result.Applied, result.Received, result.EdgesUpdated)
+				}
+			}
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
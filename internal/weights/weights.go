@@ -0,0 +1,225 @@
+// Package weights selects graph edges by way, node pair, tag expression or area
+// and applies runtime weight updates to them.
+package weights
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/vamosdalian/nav/internal/geo"
+	"github.com/vamosdalian/nav/internal/graph"
+	"github.com/vamosdalian/nav/internal/tagexpr"
+)
+
+// Selector chooses the edges an update applies to. All given criteria must match.
+type Selector struct {
+	OSMWayID int64           `json:"osm_way_id,omitempty"`
+	From     int64           `json:"from,omitempty"`    // Directed node pair (with To)
+	To       int64           `json:"to,omitempty"`      // Directed node pair (with From)
+	Tags     string          `json:"tags,omitempty"`    // Tag expression, e.g. "highway=residential AND surface=gravel"
+	BBox     []float64       `json:"bbox,omitempty"`    // [minLon, minLat, maxLon, maxLat]
+	Polygon  json.RawMessage `json:"polygon,omitempty"` // GeoJSON Polygon, MultiPolygon or Feature
+}
+
+// Update applies an operation to the edges of a selector
+type Update struct {
+	Selector Selector `json:"selector"`
+	Op       string   `json:"op"`              // set, multiply or reset
+	Value    float64  `json:"value,omitempty"` // New weight (set) or factor (multiply)
+}
+
+// Result summarises an applied batch of updates
+type Result struct {
+	Matched      []int               // Edges selected by each update
+	EdgesUpdated int                 // Distinct edges whose weight changed
+	Changes      []graph.WeightDelta // Every weight change, in order
+}
+
+// matcher is a compiled selector
+type matcher struct {
+	selector Selector
+	expr     *tagexpr.Expr
+	box      *geo.Polygon
+	polygons []geo.Polygon
+	bounds   geo.BBox // Bounds of the polygons
+}
+
+// compile validates a selector and parses its expression and area
+func compile(s Selector) (*matcher, error) {
+	m := &matcher{selector: s}
+	hasPair := s.From != 0 || s.To != 0
+	if hasPair && (s.From == 0 || s.To == 0) {
+		return nil, fmt.Errorf("node pair selector needs both from and to")
+	}
+	if s.OSMWayID == 0 && !hasPair && s.Tags == "" && s.BBox == nil && len(s.Polygon) == 0 {
+		return nil, fmt.Errorf("selector needs osm_way_id, from/to, tags, bbox or polygon")
+	}
+
+	if s.Tags != "" {
+		expr, err := tagexpr.Parse(s.Tags)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tags expression: %w", err)
+		}
+		m.expr = expr
+	}
+
+	if s.BBox != nil {
+		if len(s.BBox) != 4 {
+			return nil, fmt.Errorf("bbox needs [minLon, minLat, maxLon, maxLat]")
+		}
+		b := geo.BBox{MinLon: s.BBox[0], MinLat: s.BBox[1], MaxLon: s.BBox[2], MaxLat: s.BBox[3]}
+		if !b.Valid() {
+			return nil, fmt.Errorf("invalid bbox")
+		}
+		box := geo.PolygonFromBBox(b)
+		m.box = &box
+	}
+	if len(s.Polygon) > 0 {
+		polygons, err := geo.ParsePolygons(s.Polygon)
+		if err != nil {
+			return nil, fmt.Errorf("invalid polygon: %w", err)
+		}
+		m.polygons = polygons
+		m.bounds = geo.EmptyBBox()
+		for i := range polygons {
+			m.bounds = m.bounds.Union(polygons[i].Bounds())
+		}
+	}
+	return m, nil
+}
+
+// match tests an edge against every criterion of the selector. Area criteria
+// match edges crossing the area; with both a bbox and a polygon, both must be crossed.
+func (m *matcher) match(edge *graph.Edge, from, to *graph.Node) bool {
+	s := &m.selector
+	if s.OSMWayID != 0 && edge.OSMWayID != s.OSMWayID {
+		return false
+	}
+	if s.From != 0 && (edge.From != s.From || edge.To != s.To) {
+		return false
+	}
+	if m.expr != nil && !m.expr.Match(edge.Tags) {
+		return false
+	}
+	if m.box != nil && !m.box.IntersectsSegment(from.Lon, from.Lat, to.Lon, to.Lat) {
+		return false
+	}
+	if m.polygons == nil {
+		return true
+	}
+	if !m.bounds.Intersects(geo.SegmentBBox(from.Lon, from.Lat, to.Lon, to.Lat)) {
+		return false
+	}
+	for i := range m.polygons {
+		if m.polygons[i].IntersectsSegment(from.Lon, from.Lat, to.Lon, to.Lat) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the edges matching a selector. Way and node pair selectors
+// use the graph indexes; other selectors scan all edges.
+func Select(g *graph.Graph, s Selector) ([]graph.EdgeRef, error) {
+	m, err := compile(s)
+	if err != nil {
+		return nil, err
+	}
+	return m.resolve(g), nil
+}
+
+func (m *matcher) resolve(g *graph.Graph) []graph.EdgeRef {
+	var candidates []graph.EdgeRef
+	switch {
+	case m.selector.OSMWayID != 0:
+		candidates = g.EdgesByWay(m.selector.OSMWayID)
+	case m.selector.From != 0:
+		candidates = g.EdgeRefsBetween(m.selector.From, m.selector.To)
+	default:
+		var refs []graph.EdgeRef
+		g.ForEachEdge(func(ref graph.EdgeRef, edge *graph.Edge, from, to *graph.Node) bool {
+			if m.match(edge, from, to) {
+				refs = append(refs, ref)
+			}
+			return true
+		})
+		return refs
+	}
+
+	refs := candidates[:0]
+	for _, ref := range candidates {
+		edge, ok := g.EdgeAt(ref)
+		if !ok {
+			continue
+		}
+		from, errFrom := g.GetNode(edge.From)
+		to, errTo := g.GetNode(edge.To)
+		if errFrom != nil || errTo != nil {
+			continue
+		}
+		if m.match(&edge, from, to) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// Validate checks the operation, value and selector of an update
+func (u *Update) Validate() error {
+	if err := u.validateOp(); err != nil {
+		return err
+	}
+	_, err := compile(u.Selector)
+	return err
+}
+
+func (u *Update) validateOp() error {
+	switch u.Op {
+	case graph.WeightSet, graph.WeightMultiply:
+		if u.Value <= 0 {
+			return fmt.Errorf("%s needs a positive value", u.Op)
+		}
+	case graph.WeightReset:
+	case "":
+		return fmt.Errorf("op is required (set, multiply or reset)")
+	default:
+		return fmt.Errorf("unknown op %q (expected set, multiply or reset)", u.Op)
+	}
+	return nil
+}
+
+// Apply resolves all updates and applies them to the graph as one atomic batch.
+// If any update is invalid, no weight changes.
+func Apply(g *graph.Graph, updates []Update) (*Result, error) {
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("no updates given")
+	}
+
+	changes := make([]graph.WeightChange, len(updates))
+	result := &Result{Matched: make([]int, len(updates))}
+	for i := range updates {
+		if err := updates[i].validateOp(); err != nil {
+			return nil, fmt.Errorf("update %d: %w", i, err)
+		}
+		m, err := compile(updates[i].Selector)
+		if err != nil {
+			return nil, fmt.Errorf("update %d: %w", i, err)
+		}
+		refs := m.resolve(g)
+		changes[i] = graph.WeightChange{Edges: refs, Op: updates[i].Op, Value: updates[i].Value}
+		result.Matched[i] = len(refs)
+	}
+
+	deltas, err := g.ApplyWeightChanges(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[graph.EdgeRef]bool, len(deltas))
+	for _, d := range deltas {
+		changed[d.Ref] = true
+	}
+	result.EdgesUpdated = len(changed)
+	result.Changes = deltas
+	return result, nil
+}
@@ -0,0 +1,159 @@
+package weights
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/vamosdalian/nav/internal/graph"
+)
+
+// testGraph builds a small grid: a residential gravel street 1-2-3 (way 10),
+// a primary road 3-4 (way 20) and a residential asphalt street 4-1 (way 30)
+func testGraph() *graph.Graph {
+	g := graph.NewGraph()
+	g.AddNode(&graph.Node{ID: 1, Lat: 0, Lon: 0})
+	g.AddNode(&graph.Node{ID: 2, Lat: 0, Lon: 0.01})
+	g.AddNode(&graph.Node{ID: 3, Lat: 0, Lon: 0.02})
+	g.AddNode(&graph.Node{ID: 4, Lat: 0.01, Lon: 0.02})
+
+	gravel := map[string]string{"highway": "residential", "surface": "gravel"}
+	primary := map[string]string{"highway": "primary"}
+	asphalt := map[string]string{"highway": "residential", "surface": "asphalt"}
+	addWay := func(way int64, tags map[string]string, nodes ...int64) {
+		for i := 0; i+1 < len(nodes); i++ {
+			g.AddEdge(graph.Edge{From: nodes[i], To: nodes[i+1], Weight: 100, OSMWayID: way, Tags: tags})
+			g.AddEdge(graph.Edge{From: nodes[i+1], To: nodes[i], Weight: 100, OSMWayID: way, Tags: tags, Reverse: true})
+		}
+	}
+	addWay(10, gravel, 1, 2, 3)
+	addWay(20, primary, 3, 4)
+	addWay(30, asphalt, 4, 1)
+	return g
+}
+
+func weight(t *testing.T, g *graph.Graph, from, to int64) float64 {
+	t.Helper()
+	edge, ok := g.EdgeBetween(from, to)
+	if !ok {
+		t.Fatalf("edge %d->%d not found", from, to)
+	}
+	return edge.Weight
+}
+
+func TestSelect(t *testing.T) {
+	g := testGraph()
+	tests := []struct {
+		name     string
+		selector Selector
+		expected int
+	}{
+		{"way", Selector{OSMWayID: 10}, 4},
+		{"node pair", Selector{From: 1, To: 2}, 1},
+		{"tags", Selector{Tags: "highway=residential AND surface=gravel"}, 4},
+		{"tags or", Selector{Tags: "highway=primary OR surface=asphalt"}, 4},
+		{"bbox", Selector{BBox: []float64{0.015, -0.005, 0.025, 0.005}}, 4},
+		{"bbox and tags", Selector{BBox: []float64{0.015, -0.005, 0.025, 0.005}, Tags: "highway=primary"}, 2},
+		{"polygon", Selector{Polygon: json.RawMessage(`{"type":"Polygon","coordinates":[[[0.005,-0.005],[0.015,-0.005],[0.015,0.002],[0.005,0.002],[0.005,-0.005]]]}`)}, 4},
+		{"no match", Selector{OSMWayID: 99}, 0},
+	}
+	for _, tt := range tests {
+		refs, err := Select(g, tt.selector)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(refs) != tt.expected {
+			t.Errorf("%s: expected %d edges, got %d", tt.name, tt.expected, len(refs))
+		}
+	}
+
+	invalid := []Selector{
+		{},
+		{From: 1},
+		{Tags: "highway=("},
+		{BBox: []float64{1, 2, 3}},
+		{Polygon: json.RawMessage(`{"type":"Point"}`)},
+	}
+	for _, s := range invalid {
+		if _, err := Select(g, s); err == nil {
+			t.Errorf("Expected error for selector %+v", s)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	g := testGraph()
+
+	result, err := Apply(g, []Update{
+		{Selector: Selector{Tags: "surface=gravel"}, Op: graph.WeightMultiply, Value: 2},
+		{Selector: Selector{From: 3, To: 4}, Op: graph.WeightSet, Value: 50},
+	})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if result.EdgesUpdated != 5 || len(result.Matched) != 2 || result.Matched[0] != 4 || result.Matched[1] != 1 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if w := weight(t, g, 1, 2); w != 200 {
+		t.Errorf("Expected 1->2 weight 200, got %v", w)
+	}
+	if w := weight(t, g, 3, 4); w != 50 {
+		t.Errorf("Expected 3->4 weight 50, got %v", w)
+	}
+	if w := weight(t, g, 4, 3); w != 100 {
+		t.Errorf("Expected 4->3 to keep weight 100, got %v", w)
+	}
+
+	// The reverse adjacency list used by bidirectional search stays in sync
+	for _, edge := range g.GetReverseEdges(2) {
+		if edge.From == 1 && edge.Weight != 200 {
+			t.Errorf("Expected reverse copy of 1->2 to have weight 200, got %v", edge.Weight)
+		}
+	}
+
+	if _, err := Apply(g, []Update{{Selector: Selector{OSMWayID: 10}, Op: graph.WeightReset}}); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if w := weight(t, g, 1, 2); w != 100 {
+		t.Errorf("Expected 1->2 weight 100 after reset, got %v", w)
+	}
+	if n := g.ModifiedEdgeCount(); n != 1 {
+		t.Errorf("Expected 1 modified edge after reset, got %d", n)
+	}
+}
+
+func TestApplyIsAtomic(t *testing.T) {
+	g := testGraph()
+	_, err := Apply(g, []Update{
+		{Selector: Selector{OSMWayID: 10}, Op: graph.WeightSet, Value: 10},
+		{Selector: Selector{OSMWayID: 20}, Op: graph.WeightMultiply, Value: -1},
+	})
+	if err == nil {
+		t.Fatal("Expected error for negative multiplier")
+	}
+	if w := weight(t, g, 1, 2); w != 100 {
+		t.Errorf("Expected no change after a failed batch, got weight %v", w)
+	}
+
+	for _, u := range []Update{
+		{Selector: Selector{OSMWayID: 10}},
+		{Selector: Selector{OSMWayID: 10}, Op: "divide", Value: 2},
+		{Selector: Selector{OSMWayID: 10}, Op: graph.WeightSet},
+	} {
+		if err := u.Validate(); err == nil {
+			t.Errorf("Expected validation error for %+v", u)
+		}
+	}
+}
+
+func TestWayIndexAfterImport(t *testing.T) {
+	g := graph.NewGraph()
+	g.Import(testGraph().Export())
+	refs, err := Select(g, Selector{OSMWayID: 20})
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if len(refs) != 2 {
+		t.Errorf("Expected 2 edges of way 20 after import, got %d", len(refs))
+	}
+}
@@ -0,0 +1,90 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Node is a generic XML element. Lookups use local names, so documents can
+// be navigated without caring about namespace prefixes or schema versions.
+type Node struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Content  string     `xml:",chardata"`
+	Children []*Node    `xml:",any"`
+}
+
+// Parse reads an XML document into a tree
+func Parse(r io.Reader) (*Node, error) {
+	var root Node
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, fmt.Errorf("invalid XML: %w", err)
+	}
+	return &root, nil
+}
+
+// Name returns the local name of the element
+func (n *Node) Name() string {
+	return n.XMLName.Local
+}
+
+// Text returns the trimmed character data of the element
+func (n *Node) Text() string {
+	return strings.TrimSpace(n.Content)
+}
+
+// Attr returns the value of an attribute by local name
+func (n *Node) Attr(name string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Child returns the first direct child with a local name
+func (n *Node) Child(name string) *Node {
+	for _, child := range n.Children {
+		if child.Name() == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// Find returns the first descendant (depth first, including n) with a local name
+func (n *Node) Find(name string) *Node {
+	if n.Name() == name {
+		return n
+	}
+	for _, child := range n.Children {
+		if found := child.Find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// FindAll returns all descendants (including n) with a local name, without
+// descending into matches
+func (n *Node) FindAll(name string) []*Node {
+	if n.Name() == name {
+		return []*Node{n}
+	}
+	var found []*Node
+	for _, child := range n.Children {
+		found = append(found, child.FindAll(name)...)
+	}
+	return found
+}
+
+// FindText returns the text of the first descendant with a local name ("" if missing)
+func (n *Node) FindText(name string) string {
+	if found := n.Find(name); found != nil {
+		return found.Text()
+	}
+	return ""
+}